@@ -0,0 +1,232 @@
+// Authorization server for DFC
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+	"github.com/NVIDIA/dfcpub/dfc"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Service accounts and their API keys
+//
+// A service account is a non-interactive client (e.g., a batch job) that
+// authenticates with long-lived API keys instead of a password and expiring
+// tokens. An API key is a token signed by AuthN that carries the key's scope -
+// a role and per-bucket grants (the same as the user's ones) - and, optionally,
+// the time the key expires. DFC validates and caches API keys the same way as
+// tokens; a revoked API key is sent to the primary proxy along with revoked tokens.
+
+const (
+	accountListFile = "accounts.json"
+	apiKeyIDLen     = 8 // random bytes in API key ID
+)
+
+type (
+	apiKeyInfo struct {
+		ID      string            `json:"id"`
+		Role    string            `json:"role"`
+		Buckets map[string]string `json:"buckets,omitempty"`
+		Created time.Time         `json:"created"`
+		Expires time.Time         `json:"expires"` // zero: never expires
+		Key     string            `json:"key,omitempty"`
+	}
+	serviceAccount struct {
+		Name    string                 `json:"name"`
+		Created time.Time              `json:"created"`
+		Keys    map[string]*apiKeyInfo `json:"keys"` // key ID => key
+	}
+)
+
+// Zero expiration time means "never expires"
+func isExpired(expires time.Time) bool {
+	return !expires.IsZero() && expires.Before(time.Now())
+}
+
+func (m *userManager) loadAccounts() {
+	if err := dfc.LocalLoad(m.accountPath, &m.accounts); err != nil {
+		if !os.IsNotExist(err) {
+			glog.Fatalf("Failed to load service account list: %v\n", err)
+		}
+		return
+	}
+	for _, acc := range m.accounts {
+		if acc.Keys == nil {
+			acc.Keys = make(map[string]*apiKeyInfo, 0)
+		}
+	}
+}
+
+// The caller must hold the lock
+func (m *userManager) saveAccounts() (err error) {
+	if err = dfc.LocalSavePerm(m.accountPath, &m.accounts, 0600); err != nil {
+		err = fmt.Errorf("UserManager: Failed to save service account list: %v", err)
+	}
+	return err
+}
+
+// Registers a new service account
+func (m *userManager) addAccount(name string) error {
+	if name == "" {
+		return fmt.Errorf("Invalid service account name")
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if _, ok := m.accounts[name]; ok {
+		return fmt.Errorf("Service account '%s' already registered", name)
+	}
+	m.accounts[name] = &serviceAccount{
+		Name:    name,
+		Created: time.Now(),
+		Keys:    make(map[string]*apiKeyInfo, 0),
+	}
+
+	return m.saveAccounts()
+}
+
+// Deletes a service account and revokes all its API keys
+func (m *userManager) delAccount(name string) error {
+	m.mtx.Lock()
+	acc, ok := m.accounts[name]
+	if !ok {
+		m.mtx.Unlock()
+		return fmt.Errorf("Service account %s does not exist", name)
+	}
+	delete(m.accounts, name)
+	revoked := make([]string, 0, len(acc.Keys))
+	for _, key := range acc.Keys {
+		if !isExpired(key.Expires) {
+			m.revoked[key.Key] = key.Expires
+			revoked = append(revoked, key.Key)
+		}
+	}
+	m.saveTokens()
+	err := m.saveAccounts()
+	m.mtx.Unlock()
+
+	if len(revoked) != 0 {
+		go m.sendRevokedTokensToProxy(revoked...)
+	}
+
+	return err
+}
+
+// Generates a new API key for the service account. Empty role means the
+// default one (writer), zero lifetime - the key never expires
+func (m *userManager) addAPIKey(name, role string, buckets map[string]string, lifetime time.Duration) (*apiKeyInfo, error) {
+	if role == "" {
+		role = dfc.AuthRoleWriter
+	}
+	if !isValidRole(role) {
+		return nil, fmt.Errorf("Invalid role: %s", role)
+	}
+	for bucket, grant := range buckets {
+		if bucket == "" || !isValidRole(grant) {
+			return nil, fmt.Errorf("Invalid grant: bucket %q, role %q", bucket, grant)
+		}
+	}
+	if lifetime < 0 {
+		return nil, fmt.Errorf("Invalid API key lifetime: %v", lifetime)
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	acc, ok := m.accounts[name]
+	if !ok {
+		return nil, fmt.Errorf("Service account %s does not exist", name)
+	}
+
+	random := make([]byte, apiKeyIDLen)
+	if _, err := rand.Read(random); err != nil {
+		return nil, fmt.Errorf("failed to generate API key: %v", err)
+	}
+	key := &apiKeyInfo{
+		ID:      hex.EncodeToString(random),
+		Role:    role,
+		Buckets: buckets,
+		Created: time.Now(),
+	}
+	if key.Buckets == nil {
+		key.Buckets = make(map[string]string, 0)
+	}
+	claims := jwt.MapClaims{
+		"apikey":   key.ID,
+		"issued":   key.Created.Format(time.RFC822),
+		"username": name,
+		"role":     key.Role,
+		"buckets":  key.Buckets,
+	}
+	if lifetime != 0 {
+		key.Expires = key.Created.Add(lifetime)
+		claims["expires"] = key.Expires.Format(time.RFC822)
+	}
+	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	keyString, err := t.SignedString([]byte(conf.Auth.Secret))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate API key: %v", err)
+	}
+	key.Key = keyString
+	acc.Keys[key.ID] = key
+
+	if err = m.saveAccounts(); err != nil {
+		delete(acc.Keys, key.ID)
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// Revokes the API key: the key is removed from the account and sent to the
+// primary proxy as a revoked token
+func (m *userManager) revokeAPIKey(name, keyID string) error {
+	m.mtx.Lock()
+	acc, ok := m.accounts[name]
+	if !ok {
+		m.mtx.Unlock()
+		return fmt.Errorf("Service account %s does not exist", name)
+	}
+	key, ok := acc.Keys[keyID]
+	if !ok {
+		m.mtx.Unlock()
+		return fmt.Errorf("API key %s of %s does not exist", keyID, name)
+	}
+	delete(acc.Keys, keyID)
+	m.revoked[key.Key] = key.Expires
+	m.saveTokens()
+	err := m.saveAccounts()
+	m.mtx.Unlock()
+
+	go m.sendRevokedTokensToProxy(key.Key)
+
+	return err
+}
+
+// Returns the account's API keys without the keys themselves
+func (m *userManager) listAPIKeys(name string) ([]*apiKeyInfo, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	acc, ok := m.accounts[name]
+	if !ok {
+		return nil, fmt.Errorf("Service account %s does not exist", name)
+	}
+	keys := make([]*apiKeyInfo, 0, len(acc.Keys))
+	for _, key := range acc.Keys {
+		info := *key
+		info.Key = ""
+		keys = append(keys, &info)
+	}
+
+	return keys, nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/base64"
 	"os"
 	"strings"
 	"testing"
@@ -23,6 +24,9 @@ func init() {
 	if conf.Auth.ExpirePeriod == 0 {
 		conf.Auth.ExpirePeriod = time.Minute * 30
 	}
+	if conf.Auth.RefreshPeriod == 0 {
+		conf.Auth.RefreshPeriod = defaultRefreshPeriod
+	}
 }
 
 func createUsers(mgr *userManager, t *testing.T) {
@@ -35,7 +39,7 @@ func createUsers(mgr *userManager, t *testing.T) {
 	}
 
 	for idx := range users {
-		err = mgr.addUser(users[idx], passs[idx])
+		err = mgr.addUser(users[idx], passs[idx], "")
 		if err != nil {
 			t.Errorf("Failed to create a user %s: %v", users[idx], err)
 		}
@@ -67,10 +71,11 @@ func deleteUsers(mgr *userManager, skipNotExist bool, t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
+	os.Remove(mgr.tokenPath)
 }
 
 func testInvalidUser(mgr *userManager, t *testing.T) {
-	err := mgr.addUser(users[0], passs[1])
+	err := mgr.addUser(users[0], passs[1], "")
 	if err == nil || !strings.Contains(err.Error(), "already registered") {
 		t.Errorf("User with the existing name %s was created: %v", users[0], err)
 	}
@@ -103,7 +108,7 @@ func testUserDelete(mgr *userManager, t *testing.T) {
 		username = "newuser"
 		userpass = "newpass"
 	)
-	err := mgr.addUser(username, userpass)
+	err := mgr.addUser(username, userpass, "")
 	if err != nil {
 		t.Errorf("Failed to create a user %s: %v", username, err)
 	}
@@ -111,7 +116,7 @@ func testUserDelete(mgr *userManager, t *testing.T) {
 		t.Errorf("Expected %d users but found %d", len(users)+1, len(mgr.Users))
 	}
 
-	token, err := mgr.issueToken(username, userpass)
+	token, _, err := mgr.issueToken(username, userpass)
 	if err != nil || token == "" {
 		t.Errorf("Failed to generate token for %s: %v", username, err)
 	}
@@ -123,12 +128,55 @@ func testUserDelete(mgr *userManager, t *testing.T) {
 	if len(mgr.Users) != len(users) {
 		t.Errorf("Expected %d users but found %d", len(users), len(mgr.Users))
 	}
-	token, err = mgr.issueToken(username, userpass)
+	token, _, err = mgr.issueToken(username, userpass)
 	if token != "" || err == nil || !strings.Contains(err.Error(), "credential") {
 		t.Errorf("Token issued for deleted user  %s: %v", username, token)
 	}
 }
 
+func testPermissions(mgr *userManager, t *testing.T) {
+	userID := users[0]
+	if err := mgr.addUser("baduser", "badpass", "superuser"); err == nil {
+		t.Error("User with invalid role was created")
+	}
+	if role := mgr.Users[userID].Role; role != dfc.AuthRoleWriter {
+		t.Errorf("Expected default role %s, got %s", dfc.AuthRoleWriter, role)
+	}
+	token, _, err := mgr.issueToken(userID, passs[0])
+	if err != nil {
+		t.Fatalf("Failed to generate token for %s: %v", userID, err)
+	}
+
+	changed, err := mgr.updatePermissions(userID, dfc.AuthRoleReader, map[string]string{"bck": dfc.AuthRoleAdmin})
+	if err != nil || !changed {
+		t.Errorf("Failed to update permissions (changed: %v): %v", changed, err)
+	}
+	userInfo := mgr.Users[userID]
+	if userInfo.Role != dfc.AuthRoleReader || userInfo.Buckets["bck"] != dfc.AuthRoleAdmin {
+		t.Errorf("Invalid permissions: role %s, grants %v", userInfo.Role, userInfo.Buckets)
+	}
+	if _, err = mgr.userByToken(token); err == nil {
+		t.Error("The token must be revoked after permissions change")
+	}
+
+	// the same permissions again - nothing changes
+	changed, err = mgr.updatePermissions(userID, "", map[string]string{"bck": dfc.AuthRoleAdmin})
+	if err != nil || changed {
+		t.Errorf("Unexpected permissions update (changed: %v): %v", changed, err)
+	}
+	if _, err = mgr.updatePermissions(userID, "", map[string]string{"bck": "owner"}); err == nil {
+		t.Error("Invalid grant was accepted")
+	}
+	// revoke the grant
+	changed, err = mgr.updatePermissions(userID, dfc.AuthRoleWriter, map[string]string{"bck": ""})
+	if err != nil || !changed {
+		t.Errorf("Failed to revoke the grant (changed: %v): %v", changed, err)
+	}
+	if len(userInfo.Buckets) != 0 || userInfo.Role != dfc.AuthRoleWriter {
+		t.Errorf("Invalid permissions: role %s, grants %v", userInfo.Role, userInfo.Buckets)
+	}
+}
+
 func addRemoveCreds(mgr *userManager, t *testing.T) {
 	const (
 		AWS01 = "aws-01"
@@ -275,6 +323,7 @@ func TestManager(t *testing.T) {
 	createUsers(mgr, t)
 	testInvalidUser(mgr, t)
 	addRemoveCreds(mgr, t)
+	testPermissions(mgr, t)
 	testUserDelete(mgr, t)
 	reloadFromFile(mgr, t)
 	deleteUsers(mgr, false, t)
@@ -294,7 +343,7 @@ func TestToken(t *testing.T) {
 	createUsers(mgr, t)
 
 	// correct user creds
-	token, err = mgr.issueToken(users[1], passs[1])
+	token, _, err = mgr.issueToken(users[1], passs[1])
 	if err != nil || token == "" {
 		t.Errorf("Failed to generate token for %s: %v", users[1], err)
 	}
@@ -311,7 +360,7 @@ func TestToken(t *testing.T) {
 	}
 
 	// incorrect user creds
-	tokenInval, err := mgr.issueToken(users[1], passs[0])
+	tokenInval, _, err := mgr.issueToken(users[1], passs[0])
 	if tokenInval != "" || err == nil {
 		t.Errorf("Some token generated for incorrect user creds: %v", tokenInval)
 	}
@@ -332,7 +381,7 @@ func TestToken(t *testing.T) {
 	}
 
 	// revoke token test
-	token, err = mgr.issueToken(users[1], passs[1])
+	token, _, err = mgr.issueToken(users[1], passs[1])
 	if err == nil {
 		_, err = mgr.userByToken(token)
 	}
@@ -352,3 +401,168 @@ func TestToken(t *testing.T) {
 
 	deleteUsers(mgr, false, t)
 }
+
+func TestRefreshToken(t *testing.T) {
+	proxy := &proxy{}
+	mgr := newUserManager(dbPath, proxy)
+	createUsers(mgr, t)
+	defer deleteUsers(mgr, false, t)
+
+	token, refresh, err := mgr.issueToken(users[0], passs[0])
+	if err != nil || token == "" || refresh == "" {
+		t.Fatalf("Failed to generate token for %s: %v", users[0], err)
+	}
+	if _, _, err = mgr.refreshToken("invalid"); err == nil {
+		t.Error("Token refreshed with invalid refresh token")
+	}
+	newToken, newRefresh, err := mgr.refreshToken(refresh)
+	if err != nil {
+		t.Fatalf("Failed to refresh token: %v", err)
+	}
+	if newRefresh == refresh {
+		t.Error("Refresh token was not replaced")
+	}
+	if info, err := mgr.userByToken(newToken); err != nil || info.UserID != users[0] {
+		t.Errorf("Invalid user returned for refreshed token: %v", err)
+	}
+	if _, _, err = mgr.refreshToken(refresh); err == nil {
+		t.Error("Refresh token was used twice")
+	}
+	if newToken == token {
+		t.Error("Token was not replaced")
+	}
+	if _, ok := mgr.revoked[token]; !ok {
+		t.Error("Refreshed token was not revoked")
+	}
+
+	// issued and revoked tokens survive restart
+	if finfo, err := os.Stat(mgr.tokenPath); err != nil || finfo.Mode().Perm() != 0600 {
+		t.Errorf("Expected the token list readable by the owner only: %v, %v", finfo, err)
+	}
+	newmgr := newUserManager(dbPath, proxy)
+	if info, ok := newmgr.tokens[users[0]]; !ok || info.Token != newToken || info.RefreshToken != newRefresh {
+		t.Errorf("Token of %s was not reloaded", users[0])
+	}
+	if _, ok := newmgr.revoked[token]; !ok {
+		t.Error("Revoked token was not reloaded")
+	}
+	if tokenReloaded, _, err := newmgr.refreshToken(newRefresh); err != nil || tokenReloaded == "" {
+		t.Errorf("Failed to refresh token after reload: %v", err)
+	}
+}
+
+func TestPasswordMigration(t *testing.T) {
+	// user list saved by an older authn: base64-encoded passwords
+	oldUsers := map[string]*userInfo{
+		users[0]: {UserID: users[0], Password: base64.StdEncoding.EncodeToString([]byte(passs[0]))},
+	}
+	if err := dfc.LocalSave(dbPath, &oldUsers); err != nil {
+		t.Fatal(err)
+	}
+
+	proxy := &proxy{}
+	mgr := newUserManager(dbPath, proxy)
+	defer func() {
+		os.Remove(dbPath)
+		os.Remove(mgr.tokenPath)
+	}()
+	info, ok := mgr.Users[users[0]]
+	if !ok {
+		t.Fatalf("User %s was not loaded", users[0])
+	}
+	if !isPasswordHash(info.Password) {
+		t.Errorf("Password of %s was not converted to hash", users[0])
+	}
+	if info.Role != dfc.AuthRoleWriter {
+		t.Errorf("Expected default role %s, got %s", dfc.AuthRoleWriter, info.Role)
+	}
+	// the converted list must be saved
+	saved := make(map[string]*userInfo)
+	if err := dfc.LocalLoad(dbPath, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved[users[0]] == nil || saved[users[0]].Password != info.Password {
+		t.Error("Converted user list was not saved")
+	}
+	if _, _, err := mgr.issueToken(users[0], passs[0]); err != nil {
+		t.Errorf("Failed to log in after migration: %v", err)
+	}
+	if _, _, err := mgr.issueToken(users[0], passs[1]); err == nil {
+		t.Error("Logged in with invalid password after migration")
+	}
+}
+
+func TestServiceAccounts(t *testing.T) {
+	const account = "batchjob"
+	proxy := &proxy{}
+	mgr := newUserManager(dbPath, proxy)
+	defer func() {
+		os.Remove(mgr.accountPath)
+		os.Remove(mgr.tokenPath)
+	}()
+
+	if err := mgr.addAccount(account); err != nil {
+		t.Fatalf("Failed to create service account: %v", err)
+	}
+	if err := mgr.addAccount(account); err == nil {
+		t.Error("Service account with the existing name was created")
+	}
+	if _, err := mgr.addAPIKey("nonexisting", "", nil, 0); err == nil {
+		t.Error("API key was generated for non-existing service account")
+	}
+	if _, err := mgr.addAPIKey(account, "superuser", nil, 0); err == nil {
+		t.Error("API key with invalid role was generated")
+	}
+
+	key, err := mgr.addAPIKey(account, dfc.AuthRoleReader, map[string]string{"bck": dfc.AuthRoleWriter}, 0)
+	if err != nil {
+		t.Fatalf("Failed to generate API key: %v", err)
+	}
+	if key.Key == "" || !key.Expires.IsZero() {
+		t.Errorf("Invalid API key: %+v", key)
+	}
+	if expires, err := tokenExpires(key.Key); err != nil || !expires.IsZero() {
+		t.Errorf("API key must never expire: %v, %v", expires, err)
+	}
+	keyExp, err := mgr.addAPIKey(account, "", nil, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to generate API key: %v", err)
+	}
+	if keyExp.Role != dfc.AuthRoleWriter || keyExp.Expires.IsZero() {
+		t.Errorf("Invalid API key: %+v", keyExp)
+	}
+
+	if finfo, err := os.Stat(mgr.accountPath); err != nil || finfo.Mode().Perm() != 0600 {
+		t.Errorf("Expected the service accounts readable by the owner only: %v, %v", finfo, err)
+	}
+	// the keys survive restart, the list does not disclose them
+	newmgr := newUserManager(dbPath, proxy)
+	keys, err := newmgr.listAPIKeys(account)
+	if err != nil || len(keys) != 2 {
+		t.Fatalf("Expected 2 API keys, got %d: %v", len(keys), err)
+	}
+	for _, k := range keys {
+		if k.Key != "" {
+			t.Errorf("API key %s is disclosed", k.ID)
+		}
+	}
+
+	if err = mgr.revokeAPIKey(account, key.ID); err != nil {
+		t.Errorf("Failed to revoke API key: %v", err)
+	}
+	if _, ok := mgr.revoked[key.Key]; !ok {
+		t.Error("Revoked API key is not in the revoked list")
+	}
+	// the revoked key that never expires must stay in the list
+	mgr.saveTokens()
+	if _, ok := mgr.revoked[key.Key]; !ok {
+		t.Error("Revoked API key was removed from the revoked list")
+	}
+
+	if err = mgr.delAccount(account); err != nil {
+		t.Errorf("Failed to delete service account: %v", err)
+	}
+	if _, ok := mgr.revoked[keyExp.Key]; !ok {
+		t.Error("API key of deleted service account was not revoked")
+	}
+}
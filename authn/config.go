@@ -5,6 +5,8 @@ import (
 	"time"
 )
 
+const defaultRefreshPeriod = 24 * time.Hour
+
 type config struct {
 	ConfDir string        `json:"confdir"`
 	Proxy   proxyconfig   `json:"proxy"`
@@ -30,11 +32,13 @@ type httpconfig struct {
 	Key         string `json:"server_key"`
 }
 type authconfig struct {
-	Secret          string        `json:"secret"`
-	Username        string        `json:"username"`
-	Password        string        `json:"password"`
-	ExpirePeriodStr string        `json:"expiration_time"`
-	ExpirePeriod    time.Duration `json:"-"`
+	Secret           string        `json:"secret"`
+	Username         string        `json:"username"`
+	Password         string        `json:"password"`
+	ExpirePeriodStr  string        `json:"expiration_time"`
+	ExpirePeriod     time.Duration `json:"-"`
+	RefreshPeriodStr string        `json:"refresh_expiration_time"`
+	RefreshPeriod    time.Duration `json:"-"`
 }
 type timeoutconfig struct {
 	DefaultStr string        `json:"default_timeout"`
@@ -45,6 +49,15 @@ func (c *config) validate() (err error) {
 	if c.Auth.ExpirePeriod, err = time.ParseDuration(c.Auth.ExpirePeriodStr); err != nil {
 		return fmt.Errorf("Bad expire time format %s, err: %v", c.Auth.ExpirePeriodStr, err)
 	}
+	if c.Auth.RefreshPeriodStr == "" {
+		c.Auth.RefreshPeriod = defaultRefreshPeriod
+	} else if c.Auth.RefreshPeriod, err = time.ParseDuration(c.Auth.RefreshPeriodStr); err != nil {
+		return fmt.Errorf("Bad refresh expire time format %s, err: %v", c.Auth.RefreshPeriodStr, err)
+	}
+	if c.Auth.RefreshPeriod < c.Auth.ExpirePeriod {
+		return fmt.Errorf("Refresh token expire time %v must not be shorter than the token's one %v",
+			c.Auth.RefreshPeriod, c.Auth.ExpirePeriod)
+	}
 
 	return nil
 }
@@ -17,15 +17,18 @@ import (
 	"net/url"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/NVIDIA/dfcpub/3rdparty/glog"
 	"github.com/NVIDIA/dfcpub/dfc"
 )
 
 const (
-	pathUsers  = "users"
-	pathTokens = "tokens"
-	smapConfig = "smap.json"
+	pathUsers    = "users"
+	pathTokens   = "tokens"
+	pathAccounts = "accounts"
+	pathKeys     = "keys"
+	smapConfig   = "smap.json"
 )
 
 // a message to generate token
@@ -36,13 +39,47 @@ type loginMsg struct {
 	Password string `json:"password"`
 }
 
+// a message to change a user's role and/or per-bucket grants
+// PUT: <version>/<pathUsers>/<username>
+//		Body: <permMsg>
+type permMsg struct {
+	Role    string            `json:"role"`
+	Buckets map[string]string `json:"buckets"`
+}
+
+// a message to create a service account
+// POST: <version>/<pathAccounts>
+//		Body: <accountMsg>
+type accountMsg struct {
+	Name string `json:"name"`
+}
+
+// a message to generate an API key for a service account
+// POST: <version>/<pathAccounts>/<account>/<pathKeys>
+//		Body: <apiKeyMsg>
+//	Returns: <apiKeyInfo>
+type apiKeyMsg struct {
+	Role     string            `json:"role"`
+	Buckets  map[string]string `json:"buckets"`
+	Lifetime string            `json:"expiration_time"` // empty: never expires
+}
+
 // a message to test token validity and to revoke existing token
 // check: GET <version>/<pathTokens>
 //		Body: <tokenMsg>
 // revoke: DEL <version>/<pathTokens>
 //		Body: <tokenMsg>
 type tokenMsg struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// a message to exchange a refresh token for a new token
+// POST: <version>/<pathTokens>
+//		Body: <refreshMsg>
+//	Returns: <tokenMsg>
+type refreshMsg struct {
+	RefreshToken string `json:"refresh_token"`
 }
 
 //-------------------------------------
@@ -80,6 +117,10 @@ func isValidProvider(prov string) bool {
 	return prov == dfc.ProviderAmazon || prov == dfc.ProviderGoogle || prov == dfc.ProviderDfc
 }
 
+func isValidRole(role string) bool {
+	return role == dfc.AuthRoleAdmin || role == dfc.AuthRoleWriter || role == dfc.AuthRoleReader
+}
+
 //-------------------------------------
 // auth server
 //-------------------------------------
@@ -138,6 +179,7 @@ func (a *authServ) registerHandler(path string, handler func(http.ResponseWriter
 func (a *authServ) registerPublicHandlers() {
 	a.registerHandler(dfc.URLPath(dfc.Rversion, pathUsers), a.userHandler)
 	a.registerHandler(dfc.URLPath(dfc.Rversion, pathTokens), a.tokenHandler)
+	a.registerHandler(dfc.URLPath(dfc.Rversion, pathAccounts), a.accountHandler)
 }
 
 func (a *authServ) userHandler(w http.ResponseWriter, r *http.Request) {
@@ -157,6 +199,21 @@ func (a *authServ) tokenHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodDelete:
 		a.httpRevokeToken(w, r)
+	case http.MethodPost:
+		a.httpRefreshToken(w, r)
+	default:
+		invalhdlr(w, r, "Unsupported method", http.StatusBadRequest)
+	}
+}
+
+func (a *authServ) accountHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		a.httpAccountGet(w, r)
+	case http.MethodPost:
+		a.httpAccountPost(w, r)
+	case http.MethodDelete:
+		a.httpAccountDel(w, r)
 	default:
 		invalhdlr(w, r, "Unsupported method", http.StatusBadRequest)
 	}
@@ -194,6 +251,39 @@ func (a *authServ) httpRevokeToken(w http.ResponseWriter, r *http.Request) {
 	a.users.revokeToken(msg.Token)
 }
 
+// Issues a new token in exchange for a valid refresh token
+func (a *authServ) httpRefreshToken(w http.ResponseWriter, r *http.Request) {
+	apiItems := a.restAPIItems(r.URL.Path, pathTokens)
+	if len(apiItems) != 0 {
+		invalhdlr(w, r, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	msg := &refreshMsg{}
+	if err := a.readJSON(w, r, msg); err != nil {
+		glog.Errorf("Failed to read request: %v\n", err)
+		return
+	}
+	if msg.RefreshToken == "" {
+		invalhdlr(w, r, "Not authorized", http.StatusUnauthorized)
+		return
+	}
+
+	tokenString, refreshToken, err := a.users.refreshToken(msg.RefreshToken)
+	if err != nil {
+		glog.Errorf("Failed to refresh token: %v\n", err)
+		invalhdlr(w, r, "Not authorized", http.StatusUnauthorized)
+		return
+	}
+
+	repl, err := json.Marshal(&tokenMsg{Token: tokenString, RefreshToken: refreshToken})
+	if err != nil {
+		invalhdlr(w, r, fmt.Sprintf("Failed to marshal token: %v", err))
+		return
+	}
+	a.writeJSON(w, r, repl, "refresh")
+}
+
 func (a *authServ) httpUserDel(w http.ResponseWriter, r *http.Request) {
 	apiItems := a.restAPIItems(r.URL.Path, pathUsers)
 	if len(apiItems) == 0 {
@@ -231,7 +321,7 @@ func (a *authServ) httpUserPost(w http.ResponseWriter, r *http.Request) {
 //   then new user list is saved and sent to the proxy to update the cluster
 func (a *authServ) httpUserPut(w http.ResponseWriter, r *http.Request) {
 	apiItems := a.restAPIItems(r.URL.Path, pathUsers)
-	if len(apiItems) < 2 {
+	if len(apiItems) == 0 {
 		invalhdlr(w, r, "Invalid request")
 		return
 	}
@@ -240,6 +330,10 @@ func (a *authServ) httpUserPut(w http.ResponseWriter, r *http.Request) {
 		glog.Errorf("Not authorized: %v\n", err)
 		return
 	}
+	if len(apiItems) == 1 {
+		a.userUpdatePermissions(w, r, apiItems[0])
+		return
+	}
 
 	userID := apiItems[0]
 	provider := apiItems[1]
@@ -262,6 +356,24 @@ func (a *authServ) httpUserPut(w http.ResponseWriter, r *http.Request) {
 	a.writeJSON(w, r, []byte("Credentials updated successfully"), "update credentials")
 }
 
+// Changes user's role and/or per-bucket grants
+// If anything changes the user's token is revoked: the new one includes the
+//   new permissions
+func (a *authServ) userUpdatePermissions(w http.ResponseWriter, r *http.Request, userID string) {
+	msg := &permMsg{}
+	if err := a.readJSON(w, r, msg); err != nil {
+		glog.Errorf("Failed to read permissions: %v\n", err)
+		return
+	}
+
+	if _, err := a.users.updatePermissions(userID, msg.Role, msg.Buckets); err != nil {
+		invalhdlr(w, r, fmt.Sprintf("Failed to update permissions: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	a.writeJSON(w, r, []byte("Permissions updated successfully"), "update permissions")
+}
+
 // Adds a new user to user list
 func (a *authServ) userAdd(w http.ResponseWriter, r *http.Request) {
 	err := a.checkAuthorization(w, r)
@@ -276,7 +388,7 @@ func (a *authServ) userAdd(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err = a.users.addUser(info.UserID, info.Password); err != nil {
+	if err = a.users.addUser(info.UserID, info.Password, info.Role); err != nil {
 		invalhdlr(w, r, fmt.Sprintf("Failed to add user: %v", err))
 		return
 	}
@@ -288,6 +400,110 @@ func (a *authServ) userAdd(w http.ResponseWriter, r *http.Request) {
 	a.writeJSON(w, r, msg, "create user")
 }
 
+// Creates a service account or generates a new API key for it:
+//	POST /v1/accounts
+//	POST /v1/accounts/account-name/keys
+func (a *authServ) httpAccountPost(w http.ResponseWriter, r *http.Request) {
+	apiItems := a.restAPIItems(r.URL.Path, pathAccounts)
+	if err := a.checkAuthorization(w, r); err != nil {
+		glog.Errorf("Not authorized: %v\n", err)
+		return
+	}
+
+	switch {
+	case len(apiItems) == 0:
+		msg := &accountMsg{}
+		if err := a.readJSON(w, r, msg); err != nil {
+			glog.Errorf("Failed to read request: %v\n", err)
+			return
+		}
+		if err := a.users.addAccount(msg.Name); err != nil {
+			invalhdlr(w, r, fmt.Sprintf("Failed to add service account: %v", err))
+			return
+		}
+		a.writeJSON(w, r, []byte("Service account created successfully"), "create service account")
+	case len(apiItems) == 2 && apiItems[1] == pathKeys:
+		var lifetime time.Duration
+		msg := &apiKeyMsg{}
+		if err := a.readJSON(w, r, msg); err != nil {
+			glog.Errorf("Failed to read request: %v\n", err)
+			return
+		}
+		if msg.Lifetime != "" {
+			var err error
+			if lifetime, err = time.ParseDuration(msg.Lifetime); err != nil {
+				invalhdlr(w, r, fmt.Sprintf("Bad expire time format %s, err: %v", msg.Lifetime, err), http.StatusBadRequest)
+				return
+			}
+		}
+		key, err := a.users.addAPIKey(apiItems[0], msg.Role, msg.Buckets, lifetime)
+		if err != nil {
+			invalhdlr(w, r, fmt.Sprintf("Failed to generate API key: %v", err), http.StatusBadRequest)
+			return
+		}
+		jsbytes, err := json.Marshal(key)
+		if err != nil {
+			invalhdlr(w, r, fmt.Sprintf("Failed to marshal API key: %v", err))
+			return
+		}
+		a.writeJSON(w, r, jsbytes, "generate API key")
+	default:
+		invalhdlr(w, r, "Invalid request", http.StatusBadRequest)
+	}
+}
+
+// Lists API keys of a service account (the keys themselves are not included):
+//	GET /v1/accounts/account-name/keys
+func (a *authServ) httpAccountGet(w http.ResponseWriter, r *http.Request) {
+	apiItems := a.restAPIItems(r.URL.Path, pathAccounts)
+	if len(apiItems) != 2 || apiItems[1] != pathKeys {
+		invalhdlr(w, r, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := a.checkAuthorization(w, r); err != nil {
+		glog.Errorf("Not authorized: %v\n", err)
+		return
+	}
+
+	keys, err := a.users.listAPIKeys(apiItems[0])
+	if err != nil {
+		invalhdlr(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jsbytes, err := json.Marshal(keys)
+	if err != nil {
+		invalhdlr(w, r, fmt.Sprintf("Failed to marshal API keys: %v", err))
+		return
+	}
+	a.writeJSON(w, r, jsbytes, "list API keys")
+}
+
+// Deletes a service account along with all its API keys, or revokes one API key:
+//	DELETE /v1/accounts/account-name
+//	DELETE /v1/accounts/account-name/keys/key-id
+func (a *authServ) httpAccountDel(w http.ResponseWriter, r *http.Request) {
+	apiItems := a.restAPIItems(r.URL.Path, pathAccounts)
+	if err := a.checkAuthorization(w, r); err != nil {
+		glog.Errorf("Not authorized: %v\n", err)
+		return
+	}
+
+	var err error
+	switch {
+	case len(apiItems) == 1:
+		err = a.users.delAccount(apiItems[0])
+	case len(apiItems) == 3 && apiItems[1] == pathKeys:
+		err = a.users.revokeAPIKey(apiItems[0], apiItems[2])
+	default:
+		invalhdlr(w, r, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		glog.Errorf("Failed to delete: %v\n", err)
+		invalhdlr(w, r, err.Error(), http.StatusBadRequest)
+	}
+}
+
 // Checks if the request header contains super-user credentials and they are
 // valid. Super-user is a user created at deployment time that cannot be
 // deleted/created via REST API
@@ -344,18 +560,22 @@ func (a *authServ) userLogin(w http.ResponseWriter, r *http.Request) {
 	userID := apiItems[0]
 	pass := msg.Password
 	if glog.V(4) {
-		glog.Infof("User: %s, pass: %s\n", userID, pass)
+		glog.Infof("Login request from %s\n", userID)
 	}
 
-	tokenString, err := a.users.issueToken(userID, pass)
+	tokenString, refreshToken, err := a.users.issueToken(userID, pass)
 	if err != nil {
 		glog.Errorf("Failed to generate token: %v\n", err)
 		invalhdlr(w, r, "Not authorized", http.StatusUnauthorized)
 		return
 	}
 
-	repl := fmt.Sprintf(`{"token": "%s"}`, tokenString)
-	a.writeJSON(w, r, []byte(repl), "auth")
+	repl, err := json.Marshal(&tokenMsg{Token: tokenString, RefreshToken: refreshToken})
+	if err != nil {
+		invalhdlr(w, r, fmt.Sprintf("Failed to marshal token: %v", err))
+		return
+	}
+	a.writeJSON(w, r, repl, "auth")
 }
 
 // Borrowed from DFC (modified invalhdlr calls)
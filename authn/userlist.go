@@ -6,47 +6,64 @@ package main
 
 import (
 	"bytes"
+	"crypto/rand"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
 	"github.com/NVIDIA/dfcpub/3rdparty/glog"
 	"github.com/NVIDIA/dfcpub/dfc"
 	"github.com/dgrijalva/jwt-go"
+	"golang.org/x/crypto/bcrypt"
 )
 
 const (
-	userListFile   = "users.json"
-	tokenFile      = ".tokens"
-	proxyTimeout   = time.Minute * 2 // maximum time for syncing Authn data with primary proxy
-	proxyRetryTime = time.Second * 5 // an interval between primary proxy detection attempts
+	userListFile    = "users.json"
+	tokenFile       = ".tokens"
+	proxyTimeout    = time.Minute * 2 // maximum time for syncing Authn data with primary proxy
+	proxyRetryTime  = time.Second * 5 // an interval between primary proxy detection attempts
+	refreshTokenLen = 32              // random bytes in a refresh token
 )
 
 type (
 	userInfo struct {
-		UserID          string            `json:"name"`
-		Password        string            `json:"password,omitempty"`
-		Creds           map[string]string `json:"creds,omitempty"`
-		passwordDecoded string
+		UserID   string            `json:"name"`
+		Password string            `json:"password,omitempty"` // salted bcrypt hash
+		Creds    map[string]string `json:"creds,omitempty"`
+		Role     string            `json:"role,omitempty"`
+		Buckets  map[string]string `json:"buckets,omitempty"` // per-bucket grants: bucket => role
 	}
 	tokenInfo struct {
-		UserID  string    `json:"username"`
-		Issued  time.Time `json:"issued"`
-		Expires time.Time `json:"expires"`
-		Token   string    `json:"token"`
+		UserID         string    `json:"username"`
+		Issued         time.Time `json:"issued"`
+		Expires        time.Time `json:"expires"`
+		Token          string    `json:"token"`
+		RefreshToken   string    `json:"refresh_token"`
+		RefreshExpires time.Time `json:"refresh_expires"`
+	}
+	// issued and revoked tokens are saved to survive authn restart
+	tokenList struct {
+		Tokens  map[string]*tokenInfo `json:"tokens"`  // userID => token
+		Revoked map[string]time.Time  `json:"revoked"` // token or API key => its expiration time
 	}
 	userManager struct {
-		mtx    sync.Mutex
-		Path   string               `json:"-"`
-		Users  map[string]*userInfo `json:"users"`
-		tokens map[string]*tokenInfo
-		client *http.Client
-		proxy  *proxy
+		mtx         sync.Mutex
+		Path        string               `json:"-"`
+		Users       map[string]*userInfo `json:"users"`
+		tokens      map[string]*tokenInfo
+		revoked     map[string]time.Time
+		tokenPath   string
+		accounts    map[string]*serviceAccount
+		accountPath string
+		client      *http.Client
+		proxy       *proxy
 	}
 )
 
@@ -71,20 +88,39 @@ func createHTTPClient() *http.Client {
 	return &http.Client{Transport: transport, Timeout: conf.Timeout.Default}
 }
 
+// Returns a salted hash of the password
+func hashPassword(password string) (string, error) {
+	b, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(b), err
+}
+
+func isPasswordHash(password string) bool {
+	_, err := bcrypt.Cost([]byte(password))
+	return err == nil
+}
+
 // Creates a new user manager. If user DB exists, it loads the data from the
-// file and decrypts passwords
+// file and converts the passwords saved by an older authn (base64-encoded)
+// to hashes. Then it loads the list of issued and revoked tokens, and the
+// service accounts
 func newUserManager(dbPath string, proxy *proxy) *userManager {
 	var (
 		err   error
 		bytes []byte
 	)
 	mgr := &userManager{
-		Path:   dbPath,
-		Users:  make(map[string]*userInfo, 0),
-		tokens: make(map[string]*tokenInfo, 0),
-		client: createHTTPClient(),
-		proxy:  proxy,
-	}
+		Path:        dbPath,
+		Users:       make(map[string]*userInfo, 0),
+		tokens:      make(map[string]*tokenInfo, 0),
+		revoked:     make(map[string]time.Time, 0),
+		tokenPath:   filepath.Join(filepath.Dir(dbPath), tokenFile),
+		accounts:    make(map[string]*serviceAccount, 0),
+		accountPath: filepath.Join(filepath.Dir(dbPath), accountListFile),
+		client:      createHTTPClient(),
+		proxy:       proxy,
+	}
+	mgr.loadTokens()
+	mgr.loadAccounts()
 	if _, err = os.Stat(dbPath); err != nil {
 		if !os.IsNotExist(err) {
 			glog.Fatalf("Failed to load user list: %v\n", err)
@@ -95,23 +131,100 @@ func newUserManager(dbPath string, proxy *proxy) *userManager {
 	if err = dfc.LocalLoad(dbPath, &mgr.Users); err != nil {
 		glog.Fatalf("Failed to load user list: %v\n", err)
 	}
-	// update loaded list: create empty map for users who do not have credentials in saved file
+	// update loaded list: create empty map for users who do not have credentials in saved file,
+	// users saved before the roles were introduced get the default role
 	for _, uinfo := range mgr.Users {
 		if uinfo.Creds == nil {
 			uinfo.Creds = make(map[string]string, 0)
 		}
+		if uinfo.Role == "" {
+			uinfo.Role = dfc.AuthRoleWriter
+		}
+		if uinfo.Buckets == nil {
+			uinfo.Buckets = make(map[string]string, 0)
+		}
 	}
 
+	migrated := 0
 	for _, info := range mgr.Users {
+		if isPasswordHash(info.Password) {
+			continue
+		}
 		if bytes, err = base64.StdEncoding.DecodeString(info.Password); err != nil {
 			glog.Fatalf("Failed to read user list: %v\n", err)
 		}
-		info.passwordDecoded = string(bytes)
+		if info.Password, err = hashPassword(string(bytes)); err != nil {
+			glog.Fatalf("Failed to hash password of %s: %v\n", info.UserID, err)
+		}
+		migrated++
+	}
+	if migrated != 0 {
+		if err = mgr.saveUsers(); err != nil {
+			glog.Fatalf("Failed to save migrated user list: %v\n", err)
+		}
+		glog.Infof("Converted passwords of %d user(s) to hashes", migrated)
 	}
 
 	return mgr
 }
 
+// Loads the tokens saved before restart and resends the revoked ones to
+// the primary proxy: the cluster could have been restarted as well
+func (m *userManager) loadTokens() {
+	list := &tokenList{}
+	if err := dfc.LocalLoad(m.tokenPath, list); err != nil {
+		if !os.IsNotExist(err) {
+			glog.Errorf("Failed to load token list: %v", err)
+		}
+		return
+	}
+	now := time.Now()
+	for userID, info := range list.Tokens {
+		if info.RefreshExpires.After(now) || info.Expires.After(now) {
+			m.tokens[userID] = info
+		}
+	}
+	revoked := make([]string, 0, len(list.Revoked))
+	for token, expires := range list.Revoked {
+		if !isExpired(expires) {
+			m.revoked[token] = expires
+			revoked = append(revoked, token)
+		}
+	}
+	if len(revoked) != 0 {
+		go m.sendRevokedTokensToProxy(revoked...)
+	}
+}
+
+// Saves the list of issued and revoked tokens cleaning up the latter from
+// expired ones. The caller must hold the lock
+func (m *userManager) saveTokens() {
+	for token, expires := range m.revoked {
+		if isExpired(expires) {
+			delete(m.revoked, token)
+		}
+	}
+	list := &tokenList{Tokens: m.tokens, Revoked: m.revoked}
+	// the tokens are secrets: readable by the owner only
+	if err := dfc.LocalSavePerm(m.tokenPath, list, 0600); err != nil {
+		glog.Errorf("UserManager: Failed to save token list: %v", err)
+	}
+}
+
+// Deletes the user's token and adds its access token to the revoked list;
+// returns the access token to be sent to the primary proxy (empty if the
+// user has no token). The caller must hold the lock
+func (m *userManager) revokeUserTokenU(userID string) string {
+	token, ok := m.tokens[userID]
+	if !ok {
+		return ""
+	}
+	delete(m.tokens, userID)
+	m.revoked[token.Token] = token.Expires
+	m.saveTokens()
+	return token.Token
+}
+
 // save new user list to file
 // It is called from functions of this module that acquire lock, so this
 //    function needs no locks
@@ -122,11 +235,17 @@ func (m *userManager) saveUsers() (err error) {
 	return err
 }
 
-// Registers a new user
-func (m *userManager) addUser(userID, userPass string) error {
+// Registers a new user; empty role means the default one (writer)
+func (m *userManager) addUser(userID, userPass, role string) error {
 	if userID == "" || userPass == "" {
 		return fmt.Errorf("Invalid credentials")
 	}
+	if role == "" {
+		role = dfc.AuthRoleWriter
+	}
+	if !isValidRole(role) {
+		return fmt.Errorf("Invalid role: %s", role)
+	}
 
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
@@ -134,16 +253,70 @@ func (m *userManager) addUser(userID, userPass string) error {
 	if _, ok := m.Users[userID]; ok {
 		return fmt.Errorf("User '%s' already registered", userID)
 	}
+	hash, err := hashPassword(userPass)
+	if err != nil {
+		return fmt.Errorf("Failed to hash password: %v", err)
+	}
 	m.Users[userID] = &userInfo{
-		UserID:          userID,
-		passwordDecoded: userPass,
-		Password:        base64.StdEncoding.EncodeToString([]byte(userPass)),
-		Creds:           make(map[string]string, 0),
+		UserID:   userID,
+		Password: hash,
+		Creds:    make(map[string]string, 0),
+		Role:     role,
+		Buckets:  make(map[string]string, 0),
 	}
 
 	return m.saveUsers()
 }
 
+// Changes the user's role and/or per-bucket grants: empty role keeps the
+// current one, a grant with empty role revokes the grant for the bucket.
+// The user's token is revoked if anything changes
+func (m *userManager) updatePermissions(userID, role string, buckets map[string]string) (bool, error) {
+	if role != "" && !isValidRole(role) {
+		return false, fmt.Errorf("Invalid role: %s", role)
+	}
+	for bucket, grant := range buckets {
+		if bucket == "" || (grant != "" && !isValidRole(grant)) {
+			return false, fmt.Errorf("Invalid grant: bucket %q, role %q", bucket, grant)
+		}
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	user, ok := m.Users[userID]
+	if !ok {
+		return false, fmt.Errorf("User %s does not exist", userID)
+	}
+
+	changed := role != "" && user.Role != role
+	if changed {
+		user.Role = role
+	}
+	for bucket, grant := range buckets {
+		if current, ok := user.Buckets[bucket]; grant == "" && ok {
+			delete(user.Buckets, bucket)
+			changed = true
+		} else if grant != "" && current != grant {
+			user.Buckets[bucket] = grant
+			changed = true
+		}
+	}
+	if !changed {
+		return false, nil
+	}
+
+	// the permissions are embedded into the token
+	if token := m.revokeUserTokenU(userID); token != "" {
+		go m.sendRevokedTokensToProxy(token)
+	}
+	if err := m.saveUsers(); err != nil {
+		glog.Errorf("Update permissions failed to save user list: %v", err)
+	}
+
+	return true, nil
+}
+
 // Deletes an existing user
 func (m *userManager) delUser(userID string) error {
 	m.mtx.Lock()
@@ -152,13 +325,12 @@ func (m *userManager) delUser(userID string) error {
 		return fmt.Errorf("User %s does not exist", userID)
 	}
 	delete(m.Users, userID)
-	token, ok := m.tokens[userID]
-	delete(m.tokens, userID)
+	token := m.revokeUserTokenU(userID)
 	err := m.saveUsers()
 	m.mtx.Unlock()
 
-	if ok {
-		go m.sendRevokedTokensToProxy(token.Token)
+	if token != "" {
+		go m.sendRevokedTokensToProxy(token)
 	}
 
 	return err
@@ -167,8 +339,9 @@ func (m *userManager) delUser(userID string) error {
 // Generates a token for a user if user credentials are valid. If the token is
 // already generated and is not expired yet the existing token is returned.
 // Token includes information about userID, AWS/GCP creds and expire token time.
-// If a new token was generated then it sends the proxy a new valid token list
-func (m *userManager) issueToken(userID, pwd string) (string, error) {
+// Along with the token it returns a refresh token to get a new token when the
+// current one expires without providing the password again
+func (m *userManager) issueToken(userID, pwd string) (string, string, error) {
 	var (
 		user  *userInfo
 		token *tokenInfo
@@ -180,50 +353,129 @@ func (m *userManager) issueToken(userID, pwd string) (string, error) {
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
 	if user, ok = m.Users[userID]; !ok {
-		return "", fmt.Errorf("Invalid credentials")
+		return "", "", fmt.Errorf("Invalid credentials")
 	}
-	passwordDecoded := user.passwordDecoded
-	creds := user.Creds
-
-	if passwordDecoded != pwd {
-		return "", fmt.Errorf("Invalid username or password")
+	if err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(pwd)); err != nil {
+		return "", "", fmt.Errorf("Invalid username or password")
 	}
 
 	// check if a user is already has got token. If existing token expired then
 	// delete it and reissue a new token
 	if token, ok = m.tokens[userID]; ok {
 		if token.Expires.After(time.Now()) {
-			return token.Token, nil
+			return token.Token, token.RefreshToken, nil
 		}
 		delete(m.tokens, userID)
 	}
 
-	// generate token
+	if token, err = m.generateTokenU(user); err != nil {
+		return "", "", err
+	}
+	return token.Token, token.RefreshToken, nil
+}
+
+// Issues a new token in exchange for a valid refresh token. The user's current
+// token is revoked and the refresh token is replaced with a new one
+func (m *userManager) refreshToken(refreshToken string) (string, string, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	for userID, info := range m.tokens {
+		if info.RefreshToken != refreshToken {
+			continue
+		}
+		if info.RefreshExpires.Before(time.Now()) {
+			delete(m.tokens, userID)
+			m.saveTokens()
+			return "", "", fmt.Errorf("Refresh token expired")
+		}
+		user, ok := m.Users[userID]
+		if !ok {
+			return "", "", fmt.Errorf("Invalid refresh token")
+		}
+		revoked := ""
+		if info.Expires.After(time.Now()) {
+			revoked = m.revokeUserTokenU(userID)
+		}
+		token, err := m.generateTokenU(user)
+		if err != nil {
+			return "", "", err
+		}
+		if revoked != "" {
+			go m.sendRevokedTokensToProxy(revoked)
+		}
+		return token.Token, token.RefreshToken, nil
+	}
+
+	return "", "", fmt.Errorf("Invalid refresh token")
+}
+
+// Generates and saves a new token and refresh token for the user.
+// The caller must hold the lock
+func (m *userManager) generateTokenU(user *userInfo) (*tokenInfo, error) {
 	issued := time.Now()
 	expires := issued.Add(conf.Auth.ExpirePeriod)
+	random := make([]byte, 2*refreshTokenLen)
+	if _, err := rand.Read(random); err != nil {
+		return nil, fmt.Errorf("failed to generate token: %v", err)
+	}
 
 	// put all useful info into token: who owns the token, when it was issued,
-	// when it expires and credentials to log in AWS, GCP etc
+	// when it expires, credentials to log in AWS, GCP etc, and the user's
+	// role and per-bucket grants. Unique ID makes the tokens issued within
+	// the same minute differ - one of them can be revoked
 	t := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"jti":      hex.EncodeToString(random[refreshTokenLen:]),
 		"issued":   issued.Format(time.RFC822),
 		"expires":  expires.Format(time.RFC822),
-		"username": userID,
-		"creds":    creds,
+		"username": user.UserID,
+		"creds":    user.Creds,
+		"role":     user.Role,
+		"buckets":  user.Buckets,
 	})
 	tokenString, err := t.SignedString([]byte(conf.Auth.Secret))
 	if err != nil {
-		return "", fmt.Errorf("failed to generate token: %v", err)
+		return nil, fmt.Errorf("failed to generate token: %v", err)
 	}
 
-	token = &tokenInfo{
-		UserID:  userID,
-		Issued:  issued,
-		Expires: expires,
-		Token:   tokenString,
+	token := &tokenInfo{
+		UserID:         user.UserID,
+		Issued:         issued,
+		Expires:        expires,
+		Token:          tokenString,
+		RefreshToken:   hex.EncodeToString(random[:refreshTokenLen]),
+		RefreshExpires: issued.Add(conf.Auth.RefreshPeriod),
 	}
-	m.tokens[userID] = token
+	m.tokens[user.UserID] = token
+	m.saveTokens()
 
-	return tokenString, nil
+	return token, nil
+}
+
+// Returns the expiration time of a token or API key signed by this server
+func tokenExpires(tokenStr string) (time.Time, error) {
+	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(conf.Auth.Secret), nil
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return time.Time{}, fmt.Errorf("Invalid token")
+	}
+	expireStr, ok := claims["expires"].(string)
+	if !ok {
+		if _, ok = claims["apikey"].(string); ok {
+			// API key that never expires
+			return time.Time{}, nil
+		}
+		return time.Time{}, fmt.Errorf("Invalid token")
+	}
+	return time.Parse(time.RFC822, expireStr)
 }
 
 // Delete existing token, a.k.a log out
@@ -236,6 +488,12 @@ func (m *userManager) revokeToken(token string) {
 			break
 		}
 	}
+	// remember the token until it expires; the tokens that were not signed
+	// by this server are invalid anyway
+	if expires, err := tokenExpires(token); err == nil {
+		m.revoked[token] = expires
+	}
+	m.saveTokens()
 	m.mtx.Unlock()
 
 	// send the token in all case to allow an admin to revoke
@@ -340,9 +598,8 @@ func (m *userManager) updateCredentials(userID, provider, userCreds string) (boo
 	changed := user.Creds[provider] != userCreds
 	if changed {
 		user.Creds[provider] = userCreds
-		if token, ok := m.tokens[userID]; ok {
-			delete(m.tokens, userID)
-			go m.sendRevokedTokensToProxy(token.Token)
+		if token := m.revokeUserTokenU(userID); token != "" {
+			go m.sendRevokedTokensToProxy(token)
 		}
 	}
 
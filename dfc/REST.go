@@ -16,24 +16,35 @@ type ActionMsg struct {
 
 // ActionMsg.Action enum
 const (
-	ActShutdown    = "shutdown"
-	ActRebalance   = "rebalance"
-	ActLRU         = "lru"
-	ActSyncLB      = "synclb"
-	ActCreateLB    = "createlb"
-	ActDestroyLB   = "destroylb"
-	ActRenameLB    = "renamelb"
-	ActSetConfig   = "setconfig"
-	ActSetProps    = "setprops"
-	ActRename      = "rename"
-	ActEvict       = "evict"
-	ActDelete      = "delete"
-	ActPrefetch    = "prefetch"
-	ActRegTarget   = "regtarget"
-	ActRegProxy    = "regproxy"
-	ActUnregTarget = "unregtarget"
-	ActUnregProxy  = "unregproxy"
-	ActNewPrimary  = "newprimary"
+	ActShutdown     = "shutdown"
+	ActRebalance    = "rebalance"
+	ActLRU          = "lru"
+	ActLifecycle    = "lifecycle"
+	ActPurgeTrash   = "purgetrash"
+	ActSyncLB       = "synclb"
+	ActCreateLB     = "createlb"
+	ActDestroyLB    = "destroylb"
+	ActRenameLB     = "renamelb"
+	ActRenamePrefix = "renameprefix"
+	ActSetConfig    = "setconfig"
+	ActSetProps     = "setprops"
+	ActRename       = "rename"
+	ActCopy         = "copy"
+	ActCompose      = "compose"
+	ActCopyBucket   = "copybck"
+	ActAbortXact    = "abortxact"
+	ActInventory    = "inventory"
+	ActBatchGet     = "batchget"
+	ActDsort        = "dsort"
+	ActEvict        = "evict"
+	ActDelete       = "delete"
+	ActUndelete     = "undelete"
+	ActPrefetch     = "prefetch"
+	ActRegTarget    = "regtarget"
+	ActRegProxy     = "regproxy"
+	ActUnregTarget  = "unregtarget"
+	ActUnregProxy   = "unregproxy"
+	ActNewPrimary   = "newprimary"
 )
 
 // Cloud Provider enum
@@ -43,6 +54,13 @@ const (
 	ProviderDfc    = "dfc"
 )
 
+// AuthN role enum: a user's role and per-bucket grants are embedded into the token
+const (
+	AuthRoleAdmin  = "admin"  // all operations including bucket and cluster administration
+	AuthRoleWriter = "writer" // read, write and delete objects (default)
+	AuthRoleReader = "reader" // read objects and list buckets
+)
+
 // Header Key enum
 const (
 	CloudProvider         = "CloudProvider"         // from Cloud Provider enum
@@ -55,6 +73,11 @@ const (
 	HeaderDfcObjVersion   = "HeaderDfcObjVersion"   // Object version/generation
 	HeaderPrimaryProxyURL = "PrimaryProxyURL"       // URL of Primary Proxy
 	HeaderPrimaryProxyID  = "PrimaryProxyID"        // ID of Primary Proxy
+	HeaderDfcDaemonID     = "HeaderDfcDaemonID"     // AuthN: ID of the daemon that has sent the (intra-cluster) request
+	HeaderDfcDaemonTime   = "HeaderDfcDaemonTime"   // ditto: when the request was signed (unix seconds)
+	HeaderDfcDaemonSig    = "HeaderDfcDaemonSig"    // ditto: HMAC-SHA256 of the above, the method and the path
+	HeaderDfcTraceID      = "HeaderDfcTraceID"      // ID of the request's trace (see trace.go)
+	HeaderTraceParent     = "traceparent"           // W3C trace context
 	Size                  = "Size"                  // Size of object in bytes
 	Version               = "Version"               // Object version number
 )
@@ -77,9 +100,22 @@ const (
 	URLParamLength           = "length"       // Length, the total number of bytes that need to be read from the offset
 	URLParamWhat             = "what"         // "config" | "stats" | "xaction" ...
 	URLParamProps            = "props"        // e.g. "checksum, size" | "atime, size" | "ctime, iscached" | "bucket, size" | xaction type
+	URLParamVersion          = "version"      // local buckets: object version to GET, HEAD, or DELETE
+	URLParamFormat           = "format"       // bucket inventory: InventoryFormatJSONL (default) | InventoryFormatCSV; archive extraction: ExtractFormat enum
+	URLParamExtract          = "extract"      // true: PUT an archive and extract its members as objects (see ExtractResult)
+	URLParamPrefix           = "prefix"       // archive extraction: prefix of the names of the extracted objects
+	URLParamTransform        = "transform"    // GET: name of the transformer to run on the object (overrides the bucket's), or TransformNone
+	URLParamAppend           = "append"       // true: PUT appends to the (local bucket's) object
+	URLParamAuthUser         = "auth_user"    // redirect signed by the proxy: the user the request was authorized for
+	URLParamAuthRole         = "auth_role"    // ditto: the user's role
+	URLParamAuthGrant        = "auth_grant"   // ditto: the user's role for the bucket, if granted
+	URLParamAuthExpires      = "auth_expires" // ditto: the signature is valid until (unix seconds)
+	URLParamAuthSig          = "auth_sig"     // ditto: HMAC-SHA256 of the above, the method and the path
+	URLParamTraceParent      = "traceparent"  // W3C trace context of the redirected request
+	URLParamNoCache          = "nocache"      // true: GET a Cloud object without keeping it cached (see alternateTarget)
 )
 
-// TODO: sort and some props are TBD
+// TODO: some props are TBD
 // GetMsg represents properties and options for get requests
 type GetMsg struct {
 	GetSort       string `json:"sort"`        // "ascending, atime" | "descending, name"
@@ -88,6 +124,16 @@ type GetMsg struct {
 	GetPrefix     string `json:"prefix"`      // object name filter: return only objects which name starts with prefix
 	GetPageMarker string `json:"pagemarker"`  // AWS/GCP: marker
 	GetPageSize   int    `json:"pagesize"`    // maximum number of entries returned by list bucket call
+	GetDelimiter  string `json:"delimiter"`   // groups names that share prefix up to the delimiter into a single "directory" entry
+	// filters (see listFilter)
+	GetRegex       string `json:"regex"`        // object names must match the regex
+	GetMinSize     int64  `json:"min_size"`     // minimum object size in bytes
+	GetMaxSize     int64  `json:"max_size"`     // maximum object size in bytes (0 - no limit)
+	GetAtimeAfter  string `json:"atime_after"`  // RFC3339: accessed at or after
+	GetAtimeBefore string `json:"atime_before"` // RFC3339: not accessed since
+	GetCtimeAfter  string `json:"ctime_after"`  // RFC3339: modified at or after
+	GetCtimeBefore string `json:"ctime_before"` // RFC3339: modified before
+	GetCachedOnly  bool   `json:"cached_only"`  // Cloud buckets: list only the objects cached by DFC
 }
 
 // RangeListMsgBase contains fields common to Range and List operations
@@ -110,6 +156,101 @@ type RangeMsg struct {
 	Range  string `json:"range"`
 }
 
+// BatchGetMsg contains the options of the batch GET (ActBatchGet) - the objects to read
+// are specified by the ListMsg or RangeMsg fields of the same ActionMsg.Value
+type BatchGetMsg struct {
+	Format  string `json:"format"`  // BatchFormatTar (default) | BatchFormatZip
+	Missing string `json:"missing"` // BatchMissingError (default) | BatchMissingSkip
+	Order   string `json:"order"`   // BatchOrderRequest (default) | BatchOrderTarget
+}
+
+// BatchGetMsg enums
+const (
+	BatchFormatTar    = "tar"
+	BatchFormatZip    = "zip"
+	BatchMissingError = "error"   // fail the request if any of the objects does not exist
+	BatchMissingSkip  = "skip"    // omit missing objects from the archive
+	BatchOrderRequest = "request" // list: in the order of objnames, range: by name
+	BatchOrderTarget  = "target"  // grouped by target (and by name or the order of objnames within a group)
+)
+
+// ExtractResult is returned by the archive upload with extraction (URLParamExtract)
+type ExtractResult struct {
+	Objects int64          `json:"objects"` // number of extracted objects
+	Bytes   int64          `json:"bytes"`   // their total size
+	Errors  []ExtractError `json:"errors,omitempty"`
+}
+
+// ExtractError is the failure to extract a single archive member
+type ExtractError struct {
+	Name  string `json:"name"`
+	Error string `json:"error"`
+}
+
+// ExtractFormat enum (by default, the format is determined by the archive's extension)
+const (
+	ExtractFormatTar = "tar"
+	ExtractFormatTgz = "tgz" // .tgz or .tar.gz
+	ExtractFormatZip = "zip"
+)
+
+// DsortMsg is the value of the ActDsort action: the input shards (tar archives) are selected
+// by the same prefix, regex and range as in the RangeMsg; the output shards are written
+// into the existing local bucket as <OutputPrefix><index>.tar
+type DsortMsg struct {
+	ID           string `json:"id"`            // assigned by the proxy
+	Bucket       string `json:"bucket"`        // input bucket: set by the proxy
+	Prefix       string `json:"prefix"`        // input shards: name prefix
+	Regex        string `json:"regex"`         // input shards: name regex
+	Range        string `json:"range"`         // input shards: "min:max" (see RangeMsg)
+	OutputBucket string `json:"output_bucket"` // local bucket for the output shards
+	OutputPrefix string `json:"output_prefix"` // default: "shard-"
+	ShardSize    int64  `json:"shard_size"`    // size of the output shard in bytes (the last one may be smaller)
+	Order        string `json:"order"`         // GetSortAsc (default) | GetSortDes | DsortOrderShuffle
+	Seed         int64  `json:"seed"`          // DsortOrderShuffle: random seed (0 - current time)
+}
+
+// DsortMsg.Order enum (in addition to GetSortAsc and GetSortDes)
+const (
+	DsortOrderShuffle = "shuffle"
+)
+
+// DsortPhase enum (see DsortTargetStats)
+const (
+	DsortPhaseExtraction = "extraction" // reading input shards and exchanging records
+	DsortPhaseSorting    = "sorting"    // all records extracted, waiting for the proxy to sort
+	DsortPhaseCreation   = "creation"   // creating output shards
+	DsortPhaseFinished   = "finished"
+	DsortPhaseAborted    = "aborted"
+)
+
+// TransformNone, as the value of URLParamTransform, disables the bucket's transformer (BucketProps.Transform)
+const TransformNone = "none"
+
+// InventoryMsg is the value of the ActInventory action: the format of the bucket inventory
+// and, optionally, the local bucket and the object name to store the inventory as
+type InventoryMsg struct {
+	Format  string `json:"format"`
+	Bucket  string `json:"bucket"`
+	Objname string `json:"objname"`
+}
+
+// InventoryEntry is a single record of the bucket inventory
+// (CSV columns are in the same order)
+type InventoryEntry struct {
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum"`
+	Version  string `json:"version"`
+	Atime    string `json:"atime"` // RFC3339Nano
+}
+
+// InventoryMsg.Format enum
+const (
+	InventoryFormatJSONL = "jsonl"
+	InventoryFormatCSV   = "csv"
+)
+
 // SmapVoteMsg contains the cluster map and a bool representing whether or not a vote is currently happening.
 type SmapVoteMsg struct {
 	VoteInProgress bool      `json:"vote_in_progress"`
@@ -125,12 +266,14 @@ type SmapVoteMsg struct {
 
 // GetMsg.GetWhat enum
 const (
-	GetWhatFile     = "file" // { "what": "file" } is implied by default and can be omitted
-	GetWhatConfig   = "config"
-	GetWhatSmap     = "smap"
-	GetWhatStats    = "stats"
-	GetWhatXaction  = "xaction"
-	GetWhatSmapVote = "smapvote"
+	GetWhatFile      = "file" // { "what": "file" } is implied by default and can be omitted
+	GetWhatConfig    = "config"
+	GetWhatSmap      = "smap"
+	GetWhatStats     = "stats"
+	GetWhatXaction   = "xaction"
+	GetWhatSmapVote  = "smapvote"
+	GetWhatVersions  = "versions"  // object's version history (local buckets)
+	GetWhatInventory = "inventory" // bucket inventory (see ActInventory)
 )
 
 // GetMsg.GetSort enum
@@ -152,6 +295,7 @@ const (
 
 // GetMsg.GetProps enum
 const (
+	GetPropsName     = "name" // GetSort only: objects are always listed with their names
 	GetPropsChecksum = "checksum"
 	GetPropsSize     = "size"
 	GetPropsAtime    = "atime"
@@ -183,6 +327,12 @@ type BucketEntry struct {
 	TargetURL string `json:"targetURL,omitempty"` // URL of target which has the entry
 }
 
+// BucketEntry.Type enum
+const (
+	BucketEntryFile      = "file"
+	BucketEntryDirectory = "directory" // common prefix of the names listed with GetMsg.GetDelimiter
+)
+
 // BucketList represents the contents of a given bucket - somewhat analogous to the 'ls <bucket-name>'
 type BucketList struct {
 	Entries    []*BucketEntry `json:"entries"`
@@ -197,28 +347,33 @@ type BucketNames struct {
 
 // RESTful URL path: /v1/....
 const (
-	Rversion   = "v1"
-	Rbuckets   = "buckets"
-	Robjects   = "objects"
-	Rcluster   = "cluster"
-	Rdaemon    = "daemon"
-	Rsyncsmap  = "syncsmap"
-	Rpush      = "push"
-	Rkeepalive = "keepalive"
-	Rregister  = "register"
-	Rhealth    = "health"
-	Rvote      = "vote"
-	Rproxy     = "proxy"
-	Rvoteres   = "result"
-	Rvoteinit  = "init"
-	Rtokens    = "tokens"
-	Rmetasync  = "metasync"
+	Rversion    = "v1"
+	Rbuckets    = "buckets"
+	Robjects    = "objects"
+	Rcluster    = "cluster"
+	Rdaemon     = "daemon"
+	Rsyncsmap   = "syncsmap"
+	Rpush       = "push"
+	Rkeepalive  = "keepalive"
+	Rregister   = "register"
+	Rhealth     = "health"
+	Rvote       = "vote"
+	Rproxy      = "proxy"
+	Rvoteres    = "result"
+	Rvoteinit   = "init"
+	Rtokens     = "tokens"
+	Rmetasync   = "metasync"
+	Rsort       = "sort"
+	Roverloaded = "overloaded"
 )
 
 const (
 	// Used by various Xaction APIs
-	XactionRebalance = ActRebalance
-	XactionPrefetch  = ActPrefetch
+	XactionRebalance    = ActRebalance
+	XactionPrefetch     = ActPrefetch
+	XactionCopyBucket   = ActCopyBucket
+	XactionDsort        = ActDsort
+	XactionRenamePrefix = ActRenamePrefix
 
 	// Denote the status of an Xaction
 	XactionStatusInProgress = "InProgress"
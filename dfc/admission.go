@@ -0,0 +1,223 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// Admission control (config: admission.admission_enabled)
+//
+// A target limits the number of concurrent requests per class of operation:
+// cold GET, warm GET, PUT and rebalance. A request over the limit waits for a
+// slot up to admission.queue_time and is then shed with 503 and Retry-After.
+// In addition, cold GETs and PUTs are shed right away while the utilization of
+// any of the target's disks (see iostatrunner) is at or above admission.max_util.
+//
+// Rebalance requests are never shed - the sending target does not retry - and
+// wait for a slot as long as it takes.
+//
+// A target that sheds load notifies the proxies, and the proxies then redirect
+// the GETs of Cloud objects - which any target can serve - to the next target in
+// HRW order for the admission.backoff_time (see alternateTarget).
+
+const (
+	admitColdGet = iota
+	admitWarmGet
+	admitPut
+	admitRebalance
+	admitClasses
+)
+
+var admitClassNames = [admitClasses]string{"cold GET", "warm GET", "PUT", "rebalance"}
+
+type (
+	admissionCtl struct {
+		sync.Mutex
+		inflight [admitClasses]int
+		released chan struct{} // closed (and replaced) upon each release to wake up the waiters
+		notified int64         // when the proxies were last notified (unix nano)
+	}
+	// overloadedTargets: proxy's view of the targets that shed load
+	overloadedTargets struct {
+		sync.Mutex
+		m map[string]time.Time // daemon ID => until
+	}
+)
+
+func newAdmissionCtl() *admissionCtl {
+	return &admissionCtl{released: make(chan struct{})}
+}
+
+func admissionLimit(class int) int {
+	conf := &ctx.config.Admission
+	switch class {
+	case admitColdGet:
+		return conf.MaxColdGet
+	case admitWarmGet:
+		return conf.MaxWarmGet
+	case admitPut:
+		return conf.MaxPut
+	default:
+		return conf.MaxRebalance
+	}
+}
+
+// acquire waits for a slot of the class up to the given time (negative - without
+// deadline); the limits are re-read while waiting as they can be changed at runtime
+func (a *admissionCtl) acquire(class int, wait time.Duration) bool {
+	var (
+		timer   *time.Timer
+		timeout <-chan time.Time
+	)
+	a.Lock()
+	for limit := admissionLimit(class); limit > 0 && a.inflight[class] >= limit; limit = admissionLimit(class) {
+		if timer == nil && wait >= 0 {
+			timer = time.NewTimer(wait)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		released := a.released
+		a.Unlock()
+		select {
+		case <-released:
+		case <-timeout:
+			return false
+		}
+		a.Lock()
+	}
+	a.inflight[class]++
+	a.Unlock()
+	return true
+}
+
+func (a *admissionCtl) release(class int) {
+	a.Lock()
+	a.inflight[class]--
+	close(a.released)
+	a.released = make(chan struct{})
+	a.Unlock()
+}
+
+// admit returns the function to call when the request is done or, if the
+// request must be shed, the reason
+func (t *targetrunner) admit(class int) (release func(), errstr string) {
+	conf := &ctx.config.Admission
+	release = func() {}
+	if !conf.Enabled {
+		return
+	}
+	if (class == admitColdGet || class == admitPut) && conf.MaxUtil > 0 {
+		if riostat := getiostatrunner(); riostat != nil {
+			if util := riostat.getMaxUtil(); util >= conf.MaxUtil {
+				errstr = fmt.Sprintf("%s: disk utilization %.0f%%", admitClassNames[class], util)
+				return
+			}
+		}
+	}
+	wait := conf.QueueTime
+	if class == admitRebalance {
+		wait = -1 // never shed: sendfile does not retry
+	}
+	if !t.admission.acquire(class, wait) {
+		errstr = fmt.Sprintf("%s: %d requests in progress", admitClassNames[class], admissionLimit(class))
+		return
+	}
+	release = func() { t.admission.release(class) }
+	return
+}
+
+// shed rejects the request with 503 and lets the proxies know
+func (t *targetrunner) shed(w http.ResponseWriter, r *http.Request, errstr string) {
+	backoff := ctx.config.Admission.BackoffTime
+	w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(backoff.Seconds())), 10))
+	t.statsif.add("numshed", 1)
+	t.notifyOverloaded(backoff)
+	t.invalmsghdlr(w, r, "Target is overloaded - "+errstr, http.StatusServiceUnavailable)
+}
+
+// notifyOverloaded notifies the proxies at most twice per backoff time
+func (t *targetrunner) notifyOverloaded(backoff time.Duration) {
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&t.admission.notified)
+	if now-last < int64(backoff/2) || !atomic.CompareAndSwapInt64(&t.admission.notified, last, now) {
+		return
+	}
+	smapLock.Lock()
+	proxies := make([]*daemonInfo, 0, len(t.smap.Pmap))
+	for _, psi := range t.smap.Pmap {
+		proxies = append(proxies, psi)
+	}
+	smapLock.Unlock()
+	go func() {
+		query := url.Values{URLParamDaemonID: []string{t.si.DaemonID}}
+		path := URLPath(Rversion, Rdaemon, Roverloaded)
+		for res := range t.broadcast(path, query, http.MethodPut, nil, proxies, ProxyPingTimeout) {
+			if res.err != nil {
+				glog.Warningf("Failed to notify %s of overload, err: %s", res.si.DaemonID, res.errstr)
+			}
+		}
+	}()
+}
+
+//
+// proxy
+//
+
+func newOverloadedTargets() *overloadedTargets {
+	return &overloadedTargets{m: make(map[string]time.Time)}
+}
+
+func (o *overloadedTargets) set(daemonID string, until time.Time) {
+	o.Lock()
+	o.m[daemonID] = until
+	o.Unlock()
+}
+
+func (o *overloadedTargets) has(daemonID string) bool {
+	o.Lock()
+	defer o.Unlock()
+	until, ok := o.m[daemonID]
+	if ok && time.Now().After(until) {
+		delete(o.m, daemonID)
+		return false
+	}
+	return ok
+}
+
+// PUT /Rversion/Rdaemon/Roverloaded?daemon_id=...
+func (p *proxyrunner) targetOverloaded(w http.ResponseWriter, r *http.Request) {
+	daemonID := r.URL.Query().Get(URLParamDaemonID)
+	smapLock.Lock()
+	si := p.smap.get(daemonID)
+	smapLock.Unlock()
+	if si == nil {
+		p.invalmsghdlr(w, r, fmt.Sprintf("Unknown target %q", daemonID), http.StatusNotFound)
+		return
+	}
+	backoff := ctx.config.Admission.BackoffTime
+	p.overloaded.set(daemonID, time.Now().Add(backoff))
+	glog.Warningf("Target %s is overloaded: redirecting Cloud GETs for %v", daemonID, backoff)
+}
+
+// alternateTarget returns the target to serve a Cloud object instead of the
+// overloaded one, nil if all of them are overloaded.
+// Note that the alternate target is not a replica: it is the next target in HRW
+// order, which does not store the object (unless the cluster map has changed).
+// It cold-GETs the object and, given URLParamNoCache, evicts it once served -
+// the object stays cached only on its HRW target
+func (p *proxyrunner) alternateTarget(bucket, objname string) *daemonInfo {
+	return hrwTargetSkip(bucket, objname, p.smap, p.overloaded.has)
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAdmissionCtl(t *testing.T) {
+	oldconf := ctx.config.Admission
+	ctx.config.Admission = admissionconf{MaxPut: 2, Enabled: true}
+	defer func() { ctx.config.Admission = oldconf }()
+
+	a := newAdmissionCtl()
+	for i := 0; i < 2; i++ {
+		if !a.acquire(admitPut, 0) {
+			t.Fatalf("PUT %d was not admitted", i)
+		}
+	}
+	// other classes are not affected, 0 - unlimited
+	for i := 0; i < 10; i++ {
+		if !a.acquire(admitColdGet, 0) {
+			t.Fatalf("Cold GET %d was not admitted", i)
+		}
+	}
+	started := time.Now()
+	if a.acquire(admitPut, 50*time.Millisecond) {
+		t.Fatal("PUT over the limit was admitted")
+	}
+	if waited := time.Since(started); waited < 50*time.Millisecond {
+		t.Errorf("PUT over the limit was shed after %v, expected to wait 50ms", waited)
+	}
+
+	// a waiting request takes the slot that is released
+	admitted := make(chan bool)
+	go func() { admitted <- a.acquire(admitPut, 10*time.Second) }()
+	time.Sleep(10 * time.Millisecond)
+	a.release(admitPut)
+	if !<-admitted {
+		t.Fatal("Waiting PUT was not admitted upon release")
+	}
+
+	// the limit is changed at runtime
+	go func() { admitted <- a.acquire(admitPut, 10*time.Second) }()
+	time.Sleep(10 * time.Millisecond)
+	a.Lock() // the limits are read under the lock
+	ctx.config.Admission.MaxPut = 3
+	a.Unlock()
+	a.release(admitColdGet) // wakes up the waiters
+	if !<-admitted {
+		t.Fatal("Waiting PUT was not admitted upon raising the limit")
+	}
+	if a.inflight[admitPut] != 3 || a.inflight[admitColdGet] != 9 {
+		t.Errorf("Unexpected requests in progress: %v", a.inflight)
+	}
+
+	// no deadline: waits past any queue time
+	a.Lock()
+	ctx.config.Admission.MaxRebalance = 1
+	a.Unlock()
+	a.acquire(admitRebalance, -1)
+	go func() { admitted <- a.acquire(admitRebalance, -1) }()
+	select {
+	case <-admitted:
+		t.Fatal("Rebalance over the limit was admitted")
+	case <-time.After(50 * time.Millisecond):
+	}
+	a.release(admitRebalance)
+	if !<-admitted {
+		t.Fatal("Waiting rebalance was not admitted upon release")
+	}
+}
+
+func TestOverloadedTarget(t *testing.T) {
+	oldconf := ctx.config.Admission
+	ctx.config.Admission = admissionconf{BackoffTime: time.Minute, Enabled: true}
+	defer func() { ctx.config.Admission = oldconf }()
+
+	p := &proxyrunner{}
+	p.statsif = nopStats{}
+	p.overloaded = newOverloadedTargets()
+	p.smap = &Smap{Tmap: make(map[string]*daemonInfo), Pmap: make(map[string]*daemonInfo)}
+	for _, id := range []string{"t1", "t2", "t3"} {
+		p.smap.Tmap[id] = &daemonInfo{DaemonID: id}
+	}
+	si, _ := HrwTarget("bucket", "obj", p.smap)
+
+	w := httptest.NewRecorder()
+	p.targetOverloaded(w, httptest.NewRequest(http.MethodPut, "/v1/daemon/overloaded?daemon_id=unknown", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown target, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	p.targetOverloaded(w, httptest.NewRequest(http.MethodPut, "/v1/daemon/overloaded?daemon_id="+si.DaemonID, nil))
+	if w.Code != http.StatusOK || !p.overloaded.has(si.DaemonID) {
+		t.Fatalf("Target %s was not marked overloaded: %d", si.DaemonID, w.Code)
+	}
+
+	// the next target in HRW order
+	alt := p.alternateTarget("bucket", "obj")
+	if alt == nil || alt.DaemonID == si.DaemonID {
+		t.Fatalf("Expected a target other than %s, got %+v", si.DaemonID, alt)
+	}
+	delete(p.smap.Tmap, si.DaemonID)
+	if next, _ := HrwTarget("bucket", "obj", p.smap); next != alt {
+		t.Errorf("Expected %s, got %s", next.DaemonID, alt.DaemonID)
+	}
+	p.smap.Tmap[si.DaemonID] = si
+
+	// all targets are overloaded
+	for id := range p.smap.Tmap {
+		p.overloaded.set(id, time.Now().Add(time.Minute))
+	}
+	if alt = p.alternateTarget("bucket", "obj"); alt != nil {
+		t.Errorf("Expected no target, got %s", alt.DaemonID)
+	}
+	// backoff time expires
+	p.overloaded.set(si.DaemonID, time.Now().Add(-time.Second))
+	if p.overloaded.has(si.DaemonID) {
+		t.Errorf("Target %s is still overloaded after the backoff time", si.DaemonID)
+	}
+}
@@ -0,0 +1,439 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// Audit log (config: audit.audit_enabled)
+//
+// Every mutating (that is, not GET or HEAD) request that a proxy or a target
+// receives from a client is recorded in the audit log: who (user and API key
+// from the token), what (method, path and ActionMsg), which bucket and object,
+// when, from where, and the result (HTTP status and error). Requests of the
+// daemons of the cluster - identified by their certificates (mTLS) - are not
+// recorded.
+// The log is a JSON-lines file in its own directory, separate from glog. The
+// file is rotated upon reaching the configured size; rotated files are named
+// audit.log.<timestamp> and the oldest of them are removed when their number
+// exceeds the configured maximum.
+// With hash chaining enabled, each record carries the hash of the previous
+// record ("prev_hash") and its own hash ("hash") - SHA-256 of the previous
+// hash and the record itself - so that a removed or modified record breaks
+// the chain (see verifyAuditLog). The chain continues across rotations and
+// restarts.
+
+const (
+	auditFileName       = "audit.log"
+	auditDefaultMaxSize = 64 * MiB
+	auditMaxMsgSize     = 64 * KiB // larger request bodies are not parsed for ActionMsg
+	auditMaxErrSize     = 512      // error message is truncated to this size
+	auditHashField      = `,"hash":"`
+)
+
+type (
+	auditRecord struct {
+		Time     time.Time  `json:"time"`
+		Daemon   string     `json:"daemon"`
+		User     string     `json:"user,omitempty"`
+		APIKey   string     `json:"apikey,omitempty"`
+		Remote   string     `json:"remote"`
+		Method   string     `json:"method"`
+		Path     string     `json:"path"`
+		Bucket   string     `json:"bucket,omitempty"`
+		Object   string     `json:"object,omitempty"`
+		Action   *ActionMsg `json:"action,omitempty"`
+		Status   int        `json:"status"`
+		Error    string     `json:"error,omitempty"`
+		PrevHash string     `json:"prev_hash,omitempty"`
+		Hash     string     `json:"hash,omitempty"` // must be the last field (see verifyAuditLog)
+	}
+	auditLog struct {
+		sync.Mutex
+		daemonID string
+		authn    *authManager
+		dir      string
+		maxSize  int64
+		maxFiles int
+		chain    bool
+		file     *os.File
+		size     int64
+		lastHash string
+	}
+	// auditWriter records the status and the error message of the response
+	auditWriter struct {
+		http.ResponseWriter
+		status int
+		errmsg []byte
+	}
+)
+
+func newAuditLog(daemonID string, authn *authManager) (*auditLog, error) {
+	conf := &ctx.config.Audit
+	a := &auditLog{
+		daemonID: daemonID,
+		authn:    authn,
+		dir:      conf.Dir,
+		maxSize:  int64(conf.MaxSize),
+		maxFiles: conf.MaxFiles,
+		chain:    conf.HashChain,
+	}
+	if a.dir == "" {
+		a.dir = filepath.Join(ctx.config.Log.Dir, "audit")
+	}
+	if a.maxSize == 0 {
+		a.maxSize = auditDefaultMaxSize
+	}
+	if err := CreateDir(a.dir); err != nil {
+		return nil, fmt.Errorf("Failed to create audit log dir %q, err: %v", a.dir, err)
+	}
+	if a.chain {
+		last, err := a.lastRecordHash()
+		if err != nil {
+			return nil, err
+		}
+		a.lastHash = last
+	}
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (h *httprunner) initAudit(authn *authManager) {
+	if !ctx.config.Audit.Enabled {
+		return
+	}
+	audit, err := newAuditLog(h.si.DaemonID, authn)
+	if err != nil {
+		glog.Fatalf("FATAL: audit log: %v", err)
+	}
+	h.audit = audit
+}
+
+func (a *auditLog) open() (err error) {
+	fqn := filepath.Join(a.dir, auditFileName)
+	if a.file, err = os.OpenFile(fqn, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600); err != nil {
+		return fmt.Errorf("Failed to open audit log %q, err: %v", fqn, err)
+	}
+	finfo, err := a.file.Stat()
+	if err != nil {
+		a.file.Close()
+		return fmt.Errorf("Failed to stat audit log %q, err: %v", fqn, err)
+	}
+	a.size = finfo.Size()
+	return nil
+}
+
+func (a *auditLog) close() {
+	a.Lock()
+	if a.file != nil {
+		a.file.Close()
+		a.file = nil
+	}
+	a.Unlock()
+}
+
+// rotatedFiles returns the names of rotated audit logs, oldest first
+func (a *auditLog) rotatedFiles() ([]string, error) {
+	names, err := filepath.Glob(filepath.Join(a.dir, auditFileName+".*"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names) // timestamps sort chronologically
+	return names, nil
+}
+
+// lastRecordHash returns the hash of the most recent record: from the current
+// log or, if it is empty, from the latest rotated one
+func (a *auditLog) lastRecordHash() (string, error) {
+	rotated, err := a.rotatedFiles()
+	if err != nil {
+		return "", err
+	}
+	files := append(rotated, filepath.Join(a.dir, auditFileName))
+	for i := len(files) - 1; i >= 0; i-- {
+		file, err := os.Open(files[i])
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return "", err
+		}
+		last := ""
+		err = readAuditLines(file, func(line []byte) error {
+			last = string(line)
+			return nil
+		})
+		file.Close()
+		if err != nil {
+			return "", fmt.Errorf("Failed to read audit log %q, err: %v", files[i], err)
+		}
+		if last != "" {
+			rec := &auditRecord{}
+			if err = json.Unmarshal([]byte(last), rec); err != nil {
+				return "", fmt.Errorf("Failed to parse the last record of audit log %q, err: %v", files[i], err)
+			}
+			return rec.Hash, nil
+		}
+	}
+	return "", nil
+}
+
+// rotate renames the current log and removes the oldest rotated ones;
+// the caller must hold the lock
+func (a *auditLog) rotate() error {
+	a.file.Close()
+	a.file = nil
+	fqn := filepath.Join(a.dir, auditFileName)
+	rotated := fqn + "." + time.Now().UTC().Format("20060102-150405.000000000")
+	if err := os.Rename(fqn, rotated); err != nil {
+		glog.Errorf("Failed to rotate audit log %q, err: %v", fqn, err)
+	}
+	if a.maxFiles > 0 {
+		if names, err := a.rotatedFiles(); err == nil && len(names) > a.maxFiles {
+			for _, name := range names[:len(names)-a.maxFiles] {
+				if err := os.Remove(name); err != nil {
+					glog.Errorf("Failed to remove audit log %q, err: %v", name, err)
+				}
+			}
+		}
+	}
+	return a.open()
+}
+
+// marshal returns the record as a line of the log; with hash chaining, the
+// hash is computed over the previous hash and the record without the hash
+func (a *auditLog) marshal(rec *auditRecord) ([]byte, error) {
+	rec.PrevHash, rec.Hash = "", ""
+	if !a.chain {
+		b, err := json.Marshal(rec)
+		return append(b, '\n'), err
+	}
+	rec.PrevHash = a.lastHash
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	rec.Hash = auditHash(rec.PrevHash, b)
+	line := make([]byte, 0, len(b)+len(auditHashField)+len(rec.Hash)+3)
+	line = append(line, b[:len(b)-1]...) // without the closing brace
+	line = append(line, auditHashField...)
+	line = append(line, rec.Hash...)
+	line = append(line, '"', '}', '\n')
+	return line, nil
+}
+
+func auditHash(prevHash string, record []byte) string {
+	h := sha256.New()
+	h.Write([]byte(prevHash))
+	h.Write(record)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (a *auditLog) write(rec *auditRecord) {
+	a.Lock()
+	defer a.Unlock()
+	if a.file == nil {
+		return
+	}
+	line, err := a.marshal(rec)
+	if err != nil {
+		glog.Errorf("Failed to marshal audit record %+v, err: %v", rec, err)
+		return
+	}
+	if a.size > 0 && a.size+int64(len(line)) > a.maxSize {
+		if err = a.rotate(); err != nil {
+			glog.Errorf("Failed to rotate audit log, err: %v", err)
+			return
+		}
+	}
+	n, err := a.file.Write(line)
+	a.size += int64(n)
+	if err != nil {
+		glog.Errorf("Failed to write audit record, err: %v", err)
+		return
+	}
+	if a.chain {
+		a.lastHash = rec.Hash
+	}
+}
+
+// verifyAuditLog verifies the hash chain of the records read from r, starting
+// from the given hash of the previous record (empty: the beginning of the chain);
+// returns the hash of the last record
+func verifyAuditLog(r io.Reader, prevHash string) (string, error) {
+	n := 0
+	err := readAuditLines(r, func(line []byte) error {
+		n++
+		rec := &auditRecord{}
+		if err := json.Unmarshal(line, rec); err != nil {
+			return fmt.Errorf("record #%d: %v", n, err)
+		}
+		if rec.PrevHash != prevHash {
+			return fmt.Errorf("record #%d: broken chain: previous hash %q, expected %q", n, rec.PrevHash, prevHash)
+		}
+		idx := bytes.LastIndex(line, []byte(auditHashField))
+		if idx < 0 || rec.Hash == "" {
+			return fmt.Errorf("record #%d: no hash", n)
+		}
+		record := append(append([]byte{}, line[:idx]...), '}')
+		if auditHash(prevHash, record) != rec.Hash {
+			return fmt.Errorf("record #%d: hash mismatch", n)
+		}
+		prevHash = rec.Hash
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return prevHash, nil
+}
+
+// readAuditLines calls fn for each non-empty line (record) read from r; the
+// records are not limited in size (see auditRecord), and neither are the lines
+func readAuditLines(r io.Reader, fn func(line []byte) error) error {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if line = bytes.TrimRight(line, "\r\n"); len(line) != 0 {
+			if errfn := fn(line); errfn != nil {
+				return errfn
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+//
+// http
+//
+
+func (w *auditWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *auditWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.status >= http.StatusBadRequest && len(w.errmsg) < auditMaxErrSize {
+		l := auditMaxErrSize - len(w.errmsg)
+		if l > len(b) {
+			l = len(b)
+		}
+		w.errmsg = append(w.errmsg, b[:l]...)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// peekActionMsg returns the request's ActionMsg, if any; the body is restored
+// for the handler. Object PUT bodies are data and are not read
+func peekActionMsg(r *http.Request, items []string) *ActionMsg {
+	if r.Body == nil || r.Body == http.NoBody || (r.Method == http.MethodPut && items[1] == Robjects) {
+		return nil
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(r.Body, auditMaxMsgSize))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(b), r.Body), r.Body}
+	if err != nil || len(b) == 0 || len(b) == auditMaxMsgSize {
+		return nil
+	}
+	msg := &ActionMsg{}
+	if err = json.Unmarshal(b, msg); err != nil || msg.Action == "" {
+		return nil
+	}
+	return msg
+}
+
+// user returns the user of the request: by the token or, with no token (the
+// target), by the redirect signed by the proxy (see redirectAuth)
+func (a *auditLog) user(r *http.Request) *authRec {
+	s := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(s) != 2 || s[0] != tokenStart {
+		auth, _ := redirectAuth(r)
+		return auth
+	}
+	if a.authn == nil {
+		return nil
+	}
+	auth, err := a.authn.validateToken(s[1])
+	if err != nil {
+		return nil
+	}
+	return auth
+}
+
+// handler records mutating client requests; the path alone (see isIntraCluster)
+// does not make a request intra-cluster - only the daemon's certificate or
+// signature does
+func (a *auditLog) handler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || peerDaemonID(r.TLS) != "" || signedDaemonID(r) != "" {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		rec := &auditRecord{
+			Time:   time.Now(),
+			Daemon: a.daemonID,
+			Remote: r.RemoteAddr,
+			Method: r.Method,
+			Path:   r.URL.Path,
+		}
+		items := strings.SplitN(strings.Trim(r.URL.Path, "/"), "/", 4)
+		if len(items) >= 2 {
+			if items[1] == Rbuckets || items[1] == Robjects {
+				if len(items) > 2 {
+					rec.Bucket = items[2]
+				}
+				if len(items) > 3 && items[1] == Robjects {
+					rec.Object = items[3]
+				}
+			}
+			rec.Action = peekActionMsg(r, items)
+		}
+		if auth := a.user(r); auth != nil {
+			rec.User, rec.APIKey = auth.userID, auth.apikey
+		}
+
+		aw := &auditWriter{ResponseWriter: w}
+		handler.ServeHTTP(aw, r)
+
+		rec.Status = aw.status
+		if rec.Status == 0 {
+			rec.Status = http.StatusOK
+		}
+		if len(aw.errmsg) != 0 {
+			rec.Error = strings.TrimSpace(string(aw.errmsg))
+		}
+		a.write(rec)
+	})
+}
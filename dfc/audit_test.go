@@ -0,0 +1,202 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func withAuditConfig(t *testing.T, conf auditconf) (dir string, cleanup func()) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldconf := ctx.config.Audit
+	conf.Dir = dir
+	ctx.config.Audit = conf
+	return dir, func() {
+		ctx.config.Audit = oldconf
+		os.RemoveAll(dir)
+	}
+}
+
+// auditFiles returns rotated logs, oldest first, and the current log
+func auditFiles(t *testing.T, a *auditLog) []string {
+	files, err := a.rotatedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(files, filepath.Join(a.dir, auditFileName))
+}
+
+func readAuditRecords(t *testing.T, fqn string) (recs []*auditRecord) {
+	b, err := ioutil.ReadFile(fqn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readAuditLines(bytes.NewReader(b), func(line []byte) error {
+		rec := &auditRecord{}
+		if err := json.Unmarshal(line, rec); err != nil {
+			t.Fatalf("Invalid audit record %q: %v", line, err)
+		}
+		recs = append(recs, rec)
+		return nil
+	})
+	return
+}
+
+func TestAuditLogHashChain(t *testing.T) {
+	_, cleanup := withAuditConfig(t, auditconf{MaxSize: 2 * KiB, MaxFiles: 3, HashChain: true, Enabled: true})
+	defer cleanup()
+
+	a, err := newAuditLog("target1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(n int) {
+		for i := 0; i < n; i++ {
+			a.write(&auditRecord{
+				Time:   time.Now(),
+				Daemon: "target1",
+				Method: http.MethodDelete,
+				Path:   fmt.Sprintf("/v1/objects/bucket/obj%d", i),
+				Action: &ActionMsg{Action: ActDelete, Value: map[string]interface{}{"objnames": []string{"a", "b"}}},
+				Status: http.StatusOK,
+			})
+		}
+	}
+	write(50)
+	// a record larger than any read buffer
+	a.write(&auditRecord{Time: time.Now(), Method: http.MethodPut, Path: "/v1/objects/bucket/" + strings.Repeat("x", 256*KiB)})
+	a.close()
+
+	// restart: the chain continues
+	if a, err = newAuditLog("target1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if a.lastHash == "" {
+		t.Error("Restarted audit log lost the hash of the last record")
+	}
+	write(1)
+	a.close()
+
+	files := auditFiles(t, a)
+	if len(files) != 4 {
+		t.Fatalf("Expected 3 rotated logs and the current one, got %v", files)
+	}
+	prevHash := readAuditRecords(t, files[0])[0].PrevHash
+	if prevHash == "" {
+		t.Error("Oldest rotated logs were not removed")
+	}
+	for _, fqn := range files {
+		file, err := os.Open(fqn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prevHash, err = verifyAuditLog(file, prevHash)
+		file.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", fqn, err)
+		}
+	}
+
+	// tampering
+	fqn := files[0]
+	b, err := ioutil.ReadFile(fqn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recs := readAuditRecords(t, fqn)
+	for _, tampered := range [][]byte{
+		bytes.Replace(b, []byte("obj"), []byte("xyz"), 1),                   // modified record
+		b[bytes.IndexByte(b, '\n')+1:],                                      // removed record
+		bytes.Replace(b, []byte(`"status":200`), []byte(`"status":403`), 1), // modified result
+	} {
+		if _, err = verifyAuditLog(bytes.NewReader(tampered), recs[0].PrevHash); err == nil {
+			t.Error("Tampered audit log passed verification")
+		}
+	}
+}
+
+func TestAuditHandler(t *testing.T) {
+	dir, cleanup := withAuditConfig(t, auditconf{Enabled: true})
+	defer cleanup()
+
+	a, err := newAuditLog("proxy1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body string
+	handler := a.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+		if strings.HasPrefix(r.URL.Path, "/v1/buckets/") {
+			http.Error(w, "bucket does not exist", http.StatusNotFound)
+		}
+	}))
+
+	ctx.config.Auth.Secret = "aBitLongSecretKey"
+	redirected := signRedirect("/v1/objects/bucket/redirected", http.MethodDelete, "bucket",
+		&authRec{userID: "u", role: AuthRoleWriter})
+	requests := []struct {
+		method, path, body, peer string
+	}{
+		{http.MethodGet, "/v1/objects/bucket/obj", "", ""},
+		{http.MethodPut, "/v1/daemon/metasync", "{}", "target1"},
+		{http.MethodPut, "/v1/daemon/metasync", "{}", ""}, // without certificate: not a daemon
+		{http.MethodPut, "/v1/objects/bucket/dir/obj", `{"action":"not-an-action-msg"}`, ""},
+		{http.MethodPost, "/v1/buckets/nobucket", `{"action":"renamelb","name":"newbucket"}`, ""},
+		{http.MethodDelete, redirected, "", ""}, // the target: the user of the redirect signed by the proxy
+	}
+	for _, req := range requests {
+		r := httptest.NewRequest(req.method, req.path, strings.NewReader(req.body))
+		r.RemoteAddr = "10.0.0.2:12345"
+		if req.peer != "" {
+			cert := &x509.Certificate{Subject: pkix.Name{CommonName: req.peer}}
+			r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		if body != req.body {
+			t.Errorf("%s %s: the handler got body %q, expected %q", req.method, req.path, body, req.body)
+		}
+	}
+	a.close()
+
+	recs := readAuditRecords(t, filepath.Join(dir, auditFileName))
+	if len(recs) != 4 {
+		t.Fatalf("Expected 4 audit records, got %d", len(recs))
+	}
+	metasync, put, post, del := recs[0], recs[1], recs[2], recs[3]
+	if metasync.Path != "/v1/daemon/metasync" || metasync.Method != http.MethodPut {
+		t.Errorf("Invalid metasync record: %+v", metasync)
+	}
+	if put.Bucket != "bucket" || put.Object != "dir/obj" || put.Action != nil || put.Status != http.StatusOK {
+		t.Errorf("Invalid PUT record: %+v", put)
+	}
+	if post.Bucket != "nobucket" || post.Action == nil || post.Action.Action != ActRenameLB || post.Action.Name != "newbucket" {
+		t.Errorf("Invalid POST record: %+v", post)
+	}
+	if post.Status != http.StatusNotFound || post.Error != "bucket does not exist" || post.Remote != "10.0.0.2:12345" {
+		t.Errorf("Invalid POST result: %+v", post)
+	}
+	if post.Daemon != "proxy1" || post.Hash != "" {
+		t.Errorf("Invalid POST record: %+v", post)
+	}
+	if del.User != "u" || del.Object != "redirected" {
+		t.Errorf("Invalid redirected DELETE record: %+v", del)
+	}
+}
@@ -21,13 +21,37 @@
 //      GCP: credentials from memory saved to file <config.Auth.CredDir>/<ProvideGoogle>/<UserID>.json.
 //	    Then GCP session is intialized with the file content (GCP API does
 //          not have a way to load credentials from memory)
+//    - The token carries the user's role (admin, writer, reader) and per-bucket
+//      grants: the proxy checks them against the permissions the request requires
+//      (read, write, delete, bucket admin, cluster admin) - see requestPerms;
+//      targets do the same, and only the daemons of the cluster (see isPeerDaemon)
+//      are exempt from presenting a token
+//    - Daemons sign the requests they send to each other with the secret they
+//      share with AuthN (see daemonSigner)
+//    - HTTP clients drop the token when redirected to another host: the proxy
+//      signs the redirect location with the user and the role instead (see
+//      signRedirect) so that the target can authorize the redirected request
+//    - Service accounts use long-lived API keys instead of tokens: an API key
+//      is a token with the "apikey" claim that may have no expiration time;
+//      API keys are validated, cached and revoked exactly like tokens
 // 3. If anything goes wrong: no user credentials found, invalid credentials
 //    format etc then default session is created (as if AuthN is disabled)
 package dfc
 
 import (
+	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -55,10 +79,33 @@ type (
 		issued  time.Time
 		expires time.Time
 		creds   simplekvs
+		role    string
+		buckets simplekvs // per-bucket grants: bucket name => role
+		apikey  string    // ID of the service account's API key (empty for user tokens)
 	}
 
 	authList map[string]*authRec
 
+	// a permission the request requires on a bucket
+	authCheck struct {
+		bucket string
+		perm   authPerm
+	}
+
+	// daemonSigner signs the intra-cluster requests (see signRequest)
+	daemonSigner struct {
+		http.RoundTripper
+		h *httprunner
+	}
+
+	// authRedirectWriter signs the redirect location (see signRedirect)
+	authRedirectWriter struct {
+		http.ResponseWriter
+		method string
+		bucket string
+		auth   *authRec
+	}
+
 	authManager struct {
 		sync.Mutex
 		// cache of decrypted tokens
@@ -69,6 +116,30 @@ type (
 	}
 )
 
+const (
+	// how long the redirect signed by the proxy is valid
+	authRedirectTime = time.Minute
+	// ditto, the request signed by the daemon (either way, to allow for the clocks skew)
+	authDaemonTime = time.Minute
+)
+
+// Access permissions (bitmask) required by operations when AuthN is enabled
+type authPerm int
+
+const (
+	permRead         authPerm = 1 << iota // GET/HEAD objects and buckets
+	permWrite                             // PUT, rename, copy etc.
+	permDelete                            // delete and evict objects
+	permBucketAdmin                       // create, destroy, rename local buckets, set bucket props
+	permClusterAdmin                      // cluster-wide operations: shutdown, setconfig, rebalance etc.
+)
+
+var authRolePerms = map[string]authPerm{
+	AuthRoleReader: permRead,
+	AuthRoleWriter: permRead | permWrite | permDelete,
+	AuthRoleAdmin:  permRead | permWrite | permDelete | permBucketAdmin | permClusterAdmin,
+}
+
 // Decrypts JWT token and returns all encrypted information.
 // Used by proxy - to check a user access and token validity(e.g, expiration),
 // and by target - only to get a user name for AWS/GCP access
@@ -102,10 +173,13 @@ func decryptToken(tokenStr string) (*authRec, error) {
 	if rec.issued, err = time.Parse(time.RFC822, issueStr); err != nil {
 		return nil, invalTokenErr
 	}
-	if expireStr, ok = claims["expires"].(string); !ok {
-		return nil, invalTokenErr
-	}
-	if rec.expires, err = time.Parse(time.RFC822, expireStr); err != nil {
+	rec.apikey, _ = claims["apikey"].(string)
+	if expireStr, ok = claims["expires"].(string); ok {
+		if rec.expires, err = time.Parse(time.RFC822, expireStr); err != nil {
+			return nil, invalTokenErr
+		}
+	} else if rec.apikey == "" {
+		// only API keys can be issued without expiration time
 		return nil, invalTokenErr
 	}
 	rec.creds = make(simplekvs, 0)
@@ -120,10 +194,124 @@ func decryptToken(tokenStr string) (*authRec, error) {
 	} else {
 		glog.Info("Token for %s does not contain credentials", rec.userID)
 	}
+	// tokens issued before the roles were introduced grant the default role
+	if rec.role, ok = claims["role"].(string); !ok || rec.role == "" {
+		rec.role = AuthRoleWriter
+	}
+	rec.buckets = make(simplekvs, 0)
+	if bb, ok := claims["buckets"].(map[string]interface{}); ok {
+		for bucket, value := range bb {
+			if role, ok := value.(string); ok {
+				rec.buckets[bucket] = role
+			} else {
+				glog.Warningf("Role is not string: %v [%T]", value, value)
+			}
+		}
+	}
 
 	return rec, nil
 }
 
+// API keys may never expire (zero expiration time)
+func (rec *authRec) isExpired() bool {
+	return !rec.expires.IsZero() && rec.expires.Before(time.Now())
+}
+
+// Checks if the token grants the permission(s) on the bucket: a per-bucket
+// grant overrides the user's role for the bucket. Cluster-wide operations
+// are checked with empty bucket, so they require the user's role to be admin
+func (rec *authRec) allowed(bucket string, perm authPerm) bool {
+	role := rec.role
+	if grant, ok := rec.buckets[bucket]; ok && bucket != "" {
+		role = grant
+	}
+	return authRolePerms[role]&perm == perm
+}
+
+// Returns the permissions required to execute a request: one check per
+// bucket the request touches. Nil means that the request is not subject to
+// authorization (e.g., intra-cluster control plane).
+// Bucket and object actions are read from the request body that is then
+// restored for the handler
+func requestPerms(r *http.Request) (checks []authCheck, err error) {
+	items := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(items) < 2 {
+		return nil, nil
+	}
+	if items[1] == Rcluster {
+		if r.Method == http.MethodPut {
+			checks = []authCheck{{perm: permClusterAdmin}}
+		}
+		return
+	}
+	// PUT /Rversion/Rdaemon: setconfig, shutdown etc. (the sub-paths are intra-cluster)
+	if items[1] == Rdaemon {
+		if r.Method == http.MethodPut && len(items) == 2 {
+			checks = []authCheck{{perm: permClusterAdmin}}
+		}
+		return
+	}
+	if items[1] != Rbuckets && items[1] != Robjects {
+		return nil, nil
+	}
+	bucket := ""
+	if len(items) > 2 {
+		bucket = items[2]
+	}
+	switch {
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		return []authCheck{{bucket, permRead}}, nil
+	case r.Method == http.MethodPut && items[1] == Robjects:
+		return []authCheck{{bucket, permWrite}}, nil
+	case r.Method == http.MethodPut:
+		return []authCheck{{bucket, permBucketAdmin}}, nil
+	case r.Method == http.MethodDelete && items[1] == Robjects:
+		return []authCheck{{bucket, permDelete}}, nil
+	}
+
+	msg := &ActionMsg{}
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewBuffer(b))
+	if len(b) != 0 {
+		if err = json.Unmarshal(b, msg); err != nil {
+			return nil, fmt.Errorf("Failed to json-unmarshal %s request, err: %v", r.Method, err)
+		}
+	}
+	switch msg.Action {
+	case ActCreateLB, ActDestroyLB, ActSyncLB, ActSetProps:
+		checks = []authCheck{{bucket, permBucketAdmin}}
+	case ActRenameLB:
+		checks = []authCheck{{bucket, permBucketAdmin}, {msg.Name, permBucketAdmin}}
+	case ActDelete, ActEvict:
+		checks = []authCheck{{bucket, permDelete}}
+	case ActPrefetch, ActBatchGet:
+		checks = []authCheck{{bucket, permRead}}
+	case ActCopy:
+		checks = []authCheck{{bucket, permRead}}
+		if bucketTo, ok := msg.Value.(string); ok && bucketTo != "" {
+			checks = append(checks, authCheck{bucketTo, permWrite})
+		} else {
+			checks = append(checks, authCheck{bucket, permWrite})
+		}
+	case ActCopyBucket:
+		checks = []authCheck{{bucket, permRead}, {msg.Name, permWrite}}
+	case ActDsort:
+		checks = []authCheck{{bucket, permRead}}
+		if jsmap, ok := msg.Value.(map[string]interface{}); ok {
+			if bucketTo, ok := jsmap["output_bucket"].(string); ok {
+				checks = append(checks, authCheck{bucketTo, permWrite})
+			}
+		}
+	default:
+		// rename, undelete, compose, inventory etc.
+		checks = []authCheck{{bucket, permWrite}}
+	}
+	return
+}
+
 // Retreives a string from context field or empty string if nothing found or
 //   the field is not of string type
 func getStringFromContext(ct context.Context, fieldName contextID) string {
@@ -169,7 +357,7 @@ func (a *authManager) updateRevokedList(tokens *TokenList) {
 	// clean up the list from obsolete data
 	for token := range a.revokedTokens {
 		rec, err := a.extractTokenData(token)
-		if err == nil && rec.expires.Before(time.Now()) {
+		if err == nil && rec.isExpired() {
 			delete(a.revokedTokens, token)
 		}
 	}
@@ -180,6 +368,7 @@ func (a *authManager) updateRevokedList(tokens *TokenList) {
 //   - must not be revoked one
 //   - must not be expired
 //   - must have all mandatory fields: userID, creds, issued, expires
+//     (API keys may have no expiration time)
 // Returns decrypted token information if it is valid
 func (a *authManager) validateToken(token string) (ar *authRec, err error) {
 	a.Lock()
@@ -215,7 +404,7 @@ func (a *authManager) extractTokenData(token string) (*authRec, error) {
 		return nil, fmt.Errorf("Invalid token")
 	}
 
-	if auth.expires.Before(time.Now()) {
+	if auth.isExpired() {
 		glog.Errorf("Expired token was used: %s", token)
 		delete(a.tokens, token)
 		return nil, fmt.Errorf("Token expired")
@@ -223,3 +412,146 @@ func (a *authManager) extractTokenData(token string) (*authRec, error) {
 
 	return auth, nil
 }
+
+func redirectSignature(method, path, user, role, grant, expires string) string {
+	mac := hmac.New(sha256.New, []byte(ctx.config.Auth.Secret))
+	mac.Write([]byte(strings.Join([]string{method, path, user, role, grant, expires}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signRedirect adds the user the request has been authorized for to the
+// redirect location, along with the signature that the target verifies
+// (see redirectAuth)
+func signRedirect(location, method, bucket string, auth *authRec) string {
+	u, err := url.Parse(location)
+	if err != nil {
+		return location
+	}
+	var (
+		query   = u.Query()
+		expires = strconv.FormatInt(time.Now().Add(authRedirectTime).Unix(), 10)
+		grant   = auth.buckets[bucket]
+	)
+	query.Set(URLParamAuthUser, auth.userID)
+	query.Set(URLParamAuthRole, auth.role)
+	if grant != "" {
+		query.Set(URLParamAuthGrant, grant)
+	} else {
+		query.Del(URLParamAuthGrant)
+	}
+	query.Set(URLParamAuthExpires, expires)
+	query.Set(URLParamAuthSig, redirectSignature(method, u.Path, auth.userID, auth.role, grant, expires))
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// redirectAuth returns the user of the redirect signed by the proxy, nil if
+// the request has not been redirected
+func redirectAuth(r *http.Request) (*authRec, error) {
+	query := r.URL.Query()
+	sig := query.Get(URLParamAuthSig)
+	if sig == "" {
+		return nil, nil
+	}
+	var (
+		user, role = query.Get(URLParamAuthUser), query.Get(URLParamAuthRole)
+		grant      = query.Get(URLParamAuthGrant)
+		expires    = query.Get(URLParamAuthExpires)
+	)
+	expected := redirectSignature(r.Method, r.URL.Path, user, role, grant, expires)
+	if !hmac.Equal([]byte(sig), []byte(expected)) {
+		return nil, errors.New("Invalid redirect signature")
+	}
+	secs, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > secs {
+		return nil, errors.New("Redirect signature expired")
+	}
+	rec := &authRec{userID: user, role: role, buckets: make(simplekvs, 1), expires: time.Unix(secs, 0)}
+	if bucket := requestBucket(r); grant != "" && bucket != "" {
+		rec.buckets[bucket] = grant
+	}
+	return rec, nil
+}
+
+func (w *authRedirectWriter) WriteHeader(status int) {
+	if status >= http.StatusMultipleChoices && status < http.StatusBadRequest {
+		if location := w.Header().Get("Location"); location != "" {
+			w.Header().Set("Location", signRedirect(location, w.method, w.bucket, w.auth))
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// requestBucket returns the bucket of a /Rversion/Robjects or /Rversion/Rbuckets request
+func requestBucket(r *http.Request) string {
+	apitems := strings.SplitN(strings.Trim(r.URL.Path, "/"), "/", 4)
+	if len(apitems) < 3 || apitems[0] != Rversion || (apitems[1] != Robjects && apitems[1] != Rbuckets) {
+		return ""
+	}
+	if apitems[2] == "*" { // all buckets
+		return ""
+	}
+	return apitems[2]
+}
+
+func daemonSignature(method, path, daemonID, signed string) string {
+	// keyed apart from the redirects (see redirectSignature)
+	mac := hmac.New(sha256.New, []byte("daemon:"+ctx.config.Auth.Secret))
+	mac.Write([]byte(strings.Join([]string{method, path, daemonID, signed}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signRequest adds this daemon's ID and signature to the request
+// that it sends to another daemon of the cluster (see signedDaemonID)
+func (h *httprunner) signRequest(r *http.Request) {
+	if !ctx.config.Auth.Enabled {
+		return
+	}
+	signed := strconv.FormatInt(time.Now().Unix(), 10)
+	r.Header.Set(HeaderDfcDaemonID, h.si.DaemonID)
+	r.Header.Set(HeaderDfcDaemonTime, signed)
+	r.Header.Set(HeaderDfcDaemonSig, daemonSignature(r.Method, r.URL.Path, h.si.DaemonID, signed))
+}
+
+// signedDaemonID returns the ID of the daemon that has signed the request,
+// empty string if the request is not signed or the signature is invalid
+func signedDaemonID(r *http.Request) string {
+	sig := r.Header.Get(HeaderDfcDaemonSig)
+	if sig == "" || !ctx.config.Auth.Enabled {
+		return ""
+	}
+	daemonID, signed := r.Header.Get(HeaderDfcDaemonID), r.Header.Get(HeaderDfcDaemonTime)
+	expected := daemonSignature(r.Method, r.URL.Path, daemonID, signed)
+	if daemonID == "" || !hmac.Equal([]byte(sig), []byte(expected)) {
+		return ""
+	}
+	secs, err := strconv.ParseInt(signed, 10, 64)
+	if err != nil {
+		return ""
+	}
+	if skew := time.Since(time.Unix(secs, 0)); skew > authDaemonTime || skew < -authDaemonTime {
+		return ""
+	}
+	return daemonID
+}
+
+// isPeerDaemon returns true if the request comes from a daemon of the cluster: the
+// peer has presented its (verified) certificate (see mtls.go), or signed the request
+func (h *httprunner) isPeerDaemon(r *http.Request) bool {
+	return peerDaemonID(r.TLS) != "" || signedDaemonID(r) != ""
+}
+
+func (s *daemonSigner) RoundTrip(r *http.Request) (*http.Response, error) {
+	if !ctx.config.Auth.Enabled {
+		return s.RoundTripper.RoundTrip(r)
+	}
+	// not to modify the caller's request
+	signed := new(http.Request)
+	*signed = *r
+	signed.Header = make(http.Header, len(r.Header)+3)
+	for k, v := range r.Header {
+		signed.Header[k] = v
+	}
+	s.h.signRequest(signed)
+	return s.RoundTripper.RoundTrip(signed)
+}
@@ -0,0 +1,232 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+type nopStats struct{}
+
+func (s nopStats) add(name string, val int64)     {}
+func (s nopStats) addMany(nameval ...interface{}) {}
+
+func TestAuthAllowed(t *testing.T) {
+	reader := &authRec{userID: "r", role: AuthRoleReader, buckets: simplekvs{"rw": AuthRoleWriter, "own": AuthRoleAdmin}}
+	writer := &authRec{userID: "w", role: AuthRoleWriter, buckets: simplekvs{"ro": AuthRoleReader}}
+	admin := &authRec{userID: "a", role: AuthRoleAdmin}
+	tests := []struct {
+		rec    *authRec
+		bucket string
+		perm   authPerm
+		ok     bool
+	}{
+		{reader, "any", permRead, true},
+		{reader, "any", permWrite, false},
+		{reader, "rw", permWrite, true},
+		{reader, "rw", permDelete, true},
+		{reader, "rw", permBucketAdmin, false},
+		{reader, "own", permBucketAdmin, true},
+		{reader, "", permClusterAdmin, false},
+		{writer, "any", permDelete, true},
+		{writer, "ro", permWrite, false},
+		{writer, "any", permBucketAdmin, false},
+		{writer, "", permClusterAdmin, false},
+		{admin, "any", permBucketAdmin, true},
+		{admin, "", permClusterAdmin, true},
+	}
+	for _, test := range tests {
+		if ok := test.rec.allowed(test.bucket, test.perm); ok != test.ok {
+			t.Errorf("%s (%s) on %q, perm %d: expected %v, got %v", test.rec.userID, test.rec.role, test.bucket, test.perm, test.ok, ok)
+		}
+	}
+}
+
+func TestRequestPerms(t *testing.T) {
+	tests := []struct {
+		method, path, body string
+		checks             []authCheck
+	}{
+		{http.MethodGet, "/v1/objects/b/o", "", []authCheck{{"b", permRead}}},
+		{http.MethodGet, "/v1/buckets/*", "", []authCheck{{"*", permRead}}},
+		{http.MethodPut, "/v1/objects/b/o", "data", []authCheck{{"b", permWrite}}},
+		{http.MethodDelete, "/v1/objects/b/o", "", []authCheck{{"b", permDelete}}},
+		{http.MethodPut, "/v1/buckets/b", `{"action": "setprops"}`, []authCheck{{"b", permBucketAdmin}}},
+		{http.MethodDelete, "/v1/buckets/b", `{"action": "destroylb"}`, []authCheck{{"b", permBucketAdmin}}},
+		{http.MethodDelete, "/v1/buckets/b", `{"action": "delete", "value": {"prefix": "x"}}`, []authCheck{{"b", permDelete}}},
+		{http.MethodPost, "/v1/buckets/b", `{"action": "renamelb", "name": "c"}`, []authCheck{{"b", permBucketAdmin}, {"c", permBucketAdmin}}},
+		{http.MethodPost, "/v1/buckets/b", `{"action": "copybck", "name": "c"}`, []authCheck{{"b", permRead}, {"c", permWrite}}},
+		{http.MethodPost, "/v1/objects/b/o", `{"action": "copy", "value": "c"}`, []authCheck{{"b", permRead}, {"c", permWrite}}},
+		{http.MethodPost, "/v1/objects/b/o", `{"action": "rename", "name": "o2"}`, []authCheck{{"b", permWrite}}},
+		{http.MethodPut, "/v1/cluster", `{"action": "shutdown"}`, []authCheck{{"", permClusterAdmin}}},
+		{http.MethodPost, "/v1/cluster", `{}`, nil},
+		{http.MethodGet, "/v1/daemon", "", nil},
+		{http.MethodPut, "/v1/daemon", `{"action": "setconfig", "name": "loglevel", "value": "4"}`, []authCheck{{"", permClusterAdmin}}},
+		{http.MethodPut, "/v1/daemon/metasync", `{}`, nil},
+	}
+	for _, test := range tests {
+		r, err := http.NewRequest(test.method, "http://localhost:8080"+test.path, bytes.NewBufferString(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		checks, err := requestPerms(r)
+		if err != nil {
+			t.Errorf("%s %s: unexpected error %v", test.method, test.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(checks, test.checks) {
+			t.Errorf("%s %s %s: expected %v, got %v", test.method, test.path, test.body, test.checks, checks)
+		}
+		// the body must be left for the handler
+		if b, _ := ioutil.ReadAll(r.Body); string(b) != test.body {
+			t.Errorf("%s %s: expected body %q, got %q", test.method, test.path, test.body, string(b))
+		}
+	}
+}
+
+func TestDecryptAPIKey(t *testing.T) {
+	ctx.config.Auth.Secret = "aBitLongSecretKey"
+	sign := func(claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(ctx.config.Auth.Secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	issued := time.Now().Format(time.RFC822)
+
+	// API key without expiration time
+	rec, err := decryptToken(sign(jwt.MapClaims{"username": "svc", "issued": issued, "apikey": "01ab", "role": AuthRoleReader}))
+	if err != nil {
+		t.Fatalf("Failed to decrypt API key: %v", err)
+	}
+	if rec.apikey != "01ab" || rec.role != AuthRoleReader || rec.isExpired() {
+		t.Errorf("Invalid API key: %+v", rec)
+	}
+	// user token without expiration time is invalid
+	if _, err = decryptToken(sign(jwt.MapClaims{"username": "user", "issued": issued})); err == nil {
+		t.Error("Token without expiration time was accepted")
+	}
+	// API key with expiration time
+	expired := time.Now().Add(-time.Hour).Format(time.RFC822)
+	rec, err = decryptToken(sign(jwt.MapClaims{"username": "svc", "issued": issued, "expires": expired, "apikey": "02cd"}))
+	if err != nil {
+		t.Fatalf("Failed to decrypt API key: %v", err)
+	}
+	if !rec.isExpired() || rec.role != AuthRoleWriter {
+		t.Errorf("Expected expired API key with default role: %+v", rec)
+	}
+}
+
+func TestRedirectAuth(t *testing.T) {
+	ctx.config.Auth.Secret = "aBitLongSecretKey"
+	auth := &authRec{userID: "u", role: AuthRoleReader, buckets: simplekvs{"b": AuthRoleWriter}}
+	location := signRedirect("http://target:8081/v1/objects/b/o?local=false", http.MethodPut, "b", auth)
+
+	r := httptest.NewRequest(http.MethodPut, location, nil)
+	rec, err := redirectAuth(r)
+	if err != nil || rec == nil {
+		t.Fatalf("Failed to verify signed redirect %s: %v", location, err)
+	}
+	if rec.userID != "u" || rec.role != AuthRoleReader || !rec.allowed("b", permWrite) || rec.allowed("c", permWrite) {
+		t.Errorf("Invalid user of the signed redirect: %+v", rec)
+	}
+	if r.URL.Query().Get(URLParamLocal) != "false" {
+		t.Errorf("Redirect lost query parameters: %s", location)
+	}
+	// not redirected
+	if rec, err = redirectAuth(httptest.NewRequest(http.MethodGet, "/v1/objects/b/o", nil)); rec != nil || err != nil {
+		t.Errorf("Expected no user, got %+v, %v", rec, err)
+	}
+	// other method, other object, elevated role, expired
+	u, _ := url.Parse(location)
+	expired := u.Query()
+	expired.Set(URLParamAuthExpires, strconv.FormatInt(time.Now().Add(-time.Second).Unix(), 10))
+	expired.Set(URLParamAuthSig, redirectSignature(http.MethodPut, u.Path, "u", AuthRoleReader, AuthRoleWriter, expired.Get(URLParamAuthExpires)))
+	elevated := u.Query()
+	elevated.Set(URLParamAuthRole, AuthRoleAdmin)
+	for _, r := range []*http.Request{
+		httptest.NewRequest(http.MethodDelete, location, nil),
+		httptest.NewRequest(http.MethodPut, "/v1/objects/b/o2?"+u.RawQuery, nil),
+		httptest.NewRequest(http.MethodPut, u.Path+"?"+elevated.Encode(), nil),
+		httptest.NewRequest(http.MethodPut, u.Path+"?"+expired.Encode(), nil),
+	} {
+		if rec, err = redirectAuth(r); err == nil {
+			t.Errorf("%s %s: expected error, got %+v", r.Method, r.URL, rec)
+		}
+	}
+}
+
+func TestTargetCheckHTTPAuth(t *testing.T) {
+	ctx.config.Auth.Secret = "aBitLongSecretKey"
+	ctx.config.Auth.Enabled = true
+	defer func() { ctx.config.Auth.Enabled = false }()
+	tr := &targetrunner{}
+	tr.si = &daemonInfo{DaemonID: "t1", DirectURL: "http://localhost:8081"}
+	tr.statsif = nopStats{}
+	tr.authn = &authManager{tokens: make(authList), revokedTokens: make(map[string]bool)}
+	handler := tr.checkHTTPAuth(func(w http.ResponseWriter, r *http.Request) {})
+	reader := &authRec{userID: "r", role: AuthRoleReader}
+
+	// requests signed by another daemon of the cluster (no mTLS)
+	peer := &httprunner{si: &daemonInfo{DaemonID: "p1"}}
+	signed := httptest.NewRequest(http.MethodPut, "/v1/objects/b/o", nil)
+	peer.signRequest(signed)
+	replayed := httptest.NewRequest(http.MethodDelete, "/v1/objects/b/o", nil)
+	replayed.Header = signed.Header
+	forged := httptest.NewRequest(http.MethodPut, "/v1/objects/b/o", nil)
+	forged.Header.Set(HeaderDfcDaemonID, "p1")
+	forged.Header.Set(HeaderDfcDaemonTime, strconv.FormatInt(time.Now().Unix(), 10))
+	forged.Header.Set(HeaderDfcDaemonSig, "0123456789abcdef")
+	tests := []struct {
+		r      *http.Request
+		status int
+	}{
+		{httptest.NewRequest(http.MethodGet, "/v1/objects/b/o", nil), http.StatusUnauthorized},
+		{httptest.NewRequest(http.MethodGet, signRedirect("/v1/objects/b/o", http.MethodGet, "b", reader), nil), http.StatusOK},
+		{httptest.NewRequest(http.MethodPut, signRedirect("/v1/objects/b/o", http.MethodPut, "b", reader), nil), http.StatusForbidden},
+		{signed, http.StatusOK},
+		{replayed, http.StatusUnauthorized},
+		{forged, http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		handler(w, test.r)
+		if w.Code != test.status {
+			t.Errorf("%s %s: expected %d, got %d", test.r.Method, test.r.URL, test.status, w.Code)
+		}
+	}
+
+	// intra-cluster client: signs every request
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	client := &http.Client{Transport: &daemonSigner{RoundTripper: http.DefaultTransport, h: peer}}
+	for _, path := range []string{"/v1/objects/b/o", "/v1/objects/b/dir/o%20o?local=true", "/v1/buckets/b"} {
+		request, err := http.NewRequest(http.MethodDelete, server.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, err := client.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			t.Errorf("Signed DELETE %s: expected %d, got %d", path, http.StatusOK, response.StatusCode)
+		}
+		if request.Header.Get(HeaderDfcDaemonSig) != "" {
+			t.Errorf("Signing modified the caller's request %s", path)
+		}
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -170,6 +171,9 @@ func (awsimpl *awsimpl) listbucket(ct context.Context, bucket string, msg *GetMs
 	if msg.GetPageMarker != "" {
 		params.Marker = aws.String(msg.GetPageMarker)
 	}
+	if msg.GetDelimiter != "" {
+		params.Delimiter = aws.String(msg.GetDelimiter)
+	}
 	if msg.GetPageSize != 0 {
 		if msg.GetPageSize > awsMaxPageSize {
 			glog.Warningf("AWS maximum page size is %d (%d requested). Returning the first %d keys",
@@ -239,6 +243,12 @@ func (awsimpl *awsimpl) listbucket(ct context.Context, bucket string, msg *GetMs
 		// TODO: other GetMsg props TBD
 		reslist.Entries = append(reslist.Entries, entry)
 	}
+	for _, cp := range resp.CommonPrefixes {
+		reslist.Entries = append(reslist.Entries, &BucketEntry{Name: *(cp.Prefix), Type: BucketEntryDirectory})
+	}
+	if len(resp.CommonPrefixes) > 0 {
+		sort.Slice(reslist.Entries, func(i, j int) bool { return reslist.Entries[i].Name < reslist.Entries[j].Name })
+	}
 	if glog.V(4) {
 		glog.Infof("listbucket count %d", len(reslist.Entries))
 	}
@@ -246,7 +256,11 @@ func (awsimpl *awsimpl) listbucket(ct context.Context, bucket string, msg *GetMs
 	if *resp.IsTruncated {
 		// For AWS, resp.NextMarker is only set when a query has a delimiter.
 		// Without a delimiter, NextMarker should be the last returned key.
-		reslist.PageMarker = reslist.Entries[len(reslist.Entries)-1].Name
+		if resp.NextMarker != nil && *resp.NextMarker != "" {
+			reslist.PageMarker = *resp.NextMarker
+		} else {
+			reslist.PageMarker = reslist.Entries[len(reslist.Entries)-1].Name
+		}
 	}
 
 	jsbytes, err = json.Marshal(reslist)
@@ -0,0 +1,529 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// Batch GET: POST {"action": "batchget", "value": {list or range, "format": ..., "missing": ..., "order": ...}} /v1/buckets/bucket-name
+//
+// The objects are specified the same way as for the other List/Range operations (ListMsg
+// or RangeMsg), the options - by BatchGetMsg. The proxy splits the list between the
+// owning targets (a range is resolved by each target on its own) and requests all the
+// targets at once. Each target responds with a tar stream of its share of objects,
+// cold-GETting non-cached objects of Cloud buckets beforehand, so that missing objects
+// are detected before anything is sent. The proxy then merges the targets' streams
+// into a single tar or zip archive on the fly.
+//
+// Once the response has started, a failure (e.g., an object removed in the meantime)
+// can only be reported by aborting the connection - the client then receives
+// a truncated archive and a read error rather than an archive that looks complete.
+
+type batchStream struct {
+	tid  string
+	body io.ReadCloser
+	tr   *tar.Reader
+	hdr  *tar.Header // next entry or nil when the stream is exhausted
+}
+
+// batchArchive is the archive assembled by the proxy (see BatchGetMsg.Format)
+type batchArchive interface {
+	add(hdr *tar.Header, r io.Reader) error
+	Close() error
+}
+
+type tarArchive struct {
+	tw *tar.Writer
+}
+
+type zipArchive struct {
+	zw *zip.Writer
+}
+
+func parseBatchGetMsg(jsmap map[string]interface{}) (bmsg *BatchGetMsg, errstr string) {
+	bmsg = &BatchGetMsg{Format: BatchFormatTar, Missing: BatchMissingError, Order: BatchOrderRequest}
+	for _, opt := range []struct {
+		name  string
+		value *string
+		enum  []string
+	}{
+		{"format", &bmsg.Format, []string{BatchFormatTar, BatchFormatZip}},
+		{"missing", &bmsg.Missing, []string{BatchMissingError, BatchMissingSkip}},
+		{"order", &bmsg.Order, []string{BatchOrderRequest, BatchOrderTarget}},
+	} {
+		v, ok := jsmap[opt.name]
+		if !ok {
+			continue
+		}
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Sprintf("Invalid batch GET %s (%v, %T)", opt.name, v, v)
+		}
+		if s == "" {
+			continue
+		}
+		valid := false
+		for _, e := range opt.enum {
+			valid = valid || s == e
+		}
+		if !valid {
+			return nil, fmt.Sprintf("Invalid batch GET %s %q, expecting one of: %v", opt.name, s, opt.enum)
+		}
+		*opt.value = s
+	}
+	return
+}
+
+//===========
+//
+// target
+//
+//===========
+
+// POST { action: batchget } /Rversion/Rbuckets/bucket-name
+func (t *targetrunner) batchget(w http.ResponseWriter, r *http.Request, msg ActionMsg) {
+	var (
+		objs   []string
+		ct     = t.contextWithAuth(r)
+		detail = fmt.Sprintf(" (%s, %s, %T)", msg.Action, msg.Name, msg.Value)
+	)
+	apitems := t.restAPIItems(r.URL.Path, 5)
+	if apitems = t.checkRestAPI(w, r, apitems, 1, Rversion, Rbuckets); apitems == nil {
+		return
+	}
+	bucket := apitems[0]
+	if !t.validatebckname(w, r, bucket) {
+		return
+	}
+	jsmap, ok := msg.Value.(map[string]interface{})
+	if !ok {
+		t.invalmsghdlr(w, r, "Unexpected ActionMsg.Value format"+detail)
+		return
+	}
+	bmsg, errstr := parseBatchGetMsg(jsmap)
+	if errstr != "" {
+		t.invalmsghdlr(w, r, errstr+detail)
+		return
+	}
+	if _, ok := jsmap["objnames"]; ok {
+		listMsg, errstr := parseListMsg(jsmap)
+		if errstr != "" {
+			t.invalmsghdlr(w, r, errstr+detail)
+			return
+		}
+		for _, objname := range listMsg.Objnames {
+			si, errstr := HrwTarget(bucket, objname, t.smap)
+			if errstr != "" {
+				t.invalmsghdlr(w, r, errstr)
+				return
+			}
+			if si.DaemonID == t.si.DaemonID {
+				objs = append(objs, objname)
+			}
+		}
+	} else {
+		rangeMsg, errstr := parseRangeMsg(jsmap)
+		if errstr != "" {
+			t.invalmsghdlr(w, r, errstr+detail)
+			return
+		}
+		min, max, err := parseRange(rangeMsg.Range)
+		if err != nil {
+			t.invalmsghdlr(w, r, fmt.Sprintf("Error parsing range string (%s): %v", rangeMsg.Range, err))
+			return
+		}
+		if objs, err = t.getListFromRange(ct, bucket, rangeMsg.Prefix, rangeMsg.Regex, min, max); err != nil {
+			t.invalmsghdlr(w, r, err.Error())
+			return
+		}
+		sort.Strings(objs)
+	}
+	if objs, errstr, errcode := t.batchresolve(ct, bucket, objs, bmsg); errstr != "" {
+		if errcode == 0 {
+			errcode = http.StatusInternalServerError
+		}
+		t.invalmsghdlr(w, r, errstr, errcode)
+	} else {
+		t.batchsend(w, bucket, objs, bmsg)
+	}
+}
+
+// batchresolve makes sure that the objects are stored locally (cold-GETting the non-cached
+// objects of a Cloud bucket) and returns those of them that exist
+func (t *targetrunner) batchresolve(ct context.Context, bucket string, objs []string,
+	bmsg *BatchGetMsg) (found []string, errstr string, errcode int) {
+	islocal := t.bmdowner.get().islocal(bucket)
+	found = make([]string, 0, len(objs))
+	for _, objname := range objs {
+		fqn := t.fqn(bucket, objname, islocal)
+		_, err := os.Stat(fqn)
+		if err == nil {
+			found = append(found, objname)
+			continue
+		}
+		if !os.IsNotExist(err) {
+			return nil, fmt.Sprintf("Failed to fstat %s (%s/%s), err: %v", fqn, bucket, objname, err), http.StatusInternalServerError
+		}
+		if !islocal {
+			var props *objectProps
+			// note: coldget() keeps the read lock if successful
+			if props, errstr, errcode = t.coldget(ct, bucket, objname, false); errstr == "" {
+				t.rtnamemap.unlockname(uniquename(bucket, objname), false)
+				t.statsif.add("bytesloaded", props.size)
+				found = append(found, objname)
+				continue
+			}
+			if errcode != http.StatusNotFound {
+				return
+			}
+			errstr, errcode = "", 0
+		}
+		if bmsg.Missing == BatchMissingError {
+			return nil, fmt.Sprintf("Batch GET: %s/%s %s", bucket, objname, doesnotexist), http.StatusNotFound
+		}
+		if glog.V(4) {
+			glog.Infof("Batch GET: skipping %s/%s (%s)", bucket, objname, doesnotexist)
+		}
+	}
+	return
+}
+
+// batchsend streams the objects as a tar archive
+func (t *targetrunner) batchsend(w http.ResponseWriter, bucket string, objs []string, bmsg *BatchGetMsg) {
+	var (
+		started = time.Now()
+		nbytes  int64
+		count   int64
+	)
+	w.Header().Set("Content-Type", "application/x-tar")
+	tw := tar.NewWriter(w)
+	for _, objname := range objs {
+		size, errstr := t.batchsendone(tw, bucket, objname, bmsg)
+		if errstr != "" {
+			glog.Errorln(errstr)
+			t.statsif.add("numerr", 1)
+			panic(http.ErrAbortHandler)
+		}
+		if size >= 0 {
+			nbytes += size
+			count++
+		}
+	}
+	if err := tw.Close(); err != nil {
+		glog.Errorf("Batch GET %s: failed to finalize the archive, err: %v", bucket, err)
+		t.statsif.add("numerr", 1)
+		panic(http.ErrAbortHandler)
+	}
+	t.statsif.addMany("numbatchget", count, "bytesbatchget", nbytes)
+	if glog.V(3) {
+		glog.Infof("Batch GET %s: %d objects, %.2f MB, %d µs", bucket, count, float64(nbytes)/MiB, time.Since(started)/1000)
+	}
+}
+
+// batchsendone adds the object to the tar stream; returns -1 if the object
+// has been removed since batchresolve() and can be skipped
+func (t *targetrunner) batchsendone(tw *tar.Writer, bucket, objname string, bmsg *BatchGetMsg) (size int64, errstr string) {
+	var (
+		fqn   = t.fqn(bucket, objname, t.bmdowner.get().islocal(bucket))
+		uname = uniquename(bucket, objname)
+	)
+	t.rtnamemap.lockname(uname, false, &pendinginfo{Time: time.Now(), fqn: fqn}, time.Second)
+	defer t.rtnamemap.unlockname(uname, false)
+	file, err := os.Open(fqn)
+	if err != nil {
+		if os.IsNotExist(err) && bmsg.Missing == BatchMissingSkip {
+			return -1, ""
+		}
+		return 0, fmt.Sprintf("Batch GET: failed to open %s (%s/%s), err: %v", fqn, bucket, objname, err)
+	}
+	defer file.Close()
+	finfo, err := file.Stat()
+	if err != nil {
+		return 0, fmt.Sprintf("Batch GET: failed to fstat %s (%s/%s), err: %v", fqn, bucket, objname, err)
+	}
+	size = finfo.Size()
+	hdr := &tar.Header{Typeflag: tar.TypeReg, Name: objname, Mode: 0644, Size: size, ModTime: finfo.ModTime()}
+	if err = tw.WriteHeader(hdr); err != nil {
+		return 0, fmt.Sprintf("Batch GET: failed to send %s/%s, err: %v", bucket, objname, err)
+	}
+	slab := selectslab(size)
+	buf := slab.alloc()
+	defer slab.free(buf)
+	if _, err = io.CopyBuffer(tw, file, buf); err != nil {
+		return 0, fmt.Sprintf("Batch GET: failed to send %s/%s, err: %v", bucket, objname, err)
+	}
+	getatimerunner().touch(fqn)
+	return
+}
+
+//===========
+//
+// proxy
+//
+//===========
+
+// POST { action: batchget } /Rversion/Rbuckets/bucket-name
+func (p *proxyrunner) batchget(w http.ResponseWriter, r *http.Request, bucket string, msg *ActionMsg) {
+	var (
+		started = time.Now()
+		bodies  = make(map[string][]byte)
+		index   map[string]int // list: position of the object in the request
+	)
+	jsmap, ok := msg.Value.(map[string]interface{})
+	if !ok {
+		p.invalmsghdlr(w, r, fmt.Sprintf("Unexpected ActionMsg.Value format (%s, %T)", msg.Action, msg.Value))
+		return
+	}
+	bmsg, errstr := parseBatchGetMsg(jsmap)
+	if errstr != "" {
+		p.invalmsghdlr(w, r, errstr)
+		return
+	}
+	if _, ok := jsmap["objnames"]; ok {
+		listMsg, errstr := parseListMsg(jsmap)
+		if errstr != "" {
+			p.invalmsghdlr(w, r, errstr)
+			return
+		}
+		index = make(map[string]int, len(listMsg.Objnames))
+		tobjs := make(map[string][]string)
+		for _, objname := range listMsg.Objnames {
+			if _, ok := index[objname]; ok {
+				continue
+			}
+			si, errstr := HrwTarget(bucket, objname, p.smap)
+			if errstr != "" {
+				p.invalmsghdlr(w, r, errstr)
+				return
+			}
+			index[objname] = len(index)
+			tobjs[si.DaemonID] = append(tobjs[si.DaemonID], objname)
+		}
+		for tid, objs := range tobjs {
+			tmap := make(map[string]interface{}, len(jsmap))
+			for k, v := range jsmap {
+				tmap[k] = v
+			}
+			tmap["objnames"] = objs
+			bodies[tid] = p.batchbody(msg, tmap)
+		}
+	} else {
+		rangeMsg, errstr := parseRangeMsg(jsmap)
+		if errstr != "" {
+			p.invalmsghdlr(w, r, errstr)
+			return
+		}
+		if _, _, err := parseRange(rangeMsg.Range); err != nil {
+			p.invalmsghdlr(w, r, fmt.Sprintf("Error parsing range string (%s): %v", rangeMsg.Range, err))
+			return
+		}
+		body := p.batchbody(msg, jsmap)
+		for tid := range p.smap.Tmap {
+			bodies[tid] = body
+		}
+	}
+	streams, errstr, errcode := p.openBatchStreams(bucket, bodies)
+	if errstr != "" {
+		p.invalmsghdlr(w, r, errstr, errcode)
+		return
+	}
+	defer func() {
+		for _, stream := range streams {
+			stream.body.Close()
+		}
+	}()
+
+	// all targets have responded OK - start streaming the archive
+	var archive batchArchive
+	if bmsg.Format == BatchFormatZip {
+		w.Header().Set("Content-Type", "application/zip")
+		archive = &zipArchive{zw: zip.NewWriter(w)}
+	} else {
+		w.Header().Set("Content-Type", "application/x-tar")
+		archive = &tarArchive{tw: tar.NewWriter(w)}
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", bucket+"."+bmsg.Format))
+	less := func(a, b *batchStream) bool { return a.hdr.Name < b.hdr.Name }
+	switch {
+	case bmsg.Order == BatchOrderTarget:
+		less = func(a, b *batchStream) bool { return a.tid < b.tid }
+	case index != nil:
+		less = func(a, b *batchStream) bool { return index[a.hdr.Name] < index[b.hdr.Name] }
+	}
+	count, err := mergeBatchStreams(archive, streams, less)
+	if err == nil {
+		err = archive.Close()
+	}
+	if err != nil {
+		glog.Errorf("Batch GET %s: aborting after %d objects, err: %v", bucket, count, err)
+		p.statsif.add("numerr", 1)
+		panic(http.ErrAbortHandler)
+	}
+	if glog.V(3) {
+		glog.Infof("Batch GET %s: %d objects from %d targets, %d µs", bucket, count, len(streams), time.Since(started)/1000)
+	}
+}
+
+func (p *proxyrunner) batchbody(msg *ActionMsg, value map[string]interface{}) []byte {
+	jsbytes, err := json.Marshal(ActionMsg{Action: msg.Action, Name: msg.Name, Value: value})
+	assert(err == nil, err)
+	return jsbytes
+}
+
+// openBatchStreams sends the batch GET requests to the targets and waits for all of them
+// to respond; returns the streams sorted by target ID or the first error
+func (p *proxyrunner) openBatchStreams(bucket string, bodies map[string][]byte) (streams []*batchStream, errstr string, errcode int) {
+	var (
+		wg     = &sync.WaitGroup{}
+		mu     = &sync.Mutex{}
+		q      = url.Values{}
+		failed = false
+	)
+	q.Set(URLParamLocal, fmt.Sprintf("%t", p.bmdowner.get().islocal(bucket)))
+	for tid, body := range bodies {
+		si, ok := p.smap.Tmap[tid]
+		if !ok {
+			return nil, fmt.Sprintf("Target %s is not present in the cluster map", tid), http.StatusInternalServerError
+		}
+		wg.Add(1)
+		go func(si *daemonInfo, body []byte) {
+			defer wg.Done()
+			var (
+				status = http.StatusInternalServerError
+				s      string
+			)
+			url := si.dataURL() + URLPath(Rversion, Rbuckets, bucket) + "?" + q.Encode()
+			req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(body))
+			if err == nil {
+				req.Header.Set("Content-Type", "application/json")
+				var resp *http.Response
+				if resp, err = p.httpclientLongTimeout.Do(req); err == nil {
+					if resp.StatusCode < http.StatusBadRequest {
+						mu.Lock()
+						streams = append(streams, &batchStream{tid: si.DaemonID, body: resp.Body, tr: tar.NewReader(resp.Body)})
+						mu.Unlock()
+						return
+					}
+					b, _ := ioutil.ReadAll(resp.Body)
+					resp.Body.Close()
+					status, s = resp.StatusCode, string(b)
+				}
+			}
+			if err != nil {
+				s = err.Error()
+			}
+			mu.Lock()
+			// prefer reporting missing objects over other failures
+			if !failed || (status == http.StatusNotFound && errcode != http.StatusNotFound) {
+				errstr = fmt.Sprintf("Batch GET %s: target %s failed: %s", bucket, si.DaemonID, s)
+				errcode = status
+			}
+			failed = true
+			mu.Unlock()
+		}(si, body)
+	}
+	wg.Wait()
+	if failed {
+		for _, stream := range streams {
+			stream.body.Close()
+		}
+		return nil, errstr, errcode
+	}
+	sort.Slice(streams, func(i, j int) bool { return streams[i].tid < streams[j].tid })
+	return
+}
+
+// next advances the stream to its next entry
+func (stream *batchStream) next() error {
+	hdr, err := stream.tr.Next()
+	if err == io.EOF {
+		stream.hdr = nil
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("target %s: %v", stream.tid, err)
+	}
+	stream.hdr = hdr
+	return nil
+}
+
+// mergeBatchStreams copies the entries of all streams into the archive in the order defined by less;
+// the latter compares the streams by their next (current) entries
+func mergeBatchStreams(archive batchArchive, streams []*batchStream, less func(a, b *batchStream) bool) (count int, err error) {
+	for _, stream := range streams {
+		if err = stream.next(); err != nil {
+			return
+		}
+	}
+	for {
+		var min *batchStream
+		for _, stream := range streams {
+			if stream.hdr != nil && (min == nil || less(stream, min)) {
+				min = stream
+			}
+		}
+		if min == nil {
+			return
+		}
+		if err = archive.add(min.hdr, min.tr); err != nil {
+			return
+		}
+		count++
+		if err = min.next(); err != nil {
+			return
+		}
+	}
+}
+
+func (a *tarArchive) add(hdr *tar.Header, r io.Reader) error {
+	if err := a.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	slab := selectslab(hdr.Size)
+	buf := slab.alloc()
+	defer slab.free(buf)
+	_, err := io.CopyBuffer(a.tw, r, buf)
+	return err
+}
+
+func (a *tarArchive) Close() error {
+	return a.tw.Close()
+}
+
+func (a *zipArchive) add(hdr *tar.Header, r io.Reader) error {
+	// stored uncompressed: batch GET is about throughput, and the objects are often compressed already
+	fh := &zip.FileHeader{Name: hdr.Name, Method: zip.Store, Modified: hdr.ModTime}
+	fh.SetMode(os.FileMode(hdr.Mode))
+	zw, err := a.zw.CreateHeader(fh)
+	if err != nil {
+		return err
+	}
+	slab := selectslab(hdr.Size)
+	buf := slab.alloc()
+	defer slab.free(buf)
+	_, err = io.CopyBuffer(zw, r, buf)
+	return err
+}
+
+func (a *zipArchive) Close() error {
+	return a.zw.Close()
+}
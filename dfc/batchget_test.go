@@ -0,0 +1,101 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func newTestBatchStream(t *testing.T, tid string, names ...string) *batchStream {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, name := range names {
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0644, Size: int64(len(name))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &batchStream{tid: tid, body: ioutil.NopCloser(buf), tr: tar.NewReader(buf)}
+}
+
+func readTestArchive(t *testing.T, buf *bytes.Buffer) (names []string) {
+	tr := tar.NewReader(buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != hdr.Name {
+			t.Errorf("%s: unexpected content %q", hdr.Name, b)
+		}
+		names = append(names, hdr.Name)
+	}
+}
+
+func TestMergeBatchStreams(t *testing.T) {
+	index := map[string]int{"c": 0, "a": 1, "d": 2, "b": 3}
+	tests := []struct {
+		name string
+		less func(a, b *batchStream) bool
+		exp  []string
+	}{
+		{"request", func(a, b *batchStream) bool { return index[a.hdr.Name] < index[b.hdr.Name] }, []string{"c", "a", "d", "b"}},
+		{"target", func(a, b *batchStream) bool { return a.tid < b.tid }, []string{"a", "b", "c", "d"}},
+	}
+	for _, test := range tests {
+		streams := []*batchStream{
+			newTestBatchStream(t, "t2", "c", "d"),
+			newTestBatchStream(t, "t1", "a", "b"),
+			newTestBatchStream(t, "t3"),
+		}
+		buf := &bytes.Buffer{}
+		archive := &tarArchive{tw: tar.NewWriter(buf)}
+		count, err := mergeBatchStreams(archive, streams, test.less)
+		if err == nil {
+			err = archive.Close()
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if count != len(test.exp) {
+			t.Errorf("%s: expected %d objects, got %d", test.name, len(test.exp), count)
+		}
+		if names := readTestArchive(t, buf); !reflect.DeepEqual(names, test.exp) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.exp, names)
+		}
+	}
+}
+
+func TestParseBatchGetMsg(t *testing.T) {
+	bmsg, errstr := parseBatchGetMsg(map[string]interface{}{"format": "zip"})
+	if errstr != "" {
+		t.Fatal(errstr)
+	}
+	if exp := (BatchGetMsg{Format: BatchFormatZip, Missing: BatchMissingError, Order: BatchOrderRequest}); *bmsg != exp {
+		t.Errorf("expected %+v, got %+v", exp, *bmsg)
+	}
+	if _, errstr = parseBatchGetMsg(map[string]interface{}{"missing": "ignore"}); errstr == "" {
+		t.Error("expected error for invalid missing-object option")
+	}
+	if _, errstr = parseBatchGetMsg(map[string]interface{}{"order": 1}); errstr == "" {
+		t.Error("expected error for non-string order")
+	}
+}
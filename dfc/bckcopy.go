@@ -0,0 +1,296 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// Bucket copy: POST {"action": "copybck", "name": destination-local-bucket} /v1/buckets/bucket-name
+//
+// Clones a local bucket or materializes a Cloud bucket into a local one. The proxy
+// broadcasts the request to all targets, each target then runs the xaction (ActCopyBucket)
+// on its own share of the source: local objects it stores or, for a Cloud bucket, the objects
+// from the Cloud listing that map to it (which are cold-GET when not cached). Every object
+// is sent to its HRW target in the destination bucket - see copyobject.
+type xactCopyBucket struct {
+	xactBase
+	sync.Mutex
+	targetrunner *targetrunner
+	bucketFrom   string
+	bucketTo     string
+	stats        CopyBucketTargetStats
+}
+
+type copybckctx struct {
+	xcb     *xactCopyBucket
+	t       *targetrunner
+	ct      context.Context
+	ncopied int64
+	bcopied int64
+	errcnt  int64
+	lastErr error
+}
+
+// POST { action: copybck } /Rversion/Rbuckets/bucket-name
+func (t *targetrunner) copybucket(w http.ResponseWriter, r *http.Request, msg ActionMsg) {
+	apitems := t.restAPIItems(r.URL.Path, 5)
+	if apitems = t.checkRestAPI(w, r, apitems, 1, Rversion, Rbuckets); apitems == nil {
+		return
+	}
+	bucketFrom, bucketTo := apitems[0], msg.Name
+	if !t.validatebckname(w, r, bucketFrom) {
+		return
+	}
+	if errstr := validateCopyBucket(t.bmdowner.get(), bucketFrom, bucketTo); errstr != "" {
+		t.invalmsghdlr(w, r, errstr)
+		return
+	}
+	xcb := t.xactinp.renewCopyBucket(t, bucketFrom, bucketTo)
+	if xcb == nil {
+		t.invalmsghdlr(w, r, fmt.Sprintf("Cannot copy %s => %s: %s is already running", bucketFrom, bucketTo, ActCopyBucket))
+		return
+	}
+	go t.runCopyBucket(t.contextWithAuth(r), xcb)
+}
+
+func validateCopyBucket(bucketmd *bucketMD, bucketFrom, bucketTo string) (errstr string) {
+	if bucketTo == "" {
+		return fmt.Sprintf("Invalid copy bucket request: empty destination name for %s", bucketFrom)
+	}
+	if bucketFrom == bucketTo {
+		return fmt.Sprintf("Invalid copy bucket request: %s cannot be copied onto itself", bucketFrom)
+	}
+	if ok, _ := bucketmd.get(bucketTo, true); !ok {
+		return fmt.Sprintf("Copy destination: local bucket %s %s", bucketTo, doesnotexist)
+	}
+	return
+}
+
+func (t *targetrunner) runCopyBucket(ct context.Context, xcb *xactCopyBucket) {
+	bucketFrom := xcb.bucketFrom
+	glog.Infoln(xcb.tostring())
+	if t.bmdowner.get().islocal(bucketFrom) {
+		wg := &sync.WaitGroup{}
+		for mpath := range ctx.mountpaths.Available {
+			cbctx := &copybckctx{xcb: xcb, t: t, ct: ct}
+			wg.Add(1)
+			go cbctx.oneCopyBucket(filepath.Join(makePathLocal(mpath), bucketFrom), wg)
+		}
+		wg.Wait()
+	} else {
+		cbctx := &copybckctx{xcb: xcb, t: t, ct: ct}
+		cbctx.copyCloudBucket()
+	}
+
+	xcb.etime = time.Now()
+	glog.Infoln(xcb.tostring())
+}
+
+func (cbctx *copybckctx) oneCopyBucket(bucketdir string, wg *sync.WaitGroup) {
+	defer wg.Done()
+	if _, err := os.Stat(bucketdir); err != nil {
+		return
+	}
+	if err := filepath.Walk(bucketdir, cbctx.copywalkfn); err != nil {
+		s := err.Error()
+		if strings.Contains(s, "xaction") {
+			glog.Infof("Stopping %q traversal: %s", bucketdir, s)
+		} else {
+			glog.Errorf("Failed to traverse %q, err: %v", bucketdir, err)
+		}
+	}
+	cbctx.report(bucketdir)
+}
+
+func (cbctx *copybckctx) copywalkfn(fqn string, osfi os.FileInfo, err error) error {
+	if err != nil {
+		glog.Errorf("walkfunc callback invoked with err: %v", err)
+		return err
+	}
+	if osfi.Mode().IsDir() {
+		return nil
+	}
+	if iswork, _ := cbctx.t.isworkfile(fqn); iswork {
+		return nil
+	}
+	if err := cbctx.checkAborted(); err != nil {
+		return err
+	}
+	bucket, objname, errstr := cbctx.t.fqn2bckobj(fqn)
+	if errstr != "" {
+		glog.Errorln(errstr)
+		return nil
+	}
+	if bucket != cbctx.xcb.bucketFrom {
+		return nil
+	}
+	cbctx.copyOne(objname)
+	return nil
+}
+
+// copyCloudBucket pages through the Cloud listing and copies this target's share of it
+func (cbctx *copybckctx) copyCloudBucket() {
+	var (
+		t      = cbctx.t
+		bucket = cbctx.xcb.bucketFrom
+		msg    = &GetMsg{}
+	)
+	for {
+		jsbytes, errstr, errcode := getcloudif().listbucket(cbctx.ct, bucket, msg)
+		if errstr != "" {
+			glog.Errorf("%s: failed to list Cloud bucket %s: %d(%s)", cbctx.xcb.tostring(), bucket, errcode, errstr)
+			break
+		}
+		reslist := &BucketList{}
+		if err := json.Unmarshal(jsbytes, reslist); err != nil {
+			glog.Errorf("%s: failed to unmarshal the list of %s, err: %v", cbctx.xcb.tostring(), bucket, err)
+			break
+		}
+		for _, entry := range reslist.Entries {
+			if err := cbctx.checkAborted(); err != nil {
+				glog.Infoln(err)
+				cbctx.report(bucket)
+				return
+			}
+			si, errstr := HrwTarget(bucket, entry.Name, t.smap)
+			if errstr != "" {
+				glog.Errorln(errstr)
+				cbctx.report(bucket)
+				return
+			}
+			if si.DaemonID == t.si.DaemonID {
+				cbctx.copyOne(entry.Name)
+			}
+		}
+		if reslist.PageMarker == "" {
+			break
+		}
+		msg.GetPageMarker = reslist.PageMarker
+	}
+	cbctx.report(bucket)
+}
+
+func (cbctx *copybckctx) copyOne(objname string) {
+	var (
+		t          = cbctx.t
+		bucketFrom = cbctx.xcb.bucketFrom
+		islocal    = t.bmdowner.get().islocal(bucketFrom)
+		fqn        = t.fqn(bucketFrom, objname, islocal)
+		uname      = uniquename(bucketFrom, objname)
+		locked     bool
+	)
+	if !islocal {
+		if _, err := os.Stat(fqn); err != nil && os.IsNotExist(err) {
+			// note: coldget() keeps the read lock if successful
+			if _, errstr, _ := t.coldget(cbctx.ct, bucketFrom, objname, false); errstr != "" {
+				cbctx.errcnt++
+				cbctx.lastErr = errors.New(errstr)
+				return
+			}
+			locked = true
+		}
+	}
+	if !locked {
+		t.rtnamemap.lockname(uname, false, &pendinginfo{Time: time.Now(), fqn: fqn}, time.Second)
+	}
+	defer t.rtnamemap.unlockname(uname, false)
+	finfo, err := os.Stat(fqn)
+	if err != nil {
+		cbctx.errcnt++
+		cbctx.lastErr = err
+		return
+	}
+	if errstr := t.copyobject(bucketFrom, objname, cbctx.xcb.bucketTo, objname); errstr != "" {
+		cbctx.errcnt++
+		cbctx.lastErr = errors.New(errstr)
+		return
+	}
+	cbctx.ncopied++
+	cbctx.bcopied += finfo.Size()
+	cbctx.xcb.Lock()
+	cbctx.xcb.stats.NumCopiedFiles++
+	cbctx.xcb.stats.NumCopiedBytes += finfo.Size()
+	cbctx.xcb.Unlock()
+}
+
+func (cbctx *copybckctx) checkAborted() error {
+	select {
+	case <-cbctx.xcb.abrt:
+		s := fmt.Sprintf("%s aborted, exiting", cbctx.xcb.tostring())
+		glog.Flush()
+		return errors.New(s)
+	default:
+	}
+	if cbctx.xcb.finished() {
+		return fmt.Errorf("%s aborted, exiting", cbctx.xcb.tostring())
+	}
+	return nil
+}
+
+func (cbctx *copybckctx) report(where string) {
+	if cbctx.ncopied > 0 {
+		glog.Infof("Copy bucket %q: copied %d object(s), %.2f MB", where, cbctx.ncopied, float64(cbctx.bcopied)/MiB)
+	}
+	if cbctx.errcnt > 0 {
+		glog.Errorf("Copy bucket %q: failed to copy %d object(s), last err: %v", where, cbctx.errcnt, cbctx.lastErr)
+	}
+}
+
+//
+// xaction
+//
+
+func (q *xactInProgress) renewCopyBucket(t *targetrunner, bucketFrom, bucketTo string) *xactCopyBucket {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	_, xx := q.findU(ActCopyBucket)
+	if xx != nil {
+		xcb := xx.(*xactCopyBucket)
+		if !xcb.finished() {
+			glog.Infof("%s already running, nothing to do", xcb.tostring())
+			return nil
+		}
+		// the finished one is kept for its stats until the next one
+		k, _ := q.findU(xcb.id)
+		q.xactinp = append(q.xactinp[:k], q.xactinp[k+1:]...)
+	}
+	id := q.uniqueid()
+	xcb := &xactCopyBucket{
+		xactBase:     *newxactBase(id, ActCopyBucket),
+		targetrunner: t,
+		bucketFrom:   bucketFrom,
+		bucketTo:     bucketTo,
+	}
+	q.add(xcb)
+	return xcb
+}
+
+func (xact *xactCopyBucket) tostring() string {
+	start := xact.stime.Sub(xact.targetrunner.starttime())
+	if !xact.finished() {
+		return fmt.Sprintf("xaction %s:%d %s => %s started %v", xact.kind, xact.id, xact.bucketFrom, xact.bucketTo, start)
+	}
+	fin := time.Since(xact.targetrunner.starttime())
+	return fmt.Sprintf("xaction %s:%d %s => %s started %v finished %v", xact.kind, xact.id,
+		xact.bucketFrom, xact.bucketTo, start, fin)
+}
+
+func (xact *xactCopyBucket) abort() {
+	xact.xactBase.abort()
+	glog.Infof("ABORT: " + xact.tostring())
+}
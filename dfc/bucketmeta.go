@@ -22,6 +22,24 @@ type BucketProps struct {
 	NextTierURL   string `json:"next_tier_url,omitempty"`
 	ReadPolicy    string `json:"read_policy,omitempty"`
 	WritePolicy   string `json:"write_policy,omitempty"`
+	// object expiration rules (see lifecycle.go)
+	Lifecycle []LifecycleRule `json:"lifecycle,omitempty"`
+	// local buckets: max number of previous object versions to keep (0 - no history, see objversions.go)
+	VersionsKept int `json:"versions_kept,omitempty"`
+	// transformer applied to the bucket's objects upon GET (see etl.go)
+	Transform string `json:"transform,omitempty"`
+	// rate limits that override the cluster defaults (see ratelimit.go):
+	// requests/s per proxy and bytes/s per target; 0 - default, negative - unlimited
+	RequestRate float64 `json:"request_rate,omitempty"`
+	Bandwidth   int64   `json:"bandwidth,omitempty"`
+}
+
+// LifecycleRule expires objects that were last modified more than ExpireDays ago;
+// the rule applies to the objects with names starting with Prefix (all objects if empty).
+// Expired objects are deleted from local buckets and evicted (cached copy only) from Cloud buckets.
+type LifecycleRule struct {
+	Prefix     string `json:"prefix,omitempty"`
+	ExpireDays int    `json:"expire_days"`
 }
 
 type bucketMD struct {
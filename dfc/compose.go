@@ -0,0 +1,340 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+	"github.com/OneOfOne/xxhash"
+)
+
+// Append and compose (local buckets only):
+//
+// PUT /v1/objects/bucket-name/object-name?append=true appends the request's body to the object
+// (creating the object if it does not exist). The object's checksum is recomputed over its entire
+// content and its version is incremented; the previous version is not kept though.
+//
+// POST {"action": "compose", "value": [source-objname, ...]} /v1/objects/bucket-name/object-name
+// concatenates the source objects of the bucket, in the given order, into the destination object.
+// The proxy redirects the request to the destination's target; the latter reads the local sources
+// directly and GETs the rest from their respective targets. The destination may be one of
+// the sources, in which case its current content is used.
+//
+// Both hold the destination's exclusive lock (rtnamemap) for the entire duration of the operation,
+// and so are serialized with each other and with any other PUT, GET, or DELETE of the destination.
+// Note that composing two objects into each other at the same time is not supported
+// (each of the two requests would wait for the other one's destination lock).
+
+// composeSources returns the list of source objects given the compose action message
+func composeSources(msg *ActionMsg) (srcs []string, errstr string) {
+	v, ok := msg.Value.([]interface{})
+	if !ok || len(v) == 0 {
+		errstr = fmt.Sprintf("Invalid compose request: expecting non-empty list of source objects (%v, %T)", msg.Value, msg.Value)
+		return
+	}
+	srcs = make([]string, 0, len(v))
+	for _, src := range v {
+		s, ok := src.(string)
+		if !ok || s == "" {
+			errstr = fmt.Sprintf("Invalid compose request: source object name must be a non-empty string (%v, %T)", src, src)
+			return nil, errstr
+		}
+		srcs = append(srcs, s)
+	}
+	return
+}
+
+// POST { action: compose } /Rversion/Robjects/bucket-name/object-name
+func (p *proxyrunner) filcompose(w http.ResponseWriter, r *http.Request, msg *ActionMsg) {
+	apitems := p.restAPIItems(r.URL.Path, 5)
+	if apitems = p.checkRestAPI(w, r, apitems, 2, Rversion, Robjects); apitems == nil {
+		return
+	}
+	lbucket, objname := apitems[0], strings.Join(apitems[1:], "/")
+	if !p.bmdowner.get().islocal(lbucket) {
+		s := fmt.Sprintf("Compose is supported only for cache-only buckets (%s does not appear to be local)", lbucket)
+		p.invalmsghdlr(w, r, s)
+		return
+	}
+	if _, errstr := composeSources(msg); errstr != "" {
+		p.invalmsghdlr(w, r, errstr)
+		return
+	}
+	si, errstr := HrwTarget(lbucket, objname, p.smap)
+	if errstr != "" {
+		p.invalmsghdlr(w, r, errstr)
+		return
+	}
+	redirecturl := si.DirectURL + r.URL.Path
+	if glog.V(3) {
+		glog.Infof("COMPOSE %s %s/%s => %s", r.Method, lbucket, objname, si.DaemonID)
+	}
+	http.Redirect(w, r, redirecturl, http.StatusTemporaryRedirect)
+}
+
+// PUT /Rversion/Robjects/bucket-name/object-name?append=true
+func (t *targetrunner) appendobj(w http.ResponseWriter, r *http.Request, bucket, objname string) {
+	if !t.bmdowner.get().islocal(bucket) {
+		t.invalmsghdlr(w, r, fmt.Sprintf("Append is supported only for cache-only buckets (%s does not appear to be local)", bucket))
+		return
+	}
+	var (
+		started = time.Now()
+		fqn     = t.fqn(bucket, objname, true)
+		uname   = uniquename(bucket, objname)
+		props   = &objectProps{}
+		size    int64
+		existed bool
+		xattrs  = make(map[string][]byte, 2) // the original checksum and version
+		errstr  string
+	)
+	t.rtnamemap.lockname(uname, true, &pendinginfo{Time: time.Now(), fqn: fqn}, time.Second)
+	defer t.rtnamemap.unlockname(uname, true)
+
+	if finfo, err := os.Stat(fqn); err == nil {
+		size, existed = finfo.Size(), true
+	} else if !os.IsNotExist(err) {
+		t.invalmsghdlr(w, r, fmt.Sprintf("Failed to fstat %s, err: %v", fqn, err), http.StatusInternalServerError)
+		return
+	}
+	if existed {
+		for _, name := range []string{XattrXXHashVal, XattrObjVersion} {
+			if xattrs[name], errstr = Getxattr(fqn, name); errstr != "" {
+				t.invalmsghdlr(w, r, errstr, http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+	if t.versioningConfigured(bucket) {
+		if props.version, errstr = t.increaseObjectVersion(fqn); errstr != "" {
+			t.invalmsghdlr(w, r, errstr, http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(fqn), 0755); err != nil {
+		t.runFSKeeper(fqn)
+		t.invalmsghdlr(w, r, fmt.Sprintf("Failed to create directory for %s, err: %v", fqn, err), http.StatusInternalServerError)
+		return
+	}
+	file, err := os.OpenFile(fqn, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		t.runFSKeeper(fqn)
+		t.invalmsghdlr(w, r, fmt.Sprintf("Failed to open %s, err: %v", fqn, err), http.StatusInternalServerError)
+		return
+	}
+	slab := selectslab(0)
+	buf := slab.alloc()
+	defer slab.free(buf)
+	written, err := io.CopyBuffer(file, r.Body, buf)
+	if errc := file.Close(); err == nil {
+		err = errc
+	}
+	if err != nil {
+		t.appendRollback(fqn, existed, size, xattrs)
+		t.runFSKeeper(fqn)
+		t.invalmsghdlr(w, r, fmt.Sprintf("Failed to append to %s/%s, err: %v", bucket, objname, err))
+		return
+	}
+	if props.nhobj, errstr = t.checksumobj(fqn, buf); errstr == "" {
+		errstr = t.finalizeobj(fqn, props)
+	}
+	if errstr != "" {
+		t.appendRollback(fqn, existed, size, xattrs)
+		t.invalmsghdlr(w, r, errstr, http.StatusInternalServerError)
+		return
+	}
+	t.statsif.addMany("numappend", int64(1), "bytesappended", written)
+	if glog.V(4) {
+		glog.Infof("APPEND %s/%s: %d bytes (total %d), %d µs", bucket, objname, written, size+written, time.Since(started)/1000)
+	}
+}
+
+// appendRollback restores the original content of the object, as well as its checksum
+// and version (that finalizeobj may have updated); a new object is removed
+func (t *targetrunner) appendRollback(fqn string, existed bool, size int64, xattrs map[string][]byte) {
+	if !existed {
+		if err := os.Remove(fqn); err != nil {
+			glog.Errorf("Failed to roll back %s (remove), err: %v", fqn, err)
+		}
+		return
+	}
+	if err := os.Truncate(fqn, size); err != nil {
+		glog.Errorf("Failed to roll back %s to %d bytes, err: %v", fqn, size, err)
+		return
+	}
+	for name, value := range xattrs {
+		var errstr string
+		if value == nil {
+			if v, _ := Getxattr(fqn, name); v != nil {
+				errstr = Deletexattr(fqn, name)
+			}
+		} else {
+			errstr = Setxattr(fqn, name, value)
+		}
+		if errstr != "" {
+			glog.Errorf("Failed to roll back %s: %s", fqn, errstr)
+		}
+	}
+}
+
+// checksumobj computes the checksum of the entire object (nil if checksumming is disabled)
+func (t *targetrunner) checksumobj(fqn string, buf []byte) (nhobj cksumvalue, errstr string) {
+	if ctx.config.Cksum.Checksum == ChecksumNone {
+		return
+	}
+	assert(ctx.config.Cksum.Checksum == ChecksumXXHash)
+	file, err := os.Open(fqn)
+	if err != nil {
+		return nil, fmt.Sprintf("Failed to open %s, err: %v", fqn, err)
+	}
+	defer file.Close()
+	xxhashval, errstr := ComputeXXHash(file, buf, xxhash.New64())
+	if errstr != "" {
+		return nil, fmt.Sprintf("Failed to checksum %s: %s", fqn, errstr)
+	}
+	return newcksumvalue(ChecksumXXHash, xxhashval), ""
+}
+
+// POST { action: compose } /Rversion/Robjects/bucket-name/object-name
+func (t *targetrunner) composefile(w http.ResponseWriter, r *http.Request, msg ActionMsg) {
+	apitems := t.restAPIItems(r.URL.Path, 5)
+	if apitems = t.checkRestAPI(w, r, apitems, 2, Rversion, Robjects); apitems == nil {
+		return
+	}
+	bucket, objname := apitems[0], strings.Join(apitems[1:], "/")
+	if !t.validatebckname(w, r, bucket) {
+		return
+	}
+	if !t.bmdowner.get().islocal(bucket) {
+		t.invalmsghdlr(w, r, fmt.Sprintf("Compose is supported only for cache-only buckets (%s does not appear to be local)", bucket))
+		return
+	}
+	srcs, errstr := composeSources(&msg)
+	if errstr != "" {
+		t.invalmsghdlr(w, r, errstr)
+		return
+	}
+	var (
+		started = time.Now()
+		fqn     = t.fqn(bucket, objname, true)
+		putfqn  = t.fqn2workfile(fqn)
+		uname   = uniquename(bucket, objname)
+		props   = &objectProps{}
+		written int64
+	)
+	t.rtnamemap.lockname(uname, true, &pendinginfo{Time: time.Now(), fqn: fqn}, time.Second)
+	defer t.rtnamemap.unlockname(uname, true)
+
+	// stream the sources, one after another, into the work file (that is, checksum them on the fly)
+	pr, pw := io.Pipe()
+	go func() {
+		for _, src := range srcs {
+			if errstr := t.composesrc(bucket, src, src == objname, pw); errstr != "" {
+				pw.CloseWithError(fmt.Errorf("%s", errstr))
+				return
+			}
+		}
+		pw.Close()
+	}()
+	_, props.nhobj, written, errstr = t.receive(putfqn, objname, "", nil, pr)
+	pr.CloseWithError(io.ErrClosedPipe) // unblocks the sources' writer if receive fails
+	if errstr != "" {
+		t.invalmsghdlr(w, r, fmt.Sprintf("Failed to compose %s/%s: %s", bucket, objname, errstr))
+		return
+	}
+	if errstr = t.composeCommit(bucket, objname, putfqn, fqn, props); errstr != "" {
+		if err := os.Remove(putfqn); err != nil && !os.IsNotExist(err) {
+			glog.Errorf("Nested error: %s => (remove %s => err: %v)", errstr, putfqn, err)
+		}
+		t.invalmsghdlr(w, r, errstr, http.StatusInternalServerError)
+		return
+	}
+	t.statsif.addMany("numcompose", int64(1), "bytescomposed", written)
+	if glog.V(3) {
+		glog.Infof("COMPOSE %s/%s: %d objects, %.2f MB, %d µs", bucket, objname, len(srcs),
+			float64(written)/MiB, time.Since(started)/1000)
+	}
+}
+
+// composeCommit is the locked part of doPutCommit: the caller holds the destination's exclusive lock
+func (t *targetrunner) composeCommit(bucket, objname, putfqn, fqn string, props *objectProps) (errstr string) {
+	if t.versioningConfigured(bucket) {
+		if props.version, errstr = t.increaseObjectVersion(fqn); errstr != "" {
+			return
+		}
+	}
+	if kept := t.versionsKept(bucket); kept > 0 {
+		if errstr = t.keepVersion(bucket, objname, fqn, kept); errstr != "" {
+			return
+		}
+	}
+	if err := os.Rename(putfqn, fqn); err != nil {
+		return fmt.Sprintf("Failed to rename %s => %s, err: %v", putfqn, fqn, err)
+	}
+	if errstr = t.finalizeobj(fqn, props); errstr != "" {
+		glog.Errorf("finalizeobj %s/%s: %s (%+v)", bucket, objname, errstr, props)
+	}
+	return
+}
+
+// composesrc writes the source object into w: locally under its read lock (unless the source
+// is the destination that is already locked), or by GET-ting it from its target
+func (t *targetrunner) composesrc(bucket, src string, isdest bool, w io.Writer) (errstr string) {
+	si, errstr := HrwTarget(bucket, src, t.smap)
+	if errstr != "" {
+		return
+	}
+	if si.DaemonID != t.si.DaemonID {
+		q := url.Values{}
+		q.Set(URLParamLocal, "true")
+		q.Set(URLParamTransform, TransformNone) // the source as is, not the bucket's transformation
+		url := si.dataURL() + URLPath(Rversion, Robjects, bucket, src) + "?" + q.Encode()
+		response, err := t.httpclientLongTimeout.Get(url)
+		if err != nil {
+			return fmt.Sprintf("Failed to GET %s/%s from %s, err: %v", bucket, src, si.DaemonID, err)
+		}
+		defer response.Body.Close()
+		if err = t.checkPeer(si, response); err != nil {
+			return fmt.Sprintf("Failed to GET %s/%s from %s, err: %v", bucket, src, si.DaemonID, err)
+		}
+		if response.StatusCode >= http.StatusBadRequest {
+			b, _ := ioutil.ReadAll(response.Body)
+			return fmt.Sprintf("Failed to GET %s/%s from %s, status %d: %s", bucket, src, si.DaemonID,
+				response.StatusCode, string(b))
+		}
+		if _, err = io.Copy(w, response.Body); err != nil {
+			return fmt.Sprintf("Failed to read %s/%s from %s, err: %v", bucket, src, si.DaemonID, err)
+		}
+		return
+	}
+	fqn := t.fqn(bucket, src, true)
+	if !isdest {
+		uname := uniquename(bucket, src)
+		t.rtnamemap.lockname(uname, false, &pendinginfo{Time: time.Now(), fqn: fqn}, time.Second)
+		defer t.rtnamemap.unlockname(uname, false)
+	}
+	file, err := os.Open(fqn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Sprintf("Source object %s/%s does not exist", bucket, src)
+		}
+		return fmt.Sprintf("Failed to open %s, err: %v", fqn, err)
+	}
+	defer file.Close()
+	if _, err = io.Copy(w, file); err != nil {
+		return fmt.Sprintf("Failed to read %s, err: %v", fqn, err)
+	}
+	return
+}
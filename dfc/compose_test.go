@@ -0,0 +1,30 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestComposeSources(t *testing.T) {
+	srcs, errstr := composeSources(&ActionMsg{Action: ActCompose, Value: []interface{}{"a", "dir/b", "a"}})
+	if errstr != "" {
+		t.Fatal(errstr)
+	}
+	if exp := []string{"a", "dir/b", "a"}; !reflect.DeepEqual(srcs, exp) {
+		t.Errorf("expected %v, got %v", exp, srcs)
+	}
+	for _, value := range []interface{}{
+		nil,
+		"a",
+		[]interface{}{},
+		[]interface{}{"a", ""},
+		[]interface{}{"a", 1.0},
+	} {
+		if _, errstr = composeSources(&ActionMsg{Action: ActCompose, Value: value}); errstr == "" {
+			t.Errorf("expected error for %v", value)
+		}
+	}
+}
@@ -44,6 +44,13 @@ const (
 	rebinpname   = ".rebalancing"
 )
 
+// defaults for the settings that the config files of the older versions do not have
+const (
+	defaultLifecycleTime  = time.Hour
+	defaultTrashRetention = 24 * time.Hour
+	defaultTrashPurgeTime = time.Hour
+)
+
 //==============================
 //
 // config types
@@ -69,6 +76,13 @@ type dfconfig struct {
 	Auth             authconf          `json:"auth"`
 	KeepaliveTracker keepaliveTrackers `json:"keepalivetracker"`
 	CallStats        callStats         `json:"callstats"`
+	Trash            trashconf         `json:"trash"`
+	ETL              etlconf           `json:"etl"`
+	Audit            auditconf         `json:"audit"`
+	Trace            traceconf         `json:"trace"`
+	RateLimit        ratelimitconf     `json:"ratelimit"`
+	Admission        admissionconf     `json:"admission"`
+	XactThrottle     xactthrottleconf  `json:"xaction_throttle"`
 }
 
 type logconfig struct {
@@ -81,9 +95,11 @@ type logconfig struct {
 type periodic struct {
 	StatsTimeStr     string `json:"stats_time"`
 	RetrySyncTimeStr string `json:"retry_sync_time"`
+	LifecycleTimeStr string `json:"lifecycle_time"`
 	// omitempty
 	StatsTime     time.Duration `json:"-"`
 	RetrySyncTime time.Duration `json:"-"`
+	LifecycleTime time.Duration `json:"-"`
 }
 
 // timeoutconfig contains timeouts used for intra-cluster communication
@@ -134,21 +150,104 @@ type rebalanceconf struct {
 	Enabled             bool          `json:"rebalancing_enabled"`
 }
 
+// trashconf configures soft delete of local-bucket objects (see trash.go)
+type trashconf struct {
+	RetentionTimeStr string        `json:"retention_time"`      // trashed objects can be undeleted during this time
+	PurgeTimeStr     string        `json:"purge_time"`          // how often to purge expired objects from trash
+	RetentionTime    time.Duration `json:"-"`                   // omitempty
+	PurgeTime        time.Duration `json:"-"`                   // ditto
+	Enabled          bool          `json:"soft_delete_enabled"` // delete moves objects to trash when true
+}
+
+// etlconf configures the transformers that targets can run on objects being read (see etl.go)
+type etlconf struct {
+	Transformers map[string]*transformerconf `json:"transformers"`
+}
+
+// transformerconf is either a local command that reads the object from stdin and writes
+// the result to stdout, or a local HTTP server that transforms the body of a POST request
+type transformerconf struct {
+	Command    []string      `json:"command,omitempty"`
+	URL        string        `json:"url,omitempty"`
+	TimeoutStr string        `json:"timeout"`
+	Timeout    time.Duration `json:"-"`     // omitempty
+	Cache      bool          `json:"cache"` // true: keep the results (derived objects) until the object changes
+}
+
+// auditconf configures the audit log of mutating requests (see audit.go)
+type auditconf struct {
+	Dir       string `json:"dir"`        // empty: <logdir>/audit
+	MaxSize   uint64 `json:"max_size"`   // size that triggers rotation (0: 64MB)
+	MaxFiles  int    `json:"max_files"`  // max number of rotated logs to keep (0: unlimited)
+	HashChain bool   `json:"hash_chain"` // true: records are hash-chained for tamper evidence
+	Enabled   bool   `json:"audit_enabled"`
+}
+
+// traceconf configures distributed request tracing (see trace.go); with neither
+// the file nor the collector configured, spans go to <logdir>/trace.jsonl
+type traceconf struct {
+	File         string `json:"file"`          // JSON-lines file of spans
+	CollectorURL string `json:"collector_url"` // OTLP/HTTP (JSON) endpoint, e.g. http://localhost:4318/v1/traces
+	Enabled      bool   `json:"tracing_enabled"`
+}
+
+// ratelimitconf configures per-user and per-bucket rate limits (see ratelimit.go); 0 - unlimited
+type ratelimitconf struct {
+	UserRequests    float64 `json:"user_requests"`    // requests/s per user, per proxy
+	UserBandwidth   int64   `json:"user_bandwidth"`   // bytes/s per user, per target
+	BucketRequests  float64 `json:"bucket_requests"`  // requests/s per bucket, per proxy (see BucketProps.RequestRate)
+	BucketBandwidth int64   `json:"bucket_bandwidth"` // bytes/s per bucket, per target (see BucketProps.Bandwidth)
+	Enabled         bool    `json:"ratelimit_enabled"`
+}
+
+// admissionconf configures admission control and load shedding on targets (see admission.go)
+type admissionconf struct {
+	MaxColdGet     int           `json:"max_cold_get"`  // max concurrent cold GETs (0: unlimited)
+	MaxWarmGet     int           `json:"max_warm_get"`  // ditto warm GETs
+	MaxPut         int           `json:"max_put"`       // ditto PUTs
+	MaxRebalance   int           `json:"max_rebalance"` // ditto rebalance (incoming) objects
+	MaxUtil        float64       `json:"max_util"`      // disk utilization (%) to shed cold GETs and PUTs at (0: never)
+	QueueTimeStr   string        `json:"queue_time"`    // how long a request over the limit waits before it is shed
+	BackoffTimeStr string        `json:"backoff_time"`  // how long proxies avoid a target that sheds load
+	QueueTime      time.Duration `json:"-"`             // omitempty
+	BackoffTime    time.Duration `json:"-"`             // ditto
+	Enabled        bool          `json:"admission_enabled"`
+}
+
+// xactthrottleconf configures throttling of rebalance and prefetch (see xthrottle.go); 0 - unlimited
+type xactthrottleconf struct {
+	MaxBandwidth  int64         `json:"xaction_bandwidth"`    // MB/s per target
+	MaxTransfers  int           `json:"xaction_transfers"`    // max concurrent object transfers per target
+	Adaptive      bool          `json:"adaptive_throttle"`    // true: back off while the foreground suffers
+	MaxLatencyStr string        `json:"adaptive_max_latency"` // foreground GET latency to back off at (0: ignore)
+	MaxUtil       float64       `json:"adaptive_max_util"`    // disk utilization (%) to back off at (0: ignore)
+	MaxLatency    time.Duration `json:"-"`                    // omitempty
+	Enabled       bool          `json:"xaction_throttle_enabled"`
+}
+
 type testfspathconf struct {
 	Root     string `json:"root"`
 	Count    int    `json:"count"`
 	Instance int    `json:"instance"`
 }
 
+// netconfig: optionally, intra-cluster traffic is separated from the public one
+// (client requests) - control (keepalive, metasync, vote) and data (rebalance,
+// replication, neighbor GET) networks are selected by IPv4 address and/or port.
+// Empty address and port: the traffic shares the public network
 type netconfig struct {
-	IPv4 string  `json:"ipv4"`
-	L4   l4cnf   `json:"l4"`
-	HTTP httpcnf `json:"http"`
+	IPv4             string  `json:"ipv4"`
+	IPv4IntraControl string  `json:"ipv4_intra_control"` // empty: the same as the public one
+	IPv4IntraData    string  `json:"ipv4_intra_data"`    // ditto
+	L4               l4cnf   `json:"l4"`
+	HTTP             httpcnf `json:"http"`
 }
 
 type l4cnf struct {
-	Proto string `json:"proto"` // tcp, udp
-	Port  string `json:"port"`  // listening port
+	Proto            string `json:"proto"`              // tcp, udp
+	Port             string `json:"port"`               // listening port
+	PortIntraControl string `json:"port_intra_control"` // empty: the same as the public one
+	PortIntraData    string `json:"port_intra_data"`    // ditto
 }
 
 type httpcnf struct {
@@ -158,6 +257,11 @@ type httpcnf struct {
 	UseAsProxy    bool   `json:"use_as_proxy"`       // use DFC as an HTTP proxy
 	Certificate   string `json:"server_certificate"` // HTTPS: openssl certificate
 	Key           string `json:"server_key"`         // HTTPS: openssl key
+	// mTLS for intra-cluster traffic (see mtls.go); requires HTTPS
+	MutualTLS         bool   `json:"use_mtls"`           // verify daemon certificates
+	CACertificate     string `json:"ca_certificate"`     // mTLS: cluster CA certificate
+	DaemonCertificate string `json:"daemon_certificate"` // mTLS: this daemon's certificate, Common Name = daemon ID
+	DaemonKey         string `json:"daemon_key"`         // mTLS: this daemon's key
 }
 
 type cksumconfig struct {
@@ -289,6 +393,11 @@ func validateconf() (err error) {
 	if ctx.config.Periodic.RetrySyncTime, err = time.ParseDuration(ctx.config.Periodic.RetrySyncTimeStr); err != nil {
 		return fmt.Errorf("Bad retry_sync_time format %s, err: %v", ctx.config.Periodic.RetrySyncTimeStr, err)
 	}
+	if ctx.config.Periodic.LifecycleTimeStr == "" {
+		ctx.config.Periodic.LifecycleTime = defaultLifecycleTime
+	} else if ctx.config.Periodic.LifecycleTime, err = time.ParseDuration(ctx.config.Periodic.LifecycleTimeStr); err != nil {
+		return fmt.Errorf("Bad lifecycle_time format %s, err: %v", ctx.config.Periodic.LifecycleTimeStr, err)
+	}
 	if ctx.config.Timeout.Default, err = time.ParseDuration(ctx.config.Timeout.DefaultStr); err != nil {
 		return fmt.Errorf("Bad Timeout default format %s, err: %v", ctx.config.Timeout.DefaultStr, err)
 	}
@@ -307,6 +416,28 @@ func validateconf() (err error) {
 	if ctx.config.Rebalance.DestRetryTime, err = time.ParseDuration(ctx.config.Rebalance.DestRetryTimeStr); err != nil {
 		return fmt.Errorf("Bad dest_retry_time format %s, err: %v", ctx.config.Rebalance.DestRetryTimeStr, err)
 	}
+	if ctx.config.Trash.RetentionTimeStr == "" {
+		ctx.config.Trash.RetentionTime = defaultTrashRetention
+	} else if ctx.config.Trash.RetentionTime, err = time.ParseDuration(ctx.config.Trash.RetentionTimeStr); err != nil {
+		return fmt.Errorf("Bad trash retention_time format %s, err: %v", ctx.config.Trash.RetentionTimeStr, err)
+	}
+	if ctx.config.Trash.PurgeTimeStr == "" {
+		ctx.config.Trash.PurgeTime = defaultTrashPurgeTime
+	} else if ctx.config.Trash.PurgeTime, err = time.ParseDuration(ctx.config.Trash.PurgeTimeStr); err != nil {
+		return fmt.Errorf("Bad trash purge_time format %s, err: %v", ctx.config.Trash.PurgeTimeStr, err)
+	}
+	if ctx.config.Admission.QueueTime, err = time.ParseDuration(ctx.config.Admission.QueueTimeStr); err != nil {
+		return fmt.Errorf("Bad admission queue_time format %s, err: %v", ctx.config.Admission.QueueTimeStr, err)
+	}
+	if ctx.config.Admission.BackoffTime, err = time.ParseDuration(ctx.config.Admission.BackoffTimeStr); err != nil {
+		return fmt.Errorf("Bad admission backoff_time format %s, err: %v", ctx.config.Admission.BackoffTimeStr, err)
+	}
+	if ctx.config.XactThrottle.MaxLatency, err = time.ParseDuration(ctx.config.XactThrottle.MaxLatencyStr); err != nil {
+		return fmt.Errorf("Bad xaction_throttle adaptive_max_latency format %s, err: %v", ctx.config.XactThrottle.MaxLatencyStr, err)
+	}
+	if err = validateTransformers(ctx.config.ETL.Transformers); err != nil {
+		return err
+	}
 
 	hwm, lwm := ctx.config.LRU.HighWM, ctx.config.LRU.LowWM
 	if hwm <= 0 || lwm <= 0 || hwm < lwm || lwm > 100 || hwm > 100 {
@@ -368,6 +499,15 @@ func validateconf() (err error) {
 		return fmt.Errorf("bad target keepalive tracker type %s", ctx.config.KeepaliveTracker.Target.Name)
 	}
 
+	if hc := &ctx.config.Net.HTTP; hc.MutualTLS {
+		if !hc.UseHTTPS {
+			return fmt.Errorf("mTLS (use_mtls) requires HTTPS (use_https)")
+		}
+		if hc.CACertificate == "" || hc.DaemonCertificate == "" || hc.DaemonKey == "" {
+			return fmt.Errorf("mTLS requires CA certificate, daemon certificate and key")
+		}
+	}
+
 	return nil
 }
 
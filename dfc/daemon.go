@@ -29,6 +29,7 @@ const (
 	xfskeeper     = "fskeeper"
 	xatime        = "atime"
 	xmetasyncer   = "metasyncer"
+	xtracer       = "tracer"
 )
 
 type (
@@ -65,10 +66,12 @@ type (
 
 	// each daemon is represented by:
 	daemonInfo struct {
-		NodeIPAddr string `json:"node_ip_addr"`
-		DaemonPort string `json:"daemon_port"`
-		DaemonID   string `json:"daemon_id"`
-		DirectURL  string `json:"direct_url"`
+		NodeIPAddr      string `json:"node_ip_addr"`
+		DaemonPort      string `json:"daemon_port"`
+		DaemonID        string `json:"daemon_id"`
+		DirectURL       string `json:"direct_url"`                  // public network: client requests and redirects
+		IntraControlURL string `json:"intra_control_url,omitempty"` // keepalive, metasync, vote, etc. (see netconfig)
+		IntraDataURL    string `json:"intra_data_url,omitempty"`    // rebalance, replication, neighbor GET, etc.
 	}
 	// most basic and commonly used key/value map where both the keys and the values are strings
 	simplekvs map[string]string
@@ -115,6 +118,35 @@ var (
 	smapLock = &sync.Mutex{}
 )
 
+// controlURL returns the daemon's endpoint in the intra-cluster control network;
+// a daemon that does not advertise one is reached via the public network
+func (si *daemonInfo) controlURL() string {
+	if si.IntraControlURL != "" {
+		return si.IntraControlURL
+	}
+	return si.publicURL()
+}
+
+// dataURL returns the daemon's endpoint in the intra-cluster data network
+func (si *daemonInfo) dataURL() string {
+	if si.IntraDataURL != "" {
+		return si.IntraDataURL
+	}
+	return si.publicURL()
+}
+
+// publicURL: DirectURL unless the daemon info comes with the address only
+func (si *daemonInfo) publicURL() string {
+	if si.DirectURL != "" {
+		return si.DirectURL
+	}
+	scheme := "http"
+	if ctx.config.Net.HTTP.UseHTTPS {
+		scheme = "https"
+	}
+	return scheme + "://" + si.NodeIPAddr + ":" + si.DaemonPort
+}
+
 //====================
 //
 // smap wrapper - NOTE - caller must take the lock
@@ -346,10 +378,12 @@ func dfcinit() {
 		runmap: make(map[string]runner),
 	}
 	assert(clivars.role == xproxy || clivars.role == xtarget, "Invalid flag: role="+clivars.role)
+	var si *daemonInfo
 	if clivars.role == xproxy {
 		confdir := ctx.config.Confdir
 		p := &proxyrunner{confdir: confdir}
 		p.initSI()
+		si = p.si
 		ctx.rg.add(p, xproxy)
 		ctx.rg.add(&proxystatsrunner{}, xproxystats)
 		ctx.rg.add(newproxykalive(p), xproxykalive)
@@ -357,6 +391,7 @@ func dfcinit() {
 	} else {
 		t := &targetrunner{}
 		t.initSI()
+		si = t.si
 		ctx.rg.add(t, xtarget)
 		ctx.rg.add(&storstatsrunner{}, xstorstats)
 		ctx.rg.add(newtargetkalive(t), xtargetkalive)
@@ -395,6 +430,13 @@ func dfcinit() {
 			t.mpath2Fsid() // enforce FS uniqueness
 		}
 	}
+	if ctx.config.Trace.Enabled {
+		tracer, err := newTracer(si.DaemonID)
+		if err != nil {
+			glog.Fatalf("FATAL: tracing: %v", err)
+		}
+		ctx.rg.add(tracer, xtracer)
+	}
 	ctx.rg.add(&sigrunner{}, xsignal)
 }
 
@@ -485,6 +527,13 @@ func getatimerunner() *atimerunner {
 	return rr
 }
 
+// gettracer returns nil when tracing is disabled
+func gettracer() *tracer {
+	r := ctx.rg.runmap[xtracer]
+	rr, _ := r.(*tracer)
+	return rr
+}
+
 func getcloudif() cloudif {
 	r := ctx.rg.runmap[xtarget]
 	rr, ok := r.(*targetrunner)
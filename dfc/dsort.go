@@ -0,0 +1,1014 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// Distributed sort (shuffle) of sharded datasets: POST {"action": "dsort", "value": DsortMsg} /v1/buckets/bucket-name
+//
+// Regroups the records of the input shards (tar archives) into new shards of about the requested
+// size, sorted by record key or shuffled. A record is the group of archive members that share
+// the name up to the first dot of the base name (e.g., 0001.jpg and 0001.cls form the record 0001).
+// The primary proxy runs the xaction (ActDsort) in phases - see the DsortPhase enum:
+// 1) extraction: every target reads the input shards it stores and sends each record to the target
+//    that owns the record's key (HRW of the key in the output bucket); received records are kept
+//    in the work directories (dsortdir) of the mountpaths, one file per record;
+// 2) sorting: once all targets are done, the proxy collects the keys and sizes of all records,
+//    sorts (or shuffles) them and cuts the result into output shards, each assigned to its HRW target;
+// 3) creation: every target assembles its output shards from the local records and the records
+//    it fetches from the other targets, and stores them in the (local) output bucket.
+// The targets report the phase and progress via GET /v1/cluster?what=xaction&props=dsort
+// (see DsortTargetStats); the work files are removed once the xaction is finished or aborted.
+// NOTE: the cluster map is expected to remain unchanged while the sort is running.
+//
+// The targets talk to each other and to the proxy via /v1/sort/id/step (see dsortHandler).
+
+const (
+	dsortdir = ".dsort"
+
+	dsortStepInit    = "init"    // POST: create the xaction (DsortMsg)
+	dsortStepStart   = "start"   // POST: start the extraction
+	dsortStepRecords = "records" // PUT: receive records (tar stream), GET: sorted keys and sizes
+	dsortStepFetch   = "fetch"   // POST: send records by index ([]int)
+	dsortStepCreate  = "create"  // POST: create output shards ([]dsortShard)
+
+	dsortDefaultPrefix = "shard-"
+	dsortPollInterval  = time.Second
+	dsortTrailerSize   = 1024 // tar end-of-archive: two zero blocks
+)
+
+type (
+	xactDsort struct {
+		xactBase
+		sync.Mutex
+		targetrunner *targetrunner
+		msg          *DsortMsg
+		records      []*dsortRecord
+		sorted       bool
+		seq          int64
+		stats        DsortTargetStats // phase and progress (all but Xactions)
+	}
+	// record stored by the target: tar members (headers and padded data) without the trailer
+	dsortRecord struct {
+		key  string
+		size int64
+		fqn  string
+	}
+	// dsortRecorder groups consecutive tar members with the same key into records
+	dsortRecorder struct {
+		x      *xactDsort
+		remote bool
+		buf    []byte
+		rec    *dsortRecord
+		file   *os.File
+		tw     *tar.Writer
+	}
+	// dsortSender streams tar members to the target that owns their keys
+	dsortSender struct {
+		si      *daemonInfo
+		pw      *io.PipeWriter
+		tw      *tar.Writer
+		lastkey string
+		count   int64
+		done    chan string
+	}
+	// metadata of a target's record: the index in dsortRecordInfo list is the record's index
+	dsortRecordInfo struct {
+		Key  string `json:"key"`
+		Size int64  `json:"size"`
+	}
+	dsortShardRecord struct {
+		Target string `json:"target"`
+		Idx    int    `json:"idx"`
+		Size   int64  `json:"size"`
+		key    string
+	}
+	dsortShard struct {
+		Name    string             `json:"name"`
+		Records []dsortShardRecord `json:"records"`
+	}
+	xactDsortProxy struct {
+		xactBase
+		proxyrunner *proxyrunner
+		msg         *DsortMsg
+	}
+)
+
+// dsortKey returns the key of the record the archive member belongs to
+func dsortKey(name string) string {
+	dir, base := path.Split(name)
+	if len(base) > 1 { // the leading dot of a hidden name is not an extension
+		if i := strings.IndexByte(base[1:], '.'); i >= 0 {
+			base = base[:i+1]
+		}
+	}
+	return dir + base
+}
+
+func makePathDsort(basePath, id string) string {
+	return filepath.Join(basePath, dsortdir, id)
+}
+
+func parseDsortMsg(value interface{}) (dmsg *DsortMsg, errstr string) {
+	dmsg = &DsortMsg{}
+	jsbytes, err := json.Marshal(value)
+	if err == nil {
+		err = json.Unmarshal(jsbytes, dmsg)
+	}
+	if err != nil || value == nil {
+		return nil, fmt.Sprintf("Invalid dsort request: unexpected value format (%v, %T)", value, value)
+	}
+	if dmsg.OutputBucket == "" {
+		return nil, "Invalid dsort request: missing output bucket"
+	}
+	if dmsg.ShardSize <= 0 {
+		return nil, fmt.Sprintf("Invalid dsort request: shard size must be positive (%d)", dmsg.ShardSize)
+	}
+	if dmsg.OutputPrefix == "" {
+		dmsg.OutputPrefix = dsortDefaultPrefix
+	}
+	switch dmsg.Order {
+	case "":
+		dmsg.Order = GetSortAsc
+	case GetSortAsc, GetSortDes, DsortOrderShuffle:
+	default:
+		return nil, fmt.Sprintf("Invalid dsort request: order must be one of %q, %q, %q (got %q)",
+			GetSortAsc, GetSortDes, DsortOrderShuffle, dmsg.Order)
+	}
+	if _, _, err = parseRange(dmsg.Range); err != nil {
+		return nil, fmt.Sprintf("Invalid dsort request: range %q, err: %v", dmsg.Range, err)
+	}
+	return
+}
+
+// orderDsortRecords sorts the records of all targets by key or shuffles them;
+// the shuffle depends only on the seed and the set of records
+func orderDsortRecords(records []dsortShardRecord, order string, seed int64) {
+	sort.Slice(records, func(i, j int) bool {
+		a, b := &records[i], &records[j]
+		if a.key != b.key {
+			return (a.key < b.key) == (order != GetSortDes)
+		}
+		if a.Target != b.Target {
+			return a.Target < b.Target
+		}
+		return a.Idx < b.Idx
+	})
+	if order != DsortOrderShuffle {
+		return
+	}
+	rnd := rand.New(rand.NewSource(seed))
+	for i := len(records) - 1; i > 0; i-- {
+		j := rnd.Intn(i + 1)
+		records[i], records[j] = records[j], records[i]
+	}
+}
+
+// cutDsortShards cuts the ordered records into output shards of at least shardSize bytes
+// (the last shard may be smaller)
+func cutDsortShards(records []dsortShardRecord, prefix string, shardSize int64) (shards []*dsortShard) {
+	var (
+		shard *dsortShard
+		size  int64
+	)
+	for _, rec := range records {
+		if shard == nil {
+			shard = &dsortShard{Name: fmt.Sprintf("%s%06d.tar", prefix, len(shards))}
+			shards = append(shards, shard)
+			size = 0
+		}
+		shard.Records = append(shard.Records, rec)
+		if size += rec.Size; size >= shardSize {
+			shard = nil
+		}
+	}
+	return
+}
+
+//===========
+//
+// target
+//
+//===========
+
+// /Rversion/Rsort/id[/step]
+func (t *targetrunner) dsortHandler(w http.ResponseWriter, r *http.Request) {
+	apitems := t.restAPIItems(r.URL.Path, 5)
+	if apitems = t.checkRestAPI(w, r, apitems, 1, Rversion, Rsort); apitems == nil {
+		return
+	}
+	id, step := apitems[0], ""
+	if len(apitems) > 1 {
+		step = apitems[1]
+	}
+	if r.Method == http.MethodPost && step == dsortStepInit {
+		t.dsortInit(w, r, id)
+		return
+	}
+	var x *xactDsort
+	if _, xx := t.xactinp.findL(ActDsort); xx != nil && xx.(*xactDsort).msg.ID == id {
+		x = xx.(*xactDsort)
+	} else {
+		t.invalmsghdlr(w, r, fmt.Sprintf("dsort %s %s", id, doesnotexist), http.StatusNotFound)
+		return
+	}
+	switch {
+	case r.Method == http.MethodPost && step == dsortStepStart:
+		go x.extraction(t.contextWithAuth(r))
+	case r.Method == http.MethodPut && step == dsortStepRecords:
+		x.recvRecords(w, r)
+	case r.Method == http.MethodGet && step == dsortStepRecords:
+		jsbytes, err := json.Marshal(x.sortRecords())
+		assert(err == nil, err)
+		t.writeJSON(w, r, jsbytes, "dsortrecords")
+	case r.Method == http.MethodPost && step == dsortStepFetch:
+		x.sendRecords(w, r)
+	case r.Method == http.MethodPost && step == dsortStepCreate:
+		var shards []*dsortShard
+		if t.readJSON(w, r, &shards) != nil {
+			return
+		}
+		x.Lock()
+		x.stats.ShardsToCreate = int64(len(shards))
+		x.Unlock()
+		x.setphase(DsortPhaseCreation)
+		go x.creation(t.contextWithAuth(r), shards)
+	case r.Method == http.MethodDelete && step == "":
+		x.cleanup()
+	default:
+		invalhdlr(w, r)
+	}
+}
+
+// POST /Rversion/Rsort/id/init
+func (t *targetrunner) dsortInit(w http.ResponseWriter, r *http.Request, id string) {
+	dmsg := &DsortMsg{}
+	if t.readJSON(w, r, dmsg) != nil {
+		return
+	}
+	if dmsg.ID != id {
+		t.invalmsghdlr(w, r, fmt.Sprintf("Invalid dsort request: id mismatch (%s, %s)", id, dmsg.ID))
+		return
+	}
+	if x := t.xactinp.renewDsort(t, dmsg); x == nil {
+		t.invalmsghdlr(w, r, "Another dsort is in progress", http.StatusConflict)
+		return
+	}
+}
+
+func (x *xactDsort) fail(errstr string) {
+	glog.Errorf("%s: %s", x.tostring(), errstr)
+	x.Lock()
+	if x.stats.Error == "" {
+		x.stats.Error = errstr
+	}
+	x.stats.Phase = DsortPhaseAborted
+	x.Unlock()
+}
+
+func (x *xactDsort) setphase(phase string) {
+	x.Lock()
+	if x.stats.Phase != DsortPhaseAborted {
+		x.stats.Phase = phase
+	}
+	x.Unlock()
+	glog.Infof("%s: %s", x.tostring(), phase)
+}
+
+func (x *xactDsort) aborted() bool {
+	select {
+	case <-x.abrt:
+		return true
+	default:
+		return false
+	}
+}
+
+func (x *xactDsort) newRecorder(remote bool) *dsortRecorder {
+	return &dsortRecorder{x: x, remote: remote, buf: selectslab(0).alloc()}
+}
+
+// recordfqn returns the name of a new record's work file
+func (x *xactDsort) recordfqn(key string) string {
+	x.Lock()
+	x.seq++
+	seq := x.seq
+	x.Unlock()
+	return filepath.Join(makePathDsort(hrwMpath(dsortdir, key), x.msg.ID), strconv.FormatInt(seq, 10))
+}
+
+func (x *xactDsort) addRecord(rec *dsortRecord, remote bool) (errstr string) {
+	x.Lock()
+	if x.sorted {
+		errstr = fmt.Sprintf("%s: record %s arrived too late", x.tostring(), rec.key)
+	} else {
+		x.records = append(x.records, rec)
+		if remote {
+			x.stats.RecordsRecv++
+		} else {
+			x.stats.RecordsKept++
+		}
+	}
+	x.Unlock()
+	return
+}
+
+//
+// phase 1: extraction
+//
+
+func (x *xactDsort) extraction(ct context.Context) {
+	t := x.targetrunner
+	glog.Infoln(x.tostring())
+	min, max, _ := parseRange(x.msg.Range) // validated by the proxy
+	objs, err := t.getListFromRange(ct, x.msg.Bucket, x.msg.Prefix, x.msg.Regex, min, max)
+	if err != nil {
+		x.fail(err.Error())
+		return
+	}
+	x.Lock()
+	x.stats.ShardsTotal = int64(len(objs))
+	x.Unlock()
+	for _, objname := range objs {
+		if x.aborted() {
+			x.fail("aborted")
+			return
+		}
+		if errstr := x.extractShard(ct, objname); errstr != "" {
+			x.fail(errstr)
+			return
+		}
+		x.Lock()
+		x.stats.ShardsExtracted++
+		x.Unlock()
+	}
+	x.setphase(DsortPhaseSorting)
+}
+
+// extractShard reads the input shard and delivers its records to their owners
+func (x *xactDsort) extractShard(ct context.Context, objname string) (errstr string) {
+	var (
+		t       = x.targetrunner
+		bucket  = x.msg.Bucket
+		islocal = t.bmdowner.get().islocal(bucket)
+		fqn     = t.fqn(bucket, objname, islocal)
+		uname   = uniquename(bucket, objname)
+	)
+	if _, err := os.Stat(fqn); os.IsNotExist(err) && !islocal {
+		// note: coldget() keeps the read lock if successful
+		if _, errstr, _ = t.coldget(ct, bucket, objname, false); errstr != "" {
+			return
+		}
+		t.rtnamemap.unlockname(uname, false)
+	}
+	t.rtnamemap.lockname(uname, false, &pendinginfo{Time: time.Now(), fqn: fqn}, time.Second)
+	defer t.rtnamemap.unlockname(uname, false)
+	file, err := os.Open(fqn)
+	if err != nil {
+		return fmt.Sprintf("Failed to open %s (%s/%s), err: %v", fqn, bucket, objname, err)
+	}
+	defer file.Close()
+	getatimerunner().touch(fqn)
+
+	local := x.newRecorder(false)
+	defer local.free()
+	senders := make(map[string]*dsortSender)
+	defer func() {
+		for _, sender := range senders {
+			if s := sender.close(); s != "" && errstr == "" {
+				errstr = s
+			}
+			x.Lock()
+			x.stats.RecordsSent += sender.count
+			x.Unlock()
+		}
+	}()
+	tr := tar.NewReader(file)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Sprintf("Failed to read shard %s/%s, err: %v", bucket, objname, err)
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+		key := dsortKey(hdr.Name)
+		si, errstr := HrwTarget(x.msg.OutputBucket, key, t.smap)
+		if errstr != "" {
+			return errstr
+		}
+		if si.DaemonID == t.si.DaemonID {
+			errstr = local.add(hdr, tr)
+		} else {
+			sender, ok := senders[si.DaemonID]
+			if !ok {
+				sender = x.newSender(si)
+				senders[si.DaemonID] = sender
+			}
+			errstr = sender.add(hdr, tr, local.buf)
+		}
+		if errstr != "" {
+			return fmt.Sprintf("Failed to extract %s from shard %s/%s: %s", hdr.Name, bucket, objname, errstr)
+		}
+	}
+	return local.finish()
+}
+
+func (rc *dsortRecorder) add(hdr *tar.Header, reader io.Reader) (errstr string) {
+	var err error
+	key := dsortKey(hdr.Name)
+	if rc.rec == nil || rc.rec.key != key {
+		if errstr = rc.finish(); errstr != "" {
+			return
+		}
+		fqn := rc.x.recordfqn(key)
+		if rc.file, err = CreateFile(fqn); err != nil {
+			rc.x.targetrunner.runFSKeeper(fqn)
+			return fmt.Sprintf("Failed to create %s, err: %v", fqn, err)
+		}
+		rc.rec = &dsortRecord{key: key, fqn: fqn}
+		rc.tw = tar.NewWriter(rc.file)
+	}
+	if err = rc.tw.WriteHeader(dsortHeader(hdr)); err == nil {
+		_, err = io.CopyBuffer(rc.tw, reader, rc.buf)
+	}
+	if err != nil {
+		return fmt.Sprintf("Failed to write %s, err: %v", rc.rec.fqn, err)
+	}
+	return
+}
+
+// finish stores the current record (padded, no trailer)
+func (rc *dsortRecorder) finish() (errstr string) {
+	if rc.rec == nil {
+		return
+	}
+	rec, file, tw := rc.rec, rc.file, rc.tw
+	rc.rec, rc.file, rc.tw = nil, nil, nil
+	err := tw.Flush()
+	if err == nil {
+		var finfo os.FileInfo
+		if finfo, err = file.Stat(); err == nil {
+			rec.size = finfo.Size()
+		}
+	}
+	if errc := file.Close(); err == nil {
+		err = errc
+	}
+	if err != nil {
+		return fmt.Sprintf("Failed to write %s, err: %v", rec.fqn, err)
+	}
+	return rc.x.addRecord(rec, rc.remote)
+}
+
+func (rc *dsortRecorder) free() {
+	if rc.file != nil {
+		rc.file.Close()
+	}
+	selectslab(0).free(rc.buf)
+}
+
+// dsortHeader leaves only the member's attributes that matter
+func dsortHeader(hdr *tar.Header) *tar.Header {
+	return &tar.Header{Typeflag: tar.TypeReg, Name: hdr.Name, Mode: hdr.Mode, Size: hdr.Size, ModTime: hdr.ModTime}
+}
+
+func (x *xactDsort) newSender(si *daemonInfo) *dsortSender {
+	t := x.targetrunner
+	pr, pw := io.Pipe()
+	sender := &dsortSender{si: si, pw: pw, tw: tar.NewWriter(pw), done: make(chan string, 1)}
+	go func() {
+		url := si.dataURL() + URLPath(Rversion, Rsort, x.msg.ID, dsortStepRecords)
+		errstr := t.dsortcall(si, http.MethodPut, url, pr, nil)
+		if errstr != "" {
+			pr.CloseWithError(errors.New(errstr)) // unblocks the writer
+		} else {
+			pr.Close()
+		}
+		sender.done <- errstr
+	}()
+	return sender
+}
+
+func (sender *dsortSender) add(hdr *tar.Header, reader io.Reader, buf []byte) string {
+	err := sender.tw.WriteHeader(dsortHeader(hdr))
+	if err == nil {
+		_, err = io.CopyBuffer(sender.tw, reader, buf)
+	}
+	if err != nil {
+		return fmt.Sprintf("failed to send to %s, err: %v", sender.si.DaemonID, err)
+	}
+	if key := dsortKey(hdr.Name); key != sender.lastkey || sender.count == 0 {
+		sender.lastkey = key
+		sender.count++
+	}
+	return ""
+}
+
+func (sender *dsortSender) close() string {
+	err := sender.tw.Close()
+	sender.pw.CloseWithError(err)
+	return <-sender.done
+}
+
+// dsortcall executes a target-to-target request; the response body, if requested, is left open
+func (t *targetrunner) dsortcall(si *daemonInfo, method, url string, body io.Reader, rbody *io.ReadCloser) (errstr string) {
+	request, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return fmt.Sprintf("Unexpected failure to create %s request %s, err: %v", method, url, err)
+	}
+	response, err := t.httpclientLongTimeout.Do(request)
+	if err != nil {
+		return fmt.Sprintf("Failed to %s %s, err: %v", method, url, err)
+	}
+	if err = t.checkPeer(si, response); err != nil {
+		response.Body.Close()
+		return fmt.Sprintf("Failed to %s %s, err: %v", method, url, err)
+	}
+	if response.StatusCode >= http.StatusBadRequest {
+		b, _ := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		return fmt.Sprintf("Failed to %s %s, status %d: %s", method, url, response.StatusCode, string(b))
+	}
+	if rbody != nil {
+		*rbody = response.Body
+		return
+	}
+	ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	return
+}
+
+// PUT /Rversion/Rsort/id/records
+func (x *xactDsort) recvRecords(w http.ResponseWriter, r *http.Request) {
+	t := x.targetrunner
+	if x.aborted() {
+		t.invalmsghdlr(w, r, fmt.Sprintf("%s: aborted", x.tostring()))
+		return
+	}
+	rc := x.newRecorder(true)
+	defer rc.free()
+	tr := tar.NewReader(r.Body)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.invalmsghdlr(w, r, fmt.Sprintf("Failed to receive records, err: %v", err))
+			return
+		}
+		if errstr := rc.add(hdr, tr); errstr != "" {
+			t.invalmsghdlr(w, r, errstr)
+			return
+		}
+	}
+	if errstr := rc.finish(); errstr != "" {
+		t.invalmsghdlr(w, r, errstr)
+	}
+}
+
+//
+// phase 2: sorting (by the proxy)
+//
+
+// sortRecords sorts the target's records by key (once) and returns their metadata
+func (x *xactDsort) sortRecords() []dsortRecordInfo {
+	x.Lock()
+	defer x.Unlock()
+	if !x.sorted {
+		sort.SliceStable(x.records, func(i, j int) bool { return x.records[i].key < x.records[j].key })
+		x.sorted = true
+	}
+	infos := make([]dsortRecordInfo, len(x.records))
+	for i, rec := range x.records {
+		infos[i] = dsortRecordInfo{Key: rec.key, Size: rec.size}
+	}
+	return infos
+}
+
+// POST /Rversion/Rsort/id/fetch - streams the records by index, back to back
+func (x *xactDsort) sendRecords(w http.ResponseWriter, r *http.Request) {
+	var (
+		t    = x.targetrunner
+		idxs []int
+	)
+	if t.readJSON(w, r, &idxs) != nil {
+		return
+	}
+	x.Lock()
+	sorted, n := x.sorted, len(x.records)
+	x.Unlock()
+	for _, idx := range idxs {
+		if !sorted || idx < 0 || idx >= n {
+			t.invalmsghdlr(w, r, fmt.Sprintf("%s: invalid record index %d (%d records)", x.tostring(), idx, n))
+			return
+		}
+	}
+	slab := selectslab(0)
+	buf := slab.alloc()
+	defer slab.free(buf)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	for _, idx := range idxs {
+		if errstr := x.copyRecord(w, idx, buf); errstr != "" {
+			glog.Errorln(errstr)
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
+
+func (x *xactDsort) copyRecord(w io.Writer, idx int, buf []byte) string {
+	rec := x.records[idx]
+	file, err := os.Open(rec.fqn)
+	if err != nil {
+		return fmt.Sprintf("Failed to open %s, err: %v", rec.fqn, err)
+	}
+	defer file.Close()
+	if _, err = io.CopyBuffer(w, file, buf); err != nil {
+		return fmt.Sprintf("Failed to copy record %s, err: %v", rec.key, err)
+	}
+	return ""
+}
+
+//
+// phase 3: creation
+//
+
+func (x *xactDsort) creation(ct context.Context, shards []*dsortShard) {
+	for _, shard := range shards {
+		if x.aborted() {
+			x.fail("aborted")
+			return
+		}
+		if errstr := x.createShard(ct, shard); errstr != "" {
+			x.fail(errstr)
+			return
+		}
+	}
+	x.setphase(DsortPhaseFinished)
+	x.etime = time.Now()
+	glog.Infoln(x.tostring())
+}
+
+func (x *xactDsort) createShard(ct context.Context, shard *dsortShard) (errstr string) {
+	var (
+		t      = x.targetrunner
+		bucket = x.msg.OutputBucket
+		idxs   = make(map[string][]int)
+		bodies = make(map[string]io.ReadCloser)
+	)
+	// one stream per target that stores any of the shard's records
+	for _, rec := range shard.Records {
+		if rec.Target != t.si.DaemonID {
+			idxs[rec.Target] = append(idxs[rec.Target], rec.Idx)
+		}
+	}
+	defer func() {
+		for _, body := range bodies {
+			body.Close()
+		}
+	}()
+	for tid, l := range idxs {
+		si := t.smap.get(tid)
+		if si == nil {
+			return fmt.Sprintf("Cannot create shard %s: target %s %s", shard.Name, tid, doesnotexist)
+		}
+		jsbytes, err := json.Marshal(l)
+		assert(err == nil, err)
+		var body io.ReadCloser
+		url := si.dataURL() + URLPath(Rversion, Rsort, x.msg.ID, dsortStepFetch)
+		if errstr = t.dsortcall(si, http.MethodPost, url, strings.NewReader(string(jsbytes)), &body); errstr != "" {
+			return
+		}
+		bodies[tid] = body
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(x.writeShard(pw, shard, bodies))
+	}()
+	fqn := t.fqn(bucket, shard.Name, true)
+	putfqn := t.fqn2workfile(fqn)
+	_, nhobj, written, errstr := t.receive(putfqn, shard.Name, "", nil, pr)
+	pr.Close()
+	if errstr != "" {
+		return
+	}
+	if errstr, _ = t.putCommit(ct, bucket, shard.Name, putfqn, fqn, &objectProps{nhobj: nhobj}, false /*rebalance*/); errstr != "" {
+		return
+	}
+	x.Lock()
+	x.stats.ShardsCreated++
+	x.stats.BytesCreated += written
+	x.Unlock()
+	return
+}
+
+// writeShard writes the shard's records in order followed by the tar trailer
+func (x *xactDsort) writeShard(w io.Writer, shard *dsortShard, bodies map[string]io.ReadCloser) error {
+	slab := selectslab(0)
+	buf := slab.alloc()
+	defer slab.free(buf)
+	for _, rec := range shard.Records {
+		if rec.Target == x.targetrunner.si.DaemonID {
+			if errstr := x.copyRecord(w, rec.Idx, buf); errstr != "" {
+				return errors.New(errstr)
+			}
+			continue
+		}
+		n, err := io.CopyBuffer(w, io.LimitReader(bodies[rec.Target], rec.Size), buf)
+		if err != nil {
+			return err
+		}
+		if n != rec.Size {
+			return fmt.Errorf("record %d from %s: expected %d bytes, got %d", rec.Idx, rec.Target, rec.Size, n)
+		}
+	}
+	_, err := w.Write(make([]byte, dsortTrailerSize))
+	return err
+}
+
+// DELETE /Rversion/Rsort/id
+func (x *xactDsort) cleanup() {
+	if !x.finished() {
+		x.abort()
+	}
+	for mpath := range ctx.mountpaths.Available {
+		dir := makePathDsort(mpath, x.msg.ID)
+		if err := os.RemoveAll(dir); err != nil {
+			glog.Errorf("Failed to remove %s, err: %v", dir, err)
+		}
+	}
+}
+
+//===========
+//
+// proxy
+//
+//===========
+
+// POST { action: dsort } /Rversion/Rbuckets/bucket-name
+func (p *proxyrunner) dsort(w http.ResponseWriter, r *http.Request, bucket string, msg *ActionMsg) {
+	if !p.checkPrimaryProxy("start distributed sort", w, r) {
+		return
+	}
+	dmsg, errstr := parseDsortMsg(msg.Value)
+	if errstr != "" {
+		p.invalmsghdlr(w, r, errstr)
+		return
+	}
+	if !p.bmdowner.get().islocal(dmsg.OutputBucket) {
+		p.invalmsghdlr(w, r, fmt.Sprintf("Dsort destination: local bucket %s %s", dmsg.OutputBucket, doesnotexist))
+		return
+	}
+	dmsg.Bucket = bucket
+	dmsg.ID = strconv.FormatInt(time.Now().UnixNano(), 16)
+	x := p.xactinp.renewDsortProxy(p, dmsg)
+	if x == nil {
+		p.invalmsghdlr(w, r, "Another dsort is in progress", http.StatusConflict)
+		return
+	}
+	jsbytes, err := json.Marshal(dmsg)
+	assert(err == nil, err)
+	errstr = p.dsortBroadcast(dmsg, dsortStepInit, http.MethodPost, jsbytes)
+	if errstr == "" {
+		errstr = p.dsortBroadcast(dmsg, dsortStepStart, http.MethodPost, nil)
+	}
+	if errstr != "" {
+		x.finish(errstr)
+		p.invalmsghdlr(w, r, errstr)
+		return
+	}
+	glog.Infoln(x.tostring())
+	go x.run()
+}
+
+func (p *proxyrunner) dsortBroadcast(dmsg *DsortMsg, step, method string, body []byte) (errstr string) {
+	results := p.broadcastTargets(URLPath(Rversion, Rsort, dmsg.ID, step), nil, method, body, p.smap, 0)
+	for result := range results {
+		if result.err != nil && errstr == "" {
+			errstr = fmt.Sprintf("Dsort %s: %s %q failed on %s, err: %v (%d: %s)",
+				dmsg.ID, method, step, result.si.DaemonID, result.err, result.status, result.errstr)
+		}
+	}
+	return
+}
+
+func (x *xactDsortProxy) run() {
+	var (
+		p      = x.proxyrunner
+		errstr = x.wait(DsortPhaseSorting)
+		shards map[string][]*dsortShard
+	)
+	if errstr == "" {
+		shards, errstr = x.sort()
+	}
+	for tid, l := range shards {
+		if errstr != "" {
+			break
+		}
+		jsbytes, err := json.Marshal(l)
+		assert(err == nil, err)
+		si := p.smap.get(tid)
+		res := p.call(nil, si, si.controlURL()+URLPath(Rversion, Rsort, x.msg.ID, dsortStepCreate), http.MethodPost, jsbytes)
+		if res.err != nil {
+			errstr = fmt.Sprintf("Dsort %s: failed to start creating shards on %s, err: %v (%s)", x.msg.ID, tid, res.err, res.errstr)
+		}
+	}
+	if errstr == "" {
+		errstr = x.wait(DsortPhaseFinished)
+	}
+	x.finish(errstr)
+}
+
+// wait polls the targets until all of them reach the phase
+func (x *xactDsortProxy) wait(phase string) string {
+	p := x.proxyrunner
+	q := url.Values{}
+	q.Set(URLParamWhat, GetWhatXaction)
+	q.Set(URLParamProps, XactionDsort)
+	for {
+		select {
+		case <-x.abrt:
+			return "aborted"
+		case <-time.After(dsortPollInterval):
+		}
+		results := p.broadcastTargets(URLPath(Rversion, Rdaemon), q, http.MethodGet, nil, p.smap)
+		done := true
+		for result := range results {
+			if result.err != nil {
+				return fmt.Sprintf("Failed to get dsort progress from %s, err: %v (%s)", result.si.DaemonID, result.err, result.errstr)
+			}
+			stats := DsortTargetStats{}
+			if err := json.Unmarshal(result.outjson, &stats); err != nil {
+				return fmt.Sprintf("Failed to unmarshal dsort progress from %s, err: %v", result.si.DaemonID, err)
+			}
+			if stats.Phase == DsortPhaseAborted {
+				return fmt.Sprintf("aborted on %s: %s", result.si.DaemonID, stats.Error)
+			}
+			if stats.Phase != phase {
+				done = false
+			}
+		}
+		if done {
+			return ""
+		}
+	}
+}
+
+// sort collects the records of all targets, orders them and assigns the output shards to targets
+func (x *xactDsortProxy) sort() (shards map[string][]*dsortShard, errstr string) {
+	var (
+		p       = x.proxyrunner
+		records []dsortShardRecord
+	)
+	results := p.broadcastTargets(URLPath(Rversion, Rsort, x.msg.ID, dsortStepRecords), nil, http.MethodGet, nil, p.smap, 0)
+	for result := range results {
+		if result.err != nil {
+			return nil, fmt.Sprintf("Failed to get dsort records from %s, err: %v (%s)", result.si.DaemonID, result.err, result.errstr)
+		}
+		var infos []dsortRecordInfo
+		if err := json.Unmarshal(result.outjson, &infos); err != nil {
+			return nil, fmt.Sprintf("Failed to unmarshal dsort records from %s, err: %v", result.si.DaemonID, err)
+		}
+		for i, info := range infos {
+			records = append(records, dsortShardRecord{Target: result.si.DaemonID, Idx: i, Size: info.Size, key: info.Key})
+		}
+	}
+	seed := x.msg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	orderDsortRecords(records, x.msg.Order, seed)
+	shards = make(map[string][]*dsortShard)
+	for tid := range p.smap.Tmap {
+		shards[tid] = []*dsortShard{} // every target must move on to the creation phase
+	}
+	cut := cutDsortShards(records, x.msg.OutputPrefix, x.msg.ShardSize)
+	for _, shard := range cut {
+		si, errstr := HrwTarget(x.msg.OutputBucket, shard.Name, p.smap)
+		if errstr != "" {
+			return nil, errstr
+		}
+		shards[si.DaemonID] = append(shards[si.DaemonID], shard)
+	}
+	glog.Infof("Dsort %s: %d records => %d shards", x.msg.ID, len(records), len(cut))
+	return
+}
+
+// finish removes the work files on all targets
+func (x *xactDsortProxy) finish(errstr string) {
+	p := x.proxyrunner
+	if s := p.dsortBroadcast(x.msg, "", http.MethodDelete, nil); s != "" {
+		glog.Errorln(s)
+	}
+	if errstr != "" {
+		glog.Errorf("%s failed: %s", x.tostring(), errstr)
+	}
+	x.etime = time.Now()
+	glog.Infoln(x.tostring())
+	p.xactinp.del(x.id)
+}
+
+//
+// xaction
+//
+
+func (q *xactInProgress) renewDsort(t *targetrunner, dmsg *DsortMsg) *xactDsort {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	_, xx := q.findU(ActDsort)
+	if xx != nil {
+		x := xx.(*xactDsort)
+		if !x.finished() {
+			glog.Infof("%s already running, nothing to do", x.tostring())
+			return nil
+		}
+		// the finished one is kept for its stats until the next one
+		k, _ := q.findU(x.id)
+		q.xactinp = append(q.xactinp[:k], q.xactinp[k+1:]...)
+	}
+	id := q.uniqueid()
+	x := &xactDsort{xactBase: *newxactBase(id, ActDsort), targetrunner: t, msg: dmsg}
+	x.stats.Phase = DsortPhaseExtraction
+	q.add(x)
+	return x
+}
+
+func (xact *xactDsort) tostring() string {
+	start := xact.stime.Sub(xact.targetrunner.starttime())
+	if !xact.finished() {
+		return fmt.Sprintf("xaction %s:%d %s %s => %s started %v", xact.kind, xact.id, xact.msg.ID,
+			xact.msg.Bucket, xact.msg.OutputBucket, start)
+	}
+	fin := time.Since(xact.targetrunner.starttime())
+	return fmt.Sprintf("xaction %s:%d %s %s => %s started %v finished %v", xact.kind, xact.id, xact.msg.ID,
+		xact.msg.Bucket, xact.msg.OutputBucket, start, fin)
+}
+
+func (xact *xactDsort) abort() {
+	xact.xactBase.abort()
+	xact.Lock()
+	if xact.stats.Phase != DsortPhaseFinished {
+		xact.stats.Phase = DsortPhaseAborted
+	}
+	xact.Unlock()
+	glog.Infof("ABORT: " + xact.tostring())
+}
+
+func (q *xactInProgress) renewDsortProxy(p *proxyrunner, dmsg *DsortMsg) *xactDsortProxy {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	_, xx := q.findU(ActDsort)
+	if xx != nil {
+		glog.Infof("%s already running, nothing to do", xx.tostring())
+		return nil
+	}
+	id := q.uniqueid()
+	x := &xactDsortProxy{xactBase: *newxactBase(id, ActDsort), proxyrunner: p, msg: dmsg}
+	q.add(x)
+	return x
+}
+
+func (xact *xactDsortProxy) tostring() string {
+	start := xact.stime.Sub(xact.proxyrunner.starttime)
+	if !xact.finished() {
+		return fmt.Sprintf("xaction %s:%d %s %s => %s started %v", xact.kind, xact.id, xact.msg.ID,
+			xact.msg.Bucket, xact.msg.OutputBucket, start)
+	}
+	fin := time.Since(xact.proxyrunner.starttime)
+	return fmt.Sprintf("xaction %s:%d %s %s => %s started %v finished %v", xact.kind, xact.id, xact.msg.ID,
+		xact.msg.Bucket, xact.msg.OutputBucket, start, fin)
+}
+
+func (xact *xactDsortProxy) abort() {
+	xact.xactBase.abort()
+	glog.Infof("ABORT: " + xact.tostring())
+}
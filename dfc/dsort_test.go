@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDsortKey(t *testing.T) {
+	tests := map[string]string{
+		"0001.jpg":         "0001",
+		"0001.seg.png":     "0001",
+		"a/b.c/0001.cls":   "a/b.c/0001",
+		"noext":            "noext",
+		"dir/.hidden":      "dir/.hidden",
+		"dir/.hidden.json": "dir/.hidden",
+	}
+	for name, exp := range tests {
+		if key := dsortKey(name); key != exp {
+			t.Errorf("%s: expected key %q, got %q", name, exp, key)
+		}
+	}
+}
+
+func testDsortRecords() []dsortShardRecord {
+	return []dsortShardRecord{
+		{Target: "t2", Idx: 0, Size: 10, key: "b"},
+		{Target: "t1", Idx: 0, Size: 10, key: "a"},
+		{Target: "t1", Idx: 1, Size: 10, key: "c"},
+		{Target: "t2", Idx: 1, Size: 10, key: "d"},
+		{Target: "t3", Idx: 0, Size: 10, key: "e"},
+	}
+}
+
+func dsortKeys(records []dsortShardRecord) (keys []string) {
+	for _, rec := range records {
+		keys = append(keys, rec.key)
+	}
+	return
+}
+
+func TestOrderDsortRecords(t *testing.T) {
+	records := testDsortRecords()
+	orderDsortRecords(records, GetSortAsc, 0)
+	if keys, exp := dsortKeys(records), []string{"a", "b", "c", "d", "e"}; !reflect.DeepEqual(keys, exp) {
+		t.Errorf("ascending: expected %v, got %v", exp, keys)
+	}
+	orderDsortRecords(records, GetSortDes, 0)
+	if keys, exp := dsortKeys(records), []string{"e", "d", "c", "b", "a"}; !reflect.DeepEqual(keys, exp) {
+		t.Errorf("descending: expected %v, got %v", exp, keys)
+	}
+
+	// the same seed yields the same order regardless of the order in which the records were collected
+	shuffled := testDsortRecords()
+	orderDsortRecords(shuffled, DsortOrderShuffle, 42)
+	orderDsortRecords(records, DsortOrderShuffle, 42)
+	if !reflect.DeepEqual(dsortKeys(shuffled), dsortKeys(records)) {
+		t.Errorf("shuffle: expected the same order, got %v and %v", dsortKeys(shuffled), dsortKeys(records))
+	}
+}
+
+func TestCutDsortShards(t *testing.T) {
+	records := testDsortRecords()
+	orderDsortRecords(records, GetSortAsc, 0)
+	shards := cutDsortShards(records, "out-", 20)
+	if len(shards) != 3 {
+		t.Fatalf("expected 3 shards, got %d", len(shards))
+	}
+	for i, exp := range []struct {
+		name string
+		keys []string
+	}{
+		{"out-000000.tar", []string{"a", "b"}},
+		{"out-000001.tar", []string{"c", "d"}},
+		{"out-000002.tar", []string{"e"}},
+	} {
+		if shards[i].Name != exp.name || !reflect.DeepEqual(dsortKeys(shards[i].Records), exp.keys) {
+			t.Errorf("shard #%d: expected %s %v, got %s %v", i, exp.name, exp.keys, shards[i].Name, dsortKeys(shards[i].Records))
+		}
+	}
+	if shards = cutDsortShards(nil, "out-", 20); len(shards) != 0 {
+		t.Errorf("expected no shards, got %d", len(shards))
+	}
+}
+
+func TestParseDsortMsg(t *testing.T) {
+	dmsg, errstr := parseDsortMsg(map[string]interface{}{"output_bucket": "out", "shard_size": 1024.0, "range": "1:10"})
+	if errstr != "" {
+		t.Fatal(errstr)
+	}
+	if dmsg.OutputPrefix != dsortDefaultPrefix || dmsg.Order != GetSortAsc || dmsg.ShardSize != 1024 {
+		t.Errorf("unexpected defaults: %+v", dmsg)
+	}
+	for _, value := range []interface{}{
+		nil,
+		"out",
+		map[string]interface{}{"shard_size": 1024.0},
+		map[string]interface{}{"output_bucket": "out"},
+		map[string]interface{}{"output_bucket": "out", "shard_size": 1024.0, "order": "random"},
+		map[string]interface{}{"output_bucket": "out", "shard_size": 1024.0, "range": "a:b"},
+	} {
+		if _, errstr = parseDsortMsg(value); errstr == "" {
+			t.Errorf("expected error for %v", value)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// On-target object transformation (ETL): GET /v1/objects/bucket-name/object-name[?transform=name]
+//
+// The transformers are configured by name (see etlconf) and run on the target that stores the
+// object: either a local command that reads the object from its stdin and writes the result to
+// its stdout, or a local HTTP server that responds to POST <url>?bucket=...&objname=... with
+// the transformed body. A transformer is requested per GET or bound to the bucket
+// (BucketProps.Transform) - in the latter case, GET ?transform=none returns the original.
+// The result is spooled to a work file and then sent, so that a failed transformation is
+// reported with an error status. Results of the transformers configured with "cache" are kept
+// as derived objects under <mountpath>/<etldir>/transformer-name/bucket-name/ and reused until
+// the object is modified.
+const (
+	etldir          = ".etl"
+	etlStderrMaxLen = 1024 // the command's stderr (tail) included in the error message
+)
+
+func validateTransformers(transformers map[string]*transformerconf) (err error) {
+	for name, tc := range transformers {
+		if name == "" || name == TransformNone || strings.Contains(name, "/") {
+			return fmt.Errorf("Invalid transformer name %q", name)
+		}
+		if (len(tc.Command) == 0) == (tc.URL == "") {
+			return fmt.Errorf("Invalid transformer %s: expecting either command or url", name)
+		}
+		if tc.URL != "" {
+			if _, err = url.ParseRequestURI(tc.URL); err != nil {
+				return fmt.Errorf("Invalid transformer %s url %s, err: %v", name, tc.URL, err)
+			}
+		}
+		if tc.Timeout, err = time.ParseDuration(tc.TimeoutStr); err != nil {
+			return fmt.Errorf("Bad transformer %s timeout format %s, err: %v", name, tc.TimeoutStr, err)
+		}
+	}
+	return
+}
+
+// transformerName returns the name of the transformer requested by the GET or bound to the bucket
+func transformerName(r *http.Request, bucketmd *bucketMD, bucket string, islocal bool) (name, errstr string) {
+	name = r.URL.Query().Get(URLParamTransform)
+	if name == "" {
+		_, props := bucketmd.get(bucket, islocal)
+		name = props.Transform
+	}
+	if name == TransformNone {
+		return "", ""
+	}
+	if _, ok := ctx.config.ETL.Transformers[name]; name != "" && !ok {
+		errstr = fmt.Sprintf("Unknown transformer %q", name)
+	}
+	return
+}
+
+func etlfqn(tname, bucket, objname string) string {
+	return filepath.Join(hrwMpath(bucket, objname), etldir, tname, bucket, objname)
+}
+
+// run transforms the reader's content into the writer
+func (tc *transformerconf) run(bucket, objname string, reader io.Reader, writer io.Writer) error {
+	ct, cancel := context.WithTimeout(context.Background(), tc.Timeout)
+	defer cancel()
+	if len(tc.Command) > 0 {
+		stderr := &bytes.Buffer{}
+		cmd := exec.CommandContext(ct, tc.Command[0], tc.Command[1:]...)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = reader, writer, stderr
+		cmd.Env = append(os.Environ(), "DFC_BUCKET="+bucket, "DFC_OBJNAME="+objname)
+		if err := cmd.Run(); err != nil {
+			s := stderr.String()
+			if len(s) > etlStderrMaxLen {
+				s = s[len(s)-etlStderrMaxLen:]
+			}
+			return fmt.Errorf("%v (%s)", err, strings.TrimSpace(s))
+		}
+		return nil
+	}
+	q := url.Values{}
+	q.Set("bucket", bucket)
+	q.Set("objname", objname)
+	request, err := http.NewRequest(http.MethodPost, tc.URL+"?"+q.Encode(), reader)
+	if err != nil {
+		return err
+	}
+	response, err := http.DefaultClient.Do(request.WithContext(ct))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= http.StatusBadRequest {
+		b := make([]byte, etlStderrMaxLen)
+		n, _ := io.ReadFull(response.Body, b)
+		return fmt.Errorf("status %d: %s", response.StatusCode, strings.TrimSpace(string(b[:n])))
+	}
+	_, err = io.Copy(writer, response.Body)
+	return err
+}
+
+// transform sends the transformed object; the caller holds the object's read lock
+func (t *targetrunner) transform(w http.ResponseWriter, r *http.Request, bucket, objname, fqn, tname string, cache bool) {
+	var (
+		started = time.Now()
+		tc      = ctx.config.ETL.Transformers[tname]
+		dfqn    = etlfqn(tname, bucket, objname)
+		sendfqn = dfqn
+		hit     bool
+	)
+	cache = cache && tc.Cache
+	if cache {
+		hit = etlCached(fqn, dfqn)
+	}
+	if !hit {
+		workfqn := t.fqn2workfile(dfqn)
+		if errstr := t.runTransformer(tc, bucket, objname, fqn, workfqn); errstr != "" {
+			t.invalmsghdlr(w, r, fmt.Sprintf("Failed to transform %s/%s with %s: %s", bucket, objname, tname, errstr),
+				http.StatusInternalServerError)
+			return
+		}
+		sendfqn = workfqn
+		if cache {
+			if err := os.Rename(workfqn, dfqn); err != nil {
+				glog.Errorf("Failed to cache %s/%s transformed with %s, err: %v", bucket, objname, tname, err)
+			} else {
+				sendfqn = dfqn
+			}
+		}
+		if sendfqn == workfqn {
+			defer func() {
+				if err := os.Remove(workfqn); err != nil {
+					glog.Errorf("Failed to remove %s, err: %v", workfqn, err)
+				}
+			}()
+		}
+	}
+	file, err := os.Open(sendfqn)
+	if err != nil {
+		t.invalmsghdlr(w, r, fmt.Sprintf("Failed to open %s, err: %v", sendfqn, err), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+	finfo, err := file.Stat()
+	if err != nil {
+		t.invalmsghdlr(w, r, fmt.Sprintf("Failed to fstat %s, err: %v", sendfqn, err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(finfo.Size(), 10))
+	slab := selectslab(finfo.Size())
+	buf := slab.alloc()
+	defer slab.free(buf)
+	if _, err = io.CopyBuffer(w, file, buf); err != nil {
+		glog.Errorln(t.errHTTP(r, fmt.Sprintf("Failed to send %s, err: %v", sendfqn, err), http.StatusInternalServerError))
+		t.statsif.add("numerr", 1)
+		return
+	}
+	getatimerunner().touch(fqn)
+	if hit {
+		t.statsif.add("numtransformhit", 1)
+	} else {
+		t.statsif.add("numtransformed", 1)
+	}
+	if glog.V(4) {
+		glog.Infof("GET: %s/%s transformed with %s (cached: %t), %.2f MB, %d µs", bucket, objname, tname, hit,
+			float64(finfo.Size())/MiB, time.Since(started)/1000)
+	}
+}
+
+// etlCached returns true if the derived object exists and is not older than the object
+func etlCached(fqn, dfqn string) bool {
+	dfinfo, err := os.Stat(dfqn)
+	if err != nil {
+		return false
+	}
+	finfo, err := os.Stat(fqn)
+	return err == nil && !dfinfo.ModTime().Before(finfo.ModTime())
+}
+
+func (t *targetrunner) runTransformer(tc *transformerconf, bucket, objname, fqn, workfqn string) (errstr string) {
+	file, err := os.Open(fqn)
+	if err != nil {
+		return fmt.Sprintf("failed to open %s, err: %v", fqn, err)
+	}
+	defer file.Close()
+	workfile, err := CreateFile(workfqn)
+	if err != nil {
+		t.runFSKeeper(workfqn)
+		return fmt.Sprintf("failed to create %s, err: %v", workfqn, err)
+	}
+	err = tc.run(bucket, objname, file, workfile)
+	if errc := workfile.Close(); err == nil {
+		err = errc
+	}
+	if err != nil {
+		if errr := os.Remove(workfqn); errr != nil {
+			glog.Errorf("Failed to remove %s, err: %v", workfqn, errr)
+		}
+		return err.Error()
+	}
+	return
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateTransformers(t *testing.T) {
+	valid := map[string]*transformerconf{
+		"upper":  {Command: []string{"tr", "a-z", "A-Z"}, TimeoutStr: "10s"},
+		"resize": {URL: "http://localhost:9000/resize", TimeoutStr: "1m", Cache: true},
+	}
+	if err := validateTransformers(valid); err != nil {
+		t.Fatal(err)
+	}
+	if valid["upper"].Timeout != 10*time.Second {
+		t.Errorf("expected timeout 10s, got %v", valid["upper"].Timeout)
+	}
+	for _, invalid := range []map[string]*transformerconf{
+		{TransformNone: {Command: []string{"cat"}, TimeoutStr: "1s"}},
+		{"a/b": {Command: []string{"cat"}, TimeoutStr: "1s"}},
+		{"both": {Command: []string{"cat"}, URL: "http://localhost:9000", TimeoutStr: "1s"}},
+		{"neither": {TimeoutStr: "1s"}},
+		{"badurl": {URL: "localhost", TimeoutStr: "1s"}},
+		{"notimeout": {Command: []string{"cat"}}},
+	} {
+		if err := validateTransformers(invalid); err == nil {
+			t.Errorf("expected error for %v", invalid)
+		}
+	}
+}
+
+func TestTransformerCommand(t *testing.T) {
+	tc := &transformerconf{Command: []string{"sh", "-c", `tr a-z A-Z; printf " $DFC_BUCKET/$DFC_OBJNAME"`}, Timeout: 10 * time.Second}
+	out := &bytes.Buffer{}
+	if err := tc.run("bck", "obj", strings.NewReader("hello"), out); err != nil {
+		t.Fatal(err)
+	}
+	if exp := "HELLO bck/obj"; out.String() != exp {
+		t.Errorf("expected %q, got %q", exp, out.String())
+	}
+
+	tc = &transformerconf{Command: []string{"sh", "-c", "echo cannot decode >&2; exit 3"}, Timeout: 10 * time.Second}
+	err := tc.run("bck", "obj", strings.NewReader("hello"), ioutil.Discard)
+	if err == nil || !strings.Contains(err.Error(), "cannot decode") {
+		t.Errorf("expected error with stderr, got %v", err)
+	}
+
+	tc = &transformerconf{Command: []string{"sleep", "10"}, Timeout: 100 * time.Millisecond}
+	if err = tc.run("bck", "obj", strings.NewReader(""), ioutil.Discard); err == nil {
+		t.Error("expected timeout error")
+	}
+}
+
+func TestTransformerHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		if r.Method != http.MethodPost || r.URL.Query().Get("objname") == "" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.Write(bytes.ToUpper(b))
+	}))
+	defer server.Close()
+
+	tc := &transformerconf{URL: server.URL, Timeout: 10 * time.Second}
+	out := &bytes.Buffer{}
+	if err := tc.run("bck", "obj", strings.NewReader("hello"), out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "HELLO" {
+		t.Errorf("expected %q, got %q", "HELLO", out.String())
+	}
+	if err := tc.run("bck", "", strings.NewReader("hello"), ioutil.Discard); err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("expected status 400 error, got %v", err)
+	}
+}
@@ -0,0 +1,298 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// Archive upload with extraction: PUT /v1/objects/bucket-name/archive-name?extract=true[&prefix=...][&format=...]
+//
+// The proxy redirects the request to the HRW target of the archive (the archive itself is not stored).
+// The latter reads the archive member by member: each regular file becomes the object named
+// prefix + member-name that is received (and checksummed) locally and then either committed
+// (when this target owns it) or PUT to its owner along with the checksum, so that the owner
+// can validate what it receives. Tar and gzipped tar are parsed as they stream in, while zip -
+// that keeps its directory at the end - is spooled to a work file first.
+// The response reports the number and the total size of the extracted objects, and the members
+// that could not be extracted (the extraction continues past them unless the archive is corrupted).
+
+type extractctx struct {
+	t       *targetrunner
+	ct      context.Context
+	bucket  string
+	prefix  string
+	islocal bool
+	result  *ExtractResult
+}
+
+// archiveFormat determines the format by the archive's extension
+func archiveFormat(objname string) (format, errstr string) {
+	switch {
+	case strings.HasSuffix(objname, ".tar"):
+		format = ExtractFormatTar
+	case strings.HasSuffix(objname, ".tgz"), strings.HasSuffix(objname, ".tar.gz"):
+		format = ExtractFormatTgz
+	case strings.HasSuffix(objname, ".zip"):
+		format = ExtractFormatZip
+	default:
+		errstr = fmt.Sprintf("Cannot determine the format of %s: expecting one of the extensions .tar, .tgz, .tar.gz, .zip "+
+			"or the %q parameter", objname, URLParamFormat)
+	}
+	return
+}
+
+// memberObjname validates the member's name and returns the name of the object to extract it into
+func (ectx *extractctx) memberObjname(name string) (objname, errstr string) {
+	name = strings.TrimPrefix(name, "./")
+	if name == "" || name == ".." || strings.HasPrefix(name, "../") || path.IsAbs(name) || path.Clean(name) != name {
+		return "", fmt.Sprintf("invalid member name %q", name)
+	}
+	return ectx.prefix + name, ""
+}
+
+// PUT /Rversion/Robjects/bucket-name/archive-name?extract=true
+func (t *targetrunner) extract(w http.ResponseWriter, r *http.Request, bucket, objname string) {
+	var (
+		err     error
+		started = time.Now()
+		query   = r.URL.Query()
+		format  = query.Get(URLParamFormat)
+		errstr  string
+	)
+	if format == "" {
+		if format, errstr = archiveFormat(objname); errstr != "" {
+			t.invalmsghdlr(w, r, errstr)
+			return
+		}
+	}
+	ectx := &extractctx{
+		t:       t,
+		ct:      t.contextWithAuth(r),
+		bucket:  bucket,
+		prefix:  query.Get(URLParamPrefix),
+		islocal: t.bmdowner.get().islocal(bucket),
+		result:  &ExtractResult{Errors: []ExtractError{}},
+	}
+	switch format {
+	case ExtractFormatTar:
+		err = ectx.untar(r.Body)
+	case ExtractFormatTgz:
+		var gzr *gzip.Reader
+		if gzr, err = gzip.NewReader(r.Body); err == nil {
+			err = ectx.untar(gzr)
+			gzr.Close()
+		}
+	case ExtractFormatZip:
+		err = ectx.unzip(r.Body, t.fqn2workfile(t.fqn(bucket, objname, ectx.islocal)))
+	default:
+		t.invalmsghdlr(w, r, fmt.Sprintf("Invalid archive format %q: expecting one of: %s, %s, %s",
+			format, ExtractFormatTar, ExtractFormatTgz, ExtractFormatZip))
+		return
+	}
+	res := ectx.result
+	t.statsif.addMany("numextracted", res.Objects, "bytesextracted", res.Bytes)
+	if err != nil {
+		t.invalmsghdlr(w, r, fmt.Sprintf("Failed to extract %s/%s (%d objects extracted, %d failed), err: %v",
+			bucket, objname, res.Objects, len(res.Errors), err))
+		return
+	}
+	if glog.V(3) {
+		glog.Infof("Extracted %s/%s: %d objects, %.2f MB, %d errors, %d µs", bucket, objname,
+			res.Objects, float64(res.Bytes)/MiB, len(res.Errors), time.Since(started)/1000)
+	}
+	jsbytes, err := json.Marshal(res)
+	assert(err == nil, err)
+	t.writeJSON(w, r, jsbytes, "extract")
+}
+
+func (ectx *extractctx) untar(reader io.Reader) error {
+	tr := tar.NewReader(reader)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+		case tar.TypeReg, tar.TypeRegA:
+			ectx.member(hdr.Name, tr)
+		default:
+			ectx.fail(hdr.Name, fmt.Sprintf("unsupported type of archive member (%c)", hdr.Typeflag))
+		}
+	}
+}
+
+func (ectx *extractctx) unzip(reader io.Reader, workfqn string) error {
+	file, err := CreateFile(workfqn)
+	if err != nil {
+		ectx.t.runFSKeeper(workfqn)
+		return err
+	}
+	defer func() {
+		file.Close()
+		if err := os.Remove(workfqn); err != nil {
+			glog.Errorf("Failed to remove %s, err: %v", workfqn, err)
+		}
+	}()
+	slab := selectslab(0)
+	buf := slab.alloc()
+	size, err := io.CopyBuffer(file, reader, buf)
+	slab.free(buf)
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(file, size)
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		mode := f.Mode()
+		if mode.IsDir() {
+			continue
+		}
+		if !mode.IsRegular() {
+			ectx.fail(f.Name, fmt.Sprintf("unsupported type of archive member (%v)", mode))
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			ectx.fail(f.Name, err.Error())
+			continue
+		}
+		ectx.member(f.Name, rc)
+		rc.Close()
+	}
+	return nil
+}
+
+func (ectx *extractctx) fail(name, errstr string) {
+	glog.Errorf("Failed to extract %s into %s: %s", name, ectx.bucket, errstr)
+	ectx.result.Errors = append(ectx.result.Errors, ExtractError{Name: name, Error: errstr})
+}
+
+// member extracts a single archive member
+func (ectx *extractctx) member(name string, reader io.Reader) {
+	t := ectx.t
+	objname, errstr := ectx.memberObjname(name)
+	if errstr != "" {
+		ectx.fail(name, errstr)
+		return
+	}
+	si, errstr := HrwTarget(ectx.bucket, objname, t.smap)
+	if errstr != "" {
+		ectx.fail(name, errstr)
+		return
+	}
+	fqn := t.fqn(ectx.bucket, objname, ectx.islocal)
+	putfqn := t.fqn2workfile(fqn)
+	_, nhobj, written, errstr := t.receive(putfqn, objname, "", nil, reader)
+	if errstr != "" {
+		ectx.fail(name, errstr)
+		return
+	}
+	if si.DaemonID == t.si.DaemonID {
+		errstr, _ = t.putCommit(ectx.ct, ectx.bucket, objname, putfqn, fqn, &objectProps{nhobj: nhobj}, false /*rebalance*/)
+	} else {
+		errstr = t.forwardput(putfqn, ectx.bucket, objname, si, nhobj, ectx.islocal)
+		if err := os.Remove(putfqn); err != nil {
+			glog.Errorf("Failed to remove %s, err: %v", putfqn, err)
+		}
+	}
+	if errstr != "" {
+		ectx.fail(name, errstr)
+		return
+	}
+	ectx.result.Objects++
+	ectx.result.Bytes += written
+}
+
+// forwardedBy returns true if the PUT comes from the (other) target it claims
+// to be forwarded by (see forwardput): the target must present its certificate
+// with mTLS, or sign the request when AuthN is enabled; otherwise, one of the
+// target's addresses (public or intra-cluster) must match the sender's
+func (t *targetrunner) forwardedBy(r *http.Request, daemonID string) bool {
+	si, ok := t.smap.Tmap[daemonID]
+	if !ok || daemonID == t.si.DaemonID {
+		return false
+	}
+	if t.certs != nil {
+		return peerDaemonID(r.TLS) == daemonID
+	}
+	if ctx.config.Auth.Enabled {
+		return signedDaemonID(r) == daemonID
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	if host == si.NodeIPAddr {
+		return true
+	}
+	for _, u := range []string{si.IntraControlURL, si.IntraDataURL} {
+		if u == "" {
+			continue
+		}
+		if parsed, err := url.Parse(u); err == nil && parsed.Hostname() == host {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardput PUTs the (locally received) object to its owner, along with the checksum
+func (t *targetrunner) forwardput(putfqn, bucket, objname string, si *daemonInfo, nhobj cksumvalue, islocal bool) string {
+	file, err := os.Open(putfqn)
+	if err != nil {
+		return fmt.Sprintf("Failed to open %s, err: %v", putfqn, err)
+	}
+	defer file.Close()
+	q := url.Values{}
+	q.Set(URLParamLocal, fmt.Sprintf("%t", islocal))
+	q.Set(URLParamDaemonID, t.si.DaemonID)
+	url := si.dataURL() + URLPath(Rversion, Robjects, bucket, objname) + "?" + q.Encode()
+	request, err := http.NewRequest(http.MethodPut, url, file)
+	if err != nil {
+		return fmt.Sprintf("Unexpected failure to create PUT request %s, err: %v", url, err)
+	}
+	if nhobj != nil {
+		htype, hval := nhobj.get()
+		request.Header.Set(HeaderDfcChecksumType, htype)
+		request.Header.Set(HeaderDfcChecksumVal, hval)
+	}
+	response, err := t.httpclientLongTimeout.Do(request)
+	if err != nil {
+		return fmt.Sprintf("Failed to PUT %s/%s => %s, err: %v", bucket, objname, si.DaemonID, err)
+	}
+	b, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err == nil && response.StatusCode >= http.StatusBadRequest {
+		err = fmt.Errorf("status %d: %s", response.StatusCode, string(b))
+	}
+	if err != nil {
+		return fmt.Sprintf("Failed to PUT %s/%s => %s, err: %v", bucket, objname, si.DaemonID, err)
+	}
+	return ""
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestArchiveFormat(t *testing.T) {
+	for name, exp := range map[string]string{
+		"a.tar":        ExtractFormatTar,
+		"dir/a.tgz":    ExtractFormatTgz,
+		"a.tar.gz":     ExtractFormatTgz,
+		"a.zip":        ExtractFormatZip,
+		"a.gz":         "",
+		"tar":          "",
+		"shards/a.zip": ExtractFormatZip,
+	} {
+		format, errstr := archiveFormat(name)
+		if format != exp || (exp == "") != (errstr != "") {
+			t.Errorf("%s: expected %q, got %q (%s)", name, exp, format, errstr)
+		}
+	}
+}
+
+func TestMemberObjname(t *testing.T) {
+	ectx := &extractctx{prefix: "p/"}
+	for name, exp := range map[string]string{
+		"a":         "p/a",
+		"./a/b":     "p/a/b",
+		"a/b/c.jpg": "p/a/b/c.jpg",
+		"":          "",
+		"..":        "",
+		"../a":      "",
+		"/etc/a":    "",
+		"a/../../b": "",
+		"a//b":      "",
+	} {
+		objname, errstr := ectx.memberObjname(name)
+		if objname != exp || (exp == "") != (errstr != "") {
+			t.Errorf("%q: expected %q, got %q (%s)", name, exp, objname, errstr)
+		}
+	}
+}
+
+func TestForwardedBy(t *testing.T) {
+	tr := &targetrunner{}
+	tr.si = &daemonInfo{DaemonID: "t1", NodeIPAddr: "10.0.0.1"}
+	tr.smap = &Smap{Tmap: map[string]*daemonInfo{
+		"t1": tr.si,
+		"t2": {DaemonID: "t2", NodeIPAddr: "10.0.0.2", IntraDataURL: "http://172.16.0.2:9080"},
+	}}
+	tests := []struct {
+		from, id string
+		exp      bool
+	}{
+		{"10.0.0.2:41234", "t2", true},
+		{"172.16.0.2:41234", "t2", true}, // intra-cluster data network
+		{"10.0.0.3:41234", "t2", false},  // a client pretending to be a target
+		{"10.0.0.1:41234", "t1", false},  // self
+		{"10.0.0.2:41234", "t3", false},  // unknown
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("PUT", "/v1/objects/b/o?daemon_id="+test.id, nil)
+		r.RemoteAddr = test.from
+		if tr.forwardedBy(r, test.id) != test.exp {
+			t.Errorf("%s from %s: expected %t", test.id, test.from, test.exp)
+		}
+	}
+
+	// AuthN: the request must be signed by the target
+	ctx.config.Auth.Secret = "aBitLongSecretKey"
+	ctx.config.Auth.Enabled = true
+	defer func() { ctx.config.Auth.Enabled = false }()
+	t2 := &httprunner{si: tr.smap.Tmap["t2"]}
+	r := httptest.NewRequest("PUT", "/v1/objects/b/o?daemon_id=t2", nil)
+	r.RemoteAddr = "10.0.0.2:41234"
+	if tr.forwardedBy(r, "t2") {
+		t.Error("Unsigned request from t2 accepted")
+	}
+	t2.signRequest(r)
+	r.RemoteAddr = "192.168.0.2:41234"
+	if !tr.forwardedBy(r, "t2") {
+		t.Error("Signed request from t2 rejected")
+	}
+
+	// mTLS: the request must come with the target's certificate
+	tr.certs = &clusterCerts{}
+	if tr.forwardedBy(r, "t2") {
+		t.Error("Request from t2 without certificate accepted")
+	}
+	r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "t2"}}}}
+	if !tr.forwardedBy(r, "t2") {
+		t.Error("Request with certificate of t2 rejected")
+	}
+	r.TLS.PeerCertificates[0].Subject.CommonName = "t3"
+	if tr.forwardedBy(r, "t2") {
+		t.Error("Request with certificate of t3 accepted as t2")
+	}
+}
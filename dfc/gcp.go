@@ -188,8 +188,8 @@ func (gcpimpl *gcpimpl) listbucket(ct context.Context, bucket string, msg *GetMs
 	var query *storage.Query
 	var pageToken string
 
-	if msg.GetPrefix != "" {
-		query = &storage.Query{Prefix: msg.GetPrefix}
+	if msg.GetPrefix != "" || msg.GetDelimiter != "" {
+		query = &storage.Query{Prefix: msg.GetPrefix, Delimiter: msg.GetDelimiter}
 	}
 	if msg.GetPageMarker != "" {
 		pageToken = msg.GetPageMarker
@@ -211,6 +211,11 @@ func (gcpimpl *gcpimpl) listbucket(ct context.Context, bucket string, msg *GetMs
 	var reslist = BucketList{Entries: make([]*BucketEntry, 0, initialBucketListSize)}
 	reslist.PageMarker = nextPageToken
 	for _, attrs := range objs {
+		// with delimiter, GCP returns common prefixes as synthetic objects that have only Prefix set
+		if attrs.Prefix != "" {
+			reslist.Entries = append(reslist.Entries, &BucketEntry{Name: attrs.Prefix, Type: BucketEntryDirectory})
+			continue
+		}
 		entry := &BucketEntry{}
 		entry.Name = attrs.Name
 		if strings.Contains(msg.GetProps, GetPropsSize) {
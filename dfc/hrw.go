@@ -70,3 +70,21 @@ func hrwMpath(bucket, objname string) (mpath string) {
 	}
 	return
 }
+
+// hrwTargetSkip returns the target with the highest random weight among those
+// that are not to be skipped
+func hrwTargetSkip(bucket, objname string, smap *Smap, skip func(id string) bool) (si *daemonInfo) {
+	name := uniquename(bucket, objname)
+	var max uint64
+	for id, sinfo := range smap.Tmap {
+		if skip(id) {
+			continue
+		}
+		cs := xxhash.ChecksumString64S(id+":"+name, mLCG32)
+		if cs > max {
+			max = cs
+			si = sinfo
+		}
+	}
+	return
+}
@@ -110,7 +110,8 @@ func (r *glogwriter) Write(p []byte) (int, error) {
 type httprunner struct {
 	namedrunner
 	mux                   *http.ServeMux
-	h                     *http.Server
+	h                     *http.Server   // public network
+	intrasrv              []*http.Server // intra-cluster networks with ports of their own (see netconfig)
 	glogger               *log.Logger
 	si                    *daemonInfo
 	httpclient            *http.Client // http client for intra-cluster comm
@@ -121,6 +122,9 @@ type httprunner struct {
 	bmdowner              *bmdowner
 	callStatsServer       *CallStatsServer
 	revProxy              *httputil.ReverseProxy
+	certs                 *clusterCerts // mTLS: cluster CA and this daemon's certificate
+	audit                 *auditLog     // nil when the audit log is disabled
+	ratelimiter           *rateLimiter
 }
 
 func (h *httprunner) registerhdlr(path string, handler func(http.ResponseWriter, *http.Request)) {
@@ -151,11 +155,24 @@ func (h *httprunner) init(s statsif, isproxy bool) {
 	if numDaemons < 4 {
 		numDaemons = 4
 	}
+	if ctx.config.Net.HTTP.MutualTLS {
+		certs, err := newClusterCerts(ctx.config.Net.HTTP.CACertificate,
+			ctx.config.Net.HTTP.DaemonCertificate, ctx.config.Net.HTTP.DaemonKey)
+		if err != nil {
+			glog.Fatalf("FATAL: mTLS: %v", err)
+		}
+		h.certs = certs
+	}
 
-	h.httpclient =
-		&http.Client{Transport: h.createTransport(perhost, numDaemons), Timeout: ctx.config.Timeout.Default}
-	h.httpclientLongTimeout =
-		&http.Client{Transport: h.createTransport(perhost, numDaemons), Timeout: ctx.config.Timeout.DefaultLong}
+	// intra-cluster requests are signed (see daemonSigner)
+	h.httpclient = &http.Client{
+		Transport: &daemonSigner{RoundTripper: h.createTransport(perhost, numDaemons), h: h},
+		Timeout:   ctx.config.Timeout.Default,
+	}
+	h.httpclientLongTimeout = &http.Client{
+		Transport: &daemonSigner{RoundTripper: h.createTransport(perhost, numDaemons), h: h},
+		Timeout:   ctx.config.Timeout.DefaultLong,
+	}
 
 	if isproxy && ctx.config.Net.HTTP.UseAsProxy {
 		h.revProxy = &httputil.ReverseProxy{
@@ -166,6 +183,7 @@ func (h *httprunner) init(s statsif, isproxy bool) {
 
 	h.smap = &Smap{}
 	h.bmdowner = &bmdowner{}
+	h.ratelimiter = newRateLimiter()
 }
 
 // initSI initialize a daemon's identification (never changes once it is set)
@@ -195,6 +213,50 @@ func (h *httprunner) initSI() {
 	}
 
 	h.si.DirectURL = proto + "://" + h.si.NodeIPAddr + ":" + h.si.DaemonPort
+	h.si.IntraControlURL = intraURL(proto, ipaddr, ctx.config.Net.IPv4IntraControl, ctx.config.Net.L4.PortIntraControl)
+	h.si.IntraDataURL = intraURL(proto, ipaddr, ctx.config.Net.IPv4IntraData, ctx.config.Net.L4.PortIntraData)
+}
+
+// intraURL returns the URL of an intra-cluster network, or empty string if the
+// network is not configured (see netconfig)
+func intraURL(proto, publicIPv4, ipv4, port string) string {
+	if ipv4 == "" && port == "" {
+		return ""
+	}
+	ipaddr := publicIPv4
+	if ipv4 != "" {
+		addrlist, err := getLocalIPv4List()
+		if err != nil {
+			glog.Fatalf("FATAL: %v", err)
+		}
+		var errstr string
+		if ipaddr, errstr = selectConfiguredIPv4(addrlist, ipv4); errstr != "" {
+			glog.Fatalf("FATAL: intra-cluster network %s: %s", ipv4, errstr)
+		}
+	}
+	if port == "" {
+		port = ctx.config.Net.L4.Port
+	}
+	return proto + "://" + ipaddr + ":" + port
+}
+
+// intraAddrs returns the listening addresses of the intra-cluster networks that
+// have ports of their own; otherwise, the public listener (that listens on all
+// interfaces) serves intra-cluster traffic as well
+func (h *httprunner) intraAddrs() (addrs []string) {
+	for _, rawurl := range []string{h.si.IntraControlURL, h.si.IntraDataURL} {
+		if rawurl == "" {
+			continue
+		}
+		u, err := url.Parse(rawurl)
+		if err != nil || u.Port() == ctx.config.Net.L4.Port {
+			continue
+		}
+		if len(addrs) == 0 || addrs[0] != u.Host {
+			addrs = append(addrs, u.Host)
+		}
+	}
+	return
 }
 
 func (h *httprunner) createTransport(perhost, numDaemons int) *http.Transport {
@@ -214,8 +276,10 @@ func (h *httprunner) createTransport(perhost, numDaemons int) *http.Transport {
 		MaxIdleConnsPerHost: perhost,
 		MaxIdleConns:        perhost * numDaemons,
 	}
-	if ctx.config.Net.HTTP.UseHTTPS {
-		glog.Warningln("HTTPS for inter-cluster communications is not yet supported and should be avoided")
+	if h.certs != nil {
+		transport.TLSClientConfig = h.certs.clientTLSConfig()
+	} else if ctx.config.Net.HTTP.UseHTTPS {
+		glog.Warningln("HTTPS for inter-cluster communications without mTLS (use_mtls) should be avoided")
 		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
 	}
 	return transport
@@ -226,34 +290,63 @@ func (h *httprunner) run() error {
 	// os.Stderr would be used, as per golang.org/pkg/net/http/#Server
 	h.glogger = log.New(&glogwriter{}, "net/http err: ", 0)
 	var handler http.Handler = h.mux
-	addr := ":" + ctx.config.Net.L4.Port
 
 	if ctx.config.Net.HTTP.UseHTTP2 && !ctx.config.Net.HTTP.UseHTTPS {
 		handler = h2c.Server{Handler: handler}
 	}
-	if ctx.config.Net.HTTP.UseHTTPS {
-		h.h = &http.Server{Addr: addr, Handler: handler, ErrorLog: h.glogger}
+	if h.certs != nil {
+		handler = h.mtlsHandler(handler)
+	}
+	if h.audit != nil {
+		handler = h.audit.handler(handler)
+	}
+	if tracer := gettracer(); tracer != nil {
+		handler = tracer.handler(handler)
+	}
+	h.h = h.newServer(":"+ctx.config.Net.L4.Port, handler)
+	servers := []*http.Server{h.h}
+	// intra-cluster networks are served by the same handlers
+	for _, addr := range h.intraAddrs() {
+		srv := h.newServer(addr, handler)
+		h.intrasrv = append(h.intrasrv, srv)
+		servers = append(servers, srv)
+	}
 
-		if !ctx.config.Net.HTTP.UseHTTP2 {
-			h.h.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
-		}
-		if err := h.h.ListenAndServeTLS(ctx.config.Net.HTTP.Certificate, ctx.config.Net.HTTP.Key); err != nil {
-			if err != http.ErrServerClosed {
-				glog.Errorf("Terminated %s with err: %v", h.name, err)
-				return err
-			}
+	// the first server to terminate terminates the runner
+	errch := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func(srv *http.Server) {
+			errch <- h.serve(srv)
+		}(srv)
+	}
+	return <-errch
+}
+
+func (h *httprunner) newServer(addr string, handler http.Handler) *http.Server {
+	srv := &http.Server{Addr: addr, Handler: handler, ErrorLog: h.glogger}
+	if ctx.config.Net.HTTP.UseHTTPS && !ctx.config.Net.HTTP.UseHTTP2 {
+		srv.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+	}
+	return srv
+}
+
+func (h *httprunner) serve(srv *http.Server) (err error) {
+	if ctx.config.Net.HTTP.UseHTTPS {
+		certfile, keyfile := ctx.config.Net.HTTP.Certificate, ctx.config.Net.HTTP.Key
+		if h.certs != nil {
+			// the daemon's certificate (see mtls.go) replaces the server certificate
+			srv.TLSConfig = h.certs.serverTLSConfig()
+			certfile, keyfile = "", ""
 		}
+		err = srv.ListenAndServeTLS(certfile, keyfile)
 	} else {
-		h.h = &http.Server{Addr: addr, Handler: handler, ErrorLog: h.glogger}
-		if err := h.h.ListenAndServe(); err != nil {
-			if err != http.ErrServerClosed {
-				glog.Errorf("Terminated %s with err: %v", h.name, err)
-				return err
-			}
-		}
+		err = srv.ListenAndServe()
 	}
-
-	return nil
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	glog.Errorf("Terminated %s (%s) with err: %v", h.name, srv.Addr, err)
+	return err
 }
 
 // stop gracefully
@@ -265,11 +358,15 @@ func (h *httprunner) stop(err error) {
 	}
 	contextwith, cancel := context.WithTimeout(context.Background(), ctx.config.Timeout.Default)
 
-	err = h.h.Shutdown(contextwith)
-	if err != nil {
-		glog.Infof("Stopped %s, err: %v", h.name, err)
+	for _, srv := range append([]*http.Server{h.h}, h.intrasrv...) {
+		if err = srv.Shutdown(contextwith); err != nil {
+			glog.Infof("Stopped %s (%s), err: %v", h.name, srv.Addr, err)
+		}
 	}
 	cancel()
+	if h.audit != nil {
+		h.audit.close()
+	}
 }
 
 // intra-cluster IPC, control plane; calls (via http) another target or a proxy
@@ -318,13 +415,17 @@ func (h *httprunner) call(rOrig *http.Request, si *daemonInfo, url, method strin
 	}
 
 	copyHeaders(rOrig, request)
+	// the callee continues the trace of the original request
+	span := requestSpan(rOrig).child(method+" "+sid, spanKindClient)
+	span.setAttr("http.url", url)
+	span.inject(request)
+	defer func() { span.finish(errstr) }()
 	if len(timeout) > 0 {
 		if timeout[0] != 0 {
 			contextwith, cancel := context.WithTimeout(context.Background(), timeout[0])
 			defer cancel()
-			newrequest := request.WithContext(contextwith)
-			copyHeaders(rOrig, newrequest)
-			response, err = h.httpclient.Do(newrequest) // timeout => context.deadlineExceededError
+			newrequest := request.WithContext(contextwith) // shares the headers
+			response, err = h.httpclient.Do(newrequest)    // timeout => context.deadlineExceededError
 		} else { // zero timeout means the client wants no timeout
 			response, err = h.httpclientLongTimeout.Do(request)
 		}
@@ -342,6 +443,12 @@ func (h *httprunner) call(rOrig *http.Request, si *daemonInfo, url, method strin
 		return callResult{si, outjson, err, errstr, status}
 	}
 
+	if err = h.checkPeer(si, response); err != nil {
+		response.Body.Close()
+		errstr = fmt.Sprintf("Failed to http-call %s (%s %s): err %v", sid, method, url, err)
+		return callResult{si, outjson, err, errstr, status}
+	}
+
 	if outjson, err = ioutil.ReadAll(response.Body); err != nil {
 		errstr = fmt.Sprintf("Failed to http-call %s (%s %s): read response err: %v", sid, method, url, err)
 		if err == io.EOF {
@@ -528,6 +635,12 @@ func (h *httprunner) setconfig(name, value string) (errstr string) {
 		} else {
 			ctx.config.Periodic.StatsTime, ctx.config.Periodic.StatsTimeStr = v, value
 		}
+	case "lifecycle_time":
+		if v, err := time.ParseDuration(value); err != nil {
+			errstr = fmt.Sprintf("Failed to parse lifecycle_time, err: %v", err)
+		} else {
+			ctx.config.Periodic.LifecycleTime, ctx.config.Periodic.LifecycleTimeStr = v, value
+		}
 	case "dont_evict_time":
 		if v, err := time.ParseDuration(value); err != nil {
 			errstr = fmt.Sprintf("Failed to parse dont_evict_time, err: %v", err)
@@ -600,6 +713,24 @@ func (h *httprunner) setconfig(name, value string) (errstr string) {
 		} else {
 			ctx.config.Rebalance.Enabled = v
 		}
+	case "soft_delete_enabled":
+		if v, err := strconv.ParseBool(value); err != nil {
+			errstr = fmt.Sprintf("Failed to parse soft_delete_enabled, err: %v", err)
+		} else {
+			ctx.config.Trash.Enabled = v
+		}
+	case "retention_time":
+		if v, err := time.ParseDuration(value); err != nil {
+			errstr = fmt.Sprintf("Failed to parse retention_time, err: %v", err)
+		} else {
+			ctx.config.Trash.RetentionTime, ctx.config.Trash.RetentionTimeStr = v, value
+		}
+	case "purge_time":
+		if v, err := time.ParseDuration(value); err != nil {
+			errstr = fmt.Sprintf("Failed to parse purge_time, err: %v", err)
+		} else {
+			ctx.config.Trash.PurgeTime, ctx.config.Trash.PurgeTimeStr = v, value
+		}
 	case "validate_checksum_cold_get":
 		if v, err := strconv.ParseBool(value); err != nil {
 			errstr = fmt.Sprintf("Failed to parse validate_checksum_cold_get, err: %v", err)
@@ -624,6 +755,99 @@ func (h *httprunner) setconfig(name, value string) (errstr string) {
 		} else {
 			ctx.config.Ver.ValidateWarmGet = v
 		}
+	case "ratelimit_enabled":
+		if v, err := strconv.ParseBool(value); err != nil {
+			errstr = fmt.Sprintf("Failed to parse ratelimit_enabled, err: %v", err)
+		} else {
+			ctx.config.RateLimit.Enabled = v
+		}
+	case "user_requests", "bucket_requests":
+		if v, err := strconv.ParseFloat(value, 64); err != nil || v < 0 {
+			errstr = fmt.Sprintf("Invalid %s %q - expecting non-negative number of requests per second", name, value)
+		} else if name == "user_requests" {
+			ctx.config.RateLimit.UserRequests = v
+		} else {
+			ctx.config.RateLimit.BucketRequests = v
+		}
+	case "user_bandwidth", "bucket_bandwidth":
+		if v, err := strconv.ParseInt(value, 10, 64); err != nil || v < 0 {
+			errstr = fmt.Sprintf("Invalid %s %q - expecting non-negative number of bytes per second", name, value)
+		} else if name == "user_bandwidth" {
+			ctx.config.RateLimit.UserBandwidth = v
+		} else {
+			ctx.config.RateLimit.BucketBandwidth = v
+		}
+	case "admission_enabled":
+		if v, err := strconv.ParseBool(value); err != nil {
+			errstr = fmt.Sprintf("Failed to parse admission_enabled, err: %v", err)
+		} else {
+			ctx.config.Admission.Enabled = v
+		}
+	case "max_cold_get", "max_warm_get", "max_put", "max_rebalance":
+		if v, err := strconv.Atoi(value); err != nil || v < 0 {
+			errstr = fmt.Sprintf("Invalid %s %q - expecting non-negative number of requests", name, value)
+		} else {
+			switch name {
+			case "max_cold_get":
+				ctx.config.Admission.MaxColdGet = v
+			case "max_warm_get":
+				ctx.config.Admission.MaxWarmGet = v
+			case "max_put":
+				ctx.config.Admission.MaxPut = v
+			default:
+				ctx.config.Admission.MaxRebalance = v
+			}
+		}
+	case "max_util":
+		if v, err := strconv.ParseFloat(value, 64); err != nil || v < 0 || v > 100 {
+			errstr = fmt.Sprintf("Invalid max_util %q - expecting disk utilization percentage", value)
+		} else {
+			ctx.config.Admission.MaxUtil = v
+		}
+	case "queue_time":
+		if v, err := time.ParseDuration(value); err != nil {
+			errstr = fmt.Sprintf("Failed to parse queue_time, err: %v", err)
+		} else {
+			ctx.config.Admission.QueueTime, ctx.config.Admission.QueueTimeStr = v, value
+		}
+	case "backoff_time":
+		if v, err := time.ParseDuration(value); err != nil {
+			errstr = fmt.Sprintf("Failed to parse backoff_time, err: %v", err)
+		} else {
+			ctx.config.Admission.BackoffTime, ctx.config.Admission.BackoffTimeStr = v, value
+		}
+	case "xaction_throttle_enabled", "adaptive_throttle":
+		if v, err := strconv.ParseBool(value); err != nil {
+			errstr = fmt.Sprintf("Failed to parse %s, err: %v", name, err)
+		} else if name == "adaptive_throttle" {
+			ctx.config.XactThrottle.Adaptive = v
+		} else {
+			ctx.config.XactThrottle.Enabled = v
+		}
+	case "xaction_bandwidth":
+		if v, err := strconv.ParseInt(value, 10, 64); err != nil || v < 0 {
+			errstr = fmt.Sprintf("Invalid xaction_bandwidth %q - expecting non-negative number of MB per second", value)
+		} else {
+			ctx.config.XactThrottle.MaxBandwidth = v
+		}
+	case "xaction_transfers":
+		if v, err := strconv.Atoi(value); err != nil || v < 0 {
+			errstr = fmt.Sprintf("Invalid xaction_transfers %q - expecting non-negative number of transfers", value)
+		} else {
+			ctx.config.XactThrottle.MaxTransfers = v
+		}
+	case "adaptive_max_latency":
+		if v, err := time.ParseDuration(value); err != nil {
+			errstr = fmt.Sprintf("Failed to parse adaptive_max_latency, err: %v", err)
+		} else {
+			ctx.config.XactThrottle.MaxLatency, ctx.config.XactThrottle.MaxLatencyStr = v, value
+		}
+	case "adaptive_max_util":
+		if v, err := strconv.ParseFloat(value, 64); err != nil || v < 0 || v > 100 {
+			errstr = fmt.Sprintf("Invalid adaptive_max_util %q - expecting disk utilization percentage", value)
+		} else {
+			ctx.config.XactThrottle.MaxUtil = v
+		}
 	case "checksum":
 		if value == ChecksumXXHash || value == ChecksumNone {
 			ctx.config.Cksum.Checksum = value
@@ -672,6 +896,10 @@ func (h *httprunner) invalmsghdlr(w http.ResponseWriter, r *http.Request, msg st
 			s += fmt.Sprintf("(%s, #%d)", f, line)
 		}
 	}
+	if span := requestSpan(r); span != nil {
+		s += " (trace " + span.TraceID + ")"
+		span.Error = s
+	}
 	glog.Errorln(s)
 	http.Error(w, s, status)
 	h.statsif.add("numerr", 1)
@@ -795,13 +1023,12 @@ func (h *httprunner) broadcast(path string, query url.Values, method string, bod
 		go func(di *daemonInfo, wg *sync.WaitGroup) {
 			defer wg.Done()
 
-			var u url.URL
-			if ctx.config.Net.HTTP.UseHTTPS {
-				u.Scheme = "https"
-			} else {
-				u.Scheme = "http"
+			// control plane: intra-cluster control network
+			u, err := url.Parse(di.controlURL())
+			if err != nil {
+				ch <- callResult{si: di, err: err, errstr: err.Error()}
+				return
 			}
-			u.Host = di.NodeIPAddr + ":" + di.DaemonPort
 			u.Path = path
 			u.RawQuery = query.Encode() // golang handles query == nil
 			res := h.call(nil, di, u.String(), method, body, timeout...)
@@ -817,7 +1044,7 @@ func (h *httprunner) broadcast(path string, query url.Values, method string, bod
 func (h *httprunner) getXactionKindFromProperties(props string) (
 	string, error) {
 	switch props {
-	case XactionRebalance, XactionPrefetch:
+	case XactionRebalance, XactionPrefetch, XactionCopyBucket, XactionDsort, XactionRenamePrefix:
 		return props, nil
 	}
 
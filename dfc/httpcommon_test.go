@@ -0,0 +1,52 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIntraNetworks(t *testing.T) {
+	oldport := ctx.config.Net.L4.Port
+	ctx.config.Net.L4.Port = "8081"
+	defer func() { ctx.config.Net.L4.Port = oldport }()
+
+	si := &daemonInfo{DirectURL: "http://10.0.0.1:8081"}
+	if si.controlURL() != si.DirectURL || si.dataURL() != si.DirectURL {
+		t.Errorf("Daemon without intra-cluster networks: control %s, data %s", si.controlURL(), si.dataURL())
+	}
+
+	tests := []struct {
+		controlPort, dataPort string
+		control, data         string
+		addrs                 []string
+	}{
+		{"", "", "", "", nil},
+		{"9081", "", "http://10.0.0.1:9081", "", []string{"10.0.0.1:9081"}},
+		{"", "10081", "", "http://10.0.0.1:10081", []string{"10.0.0.1:10081"}},
+		{"9081", "10081", "http://10.0.0.1:9081", "http://10.0.0.1:10081", []string{"10.0.0.1:9081", "10.0.0.1:10081"}},
+		{"9081", "9081", "http://10.0.0.1:9081", "http://10.0.0.1:9081", []string{"10.0.0.1:9081"}},
+		// the public listener serves the public port
+		{"8081", "10081", "http://10.0.0.1:8081", "http://10.0.0.1:10081", []string{"10.0.0.1:10081"}},
+	}
+	for _, test := range tests {
+		h := &httprunner{si: &daemonInfo{DirectURL: "http://10.0.0.1:8081"}}
+		h.si.IntraControlURL = intraURL("http", "10.0.0.1", "", test.controlPort)
+		h.si.IntraDataURL = intraURL("http", "10.0.0.1", "", test.dataPort)
+		if h.si.IntraControlURL != test.control || h.si.IntraDataURL != test.data {
+			t.Errorf("ports %q, %q: expected %q, %q, got %q, %q", test.controlPort, test.dataPort,
+				test.control, test.data, h.si.IntraControlURL, h.si.IntraDataURL)
+		}
+		if addrs := h.intraAddrs(); !reflect.DeepEqual(addrs, test.addrs) {
+			t.Errorf("ports %q, %q: expected listeners %v, got %v", test.controlPort, test.dataPort, test.addrs, addrs)
+		}
+		if test.control != "" && h.si.controlURL() != test.control {
+			t.Errorf("Expected control URL %s, got %s", test.control, h.si.controlURL())
+		}
+		if test.data != "" && h.si.dataURL() != test.data {
+			t.Errorf("Expected data URL %s, got %s", test.data, h.si.dataURL())
+		}
+	}
+}
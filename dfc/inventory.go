@@ -0,0 +1,490 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// Bucket inventory: POST {"action": "inventory", "value": {"format": "jsonl"|"csv", "bucket": ..., "objname": ...}} /v1/buckets/bucket-name
+//
+// Each target runs the inventory xaction (ActInventory) that writes a gzip-compressed manifest
+// of the bucket's objects it stores (see InventoryEntry), one manifest per mountpath, under
+// <mountpath>/<inventorydir>/. The request returns when all targets are done. The manifests
+// remain unchanged until the next inventory of the bucket and can be downloaded any number
+// of times via GET /v1/buckets/bucket-name?what=inventory&format=jsonl|csv: the proxy
+// concatenates the manifests of all targets (a sequence of gzip members is a valid gzip stream).
+// Optionally, the proxy stores the inventory as an object in the specified local bucket.
+// NOTE: the manifests are not sorted.
+const inventorydir = ".inventory"
+
+type xactInventory struct {
+	xactBase
+	targetrunner *targetrunner
+	bucket       string
+}
+
+type inventoryctx struct {
+	xinv   *xactInventory
+	t      *targetrunner
+	format string
+	gzw    *gzip.Writer
+	csvw   *csv.Writer
+	jsenc  *json.Encoder
+	count  int64
+}
+
+// builds fqn of directory for bucket inventories from mountpath
+func makePathInventory(basePath string) string {
+	return filepath.Join(basePath, inventorydir)
+}
+
+func inventoryfqn(mpath, bucket, format string) string {
+	return filepath.Join(makePathInventory(mpath), bucket+"."+format+".gz")
+}
+
+func removeInventories(mpath, bucket string) {
+	for _, format := range []string{InventoryFormatJSONL, InventoryFormatCSV} {
+		manifest := inventoryfqn(mpath, bucket, format)
+		if err := os.Remove(manifest); err != nil && !os.IsNotExist(err) {
+			glog.Errorf("Failed to remove inventory %q, err: %v", manifest, err)
+		}
+	}
+}
+
+func parseInventoryMsg(value interface{}) (imsg *InventoryMsg, errstr string) {
+	imsg = &InventoryMsg{Format: InventoryFormatJSONL}
+	if value != nil {
+		jsmap, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Sprintf("Invalid inventory request: unexpected value format (%v, %T)", value, value)
+		}
+		for _, f := range []struct {
+			key string
+			val *string
+		}{{"format", &imsg.Format}, {"bucket", &imsg.Bucket}, {"objname", &imsg.Objname}} {
+			v, ok := jsmap[f.key]
+			if !ok {
+				continue
+			}
+			if *f.val, ok = v.(string); !ok {
+				return nil, fmt.Sprintf("Invalid inventory request: %s must be a string (%v, %T)", f.key, v, v)
+			}
+		}
+	}
+	if errstr = validateInventoryFormat(imsg.Format); errstr != "" {
+		return
+	}
+	if imsg.Bucket != "" && imsg.Objname == "" {
+		errstr = fmt.Sprintf("Invalid inventory request: missing object name to store the inventory in %s", imsg.Bucket)
+	}
+	return
+}
+
+func validateInventoryFormat(format string) string {
+	if format != InventoryFormatJSONL && format != InventoryFormatCSV {
+		return fmt.Sprintf("Invalid inventory format %q (expecting %q or %q)", format, InventoryFormatJSONL, InventoryFormatCSV)
+	}
+	return ""
+}
+
+//
+// target
+//
+
+// POST { action: inventory } /Rversion/Rbuckets/bucket-name
+func (t *targetrunner) inventory(w http.ResponseWriter, r *http.Request, msg ActionMsg) {
+	apitems := t.restAPIItems(r.URL.Path, 5)
+	if apitems = t.checkRestAPI(w, r, apitems, 1, Rversion, Rbuckets); apitems == nil {
+		return
+	}
+	bucket := apitems[0]
+	if !t.validatebckname(w, r, bucket) {
+		return
+	}
+	imsg, errstr := parseInventoryMsg(msg.Value)
+	if errstr != "" {
+		t.invalmsghdlr(w, r, errstr)
+		return
+	}
+	if errstr = t.runInventory(bucket, imsg.Format); errstr != "" {
+		t.invalmsghdlr(w, r, errstr)
+	}
+}
+
+func (t *targetrunner) runInventory(bucket, format string) (errstr string) {
+	xinv := t.xactinp.renewInventory(t, bucket)
+	if xinv == nil {
+		return fmt.Sprintf("Inventory of bucket %s is already running", bucket)
+	}
+	glog.Infoln(xinv.tostring())
+	var (
+		islocal = t.bmdowner.get().islocal(bucket)
+		errch   = make(chan string, len(ctx.mountpaths.Available))
+		wg      = &sync.WaitGroup{}
+	)
+	for mpath := range ctx.mountpaths.Available {
+		bucketdir := filepath.Join(makePathCloud(mpath), bucket)
+		if islocal {
+			bucketdir = filepath.Join(makePathLocal(mpath), bucket)
+		}
+		ictx := &inventoryctx{xinv: xinv, t: t, format: format}
+		wg.Add(1)
+		go func(mpath string) {
+			defer wg.Done()
+			if errstr := ictx.oneInventory(bucketdir, inventoryfqn(mpath, bucket, format)); errstr != "" {
+				errch <- errstr
+			}
+		}(mpath)
+	}
+	wg.Wait()
+	close(errch)
+	for errs := range errch {
+		glog.Errorln(errs)
+		errstr = errs
+	}
+
+	xinv.etime = time.Now()
+	glog.Infoln(xinv.tostring())
+	t.xactinp.del(xinv.id)
+	return
+}
+
+// oneInventory writes the manifest of the mountpath into a work file and, once the
+// traversal completes, replaces the previous manifest with it
+func (ictx *inventoryctx) oneInventory(bucketdir, manifest string) (errstr string) {
+	if err := CreateDir(filepath.Dir(manifest)); err != nil {
+		return fmt.Sprintf("Failed to create inventory dir for %s, err: %v", manifest, err)
+	}
+	workfqn := ictx.t.fqn2workfile(manifest)
+	file, err := CreateFile(workfqn)
+	if err != nil {
+		return fmt.Sprintf("Failed to create %s, err: %v", workfqn, err)
+	}
+	ictx.gzw = gzip.NewWriter(file)
+	if ictx.format == InventoryFormatCSV {
+		ictx.csvw = csv.NewWriter(ictx.gzw)
+	} else {
+		ictx.jsenc = json.NewEncoder(ictx.gzw)
+	}
+	if _, err = os.Stat(bucketdir); err == nil {
+		err = filepath.Walk(bucketdir, ictx.walkfn)
+	} else if os.IsNotExist(err) {
+		err = nil // nothing to inventory - write empty manifest
+	}
+	if ictx.csvw != nil && err == nil {
+		ictx.csvw.Flush()
+		err = ictx.csvw.Error()
+	}
+	if err == nil {
+		err = ictx.gzw.Close()
+	}
+	if errc := file.Close(); err == nil {
+		err = errc
+	}
+	if err == nil {
+		err = os.Rename(workfqn, manifest)
+	}
+	if err != nil {
+		if errr := os.Remove(workfqn); errr != nil && !os.IsNotExist(errr) {
+			glog.Errorf("Failed to remove %s, err: %v", workfqn, errr)
+		}
+		return fmt.Sprintf("Failed to inventory %q, err: %v", bucketdir, err)
+	}
+	if glog.V(3) {
+		glog.Infof("Inventory %q: %d object(s) => %s", bucketdir, ictx.count, manifest)
+	}
+	return
+}
+
+func (ictx *inventoryctx) walkfn(fqn string, osfi os.FileInfo, err error) error {
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		glog.Errorf("walkfunc callback invoked with err: %v", err)
+		return err
+	}
+	if osfi.IsDir() {
+		return nil
+	}
+	if iswork, _ := ictx.t.isworkfile(fqn); iswork {
+		return nil
+	}
+	select {
+	case <-ictx.xinv.abrt:
+		return fmt.Errorf("%s aborted, exiting", ictx.xinv.tostring())
+	default:
+	}
+	bucket, objname, errstr := ictx.t.fqn2bckobj(fqn)
+	if errstr != "" {
+		glog.Errorln(errstr)
+		return nil
+	}
+	if bucket != ictx.xinv.bucket {
+		return nil
+	}
+	atime, _, _ := getAmTimes(osfi)
+	entry := &InventoryEntry{Name: objname, Size: osfi.Size(), Atime: atime.Format(time.RFC3339Nano)}
+	if xxhex, errs := Getxattr(fqn, XattrXXHashVal); errs == "" {
+		entry.Checksum = hex.EncodeToString(xxhex)
+	}
+	if version, errs := Getxattr(fqn, XattrObjVersion); errs == "" {
+		entry.Version = string(version)
+	}
+	ictx.count++
+	if ictx.csvw != nil {
+		return ictx.csvw.Write([]string{entry.Name, strconv.FormatInt(entry.Size, 10), entry.Checksum, entry.Version, entry.Atime})
+	}
+	return ictx.jsenc.Encode(entry)
+}
+
+// GET /Rversion/Rbuckets/bucket-name?what=inventory&format=...
+// streams the (concatenated) manifests of the bucket stored by this target
+func (t *targetrunner) getInventory(w http.ResponseWriter, r *http.Request, bucket string) {
+	format := r.URL.Query().Get(URLParamFormat)
+	if format == "" {
+		format = InventoryFormatJSONL
+	}
+	if errstr := validateInventoryFormat(format); errstr != "" {
+		t.invalmsghdlr(w, r, errstr)
+		return
+	}
+	manifests := make([]string, 0, len(ctx.mountpaths.Available))
+	for mpath := range ctx.mountpaths.Available {
+		manifest := inventoryfqn(mpath, bucket, format)
+		if _, err := os.Stat(manifest); err == nil {
+			manifests = append(manifests, manifest)
+		}
+	}
+	if len(manifests) == 0 {
+		t.invalmsghdlr(w, r, fmt.Sprintf("Inventory (%s) of bucket %s %s", format, bucket, doesnotexist), http.StatusNotFound)
+		return
+	}
+	sort.Strings(manifests)
+	w.Header().Set("Content-Type", "application/gzip")
+	for _, manifest := range manifests {
+		file, err := os.Open(manifest)
+		if err != nil {
+			glog.Errorf("Failed to open %s, err: %v", manifest, err)
+			return
+		}
+		_, err = io.Copy(w, file)
+		file.Close()
+		if err != nil {
+			glog.Errorf("Failed to send %s, err: %v", manifest, err)
+			return
+		}
+	}
+}
+
+//
+// proxy
+//
+
+// POST { action: inventory } /Rversion/Rbuckets/bucket-name
+func (p *proxyrunner) inventory(w http.ResponseWriter, r *http.Request, bucket string, msg *ActionMsg) {
+	imsg, errstr := parseInventoryMsg(msg.Value)
+	if errstr != "" {
+		p.invalmsghdlr(w, r, errstr)
+		return
+	}
+	bucketmd := p.bmdowner.get()
+	if imsg.Bucket != "" && !bucketmd.islocal(imsg.Bucket) {
+		p.invalmsghdlr(w, r, fmt.Sprintf("Inventory destination: local bucket %s %s", imsg.Bucket, doesnotexist))
+		return
+	}
+	jsonbytes, err := json.Marshal(msg)
+	assert(err == nil, err)
+	q := url.Values{}
+	q.Set(URLParamLocal, strconv.FormatBool(bucketmd.islocal(bucket)))
+	results := p.broadcastTargets(
+		URLPath(Rversion, Rbuckets, bucket),
+		q,
+		http.MethodPost,
+		jsonbytes,
+		p.smap,
+		0, // no timeout: targets respond once done
+	)
+	for result := range results {
+		if result.err != nil {
+			p.invalmsghdlr(w, r, fmt.Sprintf("Failed to inventory bucket %s: %v (%d: %s)",
+				bucket, result.err, result.status, result.errstr))
+			return
+		}
+	}
+	glog.Infof("Inventory of bucket %s (%s) is done", bucket, imsg.Format)
+	if imsg.Bucket == "" {
+		return
+	}
+	if err = p.storeInventory(bucket, imsg); err != nil {
+		p.invalmsghdlr(w, r, err.Error())
+	}
+}
+
+// GET /Rversion/Rbuckets/bucket-name?what=inventory&format=...
+func (p *proxyrunner) getInventory(w http.ResponseWriter, r *http.Request, bucket string) {
+	format := r.URL.Query().Get(URLParamFormat)
+	if format == "" {
+		format = InventoryFormatJSONL
+	}
+	if errstr := validateInventoryFormat(format); errstr != "" {
+		p.invalmsghdlr(w, r, errstr)
+		return
+	}
+	bodies, err := p.openInventories(bucket, format)
+	if err != nil {
+		p.invalmsghdlr(w, r, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", bucket+"."+format+".gz"))
+	if err = writeInventory(w, bodies, format); err != nil {
+		glog.Errorf("Failed to send inventory of bucket %s, err: %v", bucket, err)
+	}
+}
+
+// openInventories requests the inventory manifests from all targets
+func (p *proxyrunner) openInventories(bucket, format string) (bodies []io.ReadCloser, err error) {
+	tids := make([]string, 0, len(p.smap.Tmap))
+	for tid := range p.smap.Tmap {
+		tids = append(tids, tid)
+	}
+	sort.Strings(tids)
+	for _, tid := range tids {
+		si := p.smap.Tmap[tid]
+		q := url.Values{}
+		q.Set(URLParamWhat, GetWhatInventory)
+		q.Set(URLParamFormat, format)
+		url := si.dataURL() + URLPath(Rversion, Rbuckets, bucket) + "?" + q.Encode()
+		resp, errg := p.httpclientLongTimeout.Get(url)
+		if errg == nil && resp.StatusCode >= http.StatusBadRequest {
+			b, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			errg = errors.New(string(b))
+		}
+		if errg != nil {
+			for _, body := range bodies {
+				body.Close()
+			}
+			return nil, fmt.Errorf("Failed to get inventory (%s) of bucket %s from target %s: %v", format, bucket, tid, errg)
+		}
+		bodies = append(bodies, resp.Body)
+	}
+	return
+}
+
+// writeInventory writes the CSV header (as a separate gzip member) followed by the manifests
+// of all targets and closes the latter
+func writeInventory(w io.Writer, bodies []io.ReadCloser, format string) (err error) {
+	defer func() {
+		for _, body := range bodies {
+			body.Close()
+		}
+	}()
+	if format == InventoryFormatCSV {
+		gzw := gzip.NewWriter(w)
+		if _, err = io.WriteString(gzw, strings.Join([]string{"name", "size", "checksum", "version", "atime"}, ",")+"\n"); err != nil {
+			return
+		}
+		if err = gzw.Close(); err != nil {
+			return
+		}
+	}
+	for _, body := range bodies {
+		if _, err = io.Copy(w, body); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// storeInventory PUTs the inventory into the destination local bucket
+func (p *proxyrunner) storeInventory(bucket string, imsg *InventoryMsg) error {
+	si, errstr := HrwTarget(imsg.Bucket, imsg.Objname, p.smap)
+	if errstr != "" {
+		return errors.New(errstr)
+	}
+	bodies, err := p.openInventories(bucket, imsg.Format)
+	if err != nil {
+		return err
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeInventory(pw, bodies, imsg.Format))
+	}()
+	q := url.Values{}
+	q.Set(URLParamDaemonID, p.si.DaemonID)
+	url := si.dataURL() + URLPath(Rversion, Robjects, imsg.Bucket, imsg.Objname) + "?" + q.Encode()
+	request, err := http.NewRequest(http.MethodPut, url, pr)
+	if err != nil {
+		pr.Close()
+		return err
+	}
+	resp, err := p.httpclientLongTimeout.Do(request)
+	if err != nil {
+		pr.Close()
+		return fmt.Errorf("Failed to store inventory of bucket %s as %s/%s, err: %v", bucket, imsg.Bucket, imsg.Objname, err)
+	}
+	b, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("Failed to store inventory of bucket %s as %s/%s: %s", bucket, imsg.Bucket, imsg.Objname, string(b))
+	}
+	glog.Infof("Stored inventory of bucket %s as %s/%s", bucket, imsg.Bucket, imsg.Objname)
+	return nil
+}
+
+//
+// xaction
+//
+
+func (q *xactInProgress) renewInventory(t *targetrunner, bucket string) *xactInventory {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	_, xx := q.findU(ActInventory)
+	if xx != nil {
+		xinv := xx.(*xactInventory)
+		glog.Infof("%s already running, nothing to do", xinv.tostring())
+		return nil
+	}
+	id := q.uniqueid()
+	xinv := &xactInventory{xactBase: *newxactBase(id, ActInventory), targetrunner: t, bucket: bucket}
+	q.add(xinv)
+	return xinv
+}
+
+func (xact *xactInventory) tostring() string {
+	start := xact.stime.Sub(xact.targetrunner.starttime())
+	if !xact.finished() {
+		return fmt.Sprintf("xaction %s:%d %s started %v", xact.kind, xact.id, xact.bucket, start)
+	}
+	fin := time.Since(xact.targetrunner.starttime())
+	return fmt.Sprintf("xaction %s:%d %s started %v finished %v", xact.kind, xact.id, xact.bucket, start, fin)
+}
+
+func (xact *xactInventory) abort() {
+	xact.xactBase.abort()
+	glog.Infof("ABORT: " + xact.tostring())
+}
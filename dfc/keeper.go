@@ -243,7 +243,7 @@ func (r *proxykalive) keepaliveDaemonMap(
 			continue
 		}
 
-		url := si.DirectURL + URLPath(Rversion, Rhealth)
+		url := si.controlURL() + URLPath(Rversion, Rhealth)
 		url += from
 		res := r.p.call(nil, si, url, http.MethodGet, nil, kalivetimeout)
 		if res.err == nil {
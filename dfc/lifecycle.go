@@ -0,0 +1,188 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// lifecycle: periodic (see storstatsrunner.housekeep) expiration of objects
+// according to the per-bucket BucketProps.Lifecycle rules
+type lifecyclectx struct {
+	bucket  string
+	islocal bool
+	rules   []LifecycleRule
+	now     time.Time
+	xlc     *xactLifecycle
+	t       *targetrunner
+	nexp    int64
+	bexp    int64
+	errcnt  int64
+	lastErr error
+}
+
+// expiration returns the expiration period for a given object name, or zero
+// if none of the rules apply; the longest matching prefix wins
+func expiration(rules []LifecycleRule, objname string) (exp time.Duration) {
+	plen := -1
+	for _, rule := range rules {
+		if !strings.HasPrefix(objname, rule.Prefix) || len(rule.Prefix) <= plen {
+			continue
+		}
+		plen = len(rule.Prefix)
+		exp = time.Duration(rule.ExpireDays) * 24 * time.Hour
+	}
+	return
+}
+
+func validateLifecycle(rules []LifecycleRule) error {
+	prefixes := make(map[string]struct{}, len(rules))
+	for _, rule := range rules {
+		if rule.ExpireDays <= 0 {
+			return fmt.Errorf("invalid lifecycle rule (prefix %q): expire_days must be positive, got %d",
+				rule.Prefix, rule.ExpireDays)
+		}
+		if _, ok := prefixes[rule.Prefix]; ok {
+			return fmt.Errorf("duplicate lifecycle rule for prefix %q", rule.Prefix)
+		}
+		prefixes[rule.Prefix] = struct{}{}
+	}
+	return nil
+}
+
+func (t *targetrunner) runLifecycle() {
+	bucketmd := t.bmdowner.get()
+	lcbuckets := make(map[string]BucketProps)
+	for bucket, props := range bucketmd.LBmap {
+		if len(props.Lifecycle) > 0 {
+			lcbuckets[bucket] = props
+		}
+	}
+	for bucket, props := range bucketmd.CBmap {
+		if len(props.Lifecycle) > 0 {
+			lcbuckets[bucket] = props
+		}
+	}
+	if len(lcbuckets) == 0 {
+		return
+	}
+	xlc := t.xactinp.renewLifecycle(t)
+	if xlc == nil {
+		return
+	}
+	glog.Infof("%s: %d bucket(s) with lifecycle rules", xlc.tostring(), len(lcbuckets))
+
+	wg := &sync.WaitGroup{}
+	for bucket, props := range lcbuckets {
+		islocal := bucketmd.islocal(bucket)
+		for mpath := range ctx.mountpaths.Available {
+			dir := makePathCloud(mpath)
+			if islocal {
+				dir = makePathLocal(mpath)
+			}
+			lctx := &lifecyclectx{
+				bucket:  bucket,
+				islocal: islocal,
+				rules:   props.Lifecycle,
+				now:     time.Now(),
+				xlc:     xlc,
+				t:       t,
+			}
+			wg.Add(1)
+			go lctx.oneLifecycle(filepath.Join(dir, bucket), wg)
+		}
+	}
+	wg.Wait()
+
+	xlc.etime = time.Now()
+	glog.Infoln(xlc.tostring())
+	t.xactinp.del(xlc.id)
+}
+
+func (lctx *lifecyclectx) oneLifecycle(bucketdir string, wg *sync.WaitGroup) {
+	defer wg.Done()
+	if _, err := os.Stat(bucketdir); err != nil {
+		return
+	}
+	if err := filepath.Walk(bucketdir, lctx.lifecyclewalkfn); err != nil {
+		s := err.Error()
+		if strings.Contains(s, "xaction") {
+			glog.Infof("Stopping %q traversal: %s", bucketdir, s)
+		} else {
+			glog.Errorf("Failed to traverse %q, err: %v", bucketdir, err)
+		}
+	}
+	if lctx.nexp > 0 {
+		lctx.t.statsif.addMany("numexpired", lctx.nexp, "bytesexpired", lctx.bexp)
+		glog.Infof("Lifecycle %q: expired %d object(s), %.2f MB", bucketdir, lctx.nexp, float64(lctx.bexp)/MiB)
+	}
+	if lctx.errcnt > 0 {
+		glog.Errorf("Lifecycle %q: failed to expire %d object(s), last err: %v", bucketdir, lctx.errcnt, lctx.lastErr)
+	}
+}
+
+func (lctx *lifecyclectx) lifecyclewalkfn(fqn string, osfi os.FileInfo, err error) error {
+	if err != nil {
+		glog.Errorf("walkfunc callback invoked with err: %v", err)
+		return err
+	}
+	if osfi.Mode().IsDir() {
+		return nil
+	}
+	if iswork, _ := lctx.t.isworkfile(fqn); iswork {
+		return nil
+	}
+	// abort?
+	select {
+	case <-lctx.xlc.abrt:
+		s := fmt.Sprintf("%s aborted, exiting lifecyclewalkfn", lctx.xlc.tostring())
+		glog.Infoln(s)
+		glog.Flush()
+		return errors.New(s)
+	default:
+		break
+	}
+	if lctx.xlc.finished() {
+		return fmt.Errorf("%s aborted - exiting lifecyclewalkfn", lctx.xlc.tostring())
+	}
+	bucket, objname, errstr := lctx.t.fqn2bckobj(fqn)
+	if errstr != "" {
+		glog.Errorln(errstr)
+		return nil
+	}
+	if bucket != lctx.bucket {
+		return nil
+	}
+	exp := expiration(lctx.rules, objname)
+	if exp == 0 {
+		return nil
+	}
+	_, mtime, _ := getAmTimes(osfi)
+	if lctx.now.Sub(mtime) < exp {
+		return nil
+	}
+	// local buckets: delete; Cloud buckets: evict the cached copy
+	if err := lctx.t.fildelete(context.Background(), bucket, objname, !lctx.islocal); err != nil {
+		lctx.errcnt++
+		lctx.lastErr = err
+		return nil
+	}
+	if glog.V(4) {
+		glog.Infof("Lifecycle: expired %s/%s (mtime %v)", bucket, objname, mtime)
+	}
+	lctx.nexp++
+	lctx.bexp += osfi.Size()
+	return nil
+}
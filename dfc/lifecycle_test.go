@@ -0,0 +1,47 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLifecycleExpiration(t *testing.T) {
+	day := 24 * time.Hour
+	rules := []LifecycleRule{
+		{ExpireDays: 30},
+		{Prefix: "logs/", ExpireDays: 7},
+		{Prefix: "logs/audit/", ExpireDays: 365},
+	}
+	tcs := []struct {
+		objname string
+		exp     time.Duration
+	}{
+		{"obj", 30 * day},
+		{"logs", 30 * day},
+		{"logs/today", 7 * day},
+		{"logs/audit/2018", 365 * day},
+	}
+	for _, tc := range tcs {
+		if exp := expiration(rules, tc.objname); exp != tc.exp {
+			t.Errorf("%s: expected expiration %v, got %v", tc.objname, tc.exp, exp)
+		}
+	}
+	if exp := expiration(rules[1:], "obj"); exp != 0 {
+		t.Errorf("expected no expiration, got %v", exp)
+	}
+}
+
+func TestLifecycleValidate(t *testing.T) {
+	if err := validateLifecycle([]LifecycleRule{{ExpireDays: 1}, {Prefix: "a", ExpireDays: 2}}); err != nil {
+		t.Error(err)
+	}
+	if err := validateLifecycle([]LifecycleRule{{Prefix: "a", ExpireDays: 0}}); err == nil {
+		t.Error("expected error for non-positive expire_days")
+	}
+	if err := validateLifecycle([]LifecycleRule{{Prefix: "a", ExpireDays: 1}, {Prefix: "a", ExpireDays: 2}}); err == nil {
+		t.Error("expected error for duplicate prefix")
+	}
+}
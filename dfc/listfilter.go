@@ -0,0 +1,142 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Server-side filters of the bucket listing (GetMsg): the regex that object names
+// must match, the size range, and the atime/ctime ranges (RFC3339, the lower bound
+// inclusive and the upper bound exclusive). Targets evaluate the filters while traversing
+// local buckets (and cached objects of Cloud buckets) - see listwalkf - so that only
+// the matching objects are sorted and merged into pages.
+// Listing a Cloud bucket (as opposed to its cached objects - see GetMsg.GetCachedOnly)
+// supports only the regex and the size filters.
+type listFilter struct {
+	regex       *regexp.Regexp
+	minSize     int64
+	maxSize     int64
+	atimeAfter  time.Time
+	atimeBefore time.Time
+	ctimeAfter  time.Time
+	ctimeBefore time.Time
+}
+
+// newListFilter returns nil if the listing is not filtered
+func newListFilter(msg *GetMsg) (f *listFilter, err error) {
+	if msg.GetRegex == "" && msg.GetMinSize == 0 && msg.GetMaxSize == 0 &&
+		msg.GetAtimeAfter == "" && msg.GetAtimeBefore == "" && msg.GetCtimeAfter == "" && msg.GetCtimeBefore == "" {
+		return
+	}
+	f = &listFilter{minSize: msg.GetMinSize, maxSize: msg.GetMaxSize}
+	if msg.GetRegex != "" {
+		if f.regex, err = regexp.Compile(msg.GetRegex); err != nil {
+			return nil, fmt.Errorf("Invalid regex %q, err: %v", msg.GetRegex, err)
+		}
+	}
+	if f.minSize < 0 || f.maxSize < 0 || (f.maxSize != 0 && f.maxSize < f.minSize) {
+		return nil, fmt.Errorf("Invalid size range [%d, %d]", f.minSize, f.maxSize)
+	}
+	for _, tm := range []struct {
+		s string
+		t *time.Time
+	}{
+		{msg.GetAtimeAfter, &f.atimeAfter},
+		{msg.GetAtimeBefore, &f.atimeBefore},
+		{msg.GetCtimeAfter, &f.ctimeAfter},
+		{msg.GetCtimeBefore, &f.ctimeBefore},
+	} {
+		if tm.s == "" {
+			continue
+		}
+		if *tm.t, err = time.Parse(time.RFC3339, tm.s); err != nil {
+			return nil, fmt.Errorf("Invalid time %q (expecting RFC3339, e.g. \"2018-08-01T00:00:00Z\"), err: %v", tm.s, err)
+		}
+	}
+	return
+}
+
+func (f *listFilter) hasTimes() bool {
+	return !f.atimeAfter.IsZero() || !f.atimeBefore.IsZero() || !f.ctimeAfter.IsZero() || !f.ctimeBefore.IsZero()
+}
+
+func (f *listFilter) matchName(name string) bool {
+	return f.regex == nil || f.regex.MatchString(name)
+}
+
+func (f *listFilter) matchSize(size int64) bool {
+	return size >= f.minSize && (f.maxSize == 0 || size <= f.maxSize)
+}
+
+func matchTime(t, after, before time.Time) bool {
+	return (after.IsZero() || !t.Before(after)) && (before.IsZero() || t.Before(before))
+}
+
+// match is called by the traversal for each object that has the listed prefix
+func (f *listFilter) match(relname string, osfi os.FileInfo) bool {
+	if !f.matchName(relname) || !f.matchSize(osfi.Size()) {
+		return false
+	}
+	if !f.hasTimes() {
+		return true
+	}
+	atime, ctime, _ := getAmTimes(osfi)
+	return matchTime(atime, f.atimeAfter, f.atimeBefore) && matchTime(ctime, f.ctimeAfter, f.ctimeBefore)
+}
+
+func errCloudTimeFilter(bucket string) string {
+	return fmt.Sprintf("Cannot filter Cloud bucket %s by atime or ctime: supported only for cached objects (%q)",
+		bucket, "cached_only")
+}
+
+// filterCloudList filters the Cloud bucket list in place
+func (f *listFilter) filterCloudList(reslist *BucketList) {
+	entries := reslist.Entries[:0]
+	for _, entry := range reslist.Entries {
+		if entry.Type == BucketEntryDirectory || (f.matchName(entry.Name) && f.matchSize(entry.Size)) {
+			entries = append(entries, entry)
+		}
+	}
+	for i := len(entries); i < len(reslist.Entries); i++ {
+		reslist.Entries[i] = nil
+	}
+	reslist.Entries = entries
+}
+
+// listCloudFiltered lists the Cloud bucket (one page at a time) and filters the result
+func (t *targetrunner) listCloudFiltered(ct context.Context, bucket string, msg *GetMsg,
+	f *listFilter) (jsbytes []byte, errstr string, errcode int) {
+	var cmsg GetMsg
+	copyStruct(&cmsg, msg)
+	needSize := strings.Contains(msg.GetProps, GetPropsSize)
+	if !needSize {
+		cmsg.GetProps += ", " + GetPropsSize
+	}
+	if jsbytes, errstr, errcode = getcloudif().listbucket(ct, bucket, &cmsg); errstr != "" {
+		return
+	}
+	reslist := &BucketList{}
+	if err := json.Unmarshal(jsbytes, reslist); err != nil {
+		errstr = fmt.Sprintf("Failed to unmarshal the list of %s, err: %v", bucket, err)
+		return
+	}
+	f.filterCloudList(reslist)
+	if !needSize {
+		for _, entry := range reslist.Entries {
+			entry.Size = 0
+		}
+	}
+	jsbytes, err := json.Marshal(reslist)
+	assert(err == nil, err)
+	return
+}
@@ -0,0 +1,42 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"testing"
+)
+
+func TestListFilter(t *testing.T) {
+	if f, err := newListFilter(&GetMsg{GetPrefix: "a"}); f != nil || err != nil {
+		t.Errorf("expected no filter, got %v, err: %v", f, err)
+	}
+	f, err := newListFilter(&GetMsg{GetRegex: `\d{3}$`, GetMinSize: 10, GetMaxSize: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reslist := &BucketList{Entries: []*BucketEntry{
+		{Name: "a/123", Size: 10},
+		{Name: "a/12", Size: 50},
+		{Name: "a/456", Size: 101},
+		{Name: "b/", Type: BucketEntryDirectory},
+		{Name: "c/789", Size: 100},
+	}}
+	f.filterCloudList(reslist)
+	if len(reslist.Entries) != 3 || reslist.Entries[0].Name != "a/123" || reslist.Entries[2].Name != "c/789" {
+		t.Errorf("unexpected result of filtering: %d entries", len(reslist.Entries))
+	}
+
+	for _, msg := range []*GetMsg{
+		{GetRegex: "("},
+		{GetMinSize: 10, GetMaxSize: 5},
+		{GetAtimeBefore: "yesterday"},
+	} {
+		if _, err := newListFilter(msg); err == nil {
+			t.Errorf("expected error for %+v", msg)
+		}
+	}
+	if f, err = newListFilter(&GetMsg{GetCtimeAfter: "2018-08-01T00:00:00Z"}); err != nil || !f.hasTimes() {
+		t.Errorf("expected time filter, err: %v", err)
+	}
+}
@@ -345,7 +345,12 @@ loop:
 			}
 			bucket := fwd.bucket
 			for _, objname := range fwd.objnames {
-				t.prefetchMissing(fwd.ctx, objname, bucket)
+				release, ok := t.xthrottle.acquire(xpre.abrt)
+				if !ok {
+					glog.Infof("Prefetch aborted, skipping the remaining objects of %s", bucket)
+					break
+				}
+				release(t.prefetchMissing(fwd.ctx, objname, bucket))
 			}
 
 			// Signal completion of prefetch
@@ -364,7 +369,8 @@ loop:
 	t.xactinp.del(xpre.id)
 }
 
-func (t *targetrunner) prefetchMissing(ct context.Context, objname, bucket string) {
+// prefetchMissing returns the number of bytes fetched
+func (t *targetrunner) prefetchMissing(ct context.Context, objname, bucket string) (size int64) {
 	var (
 		errstr, version   string
 		vchanged, coldget bool
@@ -399,12 +405,14 @@ func (t *targetrunner) prefetchMissing(ct context.Context, objname, bucket strin
 	if glog.V(4) {
 		glog.Infof("PREFETCH: %s/%s", bucket, objname)
 	}
+	size = props.size
 	t.statsif.add("numprefetch", 1)
 	t.statsif.add("bytesprefetched", props.size)
 	if vchanged {
 		t.statsif.add("bytesvchanged", props.size)
 		t.statsif.add("numvchanged", 1)
 	}
+	return
 }
 
 func (t *targetrunner) addPrefetchList(ct context.Context, objs []string, bucket string,
@@ -0,0 +1,237 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sorted bucket listing: GetMsg.GetSort = "[ascending|descending][, name|size|atime|ctime]"
+//
+// The default is ascending by name - the order in which targets traverse local buckets.
+// Entries with equal keys are ordered by name, so that the order is total and the page marker
+// of a multi-page listing can be stable: for the default order the marker is the last listed name,
+// otherwise it is "<key>,<name>" where the key is the size or the time in nanoseconds (see marker()).
+// Each target returns its page sorted, the proxy then k-way merges the pages (see merge()).
+// To compare times the proxy requests them from targets in RFC3339Nano (see targetMsg).
+type listSort struct {
+	desc       bool
+	key        string // GetPropsName | GetPropsSize | GetPropsAtime | GetPropsCtime
+	timeFormat string
+	// parsed GetMsg.GetPageMarker
+	hasMarker  bool
+	markerKey  int64
+	markerName string
+}
+
+func newListSort(msg *GetMsg) (ls *listSort, err error) {
+	ls = &listSort{key: GetPropsName, timeFormat: msg.GetTimeFormat}
+	if ls.timeFormat == "" {
+		ls.timeFormat = RFC822
+	}
+	for _, s := range strings.Split(msg.GetSort, ",") {
+		switch s = strings.TrimSpace(s); s {
+		case "", GetSortAsc:
+		case GetSortDes:
+			ls.desc = true
+		case GetPropsName, GetPropsSize, GetPropsAtime, GetPropsCtime:
+			ls.key = s
+		default:
+			return nil, fmt.Errorf("Invalid sort %q: expecting %q or %q and/or one of: %s, %s, %s, %s",
+				msg.GetSort, GetSortAsc, GetSortDes, GetPropsName, GetPropsSize, GetPropsAtime, GetPropsCtime)
+		}
+	}
+	if msg.GetPageMarker == "" {
+		return
+	}
+	ls.hasMarker, ls.markerName = true, msg.GetPageMarker
+	if ls.key == GetPropsName {
+		return
+	}
+	i := strings.Index(msg.GetPageMarker, ",")
+	if i < 0 {
+		return nil, fmt.Errorf("Invalid page marker %q for sort %q", msg.GetPageMarker, msg.GetSort)
+	}
+	if ls.markerKey, err = strconv.ParseInt(msg.GetPageMarker[:i], 10, 64); err != nil {
+		return nil, fmt.Errorf("Invalid page marker %q for sort %q, err: %v", msg.GetPageMarker, msg.GetSort, err)
+	}
+	ls.markerName = msg.GetPageMarker[i+1:]
+	return
+}
+
+// walkOrder is true when the listing is sorted in the order of traversal, so that
+// the latter can skip names up to the marker and stop once the page is full
+func (ls *listSort) walkOrder() bool {
+	return ls.key == GetPropsName && !ls.desc
+}
+
+func (ls *listSort) istime() bool {
+	return ls.key == GetPropsAtime || ls.key == GetPropsCtime
+}
+
+func (ls *listSort) sortkey(entry *BucketEntry) int64 {
+	var s string
+	switch ls.key {
+	case GetPropsSize:
+		return entry.Size
+	case GetPropsAtime:
+		s = entry.Atime
+	case GetPropsCtime:
+		s = entry.Ctime
+	default:
+		return 0
+	}
+	if s == "" {
+		return 0 // e.g., atime of a Cloud object that is not cached
+	}
+	t, err := time.Parse(ls.timeFormat, s)
+	if err != nil {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func (ls *listSort) compare(ikey int64, iname string, jkey int64, jname string) int {
+	c := 0
+	switch {
+	case ikey < jkey:
+		c = -1
+	case ikey > jkey:
+		c = 1
+	case iname < jname:
+		c = -1
+	case iname > jname:
+		c = 1
+	}
+	if ls.desc {
+		c = -c
+	}
+	return c
+}
+
+func (ls *listSort) less(a, b *BucketEntry) bool {
+	return ls.compare(ls.sortkey(a), a.Name, ls.sortkey(b), b.Name) < 0
+}
+
+// after returns true if the entry follows the page marker (or if there is no marker)
+func (ls *listSort) after(entry *BucketEntry) bool {
+	if !ls.hasMarker {
+		return true
+	}
+	return ls.compare(ls.sortkey(entry), entry.Name, ls.markerKey, ls.markerName) > 0
+}
+
+// marker returns the page marker to continue listing after the entry
+func (ls *listSort) marker(entry *BucketEntry) string {
+	if ls.key == GetPropsName {
+		return entry.Name
+	}
+	return strconv.FormatInt(ls.sortkey(entry), 10) + "," + entry.Name
+}
+
+func (ls *listSort) sort(entries []*BucketEntry) {
+	sort.Slice(entries, func(i, j int) bool { return ls.less(entries[i], entries[j]) })
+}
+
+// merge k-way merges the sorted pages into a single sorted page of at most 'limit' entries,
+// dropping duplicate entries (e.g., the same common prefix listed by multiple targets)
+func (ls *listSort) merge(pages [][]*BucketEntry, limit int) []*BucketEntry {
+	h := &listHeap{ls: ls}
+	for _, page := range pages {
+		if len(page) > 0 {
+			h.pages = append(h.pages, page)
+		}
+	}
+	heap.Init(h)
+	merged := make([]*BucketEntry, 0, limit)
+	for h.Len() > 0 && len(merged) < limit {
+		page := h.pages[0]
+		entry := page[0]
+		if len(merged) == 0 || merged[len(merged)-1].Name != entry.Name {
+			merged = append(merged, entry)
+		}
+		if len(page) == 1 {
+			heap.Pop(h)
+		} else {
+			h.pages[0] = page[1:]
+			heap.Fix(h, 0)
+		}
+	}
+	return merged
+}
+
+// listHeap orders the pages by their respective first entries
+type listHeap struct {
+	pages [][]*BucketEntry
+	ls    *listSort
+}
+
+func (h *listHeap) Len() int           { return len(h.pages) }
+func (h *listHeap) Less(i, j int) bool { return h.ls.less(h.pages[i][0], h.pages[j][0]) }
+func (h *listHeap) Swap(i, j int)      { h.pages[i], h.pages[j] = h.pages[j], h.pages[i] }
+func (h *listHeap) Push(x interface{}) { h.pages = append(h.pages, x.([]*BucketEntry)) }
+func (h *listHeap) Pop() interface{} {
+	n := len(h.pages)
+	page := h.pages[n-1]
+	h.pages = h.pages[:n-1]
+	return page
+}
+
+// targetMsg returns the list message the proxy sends to targets: the latter must
+// return the sort key and, if it is time, return it in the format that keeps nanoseconds -
+// the format in which the proxy (and this listSort) then compares times
+func (ls *listSort) targetMsg(msg *GetMsg) *GetMsg {
+	if !ls.istime() {
+		return msg
+	}
+	var tmsg GetMsg
+	copyStruct(&tmsg, msg)
+	tmsg.GetTimeFormat = time.RFC3339Nano
+	ls.timeFormat = time.RFC3339Nano
+	if !strings.Contains(tmsg.GetProps, ls.key) {
+		if tmsg.GetProps == "" {
+			tmsg.GetProps = ls.key
+		} else {
+			tmsg.GetProps += ", " + ls.key
+		}
+	}
+	return &tmsg
+}
+
+// restoreTimes converts the times of the listed entries back to the requested format
+// (and drops the time that was added only for the sake of sorting) - see targetMsg
+func (ls *listSort) restoreTimes(entries []*BucketEntry, msg *GetMsg) {
+	if !ls.istime() {
+		return
+	}
+	layout := msg.GetTimeFormat
+	if layout == "" {
+		layout = RFC822
+	}
+	var (
+		needAtime = strings.Contains(msg.GetProps, GetPropsAtime)
+		needCtime = strings.Contains(msg.GetProps, GetPropsCtime)
+		format    = func(s string, need bool) string {
+			if s == "" || !need {
+				return ""
+			}
+			t, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return s
+			}
+			return t.Format(layout)
+		}
+	)
+	for _, entry := range entries {
+		entry.Atime = format(entry.Atime, needAtime)
+		entry.Ctime = format(entry.Ctime, needCtime)
+	}
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func names(entries []*BucketEntry) []string {
+	nms := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		nms = append(nms, entry.Name)
+	}
+	return nms
+}
+
+func TestListSortMerge(t *testing.T) {
+	ls, err := newListSort(&GetMsg{GetSort: "descending, size"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages := [][]*BucketEntry{
+		{{Name: "a", Size: 30}, {Name: "c", Size: 10}},
+		{{Name: "b", Size: 30}, {Name: "d", Size: 20}, {Name: "e", Size: 0}},
+		{},
+	}
+	for _, page := range pages {
+		ls.sort(page)
+	}
+	merged := ls.merge(pages, 4)
+	if exp := []string{"b", "a", "d", "c"}; !reflect.DeepEqual(names(merged), exp) {
+		t.Fatalf("expected %v, got %v", exp, names(merged))
+	}
+
+	// next page starts right after the marker
+	marker := ls.marker(merged[len(merged)-1])
+	if ls, err = newListSort(&GetMsg{GetSort: "descending, size", GetPageMarker: marker}); err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range append(pages[0], pages[1]...) {
+		if exp := entry.Name == "e"; ls.after(entry) != exp {
+			t.Errorf("%s: expected after(%s) to be %t", entry.Name, marker, exp)
+		}
+	}
+}
+
+func TestListSortInvalid(t *testing.T) {
+	if _, err := newListSort(&GetMsg{GetSort: "ascending, owner"}); err == nil {
+		t.Error("expected error for invalid sort key")
+	}
+	if _, err := newListSort(&GetMsg{GetSort: "size", GetPageMarker: "obj"}); err == nil {
+		t.Error("expected error for invalid page marker")
+	}
+	if _, err := newListSort(&GetMsg{GetPageMarker: "obj,1"}); err != nil {
+		t.Errorf("unexpected error for page marker of listing sorted by name: %v", err)
+	}
+}
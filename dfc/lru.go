@@ -45,6 +45,22 @@ func (t *targetrunner) runLRU() {
 	fschkwg := &sync.WaitGroup{}
 
 	glog.Infof("LRU: %s started: dont-evict-time %v", xlru.tostring(), ctx.config.LRU.DontEvictTime)
+	// trash goes first
+	purge := make([]string, 0)
+	for mpath := range ctx.mountpaths.Available {
+		if toevict, err := getToEvict(mpath, ctx.config.LRU.HighWM, ctx.config.LRU.LowWM); err == nil && toevict > 0 {
+			purge = append(purge, mpath)
+		}
+	}
+	// the periodic purge, if running, keeps the trash within the retention time -
+	// wait for it to finish and purge everything
+	for len(purge) > 0 && t.runPurgeTrash(0, purge...) == errPurgeInProgress {
+		select {
+		case <-xlru.abrt:
+			purge = nil
+		case <-time.After(time.Second):
+		}
+	}
 	for mpath := range ctx.mountpaths.Available {
 		fschkwg.Add(1)
 		go t.oneLRU(makePathLocal(mpath), fschkwg, xlru)
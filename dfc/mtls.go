@@ -0,0 +1,271 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// Mutual TLS (config: net.http.use_mtls)
+//
+// Every daemon has a certificate issued by the cluster CA; the certificate's
+// Common Name is the daemon ID. The daemon presents the certificate both as
+// a server (to clients and other daemons) and as a client when it calls other
+// daemons. Each side verifies the peer's certificate against the cluster CA
+// instead of the host name: a server accepts a certificate only from a daemon
+// that is present in its Smap, and httprunner.call makes sure the response
+// comes from the daemon it has called. Clients of the public API are not
+// required to present a certificate, while intra-cluster requests (metasync,
+// keepalive and registration, voting, rebalance) are rejected without one.
+//
+// The certificates are reloaded, without restart, when any of the three files
+// (CA, daemon certificate, daemon key) changes.
+
+const certCheckInterval = time.Minute // how often to check the certificate files for changes
+
+type clusterCerts struct {
+	sync.Mutex
+	caPath, certPath, keyPath string
+	cert                      *tls.Certificate
+	pool                      *x509.CertPool
+	modTimes                  [3]time.Time
+	checked                   time.Time
+}
+
+func newClusterCerts(caPath, certPath, keyPath string) (*clusterCerts, error) {
+	c := &clusterCerts{caPath: caPath, certPath: certPath, keyPath: keyPath}
+	modTimes, err := c.statFiles()
+	if err != nil {
+		return nil, err
+	}
+	if err = c.load(modTimes); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *clusterCerts) statFiles() (modTimes [3]time.Time, err error) {
+	for i, fqn := range []string{c.caPath, c.certPath, c.keyPath} {
+		var finfo os.FileInfo
+		if finfo, err = os.Stat(fqn); err != nil {
+			return
+		}
+		modTimes[i] = finfo.ModTime()
+	}
+	return
+}
+
+// load reads the CA and the daemon's certificate and key; on error, the
+// previously loaded ones (if any) remain in use
+func (c *clusterCerts) load(modTimes [3]time.Time) error {
+	cabytes, err := ioutil.ReadFile(c.caPath)
+	if err != nil {
+		return fmt.Errorf("Failed to read CA certificate %q, err: %v", c.caPath, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(cabytes) {
+		return fmt.Errorf("Failed to parse CA certificate %q", c.caPath)
+	}
+	cert, err := tls.LoadX509KeyPair(c.certPath, c.keyPath)
+	if err != nil {
+		return fmt.Errorf("Failed to load daemon certificate %q (key %q), err: %v", c.certPath, c.keyPath, err)
+	}
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return fmt.Errorf("Failed to parse daemon certificate %q, err: %v", c.certPath, err)
+	}
+	if _, err = cert.Leaf.Verify(x509.VerifyOptions{Roots: pool, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+		return fmt.Errorf("Daemon certificate %q is not issued by the cluster CA, err: %v", c.certPath, err)
+	}
+	c.cert, c.pool, c.modTimes, c.checked = &cert, pool, modTimes, time.Now()
+	return nil
+}
+
+// refresh reloads the certificates if the files have changed since the last check
+func (c *clusterCerts) refresh() {
+	c.Lock()
+	defer c.Unlock()
+	if time.Since(c.checked) < certCheckInterval {
+		return
+	}
+	c.checked = time.Now()
+	modTimes, err := c.statFiles()
+	if err != nil {
+		glog.Errorf("Failed to check cluster certificates, err: %v", err)
+		return
+	}
+	if modTimes == c.modTimes {
+		return
+	}
+	if err = c.load(modTimes); err != nil {
+		glog.Errorf("Failed to reload cluster certificates, err: %v", err)
+		return
+	}
+	glog.Infof("Reloaded cluster certificates: daemon %s, expires %v", c.cert.Leaf.Subject.CommonName, c.cert.Leaf.NotAfter)
+}
+
+func (c *clusterCerts) certificate() *tls.Certificate {
+	c.refresh()
+	c.Lock()
+	defer c.Unlock()
+	return c.cert
+}
+
+// verify verifies the peer's certificate chain against the cluster CA and
+// returns the peer's daemon ID
+func (c *clusterCerts) verify(rawCerts [][]byte) (string, error) {
+	if len(rawCerts) == 0 {
+		return "", errors.New("no daemon certificate")
+	}
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse certificate, err: %v", err)
+		}
+		certs[i] = cert
+	}
+	c.refresh()
+	c.Lock()
+	pool := c.pool
+	c.Unlock()
+
+	opts := x509.VerifyOptions{
+		Roots:         pool,
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	if _, err := certs[0].Verify(opts); err != nil {
+		return "", err
+	}
+	if certs[0].Subject.CommonName == "" {
+		return "", errors.New("daemon certificate without daemon ID (Common Name)")
+	}
+	return certs[0].Subject.CommonName, nil
+}
+
+// serverTLSConfig: clients are asked for a certificate and, if they present one,
+// it must be issued by the cluster CA
+func (c *clusterCerts) serverTLSConfig() *tls.Config {
+	return &tls.Config{
+		ClientAuth: tls.RequestClientCert,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return c.certificate(), nil
+		},
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return nil
+			}
+			_, err := c.verify(rawCerts)
+			return err
+		},
+	}
+}
+
+// clientTLSConfig: the host name verification is replaced by the verification
+// against the cluster CA; the daemon ID is checked by checkPeer
+func (c *clusterCerts) clientTLSConfig() *tls.Config {
+	return &tls.Config{
+		InsecureSkipVerify: true,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return c.certificate(), nil
+		},
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			_, err := c.verify(rawCerts)
+			return err
+		},
+	}
+}
+
+// peerDaemonID returns the daemon ID from the (verified) certificate of the peer, or
+// an empty string if the peer has not presented one
+func peerDaemonID(state *tls.ConnectionState) string {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return ""
+	}
+	return state.PeerCertificates[0].Subject.CommonName
+}
+
+// checkPeer checks the daemon ID of the responding peer (mTLS: the certificate
+// itself is verified by the transport)
+func (h *httprunner) checkPeer(si *daemonInfo, response *http.Response) error {
+	if h.certs == nil || si == nil || response.TLS == nil {
+		return nil
+	}
+	if id := peerDaemonID(response.TLS); id != si.DaemonID {
+		return fmt.Errorf("daemon %s responded with certificate of %q", si.DaemonID, id)
+	}
+	return nil
+}
+
+// isIntraCluster returns true for the requests that only daemons send to each other
+func isIntraCluster(r *http.Request) bool {
+	apitems := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(apitems) < 2 || apitems[0] != Rversion {
+		return false
+	}
+	switch apitems[1] {
+	case Rvote:
+		return true
+	case Rcluster: // register, keepalive
+		return r.Method == http.MethodPost
+	case Rdaemon: // metasync, syncsmap, setprimary, register
+		return len(apitems) > 2 && (r.Method == http.MethodPut || r.Method == http.MethodPost)
+	case Robjects: // rebalance
+		query := r.URL.Query()
+		return r.Method == http.MethodPut && query.Get(URLParamFromID) != "" && query.Get(URLParamToID) != ""
+	case Rsort: // dsort: init, start, records, fetch, create, cleanup
+		return true
+	case Rtokens: // revoked tokens: the primary proxy => other daemons (AuthN => primary carries no from_id)
+		return r.Method == http.MethodDelete && r.URL.Query().Get(URLParamFromID) != ""
+	case Rpush: // bypasses the proxy (and its authorization)
+		return true
+	}
+	return false
+}
+
+// isRegistration returns true for the requests of the daemons that may be not in the Smap yet
+func isRegistration(r *http.Request) bool {
+	apitems := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	return len(apitems) >= 2 && apitems[0] == Rversion && apitems[1] == Rcluster && r.Method == http.MethodPost
+}
+
+// mtlsHandler checks the peer daemon: a daemon's certificate must belong to a
+// daemon in the Smap, intra-cluster requests must come with a certificate.
+// The daemon ID of a registering daemon is checked against its daemonInfo
+// in httpclupost
+func (h *httprunner) mtlsHandler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := peerDaemonID(r.TLS)
+		if id == "" {
+			if isIntraCluster(r) {
+				h.invalmsghdlr(w, r, "Intra-cluster request without daemon certificate", http.StatusUnauthorized)
+				return
+			}
+			handler.ServeHTTP(w, r)
+			return
+		}
+		// zero Smap version: the daemon has not joined the cluster yet
+		if !isRegistration(r) && h.smap.versionL() != 0 && !h.smap.containsL(id) {
+			h.invalmsghdlr(w, r, fmt.Sprintf("Daemon %s is not in the cluster map", id), http.StatusForbidden)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
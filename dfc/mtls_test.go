@@ -0,0 +1,280 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "dfc cluster CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns PEM-encoded daemon certificate and key
+func (ca *testCA) issue(t *testing.T, daemonID string) (certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: daemonID},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyder, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyder})
+}
+
+// writeCerts writes the CA and the daemon's certificate and key into dir
+func (ca *testCA) writeCerts(t *testing.T, dir, daemonID string) (caPath, certPath, keyPath string) {
+	caPath = filepath.Join(dir, "ca.crt")
+	certPath = filepath.Join(dir, daemonID+".crt")
+	keyPath = filepath.Join(dir, daemonID+".key")
+	certPEM, keyPEM := ca.issue(t, daemonID)
+	for fqn, data := range map[string][]byte{caPath: ca.pem, certPath: certPEM, keyPath: keyPEM} {
+		if err := ioutil.WriteFile(fqn, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return
+}
+
+func TestClusterCertsVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mtls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := newTestCA(t)
+	certs, err := newClusterCerts(ca.writeCerts(t, dir, "target1"))
+	if err != nil {
+		t.Fatalf("Failed to load certificates: %v", err)
+	}
+	id, err := certs.verify(certs.certificate().Certificate)
+	if err != nil || id != "target1" {
+		t.Errorf("Expected daemon target1, got %q, err: %v", id, err)
+	}
+
+	// a certificate issued by a different CA
+	certPEM, _ := newTestCA(t).issue(t, "target2")
+	block, _ := pem.Decode(certPEM)
+	if _, err = certs.verify([][]byte{block.Bytes}); err == nil {
+		t.Error("Certificate of a different CA was accepted")
+	}
+	// no Common Name
+	certPEM, _ = ca.issue(t, "")
+	block, _ = pem.Decode(certPEM)
+	if _, err = certs.verify([][]byte{block.Bytes}); err == nil {
+		t.Error("Certificate without daemon ID was accepted")
+	}
+	if _, err = certs.verify(nil); err == nil {
+		t.Error("Missing certificate was accepted")
+	}
+
+	// the daemon certificate must be issued by the cluster CA
+	caPath := filepath.Join(dir, "ca.crt")
+	if err = ioutil.WriteFile(caPath, newTestCA(t).pem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = newClusterCerts(caPath, filepath.Join(dir, "target1.crt"), filepath.Join(dir, "target1.key")); err == nil {
+		t.Error("Daemon certificate of a different CA was loaded")
+	}
+}
+
+func TestClusterCertsReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mtls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := newTestCA(t)
+	caPath, certPath, keyPath := ca.writeCerts(t, dir, "target1")
+	certs, err := newClusterCerts(caPath, certPath, keyPath)
+	if err != nil {
+		t.Fatalf("Failed to load certificates: %v", err)
+	}
+	serial := certs.certificate().Leaf.SerialNumber
+
+	// renew the certificate
+	certPEM, keyPEM := ca.issue(t, "target1")
+	future := time.Now().Add(time.Minute)
+	for fqn, data := range map[string][]byte{certPath: certPEM, keyPath: keyPEM} {
+		if err = ioutil.WriteFile(fqn, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(fqn, future, future)
+	}
+	// not checked yet
+	if certs.certificate().Leaf.SerialNumber.Cmp(serial) != 0 {
+		t.Error("Certificate was reloaded before the check interval")
+	}
+	certs.checked = time.Time{}
+	if certs.certificate().Leaf.SerialNumber.Cmp(serial) == 0 {
+		t.Error("Renewed certificate was not reloaded")
+	}
+
+	// a broken file does not replace the loaded certificate
+	serial = certs.certificate().Leaf.SerialNumber
+	future = future.Add(time.Minute)
+	if err = ioutil.WriteFile(certPath, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(certPath, future, future)
+	certs.checked = time.Time{}
+	if cert := certs.certificate(); cert == nil || cert.Leaf.SerialNumber.Cmp(serial) != 0 {
+		t.Error("Broken certificate replaced the loaded one")
+	}
+}
+
+func TestMTLSHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mtls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := newTestCA(t)
+	load := func(daemonID string) *clusterCerts {
+		certs, err := newClusterCerts(ca.writeCerts(t, dir, daemonID))
+		if err != nil {
+			t.Fatalf("Failed to load certificates of %s: %v", daemonID, err)
+		}
+		return certs
+	}
+	h := &httprunner{statsif: nopStats{}, certs: load("proxy1")}
+	h.smap = &Smap{Version: 1, Tmap: map[string]*daemonInfo{"target1": {DaemonID: "target1"}}, Pmap: map[string]*daemonInfo{}}
+
+	// not httptest.Server: it would present its own certificate
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", h.certs.serverTLSConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	server := &http.Server{Handler: h.mtlsHandler(handler)}
+	go server.Serve(ln)
+	defer server.Close()
+	serverURL := "https://" + ln.Addr().String()
+
+	client := func(certs *clusterCerts) *http.Client {
+		transport := &http.Transport{}
+		if certs != nil {
+			transport.TLSClientConfig = certs.clientTLSConfig()
+		} else {
+			transport.TLSClientConfig = (&clusterCerts{pool: h.certs.pool, checked: time.Now()}).clientTLSConfig()
+			transport.TLSClientConfig.GetClientCertificate = nil
+		}
+		return &http.Client{Transport: transport}
+	}
+	tests := []struct {
+		name   string
+		client *http.Client
+		method string
+		path   string
+		status int
+	}{
+		{"public, no certificate", client(nil), http.MethodGet, "/v1/objects/bucket/obj", http.StatusOK},
+		{"metasync, no certificate", client(nil), http.MethodPut, "/v1/daemon/metasync", http.StatusUnauthorized},
+		{"metasync, daemon in Smap", client(load("target1")), http.MethodPut, "/v1/daemon/metasync", http.StatusOK},
+		{"metasync, unknown daemon", client(load("target2")), http.MethodPut, "/v1/daemon/metasync", http.StatusForbidden},
+		{"register, unknown daemon", client(load("target3")), http.MethodPost, "/v1/cluster/register", http.StatusOK},
+		{"rebalance, no certificate", client(nil), http.MethodPut, "/v1/objects/bucket/obj?from_id=a&to_id=b", http.StatusUnauthorized},
+		{"dsort records, no certificate", client(nil), http.MethodPut, "/v1/sort/id/records", http.StatusUnauthorized},
+		{"dsort records, daemon in Smap", client(load("target1")), http.MethodPut, "/v1/sort/id/records", http.StatusOK},
+		{"revoked tokens from AuthN", client(nil), http.MethodDelete, "/v1/tokens", http.StatusOK},
+		{"revoked tokens from primary, no certificate", client(nil), http.MethodDelete, "/v1/tokens?from_id=a", http.StatusUnauthorized},
+		{"push, no certificate", client(nil), http.MethodPost, "/v1/push/bucket", http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest(test.method, serverURL+test.path, nil)
+		resp, err := test.client.Do(req)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("%s: expected status %d, got %d", test.name, test.status, resp.StatusCode)
+		}
+		if id := peerDaemonID(resp.TLS); id != "proxy1" {
+			t.Errorf("%s: expected server daemon proxy1, got %q", test.name, id)
+		}
+	}
+
+	// the daemon ID of the responding peer
+	resp, err := client(load("target1")).Get(serverURL + "/v1/daemon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if err = h.checkPeer(&daemonInfo{DaemonID: "proxy1"}, resp); err != nil {
+		t.Error(err)
+	}
+	if err = h.checkPeer(&daemonInfo{DaemonID: "proxy2"}, resp); err == nil {
+		t.Error("Expected proxy1 certificate to be rejected for proxy2")
+	}
+
+	// a client that does not trust the cluster CA
+	otherdir := filepath.Join(dir, "other")
+	if err = os.Mkdir(otherdir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	certs, err := newClusterCerts(newTestCA(t).writeCerts(t, otherdir, "target1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client(certs).Get(serverURL + "/v1/daemon"); err == nil {
+		t.Error("Handshake with a daemon of a different CA succeeded")
+	}
+}
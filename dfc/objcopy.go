@@ -0,0 +1,151 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// Server-side copy: POST {"action": "copy", "name": new-objname, "value": new-bucket}
+//
+// Both the name and the value are optional and default to the name and the bucket
+// of the source object, respectively. The destination must be a local bucket,
+// the source can be either local or Cloud - in the latter case a non-cached source
+// is cold-GET first. The proxy redirects the request to the target that stores the
+// source; the latter sends the object to the destination's HRW target directly,
+// along with its checksum and version (the destination, however, versions the copy
+// as any other object of the local bucket - see doPutCommit).
+
+// copyDestination returns the destination of the copy action given the source
+func copyDestination(msg *ActionMsg, bucket, objname string) (bucketTo, objnameTo, errstr string) {
+	bucketTo, objnameTo = bucket, objname
+	if msg.Name != "" {
+		objnameTo = msg.Name
+	}
+	if msg.Value != nil {
+		v, ok := msg.Value.(string)
+		if !ok {
+			errstr = fmt.Sprintf("Invalid copy request: destination bucket must be a string (%v, %T)", msg.Value, msg.Value)
+			return
+		}
+		if v != "" {
+			bucketTo = v
+		}
+	}
+	if bucketTo == bucket && objnameTo == objname {
+		errstr = fmt.Sprintf("Invalid copy request: %s/%s cannot be copied onto itself", bucket, objname)
+	}
+	return
+}
+
+// POST { action: copy } /Rversion/Robjects/bucket-name/object-name
+func (t *targetrunner) copyfile(w http.ResponseWriter, r *http.Request, msg ActionMsg) {
+	apitems := t.restAPIItems(r.URL.Path, 5)
+	if apitems = t.checkRestAPI(w, r, apitems, 2, Rversion, Robjects); apitems == nil {
+		return
+	}
+	bucket, objname := apitems[0], strings.Join(apitems[1:], "/")
+	if !t.validatebckname(w, r, bucket) {
+		return
+	}
+	bucketTo, objnameTo, errstr := copyDestination(&msg, bucket, objname)
+	if errstr != "" {
+		t.invalmsghdlr(w, r, errstr)
+		return
+	}
+	bucketmd := t.bmdowner.get()
+	if !bucketmd.islocal(bucketTo) {
+		t.invalmsghdlr(w, r, fmt.Sprintf("Copy destination must be a local bucket (%s does not appear to be local)", bucketTo))
+		return
+	}
+	var (
+		islocal = bucketmd.islocal(bucket)
+		fqn     = t.fqn(bucket, objname, islocal)
+		uname   = uniquename(bucket, objname)
+		locked  bool
+	)
+	if !islocal {
+		if _, err := os.Stat(fqn); err != nil && os.IsNotExist(err) {
+			// note: coldget() keeps the read lock if successful
+			if _, errstr, errcode := t.coldget(t.contextWithAuth(r), bucket, objname, false); errstr != "" {
+				if errcode == 0 {
+					t.invalmsghdlr(w, r, errstr)
+				} else {
+					t.invalmsghdlr(w, r, errstr, errcode)
+				}
+				return
+			}
+			locked = true
+		}
+	}
+	if !locked {
+		t.rtnamemap.lockname(uname, false, &pendinginfo{Time: time.Now(), fqn: fqn}, time.Second)
+	}
+	if errstr = t.copyobject(bucket, objname, bucketTo, objnameTo); errstr != "" {
+		t.invalmsghdlr(w, r, errstr)
+	}
+	t.rtnamemap.unlockname(uname, false)
+}
+
+// copyobject copies the (locally stored) object to its destination:
+// via sendfile if the latter maps to another target, in place otherwise.
+// Must be called under the source's lock.
+func (t *targetrunner) copyobject(bucketFrom, objnameFrom, bucketTo, objnameTo string) (errstr string) {
+	si, errstr := HrwTarget(bucketTo, objnameTo, t.smap)
+	if errstr != "" {
+		return
+	}
+	bucketmd := t.bmdowner.get()
+	fqn := t.fqn(bucketFrom, objnameFrom, bucketmd.islocal(bucketFrom))
+	finfo, err := os.Stat(fqn)
+	if err != nil {
+		errstr = fmt.Sprintf("Copy: failed to fstat %s (%s/%s), err: %v", fqn, bucketFrom, objnameFrom, err)
+		return
+	}
+	if si.DaemonID != t.si.DaemonID {
+		if glog.V(3) {
+			glog.Infof("Copying %s/%s at %s => %s/%s at %s", bucketFrom, objnameFrom, t.si.DaemonID, bucketTo, objnameTo, si.DaemonID)
+		}
+		if errstr = t.sendfile(http.MethodPut, bucketFrom, objnameFrom, si, finfo.Size(), bucketTo, objnameTo); errstr == "" {
+			t.statsif.addMany("numcopy", int64(1), "bytescopied", finfo.Size())
+		}
+		return
+	}
+	// local copy: commit as a regular PUT (new version, the destination's history retained)
+	file, err := os.Open(fqn)
+	if err != nil {
+		errstr = fmt.Sprintf("Failed to open %s, err: %v", fqn, err)
+		return
+	}
+	defer file.Close()
+	var (
+		hdhobj cksumvalue
+		props  = &objectProps{}
+		newfqn = t.fqn(bucketTo, objnameTo, true)
+		putfqn = t.fqn2workfile(newfqn)
+	)
+	if xxhashval, errs := Getxattr(fqn, XattrXXHashVal); errs == "" && len(xxhashval) != 0 {
+		hdhobj = newcksumvalue(ChecksumXXHash, string(xxhashval))
+	}
+	if _, props.nhobj, _, errstr = t.receive(putfqn, objnameTo, "", hdhobj, file); errstr != "" {
+		return
+	}
+	if errstr, _ = t.putCommit(context.Background(), bucketTo, objnameTo, putfqn, newfqn, props, false /*rebalance*/); errstr != "" {
+		return
+	}
+	t.statsif.addMany("numcopy", int64(1), "bytescopied", finfo.Size())
+	if glog.V(3) {
+		glog.Infof("Copied %s => %s", fqn, newfqn)
+	}
+	return
+}
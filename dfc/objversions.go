@@ -0,0 +1,238 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// Version history of local-bucket objects (opt-in via BucketProps.VersionsKept)
+//
+// When enabled, PUT moves the current copy of the object into the object's history
+// directory instead of overwriting it. The history is stored on the same mountpath
+// as the object itself (see hrwMpath), under <mountpath>/<versionsdir>/<bucket>/<objname><versionsuffix>/.
+// Every saved copy is named by its version and retains its xattrs (checksum and version).
+// NOTE: the history is not migrated by rebalance and is not renamed with the bucket.
+const (
+	versionsdir   = ".versions"
+	versionsuffix = "~"
+)
+
+// builds fqn of directory for local buckets' version history from mountpath
+func makePathVersions(basePath string) string {
+	return filepath.Join(basePath, versionsdir)
+}
+
+// versionsKept returns the max number of previous versions to retain, zero if disabled
+func (t *targetrunner) versionsKept(bucket string) int {
+	ok, props := t.bmdowner.get().get(bucket, true)
+	if !ok || !t.versioningConfigured(bucket) {
+		return 0
+	}
+	return props.VersionsKept
+}
+
+func (t *targetrunner) objVersionsDir(bucket, objname string) string {
+	mpath := hrwMpath(bucket, objname)
+	return filepath.Join(makePathVersions(mpath), bucket, objname+versionsuffix)
+}
+
+func (t *targetrunner) versionfqn(bucket, objname, version string) string {
+	return filepath.Join(t.objVersionsDir(bucket, objname), version)
+}
+
+// objVersions returns versions from the object's history, the most recent first
+func (t *targetrunner) objVersions(bucket, objname string) (versions []string, errstr string) {
+	dir := t.objVersionsDir(bucket, objname)
+	finfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			errstr = fmt.Sprintf("Failed to read version history %s, err: %v", dir, err)
+		}
+		return
+	}
+	for _, finfo := range finfos {
+		if finfo.IsDir() {
+			continue // history of another object, e.g. "a/b" vs "a"
+		}
+		if _, err := strconv.Atoi(finfo.Name()); err != nil {
+			continue
+		}
+		versions = append(versions, finfo.Name())
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		vi, _ := strconv.Atoi(versions[i])
+		vj, _ := strconv.Atoi(versions[j])
+		return vi > vj
+	})
+	return
+}
+
+// keepVersion moves the current copy of the object (if exists) into its version history
+// and trims the latter to keep at most 'kept' previous versions.
+// Must be called under the object's exclusive lock.
+func (t *targetrunner) keepVersion(bucket, objname, fqn string, kept int) (errstr string) {
+	if _, err := os.Stat(fqn); err != nil {
+		if !os.IsNotExist(err) {
+			errstr = fmt.Sprintf("Failed to fstat %s, err: %v", fqn, err)
+		}
+		return
+	}
+	vbytes, errstr := Getxattr(fqn, XattrObjVersion)
+	if errstr != "" || len(vbytes) == 0 {
+		return // not versioned - nothing to keep
+	}
+	vfqn := t.versionfqn(bucket, objname, string(vbytes))
+	if err := CreateDir(filepath.Dir(vfqn)); err != nil {
+		errstr = fmt.Sprintf("Failed to create version history dir for %s/%s, err: %v", bucket, objname, err)
+		return
+	}
+	if err := os.Rename(fqn, vfqn); err != nil {
+		errstr = fmt.Sprintf("Failed to rename %s => %s, err: %v", fqn, vfqn, err)
+		return
+	}
+	versions, errstr := t.objVersions(bucket, objname)
+	if errstr != "" {
+		glog.Errorln(errstr)
+		return ""
+	}
+	for i := kept; i < len(versions); i++ {
+		if err := os.Remove(t.versionfqn(bucket, objname, versions[i])); err != nil {
+			glog.Errorf("Failed to remove version %s of %s/%s, err: %v", versions[i], bucket, objname, err)
+		}
+	}
+	return
+}
+
+// objVersionFqn resolves the requested version of the object into its fqn:
+// the object itself if the version is current, a copy from the history otherwise
+func (t *targetrunner) objVersionFqn(bucket, objname, fqn, version string, islocal bool) (vfqn, errstr string, errcode int) {
+	// versions are numbers (see increaseObjectVersion), and name the files of the history
+	if _, err := strconv.ParseUint(version, 10, 64); err != nil {
+		errstr = fmt.Sprintf("Invalid version %q of %s/%s: expecting a number", version, bucket, objname)
+		errcode = http.StatusBadRequest
+		return
+	}
+	if !islocal {
+		errstr = fmt.Sprintf("Cannot access version %s of %s/%s: version history is supported only for local buckets",
+			version, bucket, objname)
+		errcode = http.StatusBadRequest
+		return
+	}
+	if vbytes, errs := Getxattr(fqn, XattrObjVersion); errs == "" && string(vbytes) == version {
+		vfqn = fqn
+		return
+	}
+	vfqn = t.versionfqn(bucket, objname, version)
+	if _, err := os.Stat(vfqn); err != nil {
+		errstr = fmt.Sprintf("Version %s of %s/%s %s", version, bucket, objname, doesnotexist)
+		errcode = http.StatusNotFound
+	}
+	return
+}
+
+// delObjVersion deletes a single version of the object; deleting the current
+// version restores the most recent one from the history (if any)
+func (t *targetrunner) delObjVersion(bucket, objname, version string) (errstr string, errcode int) {
+	islocal := t.bmdowner.get().islocal(bucket)
+	fqn := t.fqn(bucket, objname, islocal)
+	uname := uniquename(bucket, objname)
+	t.rtnamemap.lockname(uname, true, &pendinginfo{Time: time.Now(), fqn: fqn}, time.Second)
+	defer t.rtnamemap.unlockname(uname, true)
+
+	vfqn, errstr, errcode := t.objVersionFqn(bucket, objname, fqn, version, islocal)
+	if errstr != "" {
+		return
+	}
+	if err := os.Remove(vfqn); err != nil {
+		errstr = fmt.Sprintf("Failed to delete version %s of %s/%s, err: %v", version, bucket, objname, err)
+		errcode = http.StatusInternalServerError
+		return
+	}
+	if vfqn != fqn {
+		return
+	}
+	versions, errstr := t.objVersions(bucket, objname)
+	if errstr != "" {
+		errcode = http.StatusInternalServerError
+		return
+	}
+	if len(versions) == 0 {
+		return
+	}
+	if err := os.Rename(t.versionfqn(bucket, objname, versions[0]), fqn); err != nil {
+		errstr = fmt.Sprintf("Failed to restore version %s of %s/%s, err: %v", versions[0], bucket, objname, err)
+		errcode = http.StatusInternalServerError
+		return
+	}
+	glog.Infof("Deleted version %s of %s/%s, restored version %s", version, bucket, objname, versions[0])
+	return
+}
+
+// GET /Rversion/Robjects/bucket-name/object-name?what=versions
+// lists the current and all previous versions of the object, the most recent first
+func (t *targetrunner) listObjVersions(w http.ResponseWriter, r *http.Request, bucket, objname string) {
+	islocal := t.bmdowner.get().islocal(bucket)
+	if !islocal {
+		t.invalmsghdlr(w, r, fmt.Sprintf("Cannot list versions of %s/%s: version history is supported only for local buckets",
+			bucket, objname))
+		return
+	}
+	fqn := t.fqn(bucket, objname, islocal)
+	uname := uniquename(bucket, objname)
+	t.rtnamemap.lockname(uname, false, &pendinginfo{Time: time.Now(), fqn: fqn}, time.Second)
+	versions, errstr := t.objVersions(bucket, objname)
+	if errstr != "" {
+		t.rtnamemap.unlockname(uname, false)
+		t.invalmsghdlr(w, r, errstr)
+		return
+	}
+	fqns := make([]string, 0, len(versions)+1)
+	fqns = append(fqns, fqn)
+	for _, version := range versions {
+		fqns = append(fqns, t.versionfqn(bucket, objname, version))
+	}
+	bucketList := &BucketList{Entries: make([]*BucketEntry, 0, len(fqns))}
+	for _, vfqn := range fqns {
+		finfo, err := os.Stat(vfqn)
+		if err != nil {
+			continue
+		}
+		entry := &BucketEntry{
+			Name:     objname,
+			Bucket:   bucket,
+			Size:     finfo.Size(),
+			Ctime:    finfo.ModTime().Format(time.RFC822),
+			IsCached: true,
+		}
+		if vbytes, errs := Getxattr(vfqn, XattrObjVersion); errs == "" {
+			entry.Version = string(vbytes)
+		}
+		if xxhex, errs := Getxattr(vfqn, XattrXXHashVal); errs == "" {
+			entry.Checksum = hex.EncodeToString(xxhex)
+		}
+		bucketList.Entries = append(bucketList.Entries, entry)
+	}
+	t.rtnamemap.unlockname(uname, false)
+	if len(bucketList.Entries) == 0 {
+		t.invalmsghdlr(w, r, fmt.Sprintf("%s/%s %s", bucket, objname, doesnotexist), http.StatusNotFound)
+		return
+	}
+	jsbytes, err := json.Marshal(bucketList)
+	assert(err == nil, err)
+	t.writeJSON(w, r, jsbytes, "listobjversions")
+}
@@ -77,6 +77,7 @@ type proxyrunner struct {
 	stopped     bool
 	primary     bool
 	metasyncer  *metasyncer
+	overloaded  *overloadedTargets
 }
 
 // start proxy runner
@@ -90,6 +91,7 @@ func (p *proxyrunner) run() error {
 	p.callStatsServer.Start()
 
 	p.httprunner.init(getproxystatsrunner(), true)
+	p.overloaded = newOverloadedTargets()
 	p.httprunner.kalive = getproxykalive()
 
 	p.xactinp = newxactinp()
@@ -132,7 +134,7 @@ func (p *proxyrunner) run() error {
 		}
 
 		// register to current primary
-		err = p.registerWithRetry(smap.ProxySI.DirectURL, 0)
+		err = p.registerWithRetry(smap.ProxySI.controlURL(), 0)
 		if err != nil {
 			return fmt.Errorf("Failed to register with primary proxy: %v", err)
 		}
@@ -177,6 +179,7 @@ func (p *proxyrunner) run() error {
 		tokens:        make(map[string]*authRec),
 		revokedTokens: make(map[string]bool),
 	}
+	p.initAudit(p.authn)
 
 	// startup: register and sync across
 	if p.primary {
@@ -192,15 +195,17 @@ func (p *proxyrunner) run() error {
 	// REST API: register proxy handlers and start listening
 	//
 	if ctx.config.Auth.Enabled {
-		p.httprunner.registerhdlr(URLPath(Rversion, Rbuckets)+"/", wrapHandler(p.bucketHandler, p.checkHTTPAuth))
-		p.httprunner.registerhdlr(URLPath(Rversion, Robjects)+"/", wrapHandler(p.objectHandler, p.checkHTTPAuth))
+		p.httprunner.registerhdlr(URLPath(Rversion, Rbuckets)+"/", wrapHandler(p.bucketHandler, p.rateLimit, p.checkHTTPAuth))
+		p.httprunner.registerhdlr(URLPath(Rversion, Robjects)+"/", wrapHandler(p.objectHandler, p.rateLimit, p.checkHTTPAuth))
+		p.httprunner.registerhdlr(URLPath(Rversion, Rcluster), wrapHandler(p.clusterHandler, p.checkHTTPAuth))
+		p.httprunner.registerhdlr(URLPath(Rversion, Rdaemon), wrapHandler(p.daemonHandler, p.checkHTTPAuth))
 	} else {
-		p.httprunner.registerhdlr(URLPath(Rversion, Rbuckets)+"/", p.bucketHandler)
-		p.httprunner.registerhdlr(URLPath(Rversion, Robjects)+"/", p.objectHandler)
+		p.httprunner.registerhdlr(URLPath(Rversion, Rbuckets)+"/", wrapHandler(p.bucketHandler, p.rateLimit))
+		p.httprunner.registerhdlr(URLPath(Rversion, Robjects)+"/", wrapHandler(p.objectHandler, p.rateLimit))
+		p.httprunner.registerhdlr(URLPath(Rversion, Rcluster), p.clusterHandler)
+		p.httprunner.registerhdlr(URLPath(Rversion, Rdaemon), p.daemonHandler)
 	}
 
-	p.httprunner.registerhdlr(URLPath(Rversion, Rdaemon), p.daemonHandler)
-	p.httprunner.registerhdlr(URLPath(Rversion, Rcluster), p.clusterHandler)
 	p.httprunner.registerhdlr(URLPath(Rversion, Rhealth), p.httpHealth)
 	p.httprunner.registerhdlr(URLPath(Rversion, Rvote)+"/", p.voteHandler)
 	p.httprunner.registerhdlr(URLPath(Rversion, Rtokens), p.tokenHandler)
@@ -238,7 +243,7 @@ func (p *proxyrunner) register(timeout time.Duration) (status int, err error) {
 	// Here the lock should be accquired, but don't to hold the lock during the intra-cluster calls.
 	// Code needs to be re-orged to have a better structure for lock handling.
 	if p.smap.ProxySI.DaemonID != "" {
-		url = p.smap.ProxySI.DirectURL
+		url = p.smap.ProxySI.controlURL()
 	} else {
 		// Smap has not yet been synced
 		url = ctx.config.Proxy.Primary.URL
@@ -380,7 +385,7 @@ func (p *proxyrunner) findRole() {
 
 	glog.Infof("This proxy (%s) appears to be not primary in the max-versioned cluster map", p.si.DaemonID)
 	glog.Infof("Registering with the real primary %s", smap.ProxySI.DaemonID)
-	err = p.registerWithRetry(smap.ProxySI.DirectURL, ctx.config.Timeout.Default)
+	err = p.registerWithRetry(smap.ProxySI.controlURL(), ctx.config.Timeout.Default)
 	if err != nil {
 		glog.Errorf("Error registering with primary proxy %v: %v. Retrying.", smap.ProxySI.DaemonID, err)
 	} else {
@@ -455,6 +460,10 @@ func (p *proxyrunner) httpbckget(w http.ResponseWriter, r *http.Request) {
 		p.getbucketnames(w, r, bucket)
 		return
 	}
+	if r.URL.Query().Get(URLParamWhat) == GetWhatInventory {
+		p.getInventory(w, r, bucket)
+		return
+	}
 	// list the bucket
 	pagemarker, ok := p.listbucket(w, r, bucket)
 	if ok {
@@ -507,13 +516,29 @@ func (p *proxyrunner) httpobjget(w http.ResponseWriter, r *http.Request) {
 		p.invalmsghdlr(w, r, errstr)
 		return
 	}
-	var redirecturl string
+	var (
+		redirecturl string
+		nocache     bool
+	)
 	islocal := p.bmdowner.get().islocal(bucket)
+	// Cloud objects can be served by any target - steer clear of the overloaded ones
+	// (local-bucket objects have a single location and are still redirected to it)
+	if !islocal && ctx.config.Admission.Enabled && p.overloaded.has(si.DaemonID) {
+		if alt := p.alternateTarget(bucket, objname); alt != nil {
+			if glog.V(4) {
+				glog.Infof("%s is overloaded: %s/%s => %s", si.DaemonID, bucket, objname, alt.DaemonID)
+			}
+			si, nocache = alt, true
+		}
+	}
 	if r.URL.RawQuery != "" {
 		redirecturl = fmt.Sprintf("%s%s?%s&%s=%t", si.DirectURL, r.URL.Path, r.URL.RawQuery, URLParamLocal, islocal)
 	} else {
 		redirecturl = fmt.Sprintf("%s%s?%s=%t", si.DirectURL, r.URL.Path, URLParamLocal, islocal)
 	}
+	if nocache {
+		redirecturl += "&" + URLParamNoCache + "=true"
+	}
 	if glog.V(4) {
 		glog.Infof("%s %s/%s => %s", r.Method, bucket, objname, si.DaemonID)
 	}
@@ -527,6 +552,7 @@ func (p *proxyrunner) httpobjget(w http.ResponseWriter, r *http.Request) {
 			p.invalmsghdlr(w, r, err.Error())
 			return
 		}
+		p.signRequest(req) // authorized above
 		p.revProxy.ServeHTTP(w, req)
 	} else {
 		http.Redirect(w, r, redirecturl, http.StatusMovedPermanently)
@@ -569,8 +595,11 @@ func (p *proxyrunner) httpobjput(w http.ResponseWriter, r *http.Request) {
 		p.invalmsghdlr(w, r, errstr)
 		return
 	}
-	redirecturl := fmt.Sprintf("%s%s?%s=%t&%s=%s", si.DirectURL, r.URL.Path, URLParamLocal,
-		p.bmdowner.get().islocal(bucket), URLParamDaemonID, p.httprunner.si.DaemonID)
+	// preserve the request's parameters (e.g., archive extraction)
+	query := r.URL.Query()
+	query.Set(URLParamLocal, strconv.FormatBool(p.bmdowner.get().islocal(bucket)))
+	query.Set(URLParamDaemonID, p.httprunner.si.DaemonID)
+	redirecturl := si.DirectURL + r.URL.Path + "?" + query.Encode()
 	if glog.V(4) {
 		glog.Infof("%s %s/%s => %s", r.Method, bucket, objname, si.DaemonID)
 	}
@@ -649,6 +678,9 @@ func (p *proxyrunner) httpobjdelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	redirecturl := si.DirectURL + r.URL.Path
+	if r.URL.RawQuery != "" {
+		redirecturl += "?" + r.URL.RawQuery
+	}
 	if glog.V(4) {
 		glog.Infof("%s %s/%s => %s", r.Method, bucket, objname, si.DaemonID)
 	}
@@ -742,8 +774,18 @@ func (p *proxyrunner) httpbckpost(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		p.metasyncer.sync(false, p.bmdowner.get())
-	case ActPrefetch:
+	case ActPrefetch, ActUndelete:
 		p.actionlistrange(w, r, &msg)
+	case ActCopyBucket:
+		p.copybucket(w, r, lbucket, &msg)
+	case ActInventory:
+		p.inventory(w, r, lbucket, &msg)
+	case ActBatchGet:
+		p.batchget(w, r, lbucket, &msg)
+	case ActDsort:
+		p.dsort(w, r, lbucket, &msg)
+	case ActRenamePrefix:
+		p.renameprefix(w, r, lbucket, &msg)
 	default:
 		s := fmt.Sprintf("Unexpected ActionMsg <- JSON [%v]", msg)
 		p.invalmsghdlr(w, r, s)
@@ -768,6 +810,15 @@ func (p *proxyrunner) httpobjpost(w http.ResponseWriter, r *http.Request) {
 	case ActRename:
 		p.filrename(w, r, &msg)
 		return
+	case ActUndelete:
+		p.filundelete(w, r, &msg)
+		return
+	case ActCopy:
+		p.filcopy(w, r, &msg)
+		return
+	case ActCompose:
+		p.filcompose(w, r, &msg)
+		return
 	default:
 		s := fmt.Sprintf("Unexpected ActionMsg <- JSON [%v]", msg)
 		p.invalmsghdlr(w, r, s)
@@ -808,8 +859,12 @@ func (p *proxyrunner) httpbckput(w http.ResponseWriter, r *http.Request) {
 	if !p.validatebckname(w, r, bucket) {
 		return
 	}
-	props := &BucketProps{}
-	msg := ActionMsg{Value: props}
+	var (
+		props = &BucketProps{}
+		value json.RawMessage
+		isset = make(map[string]json.RawMessage) // the props that the request sets, by JSON name
+	)
+	msg := ActionMsg{Value: &value}
 	if p.readJSON(w, r, &msg) != nil {
 		return
 	}
@@ -818,6 +873,17 @@ func (p *proxyrunner) httpbckput(w http.ResponseWriter, r *http.Request) {
 		p.invalmsghdlr(w, r, s)
 		return
 	}
+	if len(value) != 0 {
+		err := json.Unmarshal(value, props)
+		if err == nil {
+			err = json.Unmarshal(value, &isset)
+		}
+		if err != nil {
+			s := fmt.Sprintf("Failed to json-unmarshal bucket props %s, err: %v", string(value), err)
+			p.invalmsghdlr(w, r, s, http.StatusBadRequest)
+			return
+		}
+	}
 
 	bucketmd := p.bmdowner.get()
 	isLocal := bucketmd.islocal(bucket)
@@ -842,6 +908,22 @@ func (p *proxyrunner) httpbckput(w http.ResponseWriter, r *http.Request) {
 	if props.WritePolicy != "" {
 		oldProps.WritePolicy = props.WritePolicy
 	}
+	// the props that the request does not set retain their values
+	if _, ok := isset["lifecycle"]; ok {
+		oldProps.Lifecycle = props.Lifecycle
+	}
+	if _, ok := isset["versions_kept"]; ok {
+		oldProps.VersionsKept = props.VersionsKept
+	}
+	if _, ok := isset["transform"]; ok {
+		oldProps.Transform = props.Transform
+	}
+	if _, ok := isset["request_rate"]; ok {
+		oldProps.RequestRate = props.RequestRate
+	}
+	if _, ok := isset["bandwidth"]; ok {
+		oldProps.Bandwidth = props.Bandwidth
+	}
 
 	clone.set(bucket, isLocal, oldProps)
 	if e := p.savebmdconf(clone); e != "" {
@@ -872,6 +954,9 @@ func (p *proxyrunner) httpobjhead(w http.ResponseWriter, r *http.Request) {
 	if checkCached {
 		redirecturl += fmt.Sprintf("&%s=true", URLParamCheckCached)
 	}
+	if version := r.URL.Query().Get(URLParamVersion); version != "" {
+		redirecturl += fmt.Sprintf("&%s=%s", URLParamVersion, url.QueryEscape(version))
+	}
 	if glog.V(3) {
 		glog.Infof("%s %s/%s => %s", r.Method, bucket, objname, si.DaemonID)
 	}
@@ -943,7 +1028,7 @@ func (p *proxyrunner) getbucketnames(w http.ResponseWriter, r *http.Request, buc
 		break
 	}
 
-	u := si.DirectURL + URLPath(Rversion, Rbuckets, bucketspec)
+	u := si.controlURL() + URLPath(Rversion, Rbuckets, bucketspec)
 	res := p.call(r, si, u, r.Method, nil)
 	if res.err != nil {
 		p.invalmsghdlr(w, r, res.errstr)
@@ -956,7 +1041,7 @@ func (p *proxyrunner) getbucketnames(w http.ResponseWriter, r *http.Request, buc
 // For cached = false goes to the Cloud, otherwise returns locally cached files
 func (p *proxyrunner) targetListBucket(r *http.Request, bucket string, dinfo *daemonInfo,
 	reqBody []byte, islocal bool, cached bool) (*bucketResp, error) {
-	url := fmt.Sprintf("%s/%s/%s/%s?%s=%v&%s=%v", dinfo.DirectURL, Rversion,
+	url := fmt.Sprintf("%s/%s/%s/%s?%s=%v&%s=%v", dinfo.controlURL(), Rversion,
 		Rbuckets, bucket, URLParamLocal, islocal, URLParamCached, cached)
 	res := p.call(r, dinfo, url, http.MethodGet, reqBody, ctx.config.Timeout.Default)
 	if res.err != nil {
@@ -986,6 +1071,9 @@ func (p *proxyrunner) consumeCachedList(bmap map[string]*BucketEntry, dataCh cha
 		}
 
 		for _, newEntry := range rb.entries {
+			if newEntry.Type == BucketEntryDirectory {
+				continue
+			}
 			nm := newEntry.Name
 			if entry, ok := bmap[nm]; ok {
 				entry.IsCached = true
@@ -1116,9 +1204,10 @@ func (p *proxyrunner) getLocalBucketObjects(bucket string, listmsgjson []byte) (
 		resp *bucketResp
 		err  error
 	}
-	const (
-		islocal    = true
-		cachedObjs = false
+	var (
+		// also lists the objects cached by targets if the bucket is a Cloud bucket
+		islocal    = p.bmdowner.get().islocal(bucket)
+		cachedObjs = !islocal
 	)
 	msg := &GetMsg{}
 	if err = json.Unmarshal(listmsgjson, msg); err != nil {
@@ -1132,6 +1221,15 @@ func (p *proxyrunner) getLocalBucketObjects(bucket string, listmsgjson []byte) (
 	if pageSize > MaxPageSize {
 		glog.Warningf("Page size(%d) for local bucket %s exceeds the limit(%d)", msg.GetPageSize, bucket, MaxPageSize)
 	}
+	ls, err := newListSort(msg)
+	if err != nil {
+		return
+	}
+	if _, err = newListFilter(msg); err != nil {
+		return
+	}
+	listmsgjson, err = json.Marshal(ls.targetMsg(msg))
+	assert(err == nil, err)
 
 	chresult := make(chan *targetReply, len(p.smap.Tmap))
 	wg := &sync.WaitGroup{}
@@ -1151,8 +1249,8 @@ func (p *proxyrunner) getLocalBucketObjects(bucket string, listmsgjson []byte) (
 	wg.Wait()
 	close(chresult)
 
-	// combine results
-	allentries = &BucketList{Entries: make([]*BucketEntry, 0, pageSize)}
+	// combine results: each target returns its list sorted
+	pages := make([][]*BucketEntry, 0, len(p.smap.Tmap))
 	for r := range chresult {
 		if r.err != nil {
 			err = r.err
@@ -1172,25 +1270,16 @@ func (p *proxyrunner) getLocalBucketObjects(bucket string, listmsgjson []byte) (
 			continue
 		}
 
-		allentries.Entries = append(allentries.Entries, bucketList.Entries...)
+		pages = append(pages, bucketList.Entries)
 	}
 
-	// return the list always sorted in alphabetical order
-	entryLess := func(i, j int) bool {
-		return allentries.Entries[i].Name < allentries.Entries[j].Name
-	}
-	sort.Slice(allentries.Entries, entryLess)
-
-	// shrink the result to `pageSize` entries. If the page is full than
+	// merge the result into at most `pageSize` entries. If the page is full than
 	// mark the result incomplete by setting PageMarker
+	allentries = &BucketList{Entries: ls.merge(pages, pageSize)}
 	if len(allentries.Entries) >= pageSize {
-		for i := pageSize; i < len(allentries.Entries); i++ {
-			allentries.Entries[i] = nil
-		}
-
-		allentries.Entries = allentries.Entries[:pageSize]
-		allentries.PageMarker = allentries.Entries[pageSize-1].Name
+		allentries.PageMarker = ls.marker(allentries.Entries[pageSize-1])
 	}
+	ls.restoreTimes(allentries.Entries, msg)
 
 	return allentries, nil
 }
@@ -1207,9 +1296,31 @@ func (p *proxyrunner) getCloudBucketObjects(r *http.Request, bucket string, list
 	if err != nil {
 		return
 	}
+	if msg.GetCachedOnly {
+		return p.getLocalBucketObjects(bucket, listmsgjson)
+	}
 	if msg.GetPageSize > MaxPageSize {
 		glog.Warningf("Page size(%d) for cloud bucket %s exceeds the limit(%d)", msg.GetPageSize, bucket, MaxPageSize)
 	}
+	filter, err := newListFilter(&msg)
+	if err != nil {
+		return
+	}
+	if filter != nil && filter.hasTimes() {
+		err = errors.New(errCloudTimeFilter(bucket))
+		return
+	}
+	// Cloud listing is paged by the Cloud provider: it is sorted page by page
+	// and the page marker is opaque
+	lsmsg := msg
+	lsmsg.GetPageMarker = ""
+	ls, err := newListSort(&lsmsg)
+	if err != nil {
+		return
+	}
+	tmsg := ls.targetMsg(&msg)
+	listmsgjson, err = json.Marshal(tmsg)
+	assert(err == nil, err)
 
 	// first, get the cloud object list from a random target
 	for _, si := range p.smap.Tmap {
@@ -1239,16 +1350,22 @@ func (p *proxyrunner) getCloudBucketObjects(r *http.Request, bucket string, list
 			e.TargetURL = si.DirectURL
 		}
 	}
-	if strings.Contains(msg.GetProps, GetPropsAtime) ||
-		strings.Contains(msg.GetProps, GetPropsIsCached) {
+	if strings.Contains(tmsg.GetProps, GetPropsAtime) ||
+		strings.Contains(tmsg.GetProps, GetPropsIsCached) {
 		// Now add local properties to the cloud objects
 		// The call replaces allentries.Entries with new values
-		err = p.collectCachedFileList(bucket, allentries, listmsgjson)
+		if err = p.collectCachedFileList(bucket, allentries, listmsgjson); err != nil {
+			return
+		}
+	}
+	if !ls.walkOrder() {
+		ls.sort(allentries.Entries)
 	}
+	ls.restoreTimes(allentries.Entries, &msg)
 	return
 }
 
-// Local bucket:
+// Local bucket (and cached objects of a Cloud bucket - GetMsg.GetCachedOnly):
 //   - reads object list from all targets, combines, sorts and returns the
 //     first pageSize objects
 // Cloud bucket:
@@ -1293,7 +1410,7 @@ func (p *proxyrunner) receiveDrop(w http.ResponseWriter, r *http.Request, redire
 	if glog.V(3) {
 		glog.Infof("GET redirect URL %q", redirecturl)
 	}
-	newr, err := http.Get(redirecturl)
+	newr, err := p.httpclientLongTimeout.Get(redirecturl)
 	if err != nil {
 		glog.Errorf("Failed to GET redirect URL %q, err: %v", redirecturl, err)
 		return
@@ -1365,6 +1482,89 @@ func (p *proxyrunner) filrename(w http.ResponseWriter, r *http.Request, msg *Act
 	http.Redirect(w, r, redirecturl, http.StatusTemporaryRedirect)
 }
 
+// copybucket starts the bucket-copy xaction on all targets
+func (p *proxyrunner) copybucket(w http.ResponseWriter, r *http.Request, bucket string, msg *ActionMsg) {
+	bucketmd := p.bmdowner.get()
+	if errstr := validateCopyBucket(bucketmd, bucket, msg.Name); errstr != "" {
+		p.invalmsghdlr(w, r, errstr)
+		return
+	}
+	jsonbytes, err := json.Marshal(msg)
+	assert(err == nil, err)
+	q := url.Values{}
+	q.Set(URLParamLocal, strconv.FormatBool(bucketmd.islocal(bucket)))
+	results := p.broadcastTargets(
+		URLPath(Rversion, Rbuckets, bucket),
+		q,
+		http.MethodPost,
+		jsonbytes,
+		p.smap,
+	)
+	for result := range results {
+		if result.err != nil {
+			p.invalmsghdlr(w, r, fmt.Sprintf("Failed to start copying bucket %s => %s: %v (%d: %s)",
+				bucket, msg.Name, result.err, result.status, result.errstr))
+			return
+		}
+	}
+	glog.Infof("Started copying bucket %s => %s", bucket, msg.Name)
+}
+
+func (p *proxyrunner) filcopy(w http.ResponseWriter, r *http.Request, msg *ActionMsg) {
+	apitems := p.restAPIItems(r.URL.Path, 5)
+	if apitems = p.checkRestAPI(w, r, apitems, 2, Rversion, Robjects); apitems == nil {
+		return
+	}
+	bucket, objname := apitems[0], strings.Join(apitems[1:], "/")
+	bucketTo, objnameTo, errstr := copyDestination(msg, bucket, objname)
+	if errstr != "" {
+		p.invalmsghdlr(w, r, errstr)
+		return
+	}
+	if !p.validatebckname(w, r, bucketTo) {
+		return
+	}
+	if !p.bmdowner.get().islocal(bucketTo) {
+		s := fmt.Sprintf("Copy destination must be a local bucket (%s does not appear to be local)", bucketTo)
+		p.invalmsghdlr(w, r, s)
+		return
+	}
+	// the source's target does the copying
+	si, errstr := HrwTarget(bucket, objname, p.smap)
+	if errstr != "" {
+		p.invalmsghdlr(w, r, errstr)
+		return
+	}
+	redirecturl := si.DirectURL + r.URL.Path
+	if glog.V(3) {
+		glog.Infof("COPY %s %s/%s => %s/%s via %s", r.Method, bucket, objname, bucketTo, objnameTo, si.DaemonID)
+	}
+	http.Redirect(w, r, redirecturl, http.StatusTemporaryRedirect)
+}
+
+func (p *proxyrunner) filundelete(w http.ResponseWriter, r *http.Request, msg *ActionMsg) {
+	apitems := p.restAPIItems(r.URL.Path, 5)
+	if apitems = p.checkRestAPI(w, r, apitems, 2, Rversion, Robjects); apitems == nil {
+		return
+	}
+	lbucket, objname := apitems[0], strings.Join(apitems[1:], "/")
+	if !p.bmdowner.get().islocal(lbucket) {
+		s := fmt.Sprintf("Undelete is supported only for cache-only buckets (%s does not appear to be local)", lbucket)
+		p.invalmsghdlr(w, r, s)
+		return
+	}
+	si, errstr := HrwTarget(lbucket, objname, p.smap)
+	if errstr != "" {
+		p.invalmsghdlr(w, r, errstr)
+		return
+	}
+	redirecturl := si.DirectURL + r.URL.Path
+	if glog.V(3) {
+		glog.Infof("UNDELETE %s %s/%s => %s", r.Method, lbucket, objname, si.DaemonID)
+	}
+	http.Redirect(w, r, redirecturl, http.StatusTemporaryRedirect)
+}
+
 func (p *proxyrunner) actionlistrange(w http.ResponseWriter, r *http.Request, actionMsg *ActionMsg) {
 	var (
 		err    error
@@ -1396,7 +1596,7 @@ func (p *proxyrunner) actionlistrange(w http.ResponseWriter, r *http.Request, ac
 	switch actionMsg.Action {
 	case ActEvict, ActDelete:
 		method = http.MethodDelete
-	case ActPrefetch:
+	case ActPrefetch, ActUndelete:
 		method = http.MethodPost
 	default:
 		s := fmt.Sprintf("Action unavailable for List/Range Operations: %s", actionMsg.Action)
@@ -1521,6 +1721,9 @@ func (p *proxyrunner) httpdaeput(w http.ResponseWriter, r *http.Request) {
 		case Rmetasync:
 			p.receiveMeta(w, r)
 			return
+		case Roverloaded:
+			p.targetOverloaded(w, r)
+			return
 		default:
 		}
 	}
@@ -1543,7 +1746,9 @@ func (p *proxyrunner) httpdaeput(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		switch msg.Name {
-		case "loglevel", "stats_time", "passthru", "vmodule":
+		case "loglevel", "stats_time", "passthru", "vmodule",
+			"ratelimit_enabled", "user_requests", "user_bandwidth", "bucket_requests", "bucket_bandwidth",
+			"admission_enabled", "backoff_time":
 			if errstr := p.setconfig(msg.Name, value); errstr != "" {
 				p.invalmsghdlr(w, r, errstr)
 			}
@@ -1870,6 +2075,13 @@ func (p *proxyrunner) httpclupost(w http.ResponseWriter, r *http.Request) {
 		p.invalmsghdlr(w, r, s)
 		return
 	}
+	if p.certs != nil {
+		if id := peerDaemonID(r.TLS); id != nsi.DaemonID {
+			s := fmt.Sprintf("register %s: certificate of daemon %q", nsi.DaemonID, id)
+			p.invalmsghdlr(w, r, s, http.StatusForbidden)
+			return
+		}
+	}
 
 	p.statsdC.Send("post",
 		statsd.Metric{
@@ -1898,7 +2110,7 @@ func (p *proxyrunner) httpclupost(w http.ResponseWriter, r *http.Request) {
 			glog.Infof("register target %s (count %d)", nsi.DaemonID, p.smap.count())
 		}
 		if register {
-			u := nsi.DirectURL + URLPath(Rversion, Rdaemon, Rregister)
+			u := nsi.controlURL() + URLPath(Rversion, Rdaemon, Rregister)
 			res := p.call(nil, &nsi, u, http.MethodPost, nil, ProxyPingTimeout)
 			if res.err != nil {
 				errstr := fmt.Sprintf("Failed to register target %s: %v, %s", nsi.DaemonID, res.err, res.errstr)
@@ -1960,7 +2172,7 @@ func (p *proxyrunner) addOrUpdateNode(nsi *daemonInfo, osi *daemonInfo, keepaliv
 			return true
 		}
 
-		if osi.NodeIPAddr != nsi.NodeIPAddr || osi.DaemonPort != nsi.DaemonPort {
+		if *osi != *nsi { // including the intra-cluster networks
 			glog.Warningf("register/keepalive %s %s: info changed - renewing", kind, nsi.DaemonID)
 			return true
 		}
@@ -1969,7 +2181,7 @@ func (p *proxyrunner) addOrUpdateNode(nsi *daemonInfo, osi *daemonInfo, keepaliv
 		return false
 	}
 	if osi != nil {
-		if osi.NodeIPAddr == nsi.NodeIPAddr && osi.DaemonPort == nsi.DaemonPort && osi.DirectURL == nsi.DirectURL {
+		if *osi == *nsi {
 			glog.Infof("register %s %s: already done", kind, nsi.DaemonID)
 			return false
 		}
@@ -2028,7 +2240,7 @@ func (p *proxyrunner) httpcludel(w http.ResponseWriter, r *http.Request) {
 		if glog.V(3) {
 			glog.Infof("Unregistered target {%s} (count %d)", sid, p.smap.count())
 		}
-		u := osi.DirectURL + URLPath(Rversion, Rdaemon)
+		u := osi.controlURL() + URLPath(Rversion, Rdaemon)
 		res := p.call(nil, osi, u, http.MethodDelete, nil, ProxyPingTimeout)
 		if res.err != nil {
 			glog.Warningf("The target %s that is being unregistered failed to respond back: %v, %s",
@@ -2127,6 +2339,26 @@ func (p *proxyrunner) httpcluput(w http.ResponseWriter, r *http.Request) {
 		time.Sleep(time.Second)
 		_ = syscall.Kill(syscall.Getpid(), syscall.SIGINT)
 
+	case ActAbortXact:
+		if _, err := p.getXactionKindFromProperties(msg.Name); err != nil {
+			p.invalmsghdlr(w, r, err.Error())
+			return
+		}
+		msgbytes, err := json.Marshal(msg) // same message -> all targets
+		assert(err == nil, err)
+		results := p.broadcastTargets(
+			URLPath(Rversion, Rdaemon),
+			nil, // query
+			http.MethodPut,
+			msgbytes,
+			p.smap,
+		)
+		for result := range results {
+			if result.err != nil {
+				p.invalmsghdlr(w, r, fmt.Sprintf("%s (%s) failed, err: %s", msg.Action, msg.Name, result.errstr))
+				return
+			}
+		}
 	case ActRebalance:
 		if !p.checkPrimaryProxy("initiate rebalance", w, r) {
 			return
@@ -2211,7 +2443,7 @@ func (p *proxyrunner) httpTokenDelete(w http.ResponseWriter, r *http.Request) {
 	p.authn.updateRevokedList(tokenList)
 
 	if p.primary {
-		url := URLPath(Rversion, Rtokens)
+		path := URLPath(Rversion, Rtokens)
 		jsonList, err := json.Marshal(tokenList)
 		if err != nil {
 			glog.Errorf("Failed to marshal token list: %v", err)
@@ -2219,7 +2451,8 @@ func (p *proxyrunner) httpTokenDelete(w http.ResponseWriter, r *http.Request) {
 		}
 		go func() {
 			smap := p.smap.cloneL().(*Smap)
-			ch := p.broadcastCluster(url, nil, http.MethodDelete, jsonList, smap, ctx.config.Timeout.CplaneOperation)
+			query := url.Values{URLParamFromID: []string{p.si.DaemonID}}
+			ch := p.broadcastCluster(path, query, http.MethodDelete, jsonList, smap, ctx.config.Timeout.CplaneOperation)
 			for r := range ch {
 				if r.err != nil {
 					glog.Errorf("Failed to broadcast token revoke request: %v", r.err)
@@ -2254,23 +2487,47 @@ func (p *proxyrunner) validateToken(r *http.Request) (*authRec, error) {
 // A wrapper to check any request before delegating the request to real handler
 // If authentication is disabled, it does nothing.
 // If authentication is enabled, it looks for token in request header and
-// makes sure that it is valid
+// makes sure that it is valid and grants the permissions the request requires
 func (p *proxyrunner) checkHTTPAuth(h http.HandlerFunc) http.HandlerFunc {
 	wrappedFunc := func(w http.ResponseWriter, r *http.Request) {
 		var (
-			auth *authRec
-			err  error
+			auth   *authRec
+			checks []authCheck
+			err    error
 		)
 
-		if ctx.config.Auth.Enabled {
+		if ctx.config.Auth.Enabled && !p.isPeerDaemon(r) {
+			if checks, err = requestPerms(r); err != nil {
+				p.invalmsghdlr(w, r, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if checks == nil {
+				// not subject to authorization
+				h.ServeHTTP(w, r)
+				return
+			}
 			if auth, err = p.validateToken(r); err != nil {
 				glog.Error(err)
 				p.invalmsghdlr(w, r, "Not authorized", http.StatusUnauthorized)
 				return
 			}
 			if glog.V(3) {
-				glog.Infof("Logged as %s", auth.userID)
+				if auth.apikey != "" {
+					glog.Infof("Logged as %s (API key %s)", auth.userID, auth.apikey)
+				} else {
+					glog.Infof("Logged as %s", auth.userID)
+				}
+			}
+			for _, check := range checks {
+				if !auth.allowed(check.bucket, check.perm) {
+					s := fmt.Sprintf("User %s (role %s) is not permitted to %s %s",
+						auth.userID, auth.role, r.Method, r.URL.Path)
+					p.invalmsghdlr(w, r, s, http.StatusForbidden)
+					return
+				}
 			}
+			// the client drops the token upon redirect
+			w = &authRedirectWriter{ResponseWriter: w, method: r.Method, bucket: requestBucket(r), auth: auth}
 		}
 
 		h.ServeHTTP(w, r)
@@ -2487,6 +2744,20 @@ func validateBucketProps(props *BucketProps, isLocal bool) error {
 	if props.WritePolicy == RWPolicyCloud && isLocal {
 		return fmt.Errorf("write policy for local bucket cannot be '%s'", RWPolicyCloud)
 	}
+	if err := validateLifecycle(props.Lifecycle); err != nil {
+		return err
+	}
+	if props.VersionsKept < 0 {
+		return fmt.Errorf("invalid number of versions to keep: %d", props.VersionsKept)
+	}
+	if props.VersionsKept > 0 && !isLocal {
+		return fmt.Errorf("version history is supported only for local buckets")
+	}
+	if props.Transform != "" && props.Transform != TransformNone {
+		if _, ok := ctx.config.ETL.Transformers[props.Transform]; !ok {
+			return fmt.Errorf("unknown transformer: %s", props.Transform)
+		}
+	}
 	if props.NextTierURL != "" {
 		if props.CloudProvider == "" {
 			return fmt.Errorf("tiered bucket must use one of the supported cloud providers (%s | %s | %s)",
@@ -0,0 +1,247 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// Rate limiting (config: ratelimit.ratelimit_enabled)
+//
+// Token buckets keyed by the authenticated user and by the bucket:
+// - proxies limit the rate of requests (requests/s), each proxy on its own;
+// - targets limit the bandwidth of object GET and PUT (bytes/s), each target
+//   on its own. The bytes are charged as they are transferred, so a large
+//   object puts the user and the bucket into debt that the subsequent requests
+//   have to wait out.
+// The limits are the cluster-wide defaults (setconfig) unless the bucket has
+// limits of its own (setprops: BucketProps.RequestRate and Bandwidth).
+// Requests over the limit are rejected with 429 and Retry-After.
+
+const rateLimiterCleanupTime = time.Minute // idle token buckets are removed after
+
+type (
+	// tokenBucket holds up to one second worth of tokens (but at least one)
+	tokenBucket struct {
+		tokens float64
+		last   time.Time
+	}
+	rateLimit struct {
+		key  string
+		rate float64 // tokens/s
+	}
+	rateLimiter struct {
+		sync.Mutex
+		buckets map[string]*tokenBucket
+		cleaned time.Time
+	}
+	// rateLimitWriter charges the bytes sent in response
+	rateLimitWriter struct {
+		http.ResponseWriter
+		limiter *rateLimiter
+		limits  []rateLimit
+	}
+	// rateLimitReader charges the bytes received in request
+	rateLimitReader struct {
+		io.ReadCloser
+		limiter *rateLimiter
+		limits  []rateLimit
+	}
+)
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: make(map[string]*tokenBucket), cleaned: time.Now()}
+}
+
+func burst(rate float64) float64 { return math.Max(rate, 1) }
+
+func (b *tokenBucket) refill(rate float64, now time.Time) {
+	b.tokens = math.Min(b.tokens+rate*now.Sub(b.last).Seconds(), burst(rate))
+	b.last = now
+}
+
+func (l *rateLimiter) bucketL(limit rateLimit, now time.Time) *tokenBucket {
+	b, ok := l.buckets[limit.key]
+	if !ok {
+		b = &tokenBucket{tokens: burst(limit.rate), last: now}
+		l.buckets[limit.key] = b
+		return b
+	}
+	b.refill(limit.rate, now)
+	return b
+}
+
+// admit takes n tokens from each of the limits if all of them have the tokens;
+// otherwise, it returns the time to wait until they do
+func (l *rateLimiter) admit(limits []rateLimit, n float64) (retry time.Duration) {
+	if len(limits) == 0 {
+		return
+	}
+	now := time.Now()
+	l.Lock()
+	defer l.Unlock()
+	if now.Sub(l.cleaned) > rateLimiterCleanupTime {
+		l.cleanupL(now)
+	}
+	for _, limit := range limits {
+		b := l.bucketL(limit, now)
+		if b.tokens < n {
+			if wait := time.Duration((n - b.tokens) / limit.rate * float64(time.Second)); wait > retry {
+				retry = wait
+			}
+		}
+	}
+	if retry > 0 {
+		return
+	}
+	for _, limit := range limits {
+		l.buckets[limit.key].tokens -= n
+	}
+	return
+}
+
+// charge takes n tokens from each of the limits, going into debt if need be
+func (l *rateLimiter) charge(limits []rateLimit, n float64) {
+	now := time.Now()
+	l.Lock()
+	for _, limit := range limits {
+		l.bucketL(limit, now).tokens -= n
+	}
+	l.Unlock()
+}
+
+// cleanupL removes the token buckets that have been idle long enough to refill
+func (l *rateLimiter) cleanupL(now time.Time) {
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > rateLimiterCleanupTime {
+			delete(l.buckets, key)
+		}
+	}
+	l.cleaned = now
+}
+
+// rateLimits returns the request rate (or bandwidth) limits of the user and the bucket;
+// a negative bucket limit means the bucket is not limited
+func (h *httprunner) rateLimits(user, bucket string, bandwidth bool) (limits []rateLimit) {
+	conf := &ctx.config.RateLimit
+	userrate, bucketrate := conf.UserRequests, conf.BucketRequests
+	if bandwidth {
+		userrate, bucketrate = float64(conf.UserBandwidth), float64(conf.BucketBandwidth)
+	}
+	if bucket != "" {
+		bucketmd := h.bmdowner.get()
+		if _, props := bucketmd.get(bucket, bucketmd.islocal(bucket)); bandwidth && props.Bandwidth != 0 {
+			bucketrate = float64(props.Bandwidth)
+		} else if !bandwidth && props.RequestRate != 0 {
+			bucketrate = props.RequestRate
+		}
+	}
+	if user != "" && userrate > 0 {
+		limits = append(limits, rateLimit{key: "user:" + user, rate: userrate})
+	}
+	if bucket != "" && bucketrate > 0 {
+		limits = append(limits, rateLimit{key: "bucket:" + bucket, rate: bucketrate})
+	}
+	return
+}
+
+// throttled rejects the request with 429 and the number of seconds to wait
+func (h *httprunner) throttled(w http.ResponseWriter, r *http.Request, limits []rateLimit, retry time.Duration) {
+	keys := make([]string, len(limits))
+	for i, limit := range limits {
+		keys[i] = limit.key
+	}
+	seconds := int64(math.Ceil(retry.Seconds()))
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	h.statsif.add("numthrottled", 1)
+	s := fmt.Sprintf("Rate limit exceeded (%s), retry in %ds", strings.Join(keys, ", "), seconds)
+	h.invalmsghdlr(w, r, s, http.StatusTooManyRequests)
+}
+
+// rateLimit enforces the request rate limits of the user and the bucket
+func (p *proxyrunner) rateLimit(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !ctx.config.RateLimit.Enabled {
+			h.ServeHTTP(w, r)
+			return
+		}
+		var user string
+		if ctx.config.Auth.Enabled {
+			// invalid tokens are rejected by checkHTTPAuth
+			if auth, err := p.validateToken(r); err == nil {
+				user = auth.userID
+			}
+		}
+		limits := p.rateLimits(user, requestBucket(r), false)
+		if retry := p.ratelimiter.admit(limits, 1); retry > 0 {
+			p.throttled(w, r, limits, retry)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}
+}
+
+// rateLimit enforces the bandwidth limits of the user and the bucket upon object GET and PUT;
+// intra-cluster transfers are not limited: rebalance (that is not retried upon 429) and
+// the GETs of the other targets (getFromNeighbor, compose), provided they come from a
+// verified daemon (see isPeerDaemon) - with AuthN, the path alone (see isIntraCluster)
+// does not suffice. The user of a redirected request is identified by the token or by
+// the redirect signed by the proxy (see userFromRequest)
+func (t *targetrunner) rateLimit(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !ctx.config.RateLimit.Enabled || (r.Method != http.MethodGet && r.Method != http.MethodPut) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if t.isPeerDaemon(r) || (isIntraCluster(r) && !ctx.config.Auth.Enabled) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		var user string
+		if authrec, err := t.userFromRequest(r); err == nil && authrec != nil {
+			user = authrec.userID
+		}
+		limits := t.rateLimits(user, requestBucket(r), true)
+		if len(limits) == 0 {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if retry := t.ratelimiter.admit(limits, 0); retry > 0 {
+			if glog.V(4) {
+				glog.Infof("%s %s: throttled for %v", r.Method, r.URL.Path, retry)
+			}
+			t.throttled(w, r, limits, retry)
+			return
+		}
+		if r.Method == http.MethodPut {
+			r.Body = &rateLimitReader{ReadCloser: r.Body, limiter: t.ratelimiter, limits: limits}
+		} else {
+			w = &rateLimitWriter{ResponseWriter: w, limiter: t.ratelimiter, limits: limits}
+		}
+		h.ServeHTTP(w, r)
+	}
+}
+
+func (w *rateLimitWriter) Write(b []byte) (n int, err error) {
+	n, err = w.ResponseWriter.Write(b)
+	w.limiter.charge(w.limits, float64(n))
+	return
+}
+
+func (r *rateLimitReader) Read(b []byte) (n int, err error) {
+	n, err = r.ReadCloser.Read(b)
+	r.limiter.charge(r.limits, float64(n))
+	return
+}
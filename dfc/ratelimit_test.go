@@ -0,0 +1,181 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter()
+	limits := []rateLimit{{key: "user:u1", rate: 10}, {key: "bucket:b1", rate: 100}}
+	for i := 0; i < 10; i++ {
+		if retry := l.admit(limits, 1); retry != 0 {
+			t.Fatalf("Request %d was throttled for %v", i, retry)
+		}
+	}
+	// the user is out of tokens, the bucket is not charged
+	retry := l.admit(limits, 1)
+	if retry <= 0 || retry > 100*time.Millisecond {
+		t.Errorf("Expected to retry within 100ms, got %v", retry)
+	}
+	if tokens := l.buckets["bucket:b1"].tokens; tokens < 89 || tokens > 91 {
+		t.Errorf("Expected 90 bucket tokens, got %f", tokens)
+	}
+	time.Sleep(retry)
+	if retry = l.admit(limits, 1); retry != 0 {
+		t.Errorf("Request was throttled for %v after the refill", retry)
+	}
+
+	// bandwidth: the transfer is admitted and then puts the bucket into debt
+	limits = []rateLimit{{key: "bucket:b2", rate: 1000}}
+	if retry = l.admit(limits, 0); retry != 0 {
+		t.Fatalf("Transfer was throttled for %v", retry)
+	}
+	l.charge(limits, 3000)
+	if retry = l.admit(limits, 0); retry < time.Second || retry > 2*time.Second {
+		t.Errorf("Expected to retry in 2s, got %v", retry)
+	}
+
+	// idle token buckets are removed
+	l.cleaned = time.Now().Add(-2 * rateLimiterCleanupTime)
+	l.buckets["user:u1"].last = l.cleaned
+	l.admit(nil, 1)
+	l.admit(limits, 0)
+	if _, ok := l.buckets["user:u1"]; ok || len(l.buckets) != 2 {
+		t.Errorf("Expected idle token bucket to be removed, got %v", l.buckets)
+	}
+}
+
+func TestProxyRateLimit(t *testing.T) {
+	oldconf := ctx.config.RateLimit
+	ctx.config.RateLimit = ratelimitconf{BucketRequests: 2, Enabled: true}
+	defer func() { ctx.config.RateLimit = oldconf }()
+
+	p := &proxyrunner{}
+	p.statsif = nopStats{}
+	p.ratelimiter = newRateLimiter()
+	p.bmdowner = &bmdowner{}
+	bucketmd := newBucketMD()
+	bucketmd.add("fast", true, BucketProps{RequestRate: 5})
+	bucketmd.add("unlimited", true, BucketProps{RequestRate: -1})
+	p.bmdowner.put(bucketmd)
+	handler := p.rateLimit(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		path     string
+		admitted int
+	}{
+		{"/v1/objects/slow/obj", 2},
+		{"/v1/objects/fast/obj", 5},
+		{"/v1/buckets/unlimited", 10},
+		{"/v1/buckets/*", 10},
+	}
+	for _, test := range tests {
+		admitted := 0
+		for i := 0; i < 10; i++ {
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+			if w.Code == http.StatusOK {
+				admitted++
+				continue
+			}
+			if w.Code != http.StatusTooManyRequests {
+				t.Fatalf("%s: unexpected status %d", test.path, w.Code)
+			}
+			if seconds, err := strconv.Atoi(w.Header().Get("Retry-After")); err != nil || seconds != 1 {
+				t.Errorf("%s: invalid Retry-After %q", test.path, w.Header().Get("Retry-After"))
+			}
+		}
+		if admitted != test.admitted {
+			t.Errorf("%s: expected %d requests admitted, got %d", test.path, test.admitted, admitted)
+		}
+	}
+
+	// runtime change
+	if errstr := p.setconfig("ratelimit_enabled", "false"); errstr != "" {
+		t.Fatal(errstr)
+	}
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/v1/objects/slow/obj", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Request was throttled with rate limiting disabled: %d", w.Code)
+	}
+}
+
+func TestTargetBandwidthLimit(t *testing.T) {
+	oldconf := ctx.config.RateLimit
+	ctx.config.RateLimit = ratelimitconf{BucketBandwidth: 1024, Enabled: true}
+	defer func() { ctx.config.RateLimit = oldconf }()
+
+	tr := &targetrunner{}
+	tr.statsif = nopStats{}
+	tr.ratelimiter = newRateLimiter()
+	tr.bmdowner = &bmdowner{}
+	tr.bmdowner.put(newBucketMD())
+	var received int
+	handler := tr.rateLimit(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			b, _ := ioutil.ReadAll(r.Body)
+			received = len(b)
+			return
+		}
+		w.Write(make([]byte, 2048))
+	})
+	do := func(method, path string, body []byte) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(method, path, bytes.NewReader(body)))
+		return w
+	}
+
+	if w := do(http.MethodGet, "/v1/objects/bucket/obj", nil); w.Code != http.StatusOK || w.Body.Len() != 2048 {
+		t.Fatalf("GET: status %d, %d bytes", w.Code, w.Body.Len())
+	}
+	// 1KB/s: the 2KB GET has to be waited out
+	w := do(http.MethodPut, "/v1/objects/bucket/obj", make([]byte, 100))
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("PUT: expected 429 and Retry-After 1, got %d and %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	// rebalance is not limited
+	if w = do(http.MethodPut, "/v1/objects/bucket/obj?from_id=t1&to_id=t2", make([]byte, 100)); w.Code != http.StatusOK {
+		t.Errorf("Rebalance PUT was throttled: %d", w.Code)
+	}
+	// with AuthN, provided it is signed by the target
+	ctx.config.Auth.Secret, ctx.config.Auth.Enabled = "aBitLongSecretKey", true
+	if w = do(http.MethodPut, "/v1/objects/bucket/obj?from_id=t1&to_id=t2", make([]byte, 100)); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Unsigned rebalance PUT: expected 429, got %d", w.Code)
+	}
+	rebalance := httptest.NewRequest(http.MethodPut, "/v1/objects/bucket/obj?from_id=t1&to_id=t2", bytes.NewReader(make([]byte, 100)))
+	(&httprunner{si: &daemonInfo{DaemonID: "t1"}}).signRequest(rebalance)
+	w = httptest.NewRecorder()
+	handler(w, rebalance)
+	ctx.config.Auth.Enabled = false
+	if w.Code != http.StatusOK {
+		t.Errorf("Signed rebalance PUT was throttled: %d", w.Code)
+	}
+	// nor are the GETs of the other targets
+	r := httptest.NewRequest(http.MethodGet, "/v1/objects/bucket/obj", nil)
+	r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "t2"}}}}
+	w = httptest.NewRecorder()
+	handler(w, r)
+	if w.Code != http.StatusOK || w.Body.Len() != 2048 {
+		t.Errorf("GET from target t2: status %d, %d bytes", w.Code, w.Body.Len())
+	}
+	// other buckets are not affected
+	if w = do(http.MethodPut, "/v1/objects/other/obj", make([]byte, 100)); w.Code != http.StatusOK || received != 100 {
+		t.Errorf("PUT: status %d, received %d bytes", w.Code, received)
+	}
+	if tokens := tr.ratelimiter.buckets["bucket:other"].tokens; tokens > 950 {
+		t.Errorf("PUT was not charged: %f tokens", tokens)
+	}
+}
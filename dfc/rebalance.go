@@ -40,7 +40,7 @@ func (t *targetrunner) runRebalance(newsmap *Smap, newtargetid string) {
 		if sid == t.si.DaemonID {
 			continue
 		}
-		url := si.DirectURL + "/" + Rversion + "/" + Rhealth
+		url := si.controlURL() + "/" + Rversion + "/" + Rhealth
 		url += from
 		pollstarted, ok := time.Now(), false
 		timeout := kalivetimeout
@@ -132,7 +132,7 @@ func (t *targetrunner) pollRebalancingDone(newsmap *Smap) {
 			if sid == t.si.DaemonID {
 				continue
 			}
-			url := si.DirectURL + "/" + Rversion + "/" + Rhealth
+			url := si.controlURL() + "/" + Rversion + "/" + Rhealth
 			res := t.call(nil, si, url, http.MethodGet, nil)
 			// retry once
 			if res.err == context.DeadlineExceeded {
@@ -221,9 +221,18 @@ func (rcl *xrebpathrunner) rebwalkf(fqn string, osfi os.FileInfo, err error) err
 		return nil
 	}
 
-	// do rebalance
+	// do rebalance (throttled)
+	release, ok := rcl.t.xthrottle.acquire(rcl.xreb.abrt)
+	if !ok {
+		err = fmt.Errorf("%s aborted, exiting rebwalkf path %s", rcl.xreb.tostring(), rcl.mpathplus)
+		glog.Infoln(err)
+		rcl.aborted = true
+		return err
+	}
 	glog.Infof("%s/%s %s => %s", bucket, objname, rcl.t.si.DaemonID, si.DaemonID)
-	if errstr = rcl.t.sendfile(http.MethodPut, bucket, objname, si, osfi.Size(), "", ""); errstr != "" {
+	errstr = rcl.t.sendfile(http.MethodPut, bucket, objname, si, osfi.Size(), "", "")
+	release(osfi.Size())
+	if errstr != "" {
 		glog.Infof("Failed to rebalance %s/%s: %s", bucket, objname, errstr)
 	} else {
 		// FIXME: TODO: delay the removal or (even) rely on the LRU
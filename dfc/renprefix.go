@@ -0,0 +1,271 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// Prefix (directory) rename: POST {"action": "renameprefix", "name": new-prefix, "value": prefix} /v1/buckets/bucket-name
+//
+// Renames all objects of the local bucket whose names start with the prefix into
+// new-prefix + the rest of the name. The proxy broadcasts the request to all targets, each target
+// then runs the xaction (ActRenamePrefix) on the objects it stores: the object is renamed in place
+// if its new name maps to the same target and sent to its new owner otherwise (see renameobject).
+// The objects that fail to rename are counted and (some of) their errors are reported by the
+// xaction's stats (RenamePrefixTargetStats) that are kept until the next rename.
+const renamePrefixMaxErrors = 16 // errors reported in the stats
+
+type xactRenamePrefix struct {
+	xactBase
+	sync.Mutex
+	targetrunner *targetrunner
+	bucket       string
+	prefix       string
+	newprefix    string
+	stats        RenamePrefixTargetStats
+}
+
+// renamePrefixArgs returns the prefix and the new prefix given the action message
+func renamePrefixArgs(bucketmd *bucketMD, bucket string, msg *ActionMsg) (prefix, newprefix, errstr string) {
+	if !bucketmd.islocal(bucket) {
+		errstr = fmt.Sprintf("Rename prefix is supported only for cache-only buckets (%s does not appear to be local)", bucket)
+		return
+	}
+	prefix, ok := msg.Value.(string)
+	if !ok || prefix == "" {
+		errstr = fmt.Sprintf("Invalid rename prefix request: prefix must be a non-empty string (%v, %T)", msg.Value, msg.Value)
+		return
+	}
+	newprefix = msg.Name
+	if newprefix == "" {
+		errstr = fmt.Sprintf("Invalid rename prefix request: empty new prefix for %s/%s", bucket, prefix)
+		return
+	}
+	// otherwise, the renamed objects would either match the prefix again or overwrite the ones yet to be renamed
+	if strings.HasPrefix(newprefix, prefix) || strings.HasPrefix(prefix, newprefix) {
+		errstr = fmt.Sprintf("Invalid rename prefix request: %s and %s overlap", prefix, newprefix)
+	}
+	return
+}
+
+// renamePrefixDir returns the deepest directory that contains all the objects with the prefix
+func renamePrefixDir(bucketdir, prefix string) string {
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		return filepath.Join(bucketdir, prefix[:i])
+	}
+	return bucketdir
+}
+
+// POST { action: renameprefix } /Rversion/Rbuckets/bucket-name
+func (p *proxyrunner) renameprefix(w http.ResponseWriter, r *http.Request, bucket string, msg *ActionMsg) {
+	if _, _, errstr := renamePrefixArgs(p.bmdowner.get(), bucket, msg); errstr != "" {
+		p.invalmsghdlr(w, r, errstr)
+		return
+	}
+	jsonbytes, err := json.Marshal(msg)
+	assert(err == nil, err)
+	q := url.Values{}
+	q.Set(URLParamLocal, strconv.FormatBool(true))
+	results := p.broadcastTargets(
+		URLPath(Rversion, Rbuckets, bucket),
+		q,
+		http.MethodPost,
+		jsonbytes,
+		p.smap,
+	)
+	for result := range results {
+		if result.err != nil {
+			p.invalmsghdlr(w, r, fmt.Sprintf("Failed to start renaming %s/%s => %s/%s: %v (%d: %s)",
+				bucket, msg.Value, bucket, msg.Name, result.err, result.status, result.errstr))
+			return
+		}
+	}
+	glog.Infof("Started renaming %s/%s => %s/%s", bucket, msg.Value, bucket, msg.Name)
+}
+
+// POST { action: renameprefix } /Rversion/Rbuckets/bucket-name
+func (t *targetrunner) renameprefix(w http.ResponseWriter, r *http.Request, msg ActionMsg) {
+	apitems := t.restAPIItems(r.URL.Path, 5)
+	if apitems = t.checkRestAPI(w, r, apitems, 1, Rversion, Rbuckets); apitems == nil {
+		return
+	}
+	bucket := apitems[0]
+	if !t.validatebckname(w, r, bucket) {
+		return
+	}
+	prefix, newprefix, errstr := renamePrefixArgs(t.bmdowner.get(), bucket, &msg)
+	if errstr != "" {
+		t.invalmsghdlr(w, r, errstr)
+		return
+	}
+	xrp := t.xactinp.renewRenamePrefix(t, bucket, prefix, newprefix)
+	if xrp == nil {
+		t.invalmsghdlr(w, r, fmt.Sprintf("Cannot rename %s/%s: %s is already running", bucket, prefix, ActRenamePrefix))
+		return
+	}
+	go t.runRenamePrefix(xrp)
+}
+
+func (t *targetrunner) runRenamePrefix(xrp *xactRenamePrefix) {
+	glog.Infoln(xrp.tostring())
+	wg := &sync.WaitGroup{}
+	for mpath := range ctx.mountpaths.Available {
+		wg.Add(1)
+		go xrp.oneRenamePrefix(renamePrefixDir(filepath.Join(makePathLocal(mpath), xrp.bucket), xrp.prefix), wg)
+	}
+	wg.Wait()
+
+	xrp.etime = time.Now()
+	xrp.Lock()
+	if xrp.stats.NumFailed > 0 {
+		glog.Errorf("%s: failed to rename %d object(s), errors: %v", xrp.tostring(), xrp.stats.NumFailed, xrp.stats.Errors)
+	}
+	xrp.Unlock()
+	glog.Infoln(xrp.tostring())
+}
+
+func (xrp *xactRenamePrefix) oneRenamePrefix(dir string, wg *sync.WaitGroup) {
+	defer wg.Done()
+	if _, err := os.Stat(dir); err != nil {
+		return
+	}
+	if err := filepath.Walk(dir, xrp.walkfn); err != nil {
+		s := err.Error()
+		if strings.Contains(s, "xaction") {
+			glog.Infof("Stopping %q traversal: %s", dir, s)
+		} else {
+			glog.Errorf("Failed to traverse %q, err: %v", dir, err)
+			xrp.failed(dir, s)
+		}
+	}
+}
+
+func (xrp *xactRenamePrefix) walkfn(fqn string, osfi os.FileInfo, err error) error {
+	if err != nil {
+		glog.Errorf("walkfunc callback invoked with err: %v", err)
+		return err
+	}
+	if osfi.Mode().IsDir() {
+		return nil
+	}
+	if iswork, _ := xrp.targetrunner.isworkfile(fqn); iswork {
+		return nil
+	}
+	if xrp.finished() {
+		return fmt.Errorf("%s aborted, exiting", xrp.tostring())
+	}
+	bucket, objname, errstr := xrp.targetrunner.fqn2bckobj(fqn)
+	if errstr != "" {
+		glog.Errorln(errstr)
+		return nil
+	}
+	if bucket != xrp.bucket || !strings.HasPrefix(objname, xrp.prefix) {
+		return nil
+	}
+	xrp.renameOne(objname, fqn)
+	return nil
+}
+
+func (xrp *xactRenamePrefix) renameOne(objname, fqn string) {
+	var (
+		t          = xrp.targetrunner
+		newobjname = xrp.newprefix + objname[len(xrp.prefix):]
+		uname      = uniquename(xrp.bucket, objname)
+	)
+	si, errstr := HrwTarget(xrp.bucket, newobjname, t.smap)
+	if errstr != "" {
+		xrp.failed(objname, errstr)
+		return
+	}
+	t.rtnamemap.lockname(uname, true, &pendinginfo{Time: time.Now(), fqn: fqn}, time.Second)
+	defer t.rtnamemap.unlockname(uname, true)
+	if errstr = t.renameobject(xrp.bucket, objname, xrp.bucket, newobjname); errstr != "" {
+		xrp.failed(objname, errstr)
+		return
+	}
+	migrated := si.DaemonID != t.si.DaemonID
+	if migrated {
+		// the new owner has it
+		if err := os.Remove(fqn); err != nil {
+			glog.Errorf("Failed to remove %s migrated to %s, err: %v", fqn, si.DaemonID, err)
+		}
+	}
+	xrp.Lock()
+	xrp.stats.NumRenamed++
+	if migrated {
+		xrp.stats.NumMigrated++
+	}
+	xrp.Unlock()
+}
+
+func (xrp *xactRenamePrefix) failed(name, errstr string) {
+	xrp.Lock()
+	xrp.stats.NumFailed++
+	if len(xrp.stats.Errors) < renamePrefixMaxErrors {
+		xrp.stats.Errors = append(xrp.stats.Errors, fmt.Sprintf("%s: %s", name, errstr))
+	}
+	xrp.Unlock()
+}
+
+//
+// xaction
+//
+
+func (q *xactInProgress) renewRenamePrefix(t *targetrunner, bucket, prefix, newprefix string) *xactRenamePrefix {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	_, xx := q.findU(ActRenamePrefix)
+	if xx != nil {
+		xrp := xx.(*xactRenamePrefix)
+		if !xrp.finished() {
+			glog.Infof("%s already running, nothing to do", xrp.tostring())
+			return nil
+		}
+		// the finished one is kept for its stats until the next one
+		k, _ := q.findU(xrp.id)
+		q.xactinp = append(q.xactinp[:k], q.xactinp[k+1:]...)
+	}
+	id := q.uniqueid()
+	xrp := &xactRenamePrefix{
+		xactBase:     *newxactBase(id, ActRenamePrefix),
+		targetrunner: t,
+		bucket:       bucket,
+		prefix:       prefix,
+		newprefix:    newprefix,
+	}
+	xrp.stats.Bucket, xrp.stats.Prefix, xrp.stats.NewPrefix = bucket, prefix, newprefix
+	xrp.stats.Errors = []string{}
+	q.add(xrp)
+	return xrp
+}
+
+func (xact *xactRenamePrefix) tostring() string {
+	start := xact.stime.Sub(xact.targetrunner.starttime())
+	if !xact.finished() {
+		return fmt.Sprintf("xaction %s:%d %s/%s => %s/%s started %v", xact.kind, xact.id,
+			xact.bucket, xact.prefix, xact.bucket, xact.newprefix, start)
+	}
+	fin := time.Since(xact.targetrunner.starttime())
+	return fmt.Sprintf("xaction %s:%d %s/%s => %s/%s started %v finished %v", xact.kind, xact.id,
+		xact.bucket, xact.prefix, xact.bucket, xact.newprefix, start, fin)
+}
+
+func (xact *xactRenamePrefix) abort() {
+	xact.xactBase.abort()
+	glog.Infof("ABORT: " + xact.tostring())
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRenamePrefixArgs(t *testing.T) {
+	bucketmd := newBucketMD()
+	bucketmd.add("local", true, BucketProps{})
+	tests := []struct {
+		bucket, prefix, newprefix string
+		ok                        bool
+	}{
+		{"local", "dir1/", "dir2/", true},
+		{"local", "a", "b", true},
+		{"local", "", "dir2/", false},
+		{"local", "dir1/", "", false},
+		{"local", "dir1/", "dir1/sub/", false},
+		{"local", "dir1/sub/", "dir1/", false},
+		{"cloud", "dir1/", "dir2/", false},
+	}
+	for _, test := range tests {
+		msg := &ActionMsg{Action: ActRenamePrefix, Name: test.newprefix, Value: test.prefix}
+		prefix, newprefix, errstr := renamePrefixArgs(bucketmd, test.bucket, msg)
+		if ok := errstr == ""; ok != test.ok {
+			t.Errorf("%s/%s => %s: expected ok=%v, got error %q", test.bucket, test.prefix, test.newprefix, test.ok, errstr)
+			continue
+		}
+		if test.ok && (prefix != test.prefix || newprefix != test.newprefix) {
+			t.Errorf("expected %s => %s, got %s => %s", test.prefix, test.newprefix, prefix, newprefix)
+		}
+	}
+}
+
+func TestRenamePrefixDir(t *testing.T) {
+	bucketdir := filepath.Join("/tmp", "local", "bucket")
+	tests := map[string]string{
+		"obj":      bucketdir,
+		"dir/":     filepath.Join(bucketdir, "dir"),
+		"dir/obj":  filepath.Join(bucketdir, "dir"),
+		"a/b/c/ob": filepath.Join(bucketdir, "a/b/c"),
+		"a/b/c/":   filepath.Join(bucketdir, "a/b/c"),
+	}
+	for prefix, exp := range tests {
+		if dir := renamePrefixDir(bucketdir, prefix); dir != exp {
+			t.Errorf("%s: expected %s, got %s", prefix, exp, dir)
+		}
+	}
+}
@@ -20,7 +20,8 @@ cat > $CONFFILE <<EOL
 		"secret": "$SECRETKEY",
 		"username": "$AUTH_SU_NAME",
 		"password": "$AUTH_SU_PASS",
-		"expiration_time": "30m"
+		"expiration_time": "30m",
+		"refresh_expiration_time": "24h"
 	},
 	"timeout": {
 		"default_timeout": "30s"
@@ -12,7 +12,8 @@
 	},
 	"periodic": {
 		"stats_time":		"10s",
-		"retry_sync_time":	"2s"
+		"retry_sync_time":	"2s",
+		"lifecycle_time":	"1h"
 	},
 	"timeout": {
 		"default_timeout":	"30s",
@@ -48,6 +49,57 @@
 		"dest_retry_time":	"2m",
 		"rebalancing_enabled": 	true
 	},
+	"trash": {
+		"retention_time":	"24h",
+		"purge_time":		"1h",
+		"soft_delete_enabled":	false
+	},
+	"etl": {
+		"transformers": {
+			"uppercase": {
+				"command":	["tr", "[:lower:]", "[:upper:]"],
+				"timeout":	"1m",
+				"cache":	true
+			}
+		}
+	},
+	"audit": {
+		"dir":		"",
+		"max_size":	67108864,
+		"max_files":	10,
+		"hash_chain":	true,
+		"audit_enabled":	false
+	},
+	"trace": {
+		"file":			"",
+		"collector_url":	"",
+		"tracing_enabled":	false
+	},
+	"ratelimit": {
+		"user_requests":	0,
+		"user_bandwidth":	0,
+		"bucket_requests":	0,
+		"bucket_bandwidth":	0,
+		"ratelimit_enabled":	false
+	},
+	"admission": {
+		"max_cold_get":		0,
+		"max_warm_get":		0,
+		"max_put":		0,
+		"max_rebalance":	0,
+		"max_util":		0,
+		"queue_time":		"100ms",
+		"backoff_time":		"10s",
+		"admission_enabled":	false
+	},
+	"xaction_throttle": {
+		"xaction_bandwidth":		0,
+		"xaction_transfers":		0,
+		"adaptive_throttle":		false,
+		"adaptive_max_latency":		"0s",
+		"adaptive_max_util":		0,
+		"xaction_throttle_enabled":	false
+	},
 	"cksum_config": {
                  "checksum":                    "xxhash",
                  "validate_checksum_cold_get":  true,
@@ -68,9 +120,13 @@
 	},
 	"netconfig": {
 		"ipv4": "$IPV4LIST",
+		"ipv4_intra_control": "",
+		"ipv4_intra_data": "",
 		"l4": {
 			"proto": 	"tcp",
-			"port":		"${PORT}"
+			"port":		"${PORT}",
+			"port_intra_control":	"${PORT_INTRA_CONTROL}",
+			"port_intra_data":	"${PORT_INTRA_DATA}"
 		},
 		"http": {
 			"max_num_targets":    16,
@@ -78,7 +134,11 @@
 			"use_http2":          false,
 			"use_as_proxy":       false,
 			"server_certificate": "server.crt",
-			"server_key":         "server.key"
+			"server_key":         "server.key",
+			"use_mtls":           false,
+			"ca_certificate":     "ca.crt",
+			"daemon_certificate": "daemon.crt",
+			"daemon_key":         "daemon.key"
 		}
 	},
 	"fskeeper": {
@@ -19,6 +19,10 @@
 export GOOGLE_CLOUD_PROJECT="involuted-forge-189016"
 USE_HTTPS=false
 PORT=${PORT:-8080}
+# intra-cluster control and data networks: empty - share the public port,
+# otherwise each daemon listens on the next port, same as with PORT
+PORT_INTRA_CONTROL=${PORT_INTRA_CONTROL:-}
+PORT_INTRA_DATA=${PORT_INTRA_DATA:-}
 PROXYURL="http://localhost:$PORT"
 if $USE_HTTPS; then
 	PROXYURL="https://localhost:$PORT"
@@ -122,6 +126,8 @@ do
 	LOGDIR="$LOGROOT/$c/log"
 	source $DIR/config.sh
 	((PORT++))
+	if [ -n "$PORT_INTRA_CONTROL" ]; then ((PORT_INTRA_CONTROL++)); fi
+	if [ -n "$PORT_INTRA_DATA" ]; then ((PORT_INTRA_DATA++)); fi
 done
 
 # conf file for authn
@@ -49,16 +49,17 @@ type statsif interface {
 
 // TODO: use static map[string]int64
 type proxyCoreStats struct {
-	Numget      int64 `json:"numget"`
-	Numput      int64 `json:"numput"`
-	Numpost     int64 `json:"numpost"`
-	Numdelete   int64 `json:"numdelete"`
-	Numrename   int64 `json:"numrename"`
-	Numlist     int64 `json:"numlist"`
-	Getlatency  int64 `json:"getlatency"`  // microseconds
-	Putlatency  int64 `json:"putlatency"`  // ---/---
-	Listlatency int64 `json:"listlatency"` // ---/---
-	Numerr      int64 `json:"numerr"`
+	Numget       int64 `json:"numget"`
+	Numput       int64 `json:"numput"`
+	Numpost      int64 `json:"numpost"`
+	Numdelete    int64 `json:"numdelete"`
+	Numrename    int64 `json:"numrename"`
+	Numlist      int64 `json:"numlist"`
+	Getlatency   int64 `json:"getlatency"`  // microseconds
+	Putlatency   int64 `json:"putlatency"`  // ---/---
+	Listlatency  int64 `json:"listlatency"` // ---/---
+	Numerr       int64 `json:"numerr"`
+	Numthrottled int64 `json:"numthrottled"` // rejected by rate limits (see ratelimit.go)
 	// omitempty
 	ngets  int64
 	nputs  int64
@@ -82,6 +83,25 @@ type targetCoreStats struct {
 	Bytesvchanged    int64 `json:"bytesvchanged"`
 	Numbadchecksum   int64 `json:"numbadchecksum"`
 	Bytesbadchecksum int64 `json:"bytesbadchecksum"`
+	Numexpired       int64 `json:"numexpired"`
+	Bytesexpired     int64 `json:"bytesexpired"`
+	Numtrashed       int64 `json:"numtrashed"`
+	Numundeleted     int64 `json:"numundeleted"`
+	Numtrashpurged   int64 `json:"numtrashpurged"`
+	Bytestrashpurged int64 `json:"bytestrashpurged"`
+	Numcopy          int64 `json:"numcopy"`
+	Bytescopied      int64 `json:"bytescopied"`
+	Numbatchget      int64 `json:"numbatchget"`
+	Bytesbatchget    int64 `json:"bytesbatchget"`
+	Numextracted     int64 `json:"numextracted"`
+	Bytesextracted   int64 `json:"bytesextracted"`
+	Numtransformed   int64 `json:"numtransformed"`
+	Numtransformhit  int64 `json:"numtransformhit"`
+	Numappend        int64 `json:"numappend"`
+	Bytesappended    int64 `json:"bytesappended"`
+	Numcompose       int64 `json:"numcompose"`
+	Bytescomposed    int64 `json:"bytescomposed"`
+	Numshed          int64 `json:"numshed"` // rejected by admission control (see admission.go)
 }
 
 type statsrunner struct {
@@ -106,6 +126,8 @@ type storstatsrunner struct {
 	// omitempty
 	timeUpdatedCapacity time.Time
 	timeCheckedLogSizes time.Time
+	timeRanLifecycle    time.Time
+	timeRanPurgeTrash   time.Time
 	fsmap               map[syscall.Fsid]string
 }
 
@@ -165,6 +187,52 @@ type (
 		NumBytesPrefetched int64            `json:"numBytesPrefetched"`
 	}
 
+	CopyBucketTargetStats struct {
+		Xactions       []XactionDetails `json:"xactionDetails"`
+		NumCopiedFiles int64            `json:"numCopiedFiles"`
+		NumCopiedBytes int64            `json:"numCopiedBytes"`
+	}
+
+	CopyBucketStats struct {
+		Kind        string                           `json:"kind"`
+		TargetStats map[string]CopyBucketTargetStats `json:"target"`
+	}
+
+	DsortTargetStats struct {
+		Xactions        []XactionDetails `json:"xactionDetails"`
+		Phase           string           `json:"phase"` // DsortPhase enum
+		Error           string           `json:"error,omitempty"`
+		ShardsTotal     int64            `json:"shardsTotal"`     // input shards stored by the target
+		ShardsExtracted int64            `json:"shardsExtracted"` // ... of which extracted
+		RecordsSent     int64            `json:"recordsSent"`     // to the other targets
+		RecordsRecv     int64            `json:"recordsRecv"`     // from the other targets
+		RecordsKept     int64            `json:"recordsKept"`     // extracted and owned by the target
+		ShardsToCreate  int64            `json:"shardsToCreate"`  // output shards assigned to the target
+		ShardsCreated   int64            `json:"shardsCreated"`
+		BytesCreated    int64            `json:"bytesCreated"`
+	}
+
+	DsortStats struct {
+		Kind        string                      `json:"kind"`
+		TargetStats map[string]DsortTargetStats `json:"target"`
+	}
+
+	RenamePrefixTargetStats struct {
+		Xactions    []XactionDetails `json:"xactionDetails"`
+		Bucket      string           `json:"bucket"`
+		Prefix      string           `json:"prefix"`
+		NewPrefix   string           `json:"newPrefix"`
+		NumRenamed  int64            `json:"numRenamed"`
+		NumMigrated int64            `json:"numMigrated"` // ... of which sent to other targets
+		NumFailed   int64            `json:"numFailed"`
+		Errors      []string         `json:"errors"` // up to renamePrefixMaxErrors
+	}
+
+	RenamePrefixStats struct {
+		Kind        string                             `json:"kind"`
+		TargetStats map[string]RenamePrefixTargetStats `json:"target"`
+	}
+
 	PrefetchStats struct {
 		Kind        string                   `json:"kind"`
 		TargetStats map[string]PrefetchStats `json:"target"`
@@ -294,6 +362,8 @@ func (r *proxystatsrunner) addL(name string, val int64) {
 		s.nlists++
 	case "numerr":
 		v = &s.Numerr
+	case "numthrottled":
+		v = &s.Numthrottled
 	default:
 		assert(false, "Invalid stats name "+name)
 	}
@@ -404,6 +474,18 @@ func (r *storstatsrunner) housekeep(runlru bool) {
 		go t.doPrefetch()
 	}
 
+	// expire objects according to the buckets' lifecycle rules
+	if time.Since(r.timeRanLifecycle) >= ctx.config.Periodic.LifecycleTime {
+		go t.runLifecycle()
+		r.timeRanLifecycle = time.Now()
+	}
+
+	// purge soft-deleted objects that are past their retention time
+	if time.Since(r.timeRanPurgeTrash) >= ctx.config.Trash.PurgeTime {
+		go t.runPurgeTrash(ctx.config.Trash.RetentionTime)
+		r.timeRanPurgeTrash = time.Now()
+	}
+
 	// keep total log size below the configured max
 	if time.Since(r.timeCheckedLogSizes) >= logsTotalSizeCheckTime {
 		go r.removeLogs(ctx.config.Log.MaxTotal)
@@ -567,6 +649,8 @@ func (r *storstatsrunner) addL(name string, val int64) {
 		s.nlists++
 	case "numerr":
 		v = &s.Numerr
+	case "numthrottled":
+		v = &s.Numthrottled
 	// target only
 	case "numcoldget":
 		v = &s.Numcoldget
@@ -596,6 +680,44 @@ func (r *storstatsrunner) addL(name string, val int64) {
 		v = &s.Numbadchecksum
 	case "bytesbadchecksum":
 		v = &s.Bytesbadchecksum
+	case "numexpired":
+		v = &s.Numexpired
+	case "bytesexpired":
+		v = &s.Bytesexpired
+	case "numtrashed":
+		v = &s.Numtrashed
+	case "numundeleted":
+		v = &s.Numundeleted
+	case "numtrashpurged":
+		v = &s.Numtrashpurged
+	case "bytestrashpurged":
+		v = &s.Bytestrashpurged
+	case "numcopy":
+		v = &s.Numcopy
+	case "bytescopied":
+		v = &s.Bytescopied
+	case "numbatchget":
+		v = &s.Numbatchget
+	case "bytesbatchget":
+		v = &s.Bytesbatchget
+	case "numextracted":
+		v = &s.Numextracted
+	case "bytesextracted":
+		v = &s.Bytesextracted
+	case "numtransformed":
+		v = &s.Numtransformed
+	case "numtransformhit":
+		v = &s.Numtransformhit
+	case "numappend":
+		v = &s.Numappend
+	case "bytesappended":
+		v = &s.Bytesappended
+	case "numcompose":
+		v = &s.Numcompose
+	case "bytescomposed":
+		v = &s.Bytescomposed
+	case "numshed":
+		v = &s.Numshed
 	default:
 		assert(false, "Invalid stats name "+name)
 	}
@@ -646,3 +768,67 @@ func (r RebalanceTargetStats) getStats(allXactionDetails []XactionDetails) (
 
 	return jsonBytes, nil
 }
+
+func (c CopyBucketTargetStats) getStats(allXactionDetails []XactionDetails) (
+	[]byte, error) {
+	copyBucketXactionStats := CopyBucketTargetStats{Xactions: allXactionDetails}
+	if _, xx := gettarget().xactinp.findL(ActCopyBucket); xx != nil {
+		xact := xx.(*xactCopyBucket)
+		xact.Lock()
+		copyBucketXactionStats = xact.stats
+		xact.Unlock()
+		copyBucketXactionStats.Xactions = allXactionDetails
+	}
+	jsonBytes, err := json.Marshal(copyBucketXactionStats)
+	if err != nil {
+		err = fmt.Errorf(
+			"Unable to marshal copyBucketXactionStats. Error: %v",
+			err)
+		return []byte{}, err
+	}
+
+	return jsonBytes, nil
+}
+
+func (c DsortTargetStats) getStats(allXactionDetails []XactionDetails) (
+	[]byte, error) {
+	dsortXactionStats := DsortTargetStats{Xactions: allXactionDetails}
+	if _, xx := gettarget().xactinp.findL(ActDsort); xx != nil {
+		xact := xx.(*xactDsort)
+		xact.Lock()
+		dsortXactionStats = xact.stats
+		xact.Unlock()
+		dsortXactionStats.Xactions = allXactionDetails
+	}
+	jsonBytes, err := json.Marshal(dsortXactionStats)
+	if err != nil {
+		err = fmt.Errorf(
+			"Unable to marshal dsortXactionStats. Error: %v",
+			err)
+		return []byte{}, err
+	}
+
+	return jsonBytes, nil
+}
+
+func (c RenamePrefixTargetStats) getStats(allXactionDetails []XactionDetails) (
+	[]byte, error) {
+	renamePrefixXactionStats := RenamePrefixTargetStats{Xactions: allXactionDetails, Errors: []string{}}
+	if _, xx := gettarget().xactinp.findL(ActRenamePrefix); xx != nil {
+		xact := xx.(*xactRenamePrefix)
+		xact.Lock()
+		renamePrefixXactionStats = xact.stats
+		renamePrefixXactionStats.Errors = append([]string{}, xact.stats.Errors...)
+		xact.Unlock()
+		renamePrefixXactionStats.Xactions = allXactionDetails
+	}
+	jsonBytes, err := json.Marshal(renamePrefixXactionStats)
+	if err != nil {
+		err = fmt.Errorf(
+			"Unable to marshal renamePrefixXactionStats. Error: %v",
+			err)
+		return []byte{}, err
+	}
+
+	return jsonBytes, nil
+}
@@ -19,7 +19,6 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
-	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -60,6 +59,10 @@ type allfinfos struct {
 	t            *targetrunner
 	bucket       string
 	limit        int
+	delimiter    string
+	dirs         map[string]struct{} // common prefixes already listed (when delimiter is set)
+	sort         *listSort
+	filter       *listFilter // nil if the listing is not filtered
 }
 
 type uxprocess struct {
@@ -93,6 +96,8 @@ type targetrunner struct {
 	prefetchQueue chan filesWithDeadline
 	statsdC       statsd.Client
 	authn         *authManager
+	admission     *admissionCtl
+	xthrottle     *xactThrottle
 }
 
 // start target runner
@@ -109,6 +114,8 @@ func (t *targetrunner) run() error {
 	t.httprunner.kalive = gettargetkalive()
 	t.xactinp = newxactinp()        // extended actions
 	t.rtnamemap = newrtnamemap(128) // lock/unlock name
+	t.admission = newAdmissionCtl()
+	t.xthrottle = newXactThrottle()
 
 	bucketmd := newBucketMD()
 	t.bmdowner.put(bucketmd)
@@ -148,16 +155,23 @@ func (t *targetrunner) run() error {
 		tokens:        make(map[string]*authRec),
 		revokedTokens: make(map[string]bool),
 	}
+	t.initAudit(t.authn)
 	//
 	// REST API: register storage target's handler(s) and start listening
 	//
-	t.httprunner.registerhdlr(URLPath(Rversion, Rbuckets)+"/", t.bucketHandler)
-	t.httprunner.registerhdlr(URLPath(Rversion, Robjects)+"/", t.objectHandler)
+	if ctx.config.Auth.Enabled {
+		t.httprunner.registerhdlr(URLPath(Rversion, Rbuckets)+"/", wrapHandler(t.bucketHandler, t.checkHTTPAuth))
+		t.httprunner.registerhdlr(URLPath(Rversion, Robjects)+"/", wrapHandler(t.objectHandler, t.rateLimit, t.checkHTTPAuth))
+	} else {
+		t.httprunner.registerhdlr(URLPath(Rversion, Rbuckets)+"/", t.bucketHandler)
+		t.httprunner.registerhdlr(URLPath(Rversion, Robjects)+"/", wrapHandler(t.objectHandler, t.rateLimit))
+	}
 	t.httprunner.registerhdlr(URLPath(Rversion, Rdaemon), t.daemonHandler)
 	t.httprunner.registerhdlr(URLPath(Rversion, Rpush)+"/", t.pushHandler)
 	t.httprunner.registerhdlr(URLPath(Rversion, Rhealth), t.httpHealth)
 	t.httprunner.registerhdlr(URLPath(Rversion, Rvote)+"/", t.voteHandler)
 	t.httprunner.registerhdlr(URLPath(Rversion, Rtokens), t.tokenHandler)
+	t.httprunner.registerhdlr(URLPath(Rversion, Rsort)+"/", t.dsortHandler)
 	t.httprunner.registerhdlr("/", invalhdlr)
 	glog.Infof("Target %s is ready", t.si.DaemonID)
 	glog.Flush()
@@ -248,7 +262,7 @@ func (t *targetrunner) getPrimaryURLAndSI() (url string, proxysi *daemonInfo) {
 		return
 	}
 	if t.smap.ProxySI.DaemonID != "" {
-		url, proxysi = t.smap.ProxySI.DirectURL, t.smap.ProxySI
+		url, proxysi = t.smap.ProxySI.controlURL(), t.smap.ProxySI
 		smapLock.Unlock()
 		return
 	}
@@ -313,6 +327,10 @@ func (t *targetrunner) httpbckget(w http.ResponseWriter, r *http.Request) {
 		t.getbucketnames(w, r)
 		return
 	}
+	if r.URL.Query().Get(URLParamWhat) == GetWhatInventory {
+		t.getInventory(w, r, bucket)
+		return
+	}
 	// list the bucket and return
 	tag, ok := t.listbucket(w, r, bucket)
 	if ok {
@@ -347,16 +365,20 @@ func (t *targetrunner) httpobjget(w http.ResponseWriter, r *http.Request) {
 		nhobj                         cksumvalue
 		bucket, objname, fqn          string
 		uname, errstr, version        string
+		reqversion                    string
 		size                          int64
 		props                         *objectProps
 		started                       time.Time
 		errcode                       int
 		coldget, vchanged, inNextTier bool
+		tname                         string
+		release                       func()
 	)
 	started = time.Now()
 	cksumcfg := &ctx.config.Cksum
 	versioncfg := &ctx.config.Ver
 	ct := t.contextWithAuth(r)
+	span := requestSpan(r)
 	apitems := t.restAPIItems(r.URL.Path, 5)
 	if apitems = t.checkRestAPI(w, r, apitems, 2, Rversion, Robjects); apitems == nil {
 		return
@@ -365,6 +387,10 @@ func (t *targetrunner) httpobjget(w http.ResponseWriter, r *http.Request) {
 	if !t.validatebckname(w, r, bucket) {
 		return
 	}
+	if r.URL.Query().Get(URLParamWhat) == GetWhatVersions {
+		t.listObjVersions(w, r, bucket, objname)
+		return
+	}
 	offset, length, readRange, errstr := t.validateOffsetAndLength(r)
 	if errstr != "" {
 		t.invalmsghdlr(w, r, errstr)
@@ -378,11 +404,36 @@ func (t *targetrunner) httpobjget(w http.ResponseWriter, r *http.Request) {
 		t.invalmsghdlr(w, r, errstr, errcode)
 		return
 	}
+	if tname, errstr = transformerName(r, bucketmd, bucket, islocal); errstr != "" {
+		t.invalmsghdlr(w, r, errstr)
+		return
+	}
+	if tname != "" && readRange {
+		t.invalmsghdlr(w, r, fmt.Sprintf("Cannot transform a byte range of %s/%s", bucket, objname))
+		return
+	}
+
+	// admission: before taking the name lock, as the request may wait for its slot;
+	// a cold GET trades the slot for one of its own class (below)
+	if release, errstr = t.admit(admitWarmGet); errstr != "" {
+		t.shed(w, r, errstr)
+		return
+	}
+	defer func() { release() }()
 
 	// lockname(ro)
 	fqn, uname = t.fqn(bucket, objname, islocal), uniquename(bucket, objname)
 	t.rtnamemap.lockname(uname, false, &pendinginfo{Time: time.Now(), fqn: fqn}, time.Second)
 
+	// specific version from the object's version history
+	if reqversion = r.URL.Query().Get(URLParamVersion); reqversion != "" {
+		if fqn, errstr, errcode = t.objVersionFqn(bucket, objname, fqn, reqversion, islocal); errstr != "" {
+			t.invalmsghdlr(w, r, errstr, errcode)
+			t.rtnamemap.unlockname(uname, false)
+			return
+		}
+	}
+
 	// existence, access & versioning
 	if coldget, size, version, errstr = t.lookupLocally(bucket, objname, fqn); islocal && errstr != "" {
 		errcode = http.StatusInternalServerError
@@ -418,8 +469,10 @@ func (t *targetrunner) httpobjget(w http.ResponseWriter, r *http.Request) {
 	if !coldget && !islocal {
 		if versioncfg.ValidateWarmGet && (version != "" &&
 			t.versioningConfigured(bucket)) {
-			if vchanged, errstr, errcode = t.checkCloudVersion(
-				ct, bucket, objname, version); errstr != "" {
+			vspan := span.child("version validation")
+			vchanged, errstr, errcode = t.checkCloudVersion(ct, bucket, objname, version)
+			vspan.finish(errstr)
+			if errstr != "" {
 				t.invalmsghdlr(w, r, errstr, errcode)
 				t.rtnamemap.unlockname(uname, false)
 				return
@@ -429,7 +482,9 @@ func (t *targetrunner) httpobjget(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	if !coldget && cksumcfg.ValidateWarmGet && cksumcfg.Checksum != ChecksumNone {
+		cspan := span.child("checksum validation")
 		validChecksum, errstr := t.validateObjectChecksum(fqn, cksumcfg.Checksum, size)
+		cspan.finish(errstr)
 		if errstr != "" {
 			t.invalmsghdlr(w, r, errstr, http.StatusInternalServerError)
 			t.rtnamemap.unlockname(uname, false)
@@ -449,6 +504,11 @@ func (t *targetrunner) httpobjget(w http.ResponseWriter, r *http.Request) {
 	}
 	if coldget {
 		t.rtnamemap.unlockname(uname, false)
+		release()
+		if release, errstr = t.admit(admitColdGet); errstr != "" {
+			t.shed(w, r, errstr)
+			return
+		}
 		if props, errstr, errcode = t.coldget(ct, bucket, objname, false); errstr != "" {
 			if errcode == 0 {
 				t.invalmsghdlr(w, r, errstr)
@@ -458,12 +518,26 @@ func (t *targetrunner) httpobjget(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		size, nhobj = props.size, props.nhobj
+		if !islocal && r.URL.Query().Get(URLParamNoCache) == "true" {
+			// served instead of the overloaded HRW target: evict once sent (and unlocked)
+			defer func() {
+				if err := t.fildelete(ct, bucket, objname, true /*evict*/); err != nil {
+					glog.Warningf("Failed to evict %s/%s, err: %v", bucket, objname, err)
+				}
+			}()
+		}
 	}
 
 existslocally:
 	// note: coldget() keeps the read lock if successful
 	defer t.rtnamemap.unlockname(uname, false)
 
+	if tname != "" {
+		// cache only the transformations of the current version
+		t.transform(w, r, bucket, objname, fqn, tname, reqversion == "")
+		return
+	}
+
 	//
 	// local file => http response
 	//
@@ -484,6 +558,8 @@ existslocally:
 	}
 	if props != nil && props.version != "" {
 		w.Header().Add(HeaderDfcObjVersion, props.version)
+	} else if reqversion != "" {
+		w.Header().Add(HeaderDfcObjVersion, reqversion)
 	}
 
 	file, err := os.Open(fqn)
@@ -522,6 +598,7 @@ existslocally:
 	}
 
 	var written int64
+	sspan := span.child("send")
 	if readRange {
 		reader := io.NewSectionReader(file, offset, length)
 		written, err = io.CopyBuffer(w, reader, buf)
@@ -529,12 +606,18 @@ existslocally:
 		// copy
 		written, err = io.CopyBuffer(w, file, buf)
 	}
+	sspan.setAttr("bytes", strconv.FormatInt(written, 10))
 	if err != nil {
 		errstr = fmt.Sprintf("Failed to send file %s, err: %v", fqn, err)
+		sspan.finish(errstr)
+		if span != nil {
+			errstr += " (trace " + span.TraceID + ")"
+		}
 		glog.Errorln(t.errHTTP(r, errstr, http.StatusInternalServerError))
 		t.statsif.add("numerr", 1)
 		return
 	}
+	sspan.finish("")
 	if !coldget {
 		getatimerunner().touch(fqn)
 	}
@@ -561,6 +644,7 @@ existslocally:
 	)
 
 	t.statsif.addMany("numget", int64(1), "getlatency", int64(delta/1000))
+	t.xthrottle.observe(delta)
 }
 func (t *targetrunner) validateOffsetAndLength(r *http.Request) (
 	offset int64, length int64, readRange bool, errstr string) {
@@ -605,6 +689,12 @@ func (t *targetrunner) httpobjput(w http.ResponseWriter, r *http.Request) {
 			t.invalmsghdlr(w, r, s)
 			return
 		}
+		release, errstr := t.admit(admitRebalance)
+		if errstr != "" {
+			t.shed(w, r, errstr)
+			return
+		}
+		defer release()
 		if errstr := t.dorebalance(r, from, to, bucket, objname); errstr != "" {
 			t.invalmsghdlr(w, r, errstr)
 		}
@@ -618,11 +708,29 @@ func (t *targetrunner) httpobjput(w http.ResponseWriter, r *http.Request) {
 				break
 			}
 		}
+		// targets forward the objects extracted from archives (see extract)
+		if t.forwardedBy(r, d) {
+			b = true
+		}
 		if !b {
 			t.invalmsghdlr(w, r, fmt.Sprintf(
 				"Invalid request: PUT request from daemon ID: %s must come from a proxy", d))
 			return
 		}
+		release, errstr := t.admit(admitPut)
+		if errstr != "" {
+			t.shed(w, r, errstr)
+			return
+		}
+		defer release()
+		if query.Get(URLParamExtract) == "true" {
+			t.extract(w, r, bucket, objname)
+			return
+		}
+		if query.Get(URLParamAppend) == "true" {
+			t.appendobj(w, r, bucket, objname)
+			return
+		}
 		errstr, errcode := t.doput(w, r, bucket, objname)
 		if errstr != "" {
 			if errcode == 0 {
@@ -720,6 +828,12 @@ func (t *targetrunner) httpobjdelete(w http.ResponseWriter, r *http.Request) {
 		t.invalmsghdlr(w, r, s)
 		return
 	}
+	if version := r.URL.Query().Get(URLParamVersion); objname != "" && version != "" && !evict {
+		if errstr, errcode := t.delObjVersion(bucket, objname, version); errstr != "" {
+			t.invalmsghdlr(w, r, errstr, errcode)
+		}
+		return
+	}
 	if objname != "" {
 		err := t.fildelete(t.contextWithAuth(r), bucket, objname, evict)
 		if err != nil {
@@ -742,6 +856,16 @@ func (t *targetrunner) httpbckpost(w http.ResponseWriter, r *http.Request) {
 	switch msg.Action {
 	case ActPrefetch:
 		t.prefetchfiles(w, r, msg)
+	case ActUndelete:
+		t.undeletefiles(w, r, msg)
+	case ActCopyBucket:
+		t.copybucket(w, r, msg)
+	case ActInventory:
+		t.inventory(w, r, msg)
+	case ActBatchGet:
+		t.batchget(w, r, msg)
+	case ActRenamePrefix:
+		t.renameprefix(w, r, msg)
 	case ActRenameLB:
 		apitems := t.restAPIItems(r.URL.Path, 5)
 		if apitems = t.checkRestAPI(w, r, apitems, 1, Rversion, Rbuckets); apitems == nil {
@@ -794,6 +918,12 @@ func (t *targetrunner) httpobjpost(w http.ResponseWriter, r *http.Request) {
 	switch msg.Action {
 	case ActRename:
 		t.renamefile(w, r, msg)
+	case ActUndelete:
+		t.undeletefile(w, r)
+	case ActCopy:
+		t.copyfile(w, r, msg)
+	case ActCompose:
+		t.composefile(w, r, msg)
 	default:
 		t.invalmsghdlr(w, r, "Unexpected action "+msg.Action)
 	}
@@ -882,6 +1012,12 @@ func (t *targetrunner) httpobjhead(w http.ResponseWriter, r *http.Request) {
 			size    int64
 			version string
 		)
+		if reqversion := r.URL.Query().Get(URLParamVersion); reqversion != "" {
+			if fqn, errstr, errcode = t.objVersionFqn(bucket, objname, fqn, reqversion, islocal); errstr != "" {
+				http.Error(w, http.StatusText(errcode), errcode)
+				return
+			}
+		}
 		if _, size, version, errstr = t.lookupLocally(bucket, objname, fqn); errstr != "" {
 			status := http.StatusNotFound
 			http.Error(w, http.StatusText(status), status)
@@ -1025,6 +1161,15 @@ func (t *targetrunner) renamelocalbucket(bucketFrom, bucketTo string, p BucketPr
 		if err := os.RemoveAll(fromdir); err != nil {
 			glog.Errorf("Failed to remove dir %s", fromdir)
 		}
+		vdir := filepath.Join(makePathVersions(mpath), bucketFrom)
+		if err := os.RemoveAll(vdir); err != nil {
+			glog.Errorf("Failed to remove dir %s", vdir)
+		}
+		tdir := filepath.Join(makePathTrash(mpath), bucketFrom)
+		if err := os.RemoveAll(tdir); err != nil {
+			glog.Errorf("Failed to remove dir %s", tdir)
+		}
+		removeInventories(mpath, bucketFrom)
 	}
 	clone.del(bucketFrom, true)
 	return
@@ -1089,7 +1234,9 @@ func (t *targetrunner) getFromNeighbor(bucket, objname string, r *http.Request,
 		glog.Infof("getFromNeighbor: found %s/%s at %s", bucket, objname, neighsi.DaemonID)
 	}
 
-	geturl := fmt.Sprintf("%s%s?%s=%t", neighsi.DirectURL, r.URL.Path, URLParamLocal, islocal)
+	// the object as is, not the bucket's transformation
+	geturl := fmt.Sprintf("%s%s?%s=%t&%s=%s", neighsi.dataURL(), r.URL.Path, URLParamLocal, islocal,
+		URLParamTransform, TransformNone)
 	//
 	// http request
 	//
@@ -1098,6 +1245,16 @@ func (t *targetrunner) getFromNeighbor(bucket, objname string, r *http.Request,
 		glog.Errorf("Unexpected failure to create %s request %s, err: %v", http.MethodGet, geturl, err)
 		return
 	}
+	span := requestSpan(r).child("neighbor GET", spanKindClient)
+	span.setAttr("neighbor", neighsi.DaemonID)
+	span.inject(newr)
+	defer func() {
+		if props == nil {
+			span.finish("failed to get " + bucket + "/" + objname + " from " + neighsi.DaemonID)
+		} else {
+			span.finish("")
+		}
+	}()
 	// Do
 	contextwith, cancel := context.WithTimeout(context.Background(), ctx.config.Timeout.SendFile)
 	defer cancel()
@@ -1164,7 +1321,9 @@ func (t *targetrunner) coldget(ct context.Context, bucket, objname string, prefe
 		vchanged    bool
 		inNextTier  bool
 		bucketProps BucketProps
+		span        = spanFromContext(ct).child("cold GET")
 	)
+	defer func() { span.finish(errstr) }()
 	// one cold GET at a time
 	if prefetch {
 		if !t.rtnamemap.trylockname(uname, true, &pendinginfo{Time: time.Now(), fqn: fqn}) {
@@ -1219,7 +1378,10 @@ func (t *targetrunner) coldget(ct context.Context, bucket, objname string, prefe
 		}
 	}
 	if !inNextTier || (inNextTier && errstr != "") {
-		if props, errstr, errcode = getcloudif().getobj(ct, getfqn, bucket, objname); errstr != "" {
+		cspan := span.child("cloud GET", spanKindClient)
+		props, errstr, errcode = getcloudif().getobj(withSpan(ct, cspan), getfqn, bucket, objname)
+		cspan.finish(errstr)
+		if errstr != "" {
 			t.rtnamemap.unlockname(uname, true)
 			return
 		}
@@ -1354,12 +1516,20 @@ func (t *targetrunner) prepareLocalObjectList(bucket string, msg *GetMsg) (*Buck
 		failedPath string
 	}
 
+	ls, err := newListSort(msg)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := newListFilter(msg)
+	if err != nil {
+		return nil, err
+	}
 	ch := make(chan *mresp, len(ctx.mountpaths.Available))
 	wg := &sync.WaitGroup{}
 
 	// function to traverse one mountpoint
 	walkMpath := func(dir string) {
-		r := &mresp{t.newFileWalk(bucket, msg), ""}
+		r := &mresp{t.newFileWalk(bucket, msg, ls, filter), ""}
 		if _, err := os.Stat(dir); err != nil {
 			if !os.IsNotExist(err) {
 				r.failedPath = dir
@@ -1413,20 +1583,24 @@ func (t *targetrunner) prepareLocalObjectList(bucket string, msg *GetMsg) (*Buck
 		fileCount += r.infos.fileCount
 	}
 
-	// sort the result and return only first `pageSize` entries
+	// sort the result - the proxy merges sorted lists from all targets
+	ls.sort(allfinfos)
+	// common prefixes are listed by each mountpath
+	if msg.GetDelimiter != "" {
+		allfinfos = uniqueEntries(allfinfos)
+		fileCount = len(allfinfos)
+	}
+
+	// return only first `pageSize` entries
 	marker := ""
 	if fileCount > pageSize {
-		ifLess := func(i, j int) bool {
-			return allfinfos[i].Name < allfinfos[j].Name
-		}
-		sort.Slice(allfinfos, ifLess)
 		// set extra infos to nil to avoid memory leaks
 		// see NOTE on https://github.com/golang/go/wiki/SliceTricks
 		for i := pageSize; i < fileCount; i++ {
 			allfinfos[i] = nil
 		}
 		allfinfos = allfinfos[:pageSize]
-		marker = allfinfos[pageSize-1].Name
+		marker = ls.marker(allfinfos[pageSize-1])
 	}
 
 	bucketList := &BucketList{
@@ -1521,7 +1695,18 @@ func (t *targetrunner) listbucket(w http.ResponseWriter, r *http.Request, bucket
 		jsbytes, errstr, errcode = t.listCachedObjects(bucket, msg)
 	} else {
 		tag = "cloud"
-		jsbytes, errstr, errcode = getcloudif().listbucket(t.contextWithAuth(r), bucket, msg)
+		filter, err := newListFilter(msg)
+		if err != nil {
+			t.invalmsghdlr(w, r, err.Error())
+			return
+		}
+		if filter == nil {
+			jsbytes, errstr, errcode = getcloudif().listbucket(t.contextWithAuth(r), bucket, msg)
+		} else if filter.hasTimes() {
+			errstr, errcode = errCloudTimeFilter(bucket), http.StatusBadRequest
+		} else {
+			jsbytes, errstr, errcode = t.listCloudFiltered(t.contextWithAuth(r), bucket, msg, filter)
+		}
 	}
 	if errstr != "" {
 		if errcode == 0 {
@@ -1535,10 +1720,11 @@ func (t *targetrunner) listbucket(w http.ResponseWriter, r *http.Request, bucket
 	return
 }
 
-func (t *targetrunner) newFileWalk(bucket string, msg *GetMsg) *allfinfos {
+func (t *targetrunner) newFileWalk(bucket string, msg *GetMsg, ls *listSort, filter *listFilter) *allfinfos {
 	// Marker is always a file name, so we need to strip filename from path
+	// (unless the list is sorted in some other order than the traversal)
 	markerDir := ""
-	if msg.GetPageMarker != "" {
+	if msg.GetPageMarker != "" && ls.walkOrder() {
 		markerDir = filepath.Dir(msg.GetPageMarker)
 	}
 
@@ -1554,12 +1740,22 @@ func (t *targetrunner) newFileWalk(bucket string, msg *GetMsg) *allfinfos {
 		strings.Contains(msg.GetProps, GetPropsCtime),    // needCtime
 		strings.Contains(msg.GetProps, GetPropsChecksum), // needChkSum
 		strings.Contains(msg.GetProps, GetPropsVersion),  // needVersion
-		msg,             // GetMsg
-		"",              // lastFilePath - next page marker
-		t,               // targetrunner
-		bucket,          // bucket
-		DefaultPageSize, // limit - maximun number of objects to return
-	}
+		msg,              // GetMsg
+		"",               // lastFilePath - next page marker
+		t,                // targetrunner
+		bucket,           // bucket
+		DefaultPageSize,  // limit - maximun number of objects to return
+		msg.GetDelimiter, // delimiter
+		nil,              // dirs
+		ls,               // sort
+		filter,           // filter
+	}
+	if msg.GetDelimiter != "" {
+		ci.dirs = make(map[string]struct{})
+	}
+	// sorting by time requires the time
+	ci.needAtime = ci.needAtime || ls.key == GetPropsAtime
+	ci.needCtime = ci.needCtime || ls.key == GetPropsCtime
 
 	if msg.GetPageSize != 0 {
 		ci.limit = msg.GetPageSize
@@ -1590,9 +1786,49 @@ func (ci *allfinfos) processDir(fqn string) error {
 		return filepath.SkipDir
 	}
 
+	// the entire directory collapses into a common prefix that has been already listed
+	if ci.delimiter != "" && strings.HasPrefix(relname, ci.prefix) {
+		if dir := commonPrefix(relname+string(filepath.Separator), ci.prefix, ci.delimiter); dir != "" {
+			if _, ok := ci.dirs[dir]; ok {
+				return filepath.SkipDir
+			}
+		}
+	}
+
 	return nil
 }
 
+// commonPrefix returns the name's prefix up to and including the first delimiter
+// that follows the listed prefix, or empty string if the name does not contain one
+func commonPrefix(name, prefix, delimiter string) string {
+	idx := strings.Index(name[len(prefix):], delimiter)
+	if idx < 0 {
+		return ""
+	}
+	return name[:len(prefix)+idx+len(delimiter)]
+}
+
+// uniqueEntries removes duplicate entries from the list sorted by name:
+// the same common prefix is listed by every mountpath (and every target) that stores
+// objects with this prefix
+func uniqueEntries(entries []*BucketEntry) []*BucketEntry {
+	if len(entries) < 2 {
+		return entries
+	}
+	j := 0
+	for i := 1; i < len(entries); i++ {
+		if entries[i].Name == entries[j].Name {
+			continue
+		}
+		j++
+		entries[j] = entries[i]
+	}
+	for i := j + 1; i < len(entries); i++ {
+		entries[i] = nil
+	}
+	return entries[:j+1]
+}
+
 // Adds an info about cached object to the list if:
 //  - its name starts with prefix (if prefix is set)
 //  - it has not been already returned by previous page request
@@ -1603,12 +1839,21 @@ func (ci *allfinfos) processRegularFile(fqn string, osfi os.FileInfo) error {
 		return nil
 	}
 
-	if ci.marker != "" && relname <= ci.marker {
+	// filter before grouping, so that only the common prefixes of the matching objects are listed
+	if ci.filter != nil && !ci.filter.match(relname, osfi) {
+		return nil
+	}
+
+	if ci.delimiter != "" {
+		if dir := commonPrefix(relname, ci.prefix, ci.delimiter); dir != "" {
+			return ci.processCommonPrefix(dir)
+		}
+	}
+
+	if ci.marker != "" && ci.sort.walkOrder() && relname <= ci.marker {
 		return nil
 	}
 
-	// the file passed all checks - add it to the batch
-	ci.fileCount++
 	fileInfo := &BucketEntry{Name: relname, Atime: "", IsCached: true}
 	if ci.needAtime {
 		atime, _, _ := getAmTimes(osfi)
@@ -1642,11 +1887,47 @@ func (ci *allfinfos) processRegularFile(fqn string, osfi os.FileInfo) error {
 		}
 	}
 	fileInfo.Size = osfi.Size()
-	ci.files = append(ci.files, fileInfo)
+	if !ci.sort.walkOrder() && !ci.sort.after(fileInfo) {
+		return nil
+	}
+
+	// the file passed all checks - add it to the batch
+	ci.add(fileInfo)
 	ci.lastFilePath = fqn
 	return nil
 }
 
+func (ci *allfinfos) add(entry *BucketEntry) {
+	ci.fileCount++
+	ci.files = append(ci.files, entry)
+	if ci.sort.walkOrder() || len(ci.files) < 2*ci.limit {
+		return
+	}
+	// the listing is sorted in some other order than the traversal:
+	// keep at most 'limit' (first) entries at the cost of sorting every so often
+	ci.sort.sort(ci.files)
+	for i := ci.limit; i < len(ci.files); i++ {
+		ci.files[i] = nil
+	}
+	ci.files = ci.files[:ci.limit]
+	ci.fileCount = ci.limit
+}
+
+// Adds a "directory" entry for the common prefix unless it has been already listed
+// (by this or by the previous page request)
+func (ci *allfinfos) processCommonPrefix(dir string) error {
+	if _, ok := ci.dirs[dir]; ok {
+		return nil
+	}
+	ci.dirs[dir] = struct{}{}
+	entry := &BucketEntry{Name: dir, Type: BucketEntryDirectory}
+	if !ci.sort.after(entry) {
+		return nil
+	}
+	ci.add(entry)
+	return nil
+}
+
 func (ci *allfinfos) listwalkf(fqn string, osfi os.FileInfo, err error) error {
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -1655,7 +1936,7 @@ func (ci *allfinfos) listwalkf(fqn string, osfi os.FileInfo, err error) error {
 		glog.Errorf("listwalkf callback invoked with err: %v", err)
 		return err
 	}
-	if ci.fileCount >= ci.limit {
+	if ci.fileCount >= ci.limit && ci.sort.walkOrder() {
 		return filepath.SkipDir
 	}
 	if osfi.IsDir() {
@@ -1726,7 +2007,11 @@ func (t *targetrunner) doput(w http.ResponseWriter, r *http.Request, bucket, obj
 			}
 		}
 	}
-	if sgl, nhobj, _, errstr = t.receive(putfqn, objname, "", hdhobj, r.Body); errstr != "" {
+	span := requestSpan(r)
+	rspan := span.child("receive")
+	sgl, nhobj, _, errstr = t.receive(putfqn, objname, "", hdhobj, r.Body)
+	rspan.finish(errstr)
+	if errstr != "" {
 		return
 	}
 	if nhobj != nil {
@@ -1741,7 +2026,9 @@ func (t *targetrunner) doput(w http.ResponseWriter, r *http.Request, bucket, obj
 	// commit
 	props := &objectProps{nhobj: nhobj}
 	if sgl == nil {
-		errstr, errcode = t.putCommit(t.contextWithAuth(r), bucket, objname, putfqn, fqn, props, false /*rebalance*/)
+		cspan := span.child("commit")
+		errstr, errcode = t.putCommit(withSpan(t.contextWithAuth(r), cspan), bucket, objname, putfqn, fqn, props, false /*rebalance*/)
+		cspan.finish(errstr)
 		if errstr == "" {
 			delta := time.Since(started)
 			t.statsdC.Send("put",
@@ -1843,6 +2130,7 @@ func (t *targetrunner) doPutCommit(ct context.Context, bucket, objname, putfqn,
 			errstr = fmt.Sprintf("Failed to reopen %s err: %v", putfqn, err)
 			return
 		}
+		span := spanFromContext(ct).child("cloud PUT", spanKindClient)
 		_, p := bucketmd.get(bucket, islocal)
 		if p.NextTierURL != "" && p.WritePolicy == RWPolicyNextTier {
 			if errstr, errcode = t.putObjectNextTier(p.NextTierURL, bucket, objname, file); errstr != "" {
@@ -1858,6 +2146,7 @@ func (t *targetrunner) doPutCommit(ct context.Context, bucket, objname, putfqn,
 		} else {
 			objprops.version, errstr, errcode = getcloudif().putobj(ct, file, bucket, objname, objprops.nhobj)
 		}
+		span.finish(errstr)
 	} else if islocal {
 		if t.versioningConfigured(bucket) {
 			if objprops.version, errstr = t.increaseObjectVersion(fqn); errstr != "" {
@@ -1883,6 +2172,14 @@ func (t *targetrunner) doPutCommit(ct context.Context, bucket, objname, putfqn,
 	uname := uniquename(bucket, objname)
 	t.rtnamemap.lockname(uname, true, &pendinginfo{Time: time.Now(), fqn: fqn}, time.Second)
 
+	if islocal && !rebalance {
+		if kept := t.versionsKept(bucket); kept > 0 {
+			if errstr = t.keepVersion(bucket, objname, fqn, kept); errstr != "" {
+				t.rtnamemap.unlockname(uname, true)
+				return
+			}
+		}
+	}
 	if err = os.Rename(putfqn, fqn); err != nil {
 		t.rtnamemap.unlockname(uname, true)
 		errstr = fmt.Sprintf("Failed to rename %s => %s, err: %v", putfqn, fqn, err)
@@ -2031,8 +2328,18 @@ func (t *targetrunner) fildelete(ct context.Context, bucket, objname string, evi
 	}
 	if !(evict && islocal) {
 		// Don't evict from a local bucket (this would be deletion)
-		if err := os.Remove(fqn); err != nil {
+		if islocal && ctx.config.Trash.Enabled {
+			// soft delete: the object and its version history stay until purged from trash
+			if errstr = t.trashObject(bucket, objname, fqn); errstr != "" {
+				return fmt.Errorf("%s", errstr)
+			}
+		} else if err := os.Remove(fqn); err != nil {
 			return err
+		} else if islocal {
+			// the object's version history goes with it
+			if err := os.RemoveAll(t.objVersionsDir(bucket, objname)); err != nil {
+				glog.Errorf("Failed to remove version history of %s/%s, err: %v", bucket, objname, err)
+			}
 		} else if evict {
 			t.statsdC.Send("evict",
 				statsd.Metric{
@@ -2193,7 +2500,7 @@ func (t *targetrunner) sendfile(method, bucket, objname string, destsi *daemonIn
 		newbucket = bucket
 	}
 	fromid, toid := t.si.DaemonID, destsi.DaemonID // source=self and destination
-	url := destsi.DirectURL + "/" + Rversion + "/" + Robjects + "/"
+	url := destsi.dataURL() + "/" + Rversion + "/" + Robjects + "/"
 	url += newbucket + "/" + newobjname
 	url += fmt.Sprintf("?%s=%s&%s=%s", URLParamFromID, fromid, URLParamToID, toid)
 	islocal := t.bmdowner.get().islocal(bucket)
@@ -2253,6 +2560,11 @@ func (t *targetrunner) sendfile(method, bucket, objname string, destsi *daemonIn
 		}
 		return errstr
 	}
+	if err = t.checkPeer(destsi, response); err != nil {
+		response.Body.Close()
+		return fmt.Sprintf("Failed to sendfile %s/%s at %s => %s/%s at %s, err: %v",
+			bucket, objname, fromid, newbucket, newobjname, toid, err)
+	}
 	if _, err = ioutil.ReadAll(response.Body); err != nil {
 		errstr = fmt.Sprintf("Failed to read sendfile response: %s/%s at %s => %s/%s at %s, err: %v",
 			bucket, objname, fromid, newbucket, newobjname, toid, err)
@@ -2383,6 +2695,12 @@ func (t *targetrunner) httpdaeput(w http.ResponseWriter, r *http.Request) {
 				lruxact.abort()
 			}
 		}
+	case ActAbortXact:
+		if _, err := t.getXactionKindFromProperties(msg.Name); err != nil {
+			t.invalmsghdlr(w, r, err.Error())
+		} else if n := t.xactinp.abortKind(msg.Name); n > 0 {
+			glog.Infof("Aborted %d %q xaction(s)", n, msg.Name)
+		}
 	case ActShutdown:
 		_ = syscall.Kill(syscall.Getpid(), syscall.SIGINT)
 	default:
@@ -2499,6 +2817,12 @@ func (t *targetrunner) getXactionStatsRetriever(kind string) XactionStatsRetriev
 		xactionStatsRetriever = RebalanceTargetStats{}
 	case XactionPrefetch:
 		xactionStatsRetriever = PrefetchTargetStats{}
+	case XactionCopyBucket:
+		xactionStatsRetriever = CopyBucketTargetStats{}
+	case XactionDsort:
+		xactionStatsRetriever = DsortTargetStats{}
+	case XactionRenamePrefix:
+		xactionStatsRetriever = RenamePrefixTargetStats{}
 	}
 
 	return xactionStatsRetriever
@@ -2967,8 +3291,8 @@ func (t *targetrunner) userFromRequest(r *http.Request) (*authRec, error) {
 	}
 
 	if token == "" {
-		// no token in header = use default credentials
-		return nil, nil
+		// no token in header: the redirect signed by the proxy, if any
+		return redirectAuth(r)
 	}
 
 	authrec, err := t.authn.validateToken(token)
@@ -2979,12 +3303,53 @@ func (t *targetrunner) userFromRequest(r *http.Request) (*authRec, error) {
 	return authrec, nil
 }
 
+// A wrapper to check the permissions of the requests: only the daemons of the
+// cluster are exempt from presenting a token (or the redirect signed by the proxy)
+func (t *targetrunner) checkHTTPAuth(h http.HandlerFunc) http.HandlerFunc {
+	wrappedFunc := func(w http.ResponseWriter, r *http.Request) {
+		if t.isPeerDaemon(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		checks, err := requestPerms(r)
+		if err != nil {
+			t.invalmsghdlr(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if checks == nil {
+			// not subject to authorization
+			h.ServeHTTP(w, r)
+			return
+		}
+		user, err := t.userFromRequest(r)
+		if err != nil || user == nil {
+			if err != nil {
+				glog.Error(err)
+			}
+			t.invalmsghdlr(w, r, "Not authorized", http.StatusUnauthorized)
+			return
+		}
+		for _, check := range checks {
+			if !user.allowed(check.bucket, check.perm) {
+				s := fmt.Sprintf("User %s (role %s) is not permitted to %s %s",
+					user.userID, user.role, r.Method, r.URL.Path)
+				t.invalmsghdlr(w, r, s, http.StatusForbidden)
+				return
+			}
+		}
+
+		h.ServeHTTP(w, r)
+	}
+
+	return wrappedFunc
+}
+
 // If Authn server is enabled then the function tries to read a user credentials
 // (at this moment userID is enough) from HTTP request header: looks for
 // 'Authorization' header and decrypts it.
 // Extracted user information is put to context that is passed to all consumers
 func (t *targetrunner) contextWithAuth(r *http.Request) context.Context {
-	ct := context.Background()
+	ct := withSpan(context.Background(), requestSpan(r))
 
 	if ctx.config.Auth.CredDir == "" || !ctx.config.Auth.Enabled {
 		return ct
@@ -3076,6 +3441,15 @@ func (t *targetrunner) receiveBucketMD(newbucketmd *bucketMD, msg *ActionMsg) (e
 				if err := os.RemoveAll(localbucketfqn); err != nil {
 					glog.Errorf("Failed to destroy local bucket dir %q, err: %v", localbucketfqn, err)
 				}
+				versionsfqn := filepath.Join(makePathVersions(mpath), bucket)
+				if err := os.RemoveAll(versionsfqn); err != nil {
+					glog.Errorf("Failed to destroy local bucket version history %q, err: %v", versionsfqn, err)
+				}
+				trashfqn := filepath.Join(makePathTrash(mpath), bucket)
+				if err := os.RemoveAll(trashfqn); err != nil {
+					glog.Errorf("Failed to destroy local bucket trash %q, err: %v", trashfqn, err)
+				}
+				removeInventories(mpath, bucket)
 			}
 		}
 	}
@@ -3215,6 +3589,11 @@ func (t *targetrunner) httpTokenDelete(w http.ResponseWriter, r *http.Request) {
 	if apitems = t.checkRestAPI(w, r, apitems, 0, Rversion, Rtokens); apitems == nil {
 		return
 	}
+	// the revoked tokens are broadcast by the primary proxy (see isIntraCluster)
+	if r.URL.Query().Get(URLParamFromID) == "" {
+		t.invalmsghdlr(w, r, "Revoked tokens must come from the primary proxy", http.StatusForbidden)
+		return
+	}
 
 	if err := t.readJSON(w, r, tokenList); err != nil {
 		s := fmt.Sprintf("Invalid token list: %v", err)
@@ -6,6 +6,8 @@ package dfc_test
 
 import (
 	"fmt"
+	"net/http"
+	"net/url"
 	"sync"
 	"testing"
 	"time"
@@ -465,3 +467,69 @@ func TestObjPropsVersionDisabled(t *testing.T) {
 
 	propsMainTest(t, dfc.VersionNone)
 }
+
+func TestObjectVersionHistory(t *testing.T) {
+	const (
+		objname  = "versionhistory_test_file"
+		numputs  = 4
+		kept     = 2
+		fileSize = 1024
+	)
+	err := client.CreateLocalBucket(proxyurl, TestLocalBucketName)
+	checkFatal(err, t)
+	defer func() {
+		checkFatal(client.DestroyLocalBucket(proxyurl, TestLocalBucketName), t)
+	}()
+	err = client.SetBucketProps(proxyurl, TestLocalBucketName, dfc.BucketProps{VersionsKept: kept})
+	checkFatal(err, t)
+
+	for i := 0; i < numputs; i++ {
+		r, err := readers.NewRandReader(int64(fileSize*(i+1)), true /* withHash */)
+		checkFatal(err, t)
+		err = client.Put(proxyurl, r, TestLocalBucketName, objname, true)
+		r.Close()
+		checkFatal(err, t)
+	}
+
+	versions, err := client.ListObjectVersions(proxyurl, TestLocalBucketName, objname)
+	checkFatal(err, t)
+	if len(versions.Entries) != kept+1 {
+		t.Fatalf("Expected %d versions (current + %d kept), got %d", kept+1, kept, len(versions.Entries))
+	}
+	for i, entry := range versions.Entries {
+		expected := fmt.Sprintf("%d", numputs-i)
+		if entry.Version != expected {
+			t.Errorf("Entry %d: expected version %s, got %s", i, expected, entry.Version)
+		}
+		if entry.Size != int64(fileSize*(numputs-i)) {
+			t.Errorf("Version %s: expected size %d, got %d", entry.Version, fileSize*(numputs-i), entry.Size)
+		}
+	}
+
+	q := url.Values{}
+	q.Add(dfc.URLParamVersion, "3")
+	n, _, err := client.GetWithQuery(proxyurl, TestLocalBucketName, objname, nil, nil, true, false, q)
+	checkFatal(err, t)
+	if n != int64(fileSize*3) {
+		t.Errorf("GET version 3: expected %d bytes, got %d", fileSize*3, n)
+	}
+	q.Set(dfc.URLParamVersion, "1")
+	if _, _, err = client.GetWithQuery(proxyurl, TestLocalBucketName, objname, nil, nil, true, false, q); err == nil {
+		t.Error("Expected GET of the trimmed version 1 to fail")
+	}
+	q.Set(dfc.URLParamVersion, "../"+objname+"~/3")
+	if _, _, err = client.GetWithQuery(proxyurl, TestLocalBucketName, objname, nil, nil, true, false, q); err == nil {
+		t.Error("Expected GET of the invalid version to fail")
+	}
+
+	// deleting the current version restores the previous one
+	delurl := proxyurl + dfc.URLPath(dfc.Rversion, dfc.Robjects, TestLocalBucketName, objname) +
+		"?" + dfc.URLParamVersion + "=4"
+	err = client.HTTPRequest(http.MethodDelete, delurl, nil)
+	checkFatal(err, t)
+	props, err := client.HeadObject(proxyurl, TestLocalBucketName, objname)
+	checkFatal(err, t)
+	if props.Version != "3" || props.Size != fileSize*3 {
+		t.Errorf("Expected version 3 (size %d) to be current, got %+v", fileSize*3, props)
+	}
+}
@@ -7,16 +7,21 @@
 package dfc_test
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	_ "net/http/pprof" // profile
 	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -325,6 +330,61 @@ func TestRenameLocalBuckets(t *testing.T) {
 	})
 }
 
+func TestCopyLocalBucket(t *testing.T) {
+	const numFiles = 20
+	var (
+		bucket       = TestLocalBucketName
+		copiedBucket = bucket + "_copy"
+		prefix       = "copybck/"
+	)
+	checkFatal(client.CreateLocalBucket(proxyurl, bucket), t)
+	defer func() {
+		checkFatal(client.DestroyLocalBucket(proxyurl, bucket), t)
+	}()
+	checkFatal(client.CreateLocalBucket(proxyurl, copiedBucket), t)
+	defer func() {
+		checkFatal(client.DestroyLocalBucket(proxyurl, copiedBucket), t)
+	}()
+
+	for i := 0; i < numFiles; i++ {
+		r, err := readers.NewRandReader(fileSize, true /* withHash */)
+		checkFatal(err, t)
+		err = client.Put(proxyurl, r, bucket, fmt.Sprintf("%s%d", prefix, i), true)
+		r.Close()
+		checkFatal(err, t)
+	}
+	if err := client.CopyBucket(proxyurl, bucket, bucket); err == nil {
+		t.Error("Expected copying the bucket onto itself to fail")
+	}
+	checkFatal(client.CopyBucket(proxyurl, bucket, copiedBucket), t)
+	waitForCopyBucketToComplete(t)
+
+	objs, err := client.ListObjects(proxyurl, copiedBucket, prefix, 0)
+	checkFatal(err, t)
+	if len(objs) != numFiles {
+		t.Errorf("Expected %d objects in the copied bucket, got %d", numFiles, len(objs))
+	}
+}
+
+func waitForCopyBucketToComplete(t *testing.T) {
+OUTER:
+	for {
+		time.Sleep(time.Second)
+		copyBucketStats, err := client.GetXactionCopyBucket(proxyurl)
+		if err != nil {
+			t.Fatalf("Unable to get copy bucket stats. Error: [%v]", err)
+		}
+		for _, targetStats := range copyBucketStats.TargetStats {
+			for _, xaction := range targetStats.Xactions {
+				if xaction.Status != dfc.XactionStatusCompleted {
+					continue OUTER
+				}
+			}
+		}
+		return
+	}
+}
+
 func TestListObjects(t *testing.T) {
 	var (
 		numFiles        = 20
@@ -510,6 +570,81 @@ func TestRenameObjects(t *testing.T) {
 	selectErr(errch, "get", t, false)
 }
 
+func TestCopyObject(t *testing.T) {
+	const (
+		objname    = "copy_test_file"
+		newobjname = "copy_test_file.copy"
+	)
+	err := client.CreateLocalBucket(proxyurl, TestLocalBucketName)
+	checkFatal(err, t)
+	defer func() {
+		checkFatal(client.DestroyLocalBucket(proxyurl, TestLocalBucketName), t)
+	}()
+
+	r, err := readers.NewRandReader(fileSize, true /* withHash */)
+	checkFatal(err, t)
+	err = client.Put(proxyurl, r, TestLocalBucketName, objname, true)
+	r.Close()
+	checkFatal(err, t)
+
+	if err = client.CopyObject(proxyurl, TestLocalBucketName, objname, "", ""); err == nil {
+		t.Error("Expected copying the object onto itself to fail")
+	}
+	checkFatal(client.CopyObject(proxyurl, TestLocalBucketName, objname, "", newobjname), t)
+
+	for _, name := range []string{objname, newobjname} {
+		props, err := client.HeadObject(proxyurl, TestLocalBucketName, name)
+		checkFatal(err, t)
+		if props.Size != fileSize {
+			t.Errorf("%s: expected size %d, got %d", name, fileSize, props.Size)
+		}
+		// validate the checksum of both the source and the copy
+		_, _, err = client.Get(proxyurl, TestLocalBucketName, name, nil, nil, true, true /* validate */)
+		checkFatal(err, t)
+	}
+}
+
+func TestRenamePrefix(t *testing.T) {
+	const (
+		numobjs   = 20
+		prefix    = "renprefix_test/old/"
+		newprefix = "renprefix_test/new/"
+	)
+	checkFatal(client.CreateLocalBucket(proxyurl, TestLocalBucketName), t)
+	defer func() {
+		checkFatal(client.DestroyLocalBucket(proxyurl, TestLocalBucketName), t)
+	}()
+
+	for i := 0; i < numobjs; i++ {
+		r, err := readers.NewRandReader(fileSize, true /* withHash */)
+		checkFatal(err, t)
+		err = client.Put(proxyurl, r, TestLocalBucketName, fmt.Sprintf("%s%04d", prefix, i), true)
+		r.Close()
+		checkFatal(err, t)
+	}
+
+	if err := client.RenamePrefix(proxyurl, TestLocalBucketName, prefix, prefix+"sub/"); err == nil {
+		t.Error("Expected renaming into an overlapping prefix to fail")
+	}
+	checkFatal(client.RenamePrefix(proxyurl, TestLocalBucketName, prefix, newprefix), t)
+	checkFatal(client.WaitRenamePrefix(proxyurl, 2*time.Minute), t)
+
+	oldnames, err := client.ListObjects(proxyurl, TestLocalBucketName, prefix, 0)
+	checkFatal(err, t)
+	if len(oldnames) != 0 {
+		t.Errorf("Expected no objects left with prefix %s, got %v", prefix, oldnames)
+	}
+	newnames, err := client.ListObjects(proxyurl, TestLocalBucketName, newprefix, 0)
+	checkFatal(err, t)
+	if len(newnames) != numobjs {
+		t.Fatalf("Expected %d objects with prefix %s, got %d", numobjs, newprefix, len(newnames))
+	}
+	for _, name := range newnames {
+		_, _, err = client.Get(proxyurl, TestLocalBucketName, name, nil, nil, true, true /* validate */)
+		checkFatal(err, t)
+	}
+}
+
 func TestObjectPrefix(t *testing.T) {
 	created := createLocalBucketIfNotExists(t, proxyurl, clibucket)
 
@@ -525,6 +660,504 @@ func TestObjectPrefix(t *testing.T) {
 	}
 }
 
+func TestListObjectsDelimiter(t *testing.T) {
+	var (
+		objnames = []string{"a/1", "a/2", "a/b/3", "b/4", "c", "d/e/5"}
+		tcs      = []struct {
+			prefix   string
+			expected []string
+		}{
+			{"", []string{"a/", "b/", "c", "d/"}},
+			{"a/", []string{"a/1", "a/2", "a/b/"}},
+			{"d/", []string{"d/e/"}},
+		}
+	)
+	err := client.CreateLocalBucket(proxyurl, TestLocalBucketName)
+	checkFatal(err, t)
+	defer func() {
+		checkFatal(client.DestroyLocalBucket(proxyurl, TestLocalBucketName), t)
+	}()
+
+	for _, objname := range objnames {
+		r, err := readers.NewRandReader(fileSize, true /* withHash */)
+		checkFatal(err, t)
+		err = client.Put(proxyurl, r, TestLocalBucketName, objname, true)
+		r.Close()
+		checkFatal(err, t)
+	}
+
+	for _, tc := range tcs {
+		// a small page to make sure common prefixes are not repeated across pages
+		msg := &dfc.GetMsg{GetPrefix: tc.prefix, GetDelimiter: "/", GetPageSize: 2}
+		reslist, err := client.ListBucket(proxyurl, TestLocalBucketName, msg, 0)
+		checkFatal(err, t)
+		names := make([]string, 0, len(reslist.Entries))
+		for _, entry := range reslist.Entries {
+			isdir := entry.Type == dfc.BucketEntryDirectory
+			if isdir != strings.HasSuffix(entry.Name, "/") {
+				t.Errorf("prefix %q: unexpected type %q of %s", tc.prefix, entry.Type, entry.Name)
+			}
+			names = append(names, entry.Name)
+		}
+		if !reflect.DeepEqual(names, tc.expected) {
+			t.Errorf("prefix %q: expected %v, got %v", tc.prefix, tc.expected, names)
+		}
+	}
+}
+
+func TestListObjectsSorted(t *testing.T) {
+	const numfiles = 10
+	err := client.CreateLocalBucket(proxyurl, TestLocalBucketName)
+	checkFatal(err, t)
+	defer func() {
+		checkFatal(client.DestroyLocalBucket(proxyurl, TestLocalBucketName), t)
+	}()
+
+	for i := 0; i < numfiles; i++ {
+		r, err := readers.NewRandReader(int64(i+1)*1024, true /* withHash */)
+		checkFatal(err, t)
+		err = client.Put(proxyurl, r, TestLocalBucketName, fmt.Sprintf("sorted/%02d", numfiles-i), true)
+		r.Close()
+		checkFatal(err, t)
+	}
+
+	// multiple pages merged from all targets must keep the order
+	msg := &dfc.GetMsg{GetSort: dfc.GetSortDes + ", " + dfc.GetPropsSize, GetPageSize: 3}
+	reslist, err := client.ListBucket(proxyurl, TestLocalBucketName, msg, 0)
+	checkFatal(err, t)
+	if len(reslist.Entries) != numfiles {
+		t.Fatalf("Expected %d objects, got %d", numfiles, len(reslist.Entries))
+	}
+	for i, entry := range reslist.Entries {
+		// the largest object has the smallest name
+		if exp := fmt.Sprintf("sorted/%02d", i+1); entry.Name != exp {
+			t.Errorf("Expected %s at position %d, got %s (size %d)", exp, i, entry.Name, entry.Size)
+		}
+	}
+}
+
+func TestListObjectsFiltered(t *testing.T) {
+	const numfiles = 10
+	err := client.CreateLocalBucket(proxyurl, TestLocalBucketName)
+	checkFatal(err, t)
+	defer func() {
+		checkFatal(client.DestroyLocalBucket(proxyurl, TestLocalBucketName), t)
+	}()
+
+	for i := 0; i < numfiles; i++ {
+		r, err := readers.NewRandReader(int64(i+1)*1024, true /* withHash */)
+		checkFatal(err, t)
+		err = client.Put(proxyurl, r, TestLocalBucketName, fmt.Sprintf("filtered/%02d", i+1), true)
+		r.Close()
+		checkFatal(err, t)
+	}
+
+	// even numbers not larger than 6K: 02, 04, 06
+	msg := &dfc.GetMsg{GetRegex: `[02468]$`, GetMaxSize: 6 * 1024}
+	reslist, err := client.ListBucket(proxyurl, TestLocalBucketName, msg, 0)
+	checkFatal(err, t)
+	names := make([]string, 0, len(reslist.Entries))
+	for _, entry := range reslist.Entries {
+		names = append(names, entry.Name)
+	}
+	if expected := []string{"filtered/02", "filtered/04", "filtered/06"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+
+	// nothing has been modified in the future
+	msg = &dfc.GetMsg{GetCtimeAfter: time.Now().Add(time.Hour).Format(time.RFC3339)}
+	reslist, err = client.ListBucket(proxyurl, TestLocalBucketName, msg, 0)
+	checkFatal(err, t)
+	if len(reslist.Entries) != 0 {
+		t.Errorf("Expected empty list, got %d objects", len(reslist.Entries))
+	}
+
+	msg = &dfc.GetMsg{GetRegex: "("}
+	if _, err = client.ListBucket(proxyurl, TestLocalBucketName, msg, 0); err == nil {
+		t.Error("Expected listing with invalid regex to fail")
+	}
+}
+
+func TestBucketInventory(t *testing.T) {
+	const (
+		numfiles     = 10
+		inventoryObj = "inventory/snapshot.jsonl.gz"
+	)
+	err := client.CreateLocalBucket(proxyurl, TestLocalBucketName)
+	checkFatal(err, t)
+	defer func() {
+		checkFatal(client.DestroyLocalBucket(proxyurl, TestLocalBucketName), t)
+	}()
+
+	for i := 0; i < numfiles; i++ {
+		r, err := readers.NewRandReader(fileSize, true /* withHash */)
+		checkFatal(err, t)
+		err = client.Put(proxyurl, r, TestLocalBucketName, fmt.Sprintf("inventory_test/%02d", i), true)
+		r.Close()
+		checkFatal(err, t)
+	}
+
+	imsg := &dfc.InventoryMsg{Format: dfc.InventoryFormatJSONL, Bucket: TestLocalBucketName, Objname: inventoryObj}
+	checkFatal(client.Inventory(proxyurl, TestLocalBucketName, imsg), t)
+	b, err := client.GetInventory(proxyurl, TestLocalBucketName, dfc.InventoryFormatJSONL)
+	checkFatal(err, t)
+	dec := json.NewDecoder(bytes.NewReader(b))
+	found := 0
+	for dec.More() {
+		entry := &dfc.InventoryEntry{}
+		checkFatal(dec.Decode(entry), t)
+		if entry.Size != fileSize || entry.Atime == "" {
+			t.Errorf("Unexpected inventory entry %+v", entry)
+		}
+		found++
+	}
+	if found != numfiles {
+		t.Errorf("Expected %d objects in the inventory, got %d", numfiles, found)
+	}
+	if _, err = client.HeadObject(proxyurl, TestLocalBucketName, inventoryObj); err != nil {
+		t.Errorf("Inventory was not stored as %s/%s: %v", TestLocalBucketName, inventoryObj, err)
+	}
+
+	// CSV: header followed by the objects (the stored inventory included)
+	checkFatal(client.Inventory(proxyurl, TestLocalBucketName, &dfc.InventoryMsg{Format: dfc.InventoryFormatCSV}), t)
+	b, err = client.GetInventory(proxyurl, TestLocalBucketName, dfc.InventoryFormatCSV)
+	checkFatal(err, t)
+	if lines := strings.Split(strings.TrimSpace(string(b)), "\n"); len(lines) != numfiles+2 {
+		t.Errorf("Expected %d CSV lines, got %d", numfiles+2, len(lines))
+	}
+}
+
+func TestBatchGet(t *testing.T) {
+	const (
+		numfiles = 10
+		prefix   = "batchget_test/"
+	)
+	err := client.CreateLocalBucket(proxyurl, TestLocalBucketName)
+	checkFatal(err, t)
+	defer func() {
+		checkFatal(client.DestroyLocalBucket(proxyurl, TestLocalBucketName), t)
+	}()
+
+	objnames := make([]string, 0, numfiles)
+	for i := 0; i < numfiles; i++ {
+		r, err := readers.NewRandReader(fileSize, true /* withHash */)
+		checkFatal(err, t)
+		objname := fmt.Sprintf("%s%02d", prefix, i)
+		err = client.Put(proxyurl, r, TestLocalBucketName, objname, true)
+		r.Close()
+		checkFatal(err, t)
+		objnames = append(objnames, objname)
+	}
+
+	// list, in the requested order, skipping the missing object
+	list := []string{objnames[7], objnames[2], prefix + "missing", objnames[9], objnames[0]}
+	buf := &bytes.Buffer{}
+	err = client.GetBatchList(proxyurl, TestLocalBucketName, list, &dfc.BatchGetMsg{Missing: dfc.BatchMissingSkip}, buf)
+	checkFatal(err, t)
+	names := make([]string, 0, len(list))
+	tr := tar.NewReader(buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		checkFatal(err, t)
+		if hdr.Size != fileSize {
+			t.Errorf("%s: expected size %d, got %d", hdr.Name, fileSize, hdr.Size)
+		}
+		names = append(names, hdr.Name)
+	}
+	if exp := []string{objnames[7], objnames[2], objnames[9], objnames[0]}; !reflect.DeepEqual(names, exp) {
+		t.Errorf("Expected %v, got %v", exp, names)
+	}
+
+	// missing objects fail the request by default
+	err = client.GetBatchList(proxyurl, TestLocalBucketName, list, nil, ioutil.Discard)
+	if err == nil {
+		t.Error("Expected batch GET of a missing object to fail")
+	}
+
+	// range as zip, sorted by name
+	buf.Reset()
+	err = client.GetBatchRange(proxyurl, TestLocalBucketName, prefix, "\\d+", "3:6", &dfc.BatchGetMsg{Format: dfc.BatchFormatZip}, buf)
+	checkFatal(err, t)
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	checkFatal(err, t)
+	names = names[:0]
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	if exp := objnames[3:7]; !reflect.DeepEqual(names, exp) {
+		t.Errorf("Expected %v, got %v", exp, names)
+	}
+}
+
+func TestPutArchive(t *testing.T) {
+	const (
+		numfiles = 10
+		prefix   = "extract_test/"
+	)
+	err := client.CreateLocalBucket(proxyurl, TestLocalBucketName)
+	checkFatal(err, t)
+	defer func() {
+		checkFatal(client.DestroyLocalBucket(proxyurl, TestLocalBucketName), t)
+	}()
+
+	// tar with a directory, regular files, and a member that cannot be extracted
+	fn := filepath.Join(LocalDestDir, "extract_test.tar")
+	checkFatal(os.MkdirAll(LocalDestDir, 0755), t)
+	defer os.Remove(fn)
+	f, err := os.Create(fn)
+	checkFatal(err, t)
+	tw := tar.NewWriter(f)
+	checkFatal(tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: "dir/", Mode: 0755}), t)
+	for i := 0; i < numfiles; i++ {
+		content := []byte(fmt.Sprintf("content of member %d", i))
+		hdr := &tar.Header{Typeflag: tar.TypeReg, Name: fmt.Sprintf("dir/%02d", i), Mode: 0644, Size: int64(len(content))}
+		checkFatal(tw.WriteHeader(hdr), t)
+		_, err = tw.Write(content)
+		checkFatal(err, t)
+	}
+	checkFatal(tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "../escape", Mode: 0644}), t)
+	checkFatal(tw.Close(), t)
+	checkFatal(f.Close(), t)
+
+	r, err := readers.NewFileReaderFromFile(fn, false /* withHash */)
+	checkFatal(err, t)
+	result, err := client.PutArchive(proxyurl, r, TestLocalBucketName, "extract_test.tar", prefix)
+	checkFatal(err, t)
+	if result.Objects != numfiles || len(result.Errors) != 1 || result.Errors[0].Name != "../escape" {
+		t.Errorf("Unexpected extraction result %+v", result)
+	}
+	objs, err := client.ListObjects(proxyurl, TestLocalBucketName, prefix, 0)
+	checkFatal(err, t)
+	if len(objs) != numfiles {
+		t.Errorf("Expected %d extracted objects, got %d: %v", numfiles, len(objs), objs)
+	}
+	props, err := client.HeadObject(proxyurl, TestLocalBucketName, prefix+"dir/03")
+	checkFatal(err, t)
+	if props.Size != len("content of member 3") {
+		t.Errorf("Unexpected size of %sdir/03: %d", prefix, props.Size)
+	}
+}
+
+func TestDsort(t *testing.T) {
+	const (
+		numshards  = 4
+		numrecords = 10 // per input shard
+		prefix     = "dsort_test/"
+		outprefix  = "sorted-"
+	)
+	outbucket := TestLocalBucketName + "-dsort"
+	checkFatal(client.CreateLocalBucket(proxyurl, TestLocalBucketName), t)
+	defer func() {
+		checkFatal(client.DestroyLocalBucket(proxyurl, TestLocalBucketName), t)
+	}()
+	checkFatal(client.CreateLocalBucket(proxyurl, outbucket), t)
+	defer func() {
+		checkFatal(client.DestroyLocalBucket(proxyurl, outbucket), t)
+	}()
+
+	// input shards with interleaved keys, two members per record
+	checkFatal(os.MkdirAll(LocalDestDir, 0755), t)
+	for s := 0; s < numshards; s++ {
+		fn := filepath.Join(LocalDestDir, fmt.Sprintf("dsort_test_%d.tar", s))
+		f, err := os.Create(fn)
+		checkFatal(err, t)
+		tw := tar.NewWriter(f)
+		for i := 0; i < numrecords; i++ {
+			key := fmt.Sprintf("%04d", i*numshards+s)
+			for _, ext := range []string{".txt", ".cls"} {
+				content := []byte(key + ext)
+				checkFatal(tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: key + ext, Mode: 0644, Size: int64(len(content))}), t)
+				_, err = tw.Write(content)
+				checkFatal(err, t)
+			}
+		}
+		checkFatal(tw.Close(), t)
+		checkFatal(f.Close(), t)
+		r, err := readers.NewFileReaderFromFile(fn, false /* withHash */)
+		checkFatal(err, t)
+		err = client.Put(proxyurl, r, TestLocalBucketName, fmt.Sprintf("%sshard-%d.tar", prefix, s), true)
+		r.Close()
+		os.Remove(fn)
+		checkFatal(err, t)
+	}
+
+	// each record takes 2 x (512-byte header + 512-byte padded data) - two records per output shard
+	dmsg := &dfc.DsortMsg{Prefix: prefix, OutputBucket: outbucket, OutputPrefix: outprefix, ShardSize: 4096}
+	checkFatal(client.Dsort(proxyurl, TestLocalBucketName, dmsg), t)
+	deadline := time.Now().Add(2 * time.Minute)
+	for done := false; !done; {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for dsort to finish")
+		}
+		time.Sleep(time.Second)
+		stats, err := client.GetXactionDsort(proxyurl)
+		checkFatal(err, t)
+		done = true
+		for tid, ts := range stats.TargetStats {
+			if ts.Phase == dfc.DsortPhaseAborted {
+				t.Fatalf("Dsort aborted on %s: %s", tid, ts.Error)
+			}
+			if ts.Phase != dfc.DsortPhaseFinished {
+				done = false
+			}
+		}
+	}
+
+	outnames, err := client.ListObjects(proxyurl, outbucket, outprefix, 0)
+	checkFatal(err, t)
+	if exp := numshards * numrecords / 2; len(outnames) != exp {
+		t.Fatalf("Expected %d output shards, got %d: %v", exp, len(outnames), outnames)
+	}
+	sort.Strings(outnames)
+	buf := &bytes.Buffer{}
+	checkFatal(client.GetBatchList(proxyurl, outbucket, outnames, nil, buf), t)
+	names := make([]string, 0, numshards*numrecords*2)
+	tr := tar.NewReader(buf)
+	for {
+		_, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		checkFatal(err, t)
+		shardtr := tar.NewReader(tr)
+		for {
+			hdr, err := shardtr.Next()
+			if err == io.EOF {
+				break
+			}
+			checkFatal(err, t)
+			names = append(names, hdr.Name)
+		}
+	}
+	if len(names) != numshards*numrecords*2 {
+		t.Fatalf("Expected %d members in the output shards, got %d", numshards*numrecords*2, len(names))
+	}
+	for i := 0; i < len(names); i += 2 {
+		key := fmt.Sprintf("%04d", i/2)
+		if (names[i] != key+".txt" && names[i] != key+".cls") || names[i][:4] != names[i+1][:4] {
+			t.Errorf("Unexpected record #%d in the output shards: %s, %s", i/2, names[i], names[i+1])
+		}
+	}
+}
+
+// TestTransform requires the "uppercase" transformer (see setup/config.sh)
+func TestTransform(t *testing.T) {
+	const (
+		objname       = "transform_test/obj"
+		content       = "hello, transformer"
+		tname         = "uppercase"
+		exp           = "HELLO, TRANSFORMER"
+		bucketdefault = "" // the transformer bound to the bucket, if any
+	)
+	checkFatal(client.CreateLocalBucket(proxyurl, TestLocalBucketName), t)
+	defer func() {
+		checkFatal(client.DestroyLocalBucket(proxyurl, TestLocalBucketName), t)
+	}()
+	checkFatal(os.MkdirAll(LocalDestDir, 0755), t)
+	fn := filepath.Join(LocalDestDir, "transform_test")
+	checkFatal(ioutil.WriteFile(fn, []byte(content), 0644), t)
+	defer os.Remove(fn)
+	r, err := readers.NewFileReaderFromFile(fn, false /* withHash */)
+	checkFatal(err, t)
+	err = client.Put(proxyurl, r, TestLocalBucketName, objname, true)
+	r.Close()
+	checkFatal(err, t)
+
+	get := func(transform string) string {
+		q := url.Values{}
+		if transform != bucketdefault {
+			q.Set(dfc.URLParamTransform, transform)
+		}
+		buf := &bytes.Buffer{}
+		_, _, err := client.GetFileWithQuery(proxyurl, TestLocalBucketName, objname, nil, nil, true, false, buf, q)
+		checkFatal(err, t)
+		return buf.String()
+	}
+	// per GET, twice: the second time from the transformer's cache
+	for i := 0; i < 2; i++ {
+		if s := get(tname); s != exp {
+			t.Errorf("Expected %q, got %q", exp, s)
+		}
+	}
+	if s := get(bucketdefault); s != content {
+		t.Errorf("Expected %q, got %q", content, s)
+	}
+
+	// bound to the bucket
+	checkFatal(client.SetBucketProps(proxyurl, TestLocalBucketName, dfc.BucketProps{Transform: tname}), t)
+	if s := get(bucketdefault); s != exp {
+		t.Errorf("Expected %q, got %q", exp, s)
+	}
+	if s := get(dfc.TransformNone); s != content {
+		t.Errorf("Expected %q, got %q", content, s)
+	}
+	if err = client.SetBucketProps(proxyurl, TestLocalBucketName, dfc.BucketProps{Transform: "nosuchtransformer"}); err == nil {
+		t.Error("Expected setting an unknown transformer to fail")
+	}
+}
+
+func TestAppendCompose(t *testing.T) {
+	const dir = "compose_test/"
+	checkFatal(client.CreateLocalBucket(proxyurl, TestLocalBucketName), t)
+	defer func() {
+		checkFatal(client.DestroyLocalBucket(proxyurl, TestLocalBucketName), t)
+	}()
+	checkFatal(os.MkdirAll(LocalDestDir, 0755), t)
+	fn := filepath.Join(LocalDestDir, "compose_test")
+	defer os.Remove(fn)
+	reader := func(content string) client.Reader {
+		checkFatal(ioutil.WriteFile(fn, []byte(content), 0644), t)
+		r, err := readers.NewFileReaderFromFile(fn, false /* withHash */)
+		checkFatal(err, t)
+		return r
+	}
+	get := func(objname string) string {
+		buf := &bytes.Buffer{}
+		_, _, err := client.GetFileWithQuery(proxyurl, TestLocalBucketName, objname, nil, nil, true, true, buf, nil)
+		checkFatal(err, t)
+		return buf.String()
+	}
+
+	// append, including to a non-existing object
+	for _, s := range []string{"line1\n", "line2\n", "line3\n"} {
+		r := reader(s)
+		err := client.Append(proxyurl, r, TestLocalBucketName, dir+"log")
+		r.Close()
+		checkFatal(err, t)
+	}
+	if s, exp := get(dir+"log"), "line1\nline2\nline3\n"; s != exp {
+		t.Errorf("Expected %q, got %q", exp, s)
+	}
+
+	// compose the parts (most likely stored by different targets)
+	var srcs []string
+	for i, s := range []string{"part0-", "part1-", "part2"} {
+		srcs = append(srcs, fmt.Sprintf("%spart%d", dir, i))
+		r := reader(s)
+		err := client.Put(proxyurl, r, TestLocalBucketName, srcs[i], true)
+		r.Close()
+		checkFatal(err, t)
+	}
+	checkFatal(client.Compose(proxyurl, TestLocalBucketName, dir+"all", srcs), t)
+	if s, exp := get(dir+"all"), "part0-part1-part2"; s != exp {
+		t.Errorf("Expected %q, got %q", exp, s)
+	}
+	// the destination is one of the sources
+	checkFatal(client.Compose(proxyurl, TestLocalBucketName, srcs[0], []string{srcs[0], dir + "log"}), t)
+	if s, exp := get(srcs[0]), "part0-line1\nline2\nline3\n"; s != exp {
+		t.Errorf("Expected %q, got %q", exp, s)
+	}
+	if err := client.Compose(proxyurl, TestLocalBucketName, dir+"all", []string{srcs[1], dir + "nosuchobject"}); err == nil {
+		t.Error("Expected composing a non-existing object to fail")
+	}
+	if s, exp := get(dir+"all"), "part0-part1-part2"; s != exp {
+		t.Errorf("Expected %q (unchanged by the failed compose), got %q", exp, s)
+	}
+}
+
 func TestObjectsVersions(t *testing.T) {
 	propsMainTest(t, dfc.VersionAll)
 }
@@ -1016,6 +1649,52 @@ func TestDeleteList(t *testing.T) {
 	}
 }
 
+func TestSoftDeleteUndelete(t *testing.T) {
+	var (
+		prefix = ListRangeStr + "/soft-"
+		files  = make([]string, 0)
+	)
+	oconfig := getConfig(proxyurl+"/"+dfc.Rversion+"/"+dfc.Rdaemon, httpclient, t)
+	otrashconfig := oconfig["trash"].(map[string]interface{})
+	setConfig("soft_delete_enabled", "true", proxyurl+"/"+dfc.Rversion+"/"+dfc.Rcluster, httpclient, t)
+	defer setConfig("soft_delete_enabled", fmt.Sprint(otrashconfig["soft_delete_enabled"]),
+		proxyurl+"/"+dfc.Rversion+"/"+dfc.Rcluster, httpclient, t)
+
+	err := client.CreateLocalBucket(proxyurl, TestLocalBucketName)
+	checkFatal(err, t)
+	defer func() {
+		checkFatal(client.DestroyLocalBucket(proxyurl, TestLocalBucketName), t)
+	}()
+
+	for i := 0; i < 4; i++ {
+		r, err := readers.NewRandReader(fileSize, true /* withHash */)
+		checkFatal(err, t)
+		keyname := fmt.Sprintf("%s%d", prefix, i)
+		err = client.Put(proxyurl, r, TestLocalBucketName, keyname, true)
+		r.Close()
+		checkFatal(err, t)
+		files = append(files, keyname)
+	}
+	checkFatal(client.DeleteList(proxyurl, TestLocalBucketName, files, true, 0), t)
+	objs, err := client.ListObjects(proxyurl, TestLocalBucketName, prefix, 0)
+	checkFatal(err, t)
+	if len(objs) != 0 {
+		t.Fatalf("Expected all objects to be deleted, %d remain", len(objs))
+	}
+
+	// undelete: a single object, then the rest with a range
+	checkFatal(client.UndeleteObject(proxyurl, TestLocalBucketName, files[0]), t)
+	if err = client.UndeleteObject(proxyurl, TestLocalBucketName, files[0]); err == nil {
+		t.Error("Expected the second undelete of the same object to fail")
+	}
+	checkFatal(client.UndeleteRange(proxyurl, TestLocalBucketName, prefix, "\\d+$", "1:3", true, 0), t)
+	objs, err = client.ListObjects(proxyurl, TestLocalBucketName, prefix, 0)
+	checkFatal(err, t)
+	if len(objs) != len(files) {
+		t.Errorf("Expected %d objects after undelete, got %d", len(files), len(objs))
+	}
+}
+
 func TestPrefetchRange(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping test in short mode.")
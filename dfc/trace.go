@@ -0,0 +1,517 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// Distributed request tracing (config: trace.tracing_enabled)
+//
+// A trace follows a client request through the cluster. The daemon that receives
+// the request continues the client's trace (W3C trace context, the "traceparent"
+// header) or starts a new one, and passes it on: to the target the client is
+// redirected to - via the redirect URL (URLParamTraceParent), and to the daemons
+// it calls - via the "traceparent" header (httprunner.call, getFromNeighbor).
+// Each daemon records a server span per request and child spans for the major
+// phases of object GET and PUT: neighbor GET, version and checksum validation,
+// cold GET and the cloud call, receive, commit, send.
+//
+// The tracer runner exports the spans to a local JSON-lines file and/or to an
+// OTLP/HTTP (JSON) collector. The trace ID is returned to the client in
+// HeaderDfcTraceID and is included in error responses and error logs.
+
+const (
+	traceFlushTime = time.Second // max time a span waits to be exported
+	traceBatchSize = 256         // max number of spans per export
+	traceChanSize  = 4096        // spans that do not fit are dropped (and counted)
+)
+
+// span kinds, as per OTLP
+const (
+	spanKindInternal = "internal"
+	spanKindServer   = "server"
+	spanKindClient   = "client"
+)
+
+const ctxTraceSpan contextID = "traceSpan" // a field of a context that contains the current span
+
+type (
+	traceSpan struct {
+		TraceID  string            `json:"trace_id"`
+		SpanID   string            `json:"span_id"`
+		ParentID string            `json:"parent_id,omitempty"`
+		Name     string            `json:"name"`
+		Kind     string            `json:"kind"`
+		Daemon   string            `json:"daemon"`
+		Start    time.Time         `json:"start"`
+		End      time.Time         `json:"end"`
+		Attrs    map[string]string `json:"attrs,omitempty"`
+		Error    string            `json:"error,omitempty"`
+		tracer   *tracer
+	}
+	tracer struct {
+		namedrunner
+		daemonID     string
+		spanch       chan *traceSpan
+		chstop       chan struct{}
+		file         *os.File
+		collectorURL string
+		client       *http.Client
+		dropped      int64
+	}
+	// traceWriter records the status of the response and adds the trace
+	// context to the redirect location
+	traceWriter struct {
+		http.ResponseWriter
+		span   *traceSpan
+		status int
+	}
+)
+
+//
+// W3C trace context: traceparent = version "-" trace-id "-" parent-id "-" trace-flags
+//
+
+func newTraceID() string { return randomHex(16) }
+func newSpanID() string  { return randomHex(8) }
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		glog.Errorf("Failed to generate trace ID, err: %v", err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// parseTraceparent returns empty strings if the traceparent is missing or invalid
+func parseTraceparent(traceparent string) (traceID, parentID string) {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || !isTraceHex(parts[0], 2) || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return
+	}
+	if !isTraceHex(parts[1], 32) || !isTraceHex(parts[2], 16) || !isTraceHex(parts[3], 2) {
+		return
+	}
+	if strings.Trim(parts[1], "0") == "" || strings.Trim(parts[2], "0") == "" {
+		return
+	}
+	return parts[1], parts[2]
+}
+
+func isTraceHex(s string, l int) bool {
+	if len(s) != l {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+//
+// spans
+//
+
+func withSpan(ct context.Context, span *traceSpan) context.Context {
+	if span == nil {
+		return ct
+	}
+	return context.WithValue(ct, ctxTraceSpan, span)
+}
+
+func spanFromContext(ct context.Context) *traceSpan {
+	if ct == nil {
+		return nil
+	}
+	span, _ := ct.Value(ctxTraceSpan).(*traceSpan)
+	return span
+}
+
+// requestSpan returns the server span of the request, nil if the request is not traced
+func requestSpan(r *http.Request) *traceSpan {
+	if r == nil {
+		return nil
+	}
+	return spanFromContext(r.Context())
+}
+
+func (t *tracer) newSpan(traceID, parentID, name, kind string) *traceSpan {
+	return &traceSpan{
+		TraceID:  traceID,
+		SpanID:   newSpanID(),
+		ParentID: parentID,
+		Name:     name,
+		Kind:     kind,
+		Daemon:   t.daemonID,
+		Start:    time.Now(),
+		tracer:   t,
+	}
+}
+
+// child starts a new span within the span; all span methods are no-ops on nil
+// (untraced) spans, so that the callers do not have to check
+func (s *traceSpan) child(name string, kind ...string) *traceSpan {
+	if s == nil {
+		return nil
+	}
+	k := spanKindInternal
+	if len(kind) > 0 {
+		k = kind[0]
+	}
+	return s.tracer.newSpan(s.TraceID, s.SpanID, name, k)
+}
+
+func (s *traceSpan) setAttr(key, value string) {
+	if s == nil {
+		return
+	}
+	if s.Attrs == nil {
+		s.Attrs = make(map[string]string, 4)
+	}
+	s.Attrs[key] = value
+}
+
+func (s *traceSpan) traceparent() string {
+	return "00-" + s.TraceID + "-" + s.SpanID + "-01"
+}
+
+// inject passes the trace context on to the outgoing request
+func (s *traceSpan) inject(r *http.Request) {
+	if s == nil {
+		return
+	}
+	r.Header.Set(HeaderTraceParent, s.traceparent())
+}
+
+// finish ends the span and hands it over to the tracer; errstr (if any) is the phase's error
+func (s *traceSpan) finish(errstr string) {
+	if s == nil {
+		return
+	}
+	s.End = time.Now()
+	if errstr != "" {
+		s.Error = errstr
+	}
+	s.tracer.export(s)
+}
+
+//
+// tracer runner
+//
+
+func newTracer(daemonID string) (*tracer, error) {
+	conf := &ctx.config.Trace
+	t := &tracer{
+		daemonID:     daemonID,
+		spanch:       make(chan *traceSpan, traceChanSize),
+		chstop:       make(chan struct{}, 4),
+		collectorURL: conf.CollectorURL,
+		client:       &http.Client{Timeout: ctx.config.Timeout.Default},
+	}
+	fqn := conf.File
+	if fqn == "" && conf.CollectorURL == "" {
+		fqn = filepath.Join(ctx.config.Log.Dir, "trace.jsonl")
+	}
+	if fqn != "" {
+		if err := CreateDir(filepath.Dir(fqn)); err != nil {
+			return nil, fmt.Errorf("Failed to create trace dir %q, err: %v", filepath.Dir(fqn), err)
+		}
+		file, err := os.OpenFile(fqn, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to open trace file %q, err: %v", fqn, err)
+		}
+		t.file = file
+	}
+	return t, nil
+}
+
+func (t *tracer) run() error {
+	glog.Infof("Starting %s", t.name)
+	ticker := time.NewTicker(traceFlushTime)
+	batch := make([]*traceSpan, 0, traceBatchSize)
+loop:
+	for {
+		select {
+		case span := <-t.spanch:
+			if batch = append(batch, span); len(batch) >= traceBatchSize {
+				t.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				t.flush(batch)
+				batch = batch[:0]
+			}
+			if dropped := atomic.SwapInt64(&t.dropped, 0); dropped > 0 {
+				glog.Warningf("%s: dropped %d spans", t.name, dropped)
+			}
+		case <-t.chstop:
+			ticker.Stop()
+			break loop
+		}
+	}
+	// export what's left
+	for n := len(t.spanch); n > 0; n-- {
+		batch = append(batch, <-t.spanch)
+	}
+	if len(batch) > 0 {
+		t.flush(batch)
+	}
+	if t.file != nil {
+		t.file.Close()
+	}
+	return nil
+}
+
+func (t *tracer) stop(err error) {
+	glog.Infof("Stopping %s, err: %v", t.name, err)
+	var v struct{}
+	t.chstop <- v
+	close(t.chstop)
+}
+
+// export never blocks the request
+func (t *tracer) export(span *traceSpan) {
+	select {
+	case t.spanch <- span:
+	default:
+		atomic.AddInt64(&t.dropped, 1)
+	}
+}
+
+func (t *tracer) flush(batch []*traceSpan) {
+	if t.file != nil {
+		if err := t.writeFile(batch); err != nil {
+			glog.Errorf("Failed to write %d spans, err: %v", len(batch), err)
+		}
+	}
+	if t.collectorURL != "" {
+		if err := t.sendCollector(batch); err != nil {
+			glog.Errorf("Failed to send %d spans to %s, err: %v", len(batch), t.collectorURL, err)
+		}
+	}
+}
+
+func (t *tracer) writeFile(batch []*traceSpan) error {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf) // one span per line
+	for _, span := range batch {
+		if err := enc.Encode(span); err != nil {
+			return err
+		}
+	}
+	_, err := t.file.Write(buf.Bytes())
+	return err
+}
+
+func (t *tracer) sendCollector(batch []*traceSpan) error {
+	body, err := json.Marshal(otlpRequest(t.daemonID, batch))
+	if err != nil {
+		return err
+	}
+	response, err := t.client.Post(t.collectorURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	b, _ := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if response.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("status %d: %s", response.StatusCode, b)
+	}
+	return nil
+}
+
+//
+// OTLP/HTTP JSON encoding (ExportTraceServiceRequest)
+//
+
+type (
+	otlpAttr struct {
+		Key   string `json:"key"`
+		Value struct {
+			StringValue string `json:"stringValue"`
+		} `json:"value"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code"` // 2: error
+		Message string `json:"message,omitempty"`
+	}
+	otlpSpan struct {
+		TraceID           string      `json:"traceId"`
+		SpanID            string      `json:"spanId"`
+		ParentSpanID      string      `json:"parentSpanId,omitempty"`
+		Name              string      `json:"name"`
+		Kind              int         `json:"kind"`
+		StartTimeUnixNano string      `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string      `json:"endTimeUnixNano"`
+		Attributes        []otlpAttr  `json:"attributes,omitempty"`
+		Status            *otlpStatus `json:"status,omitempty"`
+	}
+	otlpScopeSpans struct {
+		Scope struct {
+			Name string `json:"name"`
+		} `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpResourceSpans struct {
+		Resource struct {
+			Attributes []otlpAttr `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpTraces struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+)
+
+var otlpKinds = map[string]int{spanKindInternal: 1, spanKindServer: 2, spanKindClient: 3}
+
+func newOTLPAttr(key, value string) (attr otlpAttr) {
+	attr.Key = key
+	attr.Value.StringValue = value
+	return
+}
+
+func otlpRequest(daemonID string, batch []*traceSpan) *otlpTraces {
+	scope := otlpScopeSpans{Spans: make([]otlpSpan, 0, len(batch))}
+	scope.Scope.Name = "dfc"
+	for _, span := range batch {
+		ospan := otlpSpan{
+			TraceID:           span.TraceID,
+			SpanID:            span.SpanID,
+			ParentSpanID:      span.ParentID,
+			Name:              span.Name,
+			Kind:              otlpKinds[span.Kind],
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+		}
+		for key, value := range span.Attrs {
+			ospan.Attributes = append(ospan.Attributes, newOTLPAttr(key, value))
+		}
+		if span.Error != "" {
+			ospan.Status = &otlpStatus{Code: 2, Message: span.Error}
+		}
+		scope.Spans = append(scope.Spans, ospan)
+	}
+	resource := otlpResourceSpans{ScopeSpans: []otlpScopeSpans{scope}}
+	resource.Resource.Attributes = []otlpAttr{
+		newOTLPAttr("service.name", "dfc"),
+		newOTLPAttr("service.instance.id", daemonID),
+	}
+	return &otlpTraces{ResourceSpans: []otlpResourceSpans{resource}}
+}
+
+//
+// http
+//
+
+// handler starts the server span of the request; the requests that daemons send
+// to each other on their own (keepalive, metasync etc.) and health checks are
+// traced only when they carry the trace context
+func (t *tracer) handler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceID, parentID := parseTraceparent(r.URL.Query().Get(URLParamTraceParent))
+		if traceID == "" {
+			traceID, parentID = parseTraceparent(r.Header.Get(HeaderTraceParent))
+		}
+		if traceID == "" {
+			if isIntraCluster(r) || isHealthCheck(r) {
+				handler.ServeHTTP(w, r)
+				return
+			}
+			traceID = newTraceID()
+		}
+		span := t.newSpan(traceID, parentID, r.Method+" "+traceSpanPath(r.URL.Path), spanKindServer)
+		span.setAttr("http.method", r.Method)
+		span.setAttr("http.target", r.URL.RequestURI())
+		span.setAttr("http.client_ip", r.RemoteAddr)
+
+		// the calls made on behalf of the request continue the trace (see copyHeaders)
+		r.Header.Set(HeaderTraceParent, span.traceparent())
+		w.Header().Set(HeaderDfcTraceID, traceID)
+		tw := &traceWriter{ResponseWriter: w, span: span}
+		handler.ServeHTTP(tw, r.WithContext(withSpan(r.Context(), span)))
+
+		if tw.status == 0 {
+			tw.status = http.StatusOK
+		}
+		span.setAttr("http.status_code", strconv.Itoa(tw.status))
+		if tw.status >= http.StatusBadRequest && span.Error == "" {
+			span.Error = http.StatusText(tw.status)
+		}
+		span.finish("")
+	})
+}
+
+// traceSpanPath keeps the span names generic: /v1/objects/bucket/obj => /v1/objects
+func traceSpanPath(path string) string {
+	apitems := strings.SplitN(strings.Trim(path, "/"), "/", 3)
+	if len(apitems) > 2 {
+		apitems = apitems[:2]
+	}
+	return "/" + strings.Join(apitems, "/")
+}
+
+func isHealthCheck(r *http.Request) bool {
+	return r.Method == http.MethodGet && strings.Trim(r.URL.Path, "/") == Rversion+"/"+Rhealth
+}
+
+// traceID returns the trace ID to be included in the error messages, empty if the request is not traced
+func traceID(r *http.Request) string {
+	if span := requestSpan(r); span != nil {
+		return span.TraceID
+	}
+	return ""
+}
+
+func (w *traceWriter) WriteHeader(status int) {
+	w.status = status
+	if status >= http.StatusMultipleChoices && status < http.StatusBadRequest {
+		if location := w.Header().Get("Location"); location != "" {
+			if u, err := url.Parse(location); err == nil {
+				query := u.Query()
+				query.Set(URLParamTraceParent, w.span.traceparent())
+				u.RawQuery = query.Encode()
+				w.Header().Set("Location", u.String())
+			}
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *traceWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Push: see targetrunner.pushhdlr
+func (w *traceWriter) Push(target string, opts *http.PushOptions) error {
+	if pusher, ok := w.ResponseWriter.(http.Pusher); ok {
+		return pusher.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
@@ -0,0 +1,182 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		traceparent       string
+		traceID, parentID string
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"},
+		// future versions may append fields
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"},
+		{"", "", ""},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", "", ""},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "", ""},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", "", ""},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", "", ""},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", "", ""},
+		{"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01", "", ""},
+	}
+	for _, test := range tests {
+		traceID, parentID := parseTraceparent(test.traceparent)
+		if traceID != test.traceID || parentID != test.parentID {
+			t.Errorf("%q: expected %q, %q, got %q, %q", test.traceparent, test.traceID, test.parentID, traceID, parentID)
+		}
+	}
+	span := &traceSpan{TraceID: newTraceID(), SpanID: newSpanID()}
+	if traceID, parentID := parseTraceparent(span.traceparent()); traceID != span.TraceID || parentID != span.SpanID {
+		t.Errorf("Generated traceparent %q does not parse", span.traceparent())
+	}
+}
+
+// TestTracePropagation: client => proxy (redirect) => target; the spans of both
+// daemons are exported to a stand-in collector and to the file
+func TestTracePropagation(t *testing.T) {
+	const (
+		clientTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		clientSpanID  = "00f067aa0ba902b7"
+	)
+	var (
+		mu    sync.Mutex
+		spans = make(map[string]otlpSpan) // by daemon and name
+	)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := &otlpTraces{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			t.Errorf("Invalid OTLP request: %v", err)
+			return
+		}
+		mu.Lock()
+		for _, rs := range req.ResourceSpans {
+			daemonID := rs.Resource.Attributes[1].Value.StringValue
+			for _, ss := range rs.ScopeSpans {
+				for _, span := range ss.Spans {
+					spans[daemonID+" "+span.Name] = span
+				}
+			}
+		}
+		mu.Unlock()
+	}))
+	defer collector.Close()
+
+	dir, err := ioutil.TempDir("", "trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fqn := filepath.Join(dir, "trace.jsonl")
+	oldconf := ctx.config.Trace
+	ctx.config.Trace = traceconf{File: fqn, CollectorURL: collector.URL, Enabled: true}
+	defer func() { ctx.config.Trace = oldconf }()
+
+	start := func(daemonID string) (*tracer, chan struct{}) {
+		tracer, err := newTracer(daemonID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tracer.setname(xtracer)
+		done := make(chan struct{})
+		go func() {
+			tracer.run()
+			close(done)
+		}()
+		return tracer, done
+	}
+	ptracer, pdone := start("proxy1")
+	ttracer, tdone := start("target1")
+
+	h := &httprunner{statsif: nopStats{}}
+	target := httptest.NewServer(ttracer.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span := requestSpan(r).child("cold GET")
+		span.finish("")
+		h.invalmsghdlr(w, r, "object does not exist", http.StatusNotFound)
+	})))
+	defer target.Close()
+	proxy := httptest.NewServer(ptracer.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/objects/") {
+			return
+		}
+		http.Redirect(w, r, target.URL+r.URL.Path+"?"+URLParamLocal+"=true", http.StatusMovedPermanently)
+	})))
+	defer proxy.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, proxy.URL+"/v1/objects/bucket/obj", nil)
+	req.Header.Set(HeaderTraceParent, "00-"+clientTraceID+"-"+clientSpanID+"-01")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound || resp.Request.URL.Query().Get(URLParamLocal) != "true" {
+		t.Errorf("Expected redirect and status 404, got %d from %s", resp.StatusCode, resp.Request.URL)
+	}
+	if resp.Header.Get(HeaderDfcTraceID) != clientTraceID || !strings.Contains(string(body), "trace "+clientTraceID) {
+		t.Errorf("Expected trace %s in the response, got %q: %s", clientTraceID, resp.Header.Get(HeaderDfcTraceID), body)
+	}
+	// keepalive is not traced
+	resp, err = http.Post(proxy.URL+"/v1/cluster/keepalive", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get(HeaderDfcTraceID) != "" {
+		t.Error("Keepalive was traced")
+	}
+
+	ptracer.stop(nil)
+	ttracer.stop(nil)
+	<-pdone
+	<-tdone
+
+	if len(spans) != 3 {
+		t.Fatalf("Expected 3 spans, got %v", spans)
+	}
+	pspan, tspan, cspan := spans["proxy1 GET /v1/objects"], spans["target1 GET /v1/objects"], spans["target1 cold GET"]
+	for _, span := range []otlpSpan{pspan, tspan, cspan} {
+		if span.TraceID != clientTraceID || span.StartTimeUnixNano == "" || span.EndTimeUnixNano == "" {
+			t.Errorf("Invalid span %+v", span)
+		}
+	}
+	if pspan.ParentSpanID != clientSpanID || pspan.Kind != 2 || pspan.Status != nil {
+		t.Errorf("Invalid proxy span %+v", pspan)
+	}
+	if tspan.ParentSpanID != pspan.SpanID || tspan.Status == nil || !strings.Contains(tspan.Status.Message, "object does not exist") {
+		t.Errorf("Invalid target span %+v", tspan)
+	}
+	if cspan.ParentSpanID != tspan.SpanID || cspan.Kind != 1 {
+		t.Errorf("Invalid cold GET span %+v", cspan)
+	}
+
+	file, err := os.Open(fqn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	n := 0
+	for scanner := bufio.NewScanner(file); scanner.Scan(); n++ {
+		span := &traceSpan{}
+		if err := json.Unmarshal(scanner.Bytes(), span); err != nil || span.TraceID != clientTraceID {
+			t.Errorf("Invalid span %q, err: %v", scanner.Text(), err)
+		}
+	}
+	if n != 3 {
+		t.Errorf("Expected 3 spans in %s, got %d", fqn, n)
+	}
+}
@@ -0,0 +1,408 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// Soft delete (config: trash.soft_delete_enabled)
+//
+// When enabled, deleting an object from a local bucket moves it into the trash
+// area of the same mountpath: <mountpath>/<trashdir>/<bucket>/<objname>. The object's
+// mtime is then set to the time of deletion. Trashed objects can be undeleted
+// (ActUndelete) until they get purged - periodically, upon exceeding the configured
+// retention time, and unconditionally when LRU runs out of space on the mountpath.
+// NOTE: like version history, trash is not migrated by rebalance.
+const trashdir = ".trash"
+
+// errPurgeInProgress: another purge is running (and it may have a different retention time)
+var errPurgeInProgress = errors.New("trash purge in progress")
+
+type xactPurgeTrash struct {
+	xactBase
+	targetrunner *targetrunner
+}
+
+type trashctx struct {
+	trashroot string
+	retention time.Duration
+	now       time.Time
+	xpt       *xactPurgeTrash
+	t         *targetrunner
+	npurged   int64
+	bpurged   int64
+}
+
+// builds fqn of the trash directory from mountpath
+func makePathTrash(basePath string) string {
+	return filepath.Join(basePath, trashdir)
+}
+
+func (t *targetrunner) trashfqn(bucket, objname string) string {
+	mpath := hrwMpath(bucket, objname)
+	return filepath.Join(makePathTrash(mpath), bucket, objname)
+}
+
+// trashObject moves the object into trash; must be called under the object's exclusive lock
+func (t *targetrunner) trashObject(bucket, objname, fqn string) (errstr string) {
+	tfqn := t.trashfqn(bucket, objname)
+	if err := CreateDir(filepath.Dir(tfqn)); err != nil {
+		errstr = fmt.Sprintf("Failed to create trash dir for %s/%s, err: %v", bucket, objname, err)
+		return
+	}
+	if err := os.Rename(fqn, tfqn); err != nil {
+		errstr = fmt.Sprintf("Failed to move %s => %s, err: %v", fqn, tfqn, err)
+		return
+	}
+	// retention time counts from the deletion
+	now := time.Now()
+	if err := os.Chtimes(tfqn, now, now); err != nil {
+		glog.Errorf("Failed to set times of %s, err: %v", tfqn, err)
+	}
+	t.statsif.add("numtrashed", 1)
+	return
+}
+
+// undeleteObject restores the object from trash unless the bucket already has an object with the same name
+func (t *targetrunner) undeleteObject(bucket, objname string) (errstr string, errcode int) {
+	islocal := t.bmdowner.get().islocal(bucket)
+	if !islocal {
+		errstr = fmt.Sprintf("Cannot undelete %s/%s: soft delete is supported only for local buckets", bucket, objname)
+		errcode = http.StatusBadRequest
+		return
+	}
+	fqn := t.fqn(bucket, objname, islocal)
+	uname := uniquename(bucket, objname)
+	t.rtnamemap.lockname(uname, true, &pendinginfo{Time: time.Now(), fqn: fqn}, time.Second)
+	defer t.rtnamemap.unlockname(uname, true)
+
+	tfqn := t.trashfqn(bucket, objname)
+	if _, err := os.Stat(tfqn); err != nil {
+		errstr = fmt.Sprintf("Cannot undelete %s/%s: not found in trash", bucket, objname)
+		errcode = http.StatusNotFound
+		return
+	}
+	if _, err := os.Stat(fqn); err == nil {
+		errstr = fmt.Sprintf("Cannot undelete %s/%s: object already exists", bucket, objname)
+		errcode = http.StatusConflict
+		return
+	}
+	if err := CreateDir(filepath.Dir(fqn)); err != nil {
+		errstr = fmt.Sprintf("Failed to create dir for %s/%s, err: %v", bucket, objname, err)
+		return
+	}
+	if err := os.Rename(tfqn, fqn); err != nil {
+		errstr = fmt.Sprintf("Failed to move %s => %s, err: %v", tfqn, fqn, err)
+		return
+	}
+	t.statsif.add("numundeleted", 1)
+	if glog.V(3) {
+		glog.Infof("Undeleted %s/%s", bucket, objname)
+	}
+	return
+}
+
+// POST { action: undelete } /Rversion/Robjects/bucket-name/object-name
+func (t *targetrunner) undeletefile(w http.ResponseWriter, r *http.Request) {
+	apitems := t.restAPIItems(r.URL.Path, 5)
+	if apitems = t.checkRestAPI(w, r, apitems, 2, Rversion, Robjects); apitems == nil {
+		return
+	}
+	bucket, objname := apitems[0], strings.Join(apitems[1:], "/")
+	if !t.validatebckname(w, r, bucket) {
+		return
+	}
+	if errstr, errcode := t.undeleteObject(bucket, objname); errstr != "" {
+		if errcode == 0 {
+			t.invalmsghdlr(w, r, errstr)
+		} else {
+			t.invalmsghdlr(w, r, errstr, errcode)
+		}
+	}
+}
+
+// POST { action: undelete, value: ListMsg or RangeMsg } /Rversion/Rbuckets/bucket-name
+func (t *targetrunner) undeletefiles(w http.ResponseWriter, r *http.Request, msg ActionMsg) {
+	detail := fmt.Sprintf(" (%s, %s, %T)", msg.Action, msg.Name, msg.Value)
+	jsmap, ok := msg.Value.(map[string]interface{})
+	if !ok {
+		t.invalmsghdlr(w, r, "undeletefiles: invalid ActionMsg.Value format"+detail)
+		return
+	}
+	if _, ok := jsmap["objnames"]; ok {
+		// Undelete with List
+		if undeleteMsg, errstr := parseListMsg(jsmap); errstr != "" {
+			t.invalmsghdlr(w, r, errstr+detail)
+		} else {
+			t.listOperation(w, r, undeleteMsg, t.doListUndelete)
+		}
+	} else {
+		// Undelete with Range
+		if undeleteMsg, errstr := parseRangeMsg(jsmap); errstr != "" {
+			t.invalmsghdlr(w, r, errstr+detail)
+		} else {
+			t.rangeOperation(w, r, undeleteMsg, t.doRangeUndelete)
+		}
+	}
+}
+
+func (t *targetrunner) doListUndelete(ct context.Context, objs []string, bucket string, deadline time.Duration, done chan struct{}) error {
+	xund := t.xactinp.newUndelete(t)
+	defer func() {
+		if done != nil {
+			var v struct{}
+			done <- v
+		}
+		t.xactinp.del(xund.id)
+	}()
+	if !t.bmdowner.get().islocal(bucket) {
+		return fmt.Errorf("Cannot undelete from a cloud bucket: %s", bucket)
+	}
+
+	var (
+		absdeadline time.Time
+		nfailed     int
+		firstErr    string
+	)
+	if deadline != 0 {
+		absdeadline = time.Now().Add(deadline)
+	}
+	for _, objname := range objs {
+		select {
+		case <-xund.abrt:
+			return nil
+		default:
+		}
+		if !absdeadline.IsZero() && time.Now().After(absdeadline) {
+			continue
+		}
+		// keep undeleting the rest of the objects
+		if errstr, _ := t.undeleteObject(bucket, objname); errstr != "" {
+			glog.Errorln(errstr)
+			if nfailed == 0 {
+				firstErr = errstr
+			}
+			nfailed++
+		}
+	}
+	if nfailed > 0 {
+		return fmt.Errorf("Failed to undelete %d out of %d objects from %s, first error: %s",
+			nfailed, len(objs), bucket, firstErr)
+	}
+	return nil
+}
+
+func (t *targetrunner) doRangeUndelete(ct context.Context, bucket, prefix, regex string, min, max int64,
+	deadline time.Duration, done chan struct{}) error {
+	objs, err := t.getTrashListFromRange(bucket, prefix, regex, min, max)
+	if err != nil {
+		if done != nil {
+			var v struct{}
+			done <- v
+		}
+		return err
+	}
+	return t.doListUndelete(ct, objs, bucket, deadline, done)
+}
+
+// getTrashListFromRange is the trash counterpart of getListFromRange: it selects
+// this target's trashed objects that match the prefix, regex and range
+func (t *targetrunner) getTrashListFromRange(bucket, prefix, regex string, min, max int64) ([]string, error) {
+	re, err := regexp.Compile(regex)
+	if err != nil {
+		return nil, fmt.Errorf("Could not compile regex: %v", err)
+	}
+	objs := make([]string, 0)
+	for mpath := range ctx.mountpaths.Available {
+		bucketdir := filepath.Join(makePathTrash(mpath), bucket)
+		if _, err := os.Stat(bucketdir); err != nil {
+			continue
+		}
+		err := filepath.Walk(bucketdir, func(fqn string, osfi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if osfi.IsDir() {
+				return nil
+			}
+			objname, err := filepath.Rel(bucketdir, fqn)
+			if err != nil || !strings.HasPrefix(objname, prefix) || !acceptRegexRange(objname, prefix, re, min, max) {
+				return nil
+			}
+			if si, errstr := HrwTarget(bucket, objname, t.smap); errstr != "" {
+				return errors.New(errstr)
+			} else if si.DaemonID == t.si.DaemonID {
+				objs = append(objs, objname)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Failed to traverse %q, err: %v", bucketdir, err)
+		}
+	}
+	return objs, nil
+}
+
+//
+// purge
+//
+
+// runPurgeTrash permanently removes trashed objects older than the retention
+// time from the given mountpaths (all available mountpaths if none given);
+// returns errPurgeInProgress if a purge is already running
+func (t *targetrunner) runPurgeTrash(retention time.Duration, mpaths ...string) error {
+	xpt := t.xactinp.renewPurgeTrash(t)
+	if xpt == nil {
+		return errPurgeInProgress
+	}
+	if len(mpaths) == 0 {
+		for mpath := range ctx.mountpaths.Available {
+			mpaths = append(mpaths, mpath)
+		}
+	}
+	wg := &sync.WaitGroup{}
+	for _, mpath := range mpaths {
+		tctx := &trashctx{
+			trashroot: makePathTrash(mpath),
+			retention: retention,
+			now:       time.Now(),
+			xpt:       xpt,
+			t:         t,
+		}
+		wg.Add(1)
+		go tctx.onePurge(wg)
+	}
+	wg.Wait()
+
+	xpt.etime = time.Now()
+	glog.Infoln(xpt.tostring())
+	t.xactinp.del(xpt.id)
+	return nil
+}
+
+func (tctx *trashctx) onePurge(wg *sync.WaitGroup) {
+	defer wg.Done()
+	if _, err := os.Stat(tctx.trashroot); err != nil {
+		return
+	}
+	if err := filepath.Walk(tctx.trashroot, tctx.purgewalkfn); err != nil {
+		s := err.Error()
+		if strings.Contains(s, "xaction") {
+			glog.Infof("Stopping %q traversal: %s", tctx.trashroot, s)
+		} else {
+			glog.Errorf("Failed to traverse %q, err: %v", tctx.trashroot, err)
+		}
+	}
+	if tctx.npurged > 0 {
+		tctx.t.statsif.addMany("numtrashpurged", tctx.npurged, "bytestrashpurged", tctx.bpurged)
+		glog.Infof("Trash %q: purged %d object(s), %.2f MB", tctx.trashroot, tctx.npurged, float64(tctx.bpurged)/MiB)
+	}
+}
+
+func (tctx *trashctx) purgewalkfn(tfqn string, osfi os.FileInfo, err error) error {
+	if err != nil {
+		glog.Errorf("walkfunc callback invoked with err: %v", err)
+		return err
+	}
+	if osfi.Mode().IsDir() {
+		return nil
+	}
+	// abort?
+	select {
+	case <-tctx.xpt.abrt:
+		s := fmt.Sprintf("%s aborted, exiting purgewalkfn", tctx.xpt.tostring())
+		glog.Infoln(s)
+		glog.Flush()
+		return errors.New(s)
+	default:
+		break
+	}
+	if tctx.now.Sub(osfi.ModTime()) < tctx.retention {
+		return nil
+	}
+	rel, err := filepath.Rel(tctx.trashroot, tfqn)
+	if err != nil {
+		glog.Errorf("Invalid trash fqn %s, err: %v", tfqn, err)
+		return nil
+	}
+	items := strings.SplitN(rel, string(filepath.Separator), 2)
+	if len(items) < 2 {
+		glog.Errorf("Invalid trash fqn %s: no object name", tfqn)
+		return nil
+	}
+	bucket, objname := items[0], items[1]
+	t := tctx.t
+	fqn := t.fqn(bucket, objname, true)
+	uname := uniquename(bucket, objname)
+	t.rtnamemap.lockname(uname, true, &pendinginfo{Time: time.Now(), fqn: fqn}, time.Second)
+	defer t.rtnamemap.unlockname(uname, true)
+	if err := os.Remove(tfqn); err != nil {
+		if !os.IsNotExist(err) { // undeleted meanwhile
+			glog.Errorf("Failed to purge %s, err: %v", tfqn, err)
+		}
+		return nil
+	}
+	// the version history goes with the last copy of the object
+	if _, err := os.Stat(fqn); os.IsNotExist(err) {
+		if err := os.RemoveAll(t.objVersionsDir(bucket, objname)); err != nil {
+			glog.Errorf("Failed to remove version history of %s/%s, err: %v", bucket, objname, err)
+		}
+	}
+	tctx.npurged++
+	tctx.bpurged += osfi.Size()
+	return nil
+}
+
+//
+// xactions
+//
+
+func (q *xactInProgress) newUndelete(t *targetrunner) *xactDeleteEvict {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	id := q.uniqueid()
+	xund := &xactDeleteEvict{xactBase: *newxactBase(id, ActUndelete)}
+	xund.targetrunner = t
+	q.add(xund)
+	return xund
+}
+
+func (q *xactInProgress) renewPurgeTrash(t *targetrunner) *xactPurgeTrash {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	_, xx := q.findU(ActPurgeTrash)
+	if xx != nil {
+		xpt := xx.(*xactPurgeTrash)
+		glog.Infof("%s already running, nothing to do", xpt.tostring())
+		return nil
+	}
+	id := q.uniqueid()
+	xpt := &xactPurgeTrash{xactBase: *newxactBase(id, ActPurgeTrash)}
+	xpt.targetrunner = t
+	q.add(xpt)
+	return xpt
+}
+
+func (xact *xactPurgeTrash) tostring() string {
+	start := xact.stime.Sub(xact.targetrunner.starttime())
+	if !xact.finished() {
+		return fmt.Sprintf("xaction %s:%d started %v", xact.kind, xact.id, start)
+	}
+	fin := time.Since(xact.targetrunner.starttime())
+	return fmt.Sprintf("xaction %s:%d started %v finished %v", xact.kind, xact.id, start, fin)
+}
@@ -359,8 +359,13 @@ func (v *cksumvalmd5) get() (string, string) { return v.tag, v.val }
 //
 //===========================================================================
 func LocalSave(pathname string, v interface{}) error {
+	return LocalSavePerm(pathname, v, 0666)
+}
+
+// LocalSavePerm is LocalSave with the given permissions (before umask), e.g. 0600 for secrets
+func LocalSavePerm(pathname string, v interface{}, perm os.FileMode) error {
 	tmp := pathname + ".tmp"
-	file, err := os.Create(tmp)
+	file, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, perm)
 	if err != nil {
 		return err
 	}
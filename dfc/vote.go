@@ -231,7 +231,7 @@ func (p *proxyrunner) httpRequestNewPrimary(w http.ResponseWriter, r *http.Reque
 
 	// If the passed Smap is newer, update our Smap. If it is older, update it.
 	currPrimary := p.smap.ProxySI.DaemonID
-	currPrimaryURL := p.smap.ProxySI.DirectURL
+	currPrimaryURL := p.smap.ProxySI.controlURL()
 	if msg.Request.Smap.version() > p.smap.version() {
 		p.smap = &msg.Request.Smap
 	}
@@ -451,7 +451,7 @@ func (p *proxyrunner) becomePrimaryProxy(proxyidToRemove string) {
 	p.smap.Version += 100
 
 	ctx.config.Proxy.Primary.ID = psi.DaemonID
-	ctx.config.Proxy.Primary.URL = psi.DirectURL
+	ctx.config.Proxy.Primary.URL = psi.controlURL()
 	err := LocalSave(clivars.conffile, ctx.config)
 	if err != nil {
 		glog.Errorf("Error writing config file: %v", err)
@@ -494,7 +494,7 @@ func (p *proxyrunner) onPrimaryProxyFailure() {
 		return
 	}
 
-	currPrimaryURL := p.smap.ProxySI.DirectURL
+	currPrimaryURL := p.smap.ProxySI.controlURL()
 	if glog.V(4) {
 		glog.Infof("Primary proxy %s failure detected {url: %s}", p.smap.ProxySI.DaemonID, currPrimaryURL)
 	}
@@ -553,7 +553,7 @@ func (t *targetrunner) onPrimaryProxyFailure() {
 }
 
 func (h *httprunner) sendElectionRequest(vr *VoteInitiation, nextPrimaryProxy *daemonInfo) {
-	url := nextPrimaryProxy.DirectURL + "/" + Rversion + "/" + Rvote + "/" + Rvoteinit
+	url := nextPrimaryProxy.controlURL() + "/" + Rversion + "/" + Rvote + "/" + Rvoteinit
 	msg := VoteInitiationMessage{Request: *vr}
 	jsbytes, err := json.Marshal(&msg)
 	assert(err == nil, err)
@@ -637,7 +637,7 @@ func (h *httprunner) setPrimaryProxy(newPrimaryProxy, primaryToRemove string, pr
 
 	h.smap.ProxySI = proxyinfo
 	ctx.config.Proxy.Primary.ID = proxyinfo.DaemonID
-	ctx.config.Proxy.Primary.URL = proxyinfo.DirectURL
+	ctx.config.Proxy.Primary.URL = proxyinfo.controlURL()
 
 	err := LocalSave(clivars.conffile, ctx.config)
 	if err != nil {
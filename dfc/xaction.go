@@ -53,6 +53,11 @@ type xactLRU struct {
 	targetrunner *targetrunner
 }
 
+type xactLifecycle struct {
+	xactBase
+	targetrunner *targetrunner
+}
+
 type xactElection struct {
 	xactBase
 	proxyrunner *proxyrunner
@@ -241,6 +246,23 @@ func (q *xactInProgress) renewLRU(t *targetrunner) *xactLRU {
 	return xlru
 }
 
+func (q *xactInProgress) renewLifecycle(t *targetrunner) *xactLifecycle {
+	q.lock.Lock()
+	_, xx := q.findU(ActLifecycle)
+	if xx != nil {
+		xlc := xx.(*xactLifecycle)
+		glog.Infof("%s already running, nothing to do", xlc.tostring())
+		q.lock.Unlock()
+		return nil
+	}
+	id := q.uniqueid()
+	xlc := &xactLifecycle{xactBase: *newxactBase(id, ActLifecycle)}
+	xlc.targetrunner = t
+	q.add(xlc)
+	q.lock.Unlock()
+	return xlc
+}
+
 func (q *xactInProgress) renewElection(p *proxyrunner, vr *VoteRecord) *xactElection {
 	q.lock.Lock()
 	_, xx := q.findU(ActElection)
@@ -261,6 +283,19 @@ func (q *xactInProgress) renewElection(p *proxyrunner, vr *VoteRecord) *xactElec
 	return xele
 }
 
+// abortKind aborts all running xactions of a given kind
+func (q *xactInProgress) abortKind(kind string) (n int) {
+	q.lock.Lock()
+	for _, xact := range q.xactinp {
+		if xact.getkind() == kind && !xact.finished() {
+			xact.abort()
+			n++
+		}
+	}
+	q.lock.Unlock()
+	return
+}
+
 func (q *xactInProgress) abortAll() (sleep bool) {
 	q.lock.Lock()
 	for _, xact := range q.xactinp {
@@ -287,6 +322,25 @@ func (xact *xactLRU) tostring() string {
 	return fmt.Sprintf("xaction %s:%d %v finished %v", xact.kind, xact.id, start, fin)
 }
 
+//===================
+//
+// xactLifecycle
+//
+//===================
+func (xact *xactLifecycle) tostring() string {
+	start := xact.stime.Sub(xact.targetrunner.starttime())
+	if !xact.finished() {
+		return fmt.Sprintf("xaction %s:%d started %v", xact.kind, xact.id, start)
+	}
+	fin := time.Since(xact.targetrunner.starttime())
+	return fmt.Sprintf("xaction %s:%d started %v finished %v", xact.kind, xact.id, start, fin)
+}
+
+func (xact *xactLifecycle) abort() {
+	xact.xactBase.abort()
+	glog.Infof("ABORT: " + xact.tostring())
+}
+
 //===================
 //
 // xactRebalance
@@ -0,0 +1,157 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// Throttling of background xactions (config: xaction_throttle.xaction_throttle_enabled)
+//
+// Rebalance and prefetch transfer objects one at a time per goroutine; each transfer
+// takes a slot (xaction_transfers per target) and is paced by the bandwidth limit
+// (xaction_bandwidth MB/s per target): the bytes are charged once the object is
+// transferred, and the next transfer waits out the debt.
+//
+// In the adaptive mode, the limits are halved (down to 1/16 of the configured ones)
+// whenever the foreground GET latency or the disk utilization exceeds its maximum,
+// and scaled back up gradually otherwise.
+
+const (
+	xactThrottleAdjustTime = time.Second // how often the adaptive mode re-evaluates
+	xactThrottleMinFactor  = 1.0 / 16
+	xactThrottleStep       = 1.0 / 8 // additive increase
+	xactThrottleKey        = "xaction"
+)
+
+type xactThrottle struct {
+	sync.Mutex
+	limiter   *rateLimiter
+	transfers int
+	released  chan struct{} // closed (and replaced) upon each release to wake up the waiters
+	factor    float64       // adaptive: the fraction of the configured limits in effect
+	adjusted  time.Time
+	latency   int64 // EWMA of the foreground GET latency (microseconds)
+	observed  int64 // when the latency was last observed (unix nano)
+}
+
+func newXactThrottle() *xactThrottle {
+	return &xactThrottle{limiter: newRateLimiter(), released: make(chan struct{}), factor: 1, adjusted: time.Now()}
+}
+
+// observe is called upon each foreground GET
+func (x *xactThrottle) observe(delta time.Duration) {
+	us := int64(delta / time.Microsecond)
+	for {
+		old := atomic.LoadInt64(&x.latency)
+		if atomic.CompareAndSwapInt64(&x.latency, old, old-old/8+us/8) {
+			break
+		}
+	}
+	atomic.StoreInt64(&x.observed, time.Now().UnixNano())
+}
+
+// adjustL backs off (multiplicative decrease) while the foreground suffers and
+// recovers (additive increase) otherwise
+func (x *xactThrottle) adjustL(now time.Time) {
+	conf := &ctx.config.XactThrottle
+	if !conf.Adaptive {
+		x.factor = 1
+		return
+	}
+	if now.Sub(x.adjusted) < xactThrottleAdjustTime {
+		return
+	}
+	var overloaded bool
+	if conf.MaxLatency > 0 && atomic.LoadInt64(&x.observed) > x.adjusted.UnixNano() {
+		overloaded = time.Duration(atomic.LoadInt64(&x.latency))*time.Microsecond > conf.MaxLatency
+	}
+	if !overloaded && conf.MaxUtil > 0 {
+		if riostat := getiostatrunner(); riostat != nil {
+			overloaded = riostat.getMaxUtil() >= conf.MaxUtil
+		}
+	}
+	factor := x.factor
+	if overloaded {
+		x.factor = math.Max(x.factor/2, xactThrottleMinFactor)
+	} else {
+		x.factor = math.Min(x.factor+xactThrottleStep, 1)
+	}
+	if x.factor != factor && glog.V(4) {
+		glog.Infof("xaction throttle: %.0f%% of the configured limits", x.factor*100)
+	}
+	x.adjusted = now
+}
+
+func (x *xactThrottle) maxTransfersL() int {
+	n := ctx.config.XactThrottle.MaxTransfers
+	if n <= 0 {
+		return 0
+	}
+	return int(math.Max(math.Floor(float64(n)*x.factor), 1))
+}
+
+func (x *xactThrottle) limitsL() []rateLimit {
+	mbps := ctx.config.XactThrottle.MaxBandwidth
+	if mbps <= 0 {
+		return nil
+	}
+	return []rateLimit{{key: xactThrottleKey, rate: float64(mbps) * MiB * x.factor}}
+}
+
+// acquire waits for a transfer slot and for the bandwidth debt to be repaid;
+// it returns the function to call with the number of bytes transferred or, if
+// the xaction is aborted while waiting, false
+func (x *xactThrottle) acquire(abrt <-chan struct{}) (release func(size int64), ok bool) {
+	if !ctx.config.XactThrottle.Enabled {
+		return func(int64) {}, true
+	}
+	x.Lock()
+	x.adjustL(time.Now())
+	for limit := x.maxTransfersL(); limit > 0 && x.transfers >= limit; limit = x.maxTransfersL() {
+		released := x.released
+		x.Unlock()
+		select {
+		case <-released:
+		case <-abrt:
+			return nil, false
+		case <-time.After(xactThrottleAdjustTime): // the limits may change in the meantime
+		}
+		x.Lock()
+		x.adjustL(time.Now())
+	}
+	x.transfers++
+	limits := x.limitsL()
+	x.Unlock()
+
+	release = func(size int64) {
+		x.Lock()
+		x.transfers--
+		close(x.released)
+		x.released = make(chan struct{})
+		limits := x.limitsL()
+		x.Unlock()
+		x.limiter.charge(limits, float64(size))
+	}
+	for retry := x.limiter.admit(limits, 0); retry > 0; retry = x.limiter.admit(limits, 0) {
+		select {
+		case <-time.After(time.Duration(math.Min(float64(retry), float64(xactThrottleAdjustTime)))):
+		case <-abrt:
+			release(0)
+			return nil, false
+		}
+		x.Lock()
+		x.adjustL(time.Now())
+		limits = x.limitsL()
+		x.Unlock()
+	}
+	return release, true
+}
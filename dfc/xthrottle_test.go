@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestXactThrottle(t *testing.T) {
+	oldconf := ctx.config.XactThrottle
+	ctx.config.XactThrottle = xactthrottleconf{MaxBandwidth: 1, MaxTransfers: 1, Enabled: true}
+	defer func() { ctx.config.XactThrottle = oldconf }()
+
+	x := newXactThrottle()
+	abrt := make(chan struct{})
+	release, ok := x.acquire(abrt)
+	if !ok {
+		t.Fatal("First transfer was not admitted")
+	}
+	// the second transfer waits for the slot
+	admitted := make(chan time.Time)
+	go func() {
+		release, ok := x.acquire(abrt)
+		if !ok {
+			t.Error("Second transfer was aborted")
+		}
+		admitted <- time.Now()
+		release(0)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case <-admitted:
+		t.Fatal("Second transfer was admitted over the limit")
+	default:
+	}
+	// 1.5MB at 1MB/s: the debt takes 0.5s to repay
+	released := time.Now()
+	release(MiB + MiB/2)
+	if waited := (<-admitted).Sub(released); waited < 400*time.Millisecond || waited > 800*time.Millisecond {
+		t.Errorf("Expected the second transfer to wait 0.5s, waited %v", waited)
+	}
+
+	// abort while waiting
+	release, _ = x.acquire(abrt)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(abrt)
+	}()
+	if _, ok = x.acquire(abrt); ok {
+		t.Error("Expected the transfer to be aborted")
+	}
+	release(0)
+	if x.transfers != 0 {
+		t.Errorf("Expected no transfers in progress, got %d", x.transfers)
+	}
+}
+
+func TestXactThrottleAdaptive(t *testing.T) {
+	oldconf := ctx.config.XactThrottle
+	ctx.config.XactThrottle = xactthrottleconf{MaxTransfers: 8, Adaptive: true, MaxLatency: 10 * time.Millisecond, Enabled: true}
+	defer func() { ctx.config.XactThrottle = oldconf }()
+
+	x := newXactThrottle()
+	now := time.Now()
+	adjust := func(latency time.Duration) {
+		now = now.Add(xactThrottleAdjustTime)
+		if latency > 0 {
+			for i := 0; i < 64; i++ {
+				x.observe(latency)
+			}
+			x.observed = now.UnixNano()
+		}
+		x.adjustL(now)
+	}
+	// the foreground suffers: multiplicative decrease down to the minimum
+	for _, expected := range []int{4, 2, 1, 1, 1} {
+		adjust(50 * time.Millisecond)
+		if n := x.maxTransfersL(); n != expected {
+			t.Errorf("Expected %d transfers, got %d (factor %f)", expected, n, x.factor)
+		}
+	}
+	if x.factor != xactThrottleMinFactor {
+		t.Errorf("Expected factor %f, got %f", xactThrottleMinFactor, x.factor)
+	}
+	// fast foreground, and then no foreground traffic at all: additive increase
+	adjust(time.Millisecond)
+	for i := 0; i < 8; i++ {
+		adjust(0)
+	}
+	if x.factor != 1 || x.maxTransfersL() != 8 {
+		t.Errorf("Expected the configured limits, got factor %f", x.factor)
+	}
+}
@@ -8,6 +8,7 @@ package client
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
 	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
@@ -560,6 +561,79 @@ func EvictRange(proxyurl, bucket, prefix, regex, rng string, wait bool, deadline
 	return doListRangeCall(proxyurl, bucket, dfc.ActEvict, http.MethodDelete, evictMsg, wait)
 }
 
+// CopyObject copies an object within or across buckets; the destination bucket must be local
+func CopyObject(proxyurl, bucket, objname, newbucket, newobjname string) error {
+	msg, err := json.Marshal(dfc.ActionMsg{Action: dfc.ActCopy, Name: newobjname, Value: newbucket})
+	if err != nil {
+		return err
+	}
+	return HTTPRequest(http.MethodPost, proxyurl+"/"+dfc.Rversion+"/"+dfc.Robjects+"/"+bucket+"/"+objname, bytes.NewBuffer(msg))
+}
+
+// UndeleteObject restores a soft-deleted object of a local bucket from trash
+func UndeleteObject(proxyurl, bucket, objname string) error {
+	msg, err := json.Marshal(dfc.ActionMsg{Action: dfc.ActUndelete})
+	if err != nil {
+		return err
+	}
+	return HTTPRequest(http.MethodPost, proxyurl+"/"+dfc.Rversion+"/"+dfc.Robjects+"/"+bucket+"/"+objname, bytes.NewBuffer(msg))
+}
+
+func UndeleteList(proxyurl, bucket string, fileslist []string, wait bool, deadline time.Duration) error {
+	rangeListMsgBase := dfc.RangeListMsgBase{Deadline: deadline, Wait: wait}
+	undeleteMsg := dfc.ListMsg{Objnames: fileslist, RangeListMsgBase: rangeListMsgBase}
+	return doListRangeCall(proxyurl, bucket, dfc.ActUndelete, http.MethodPost, undeleteMsg, wait)
+}
+
+func UndeleteRange(proxyurl, bucket, prefix, regex, rng string, wait bool, deadline time.Duration) error {
+	rangeListMsgBase := dfc.RangeListMsgBase{Deadline: deadline, Wait: wait}
+	undeleteMsg := dfc.RangeMsg{Prefix: prefix, Regex: regex, Range: rng, RangeListMsgBase: rangeListMsgBase}
+	return doListRangeCall(proxyurl, bucket, dfc.ActUndelete, http.MethodPost, undeleteMsg, wait)
+}
+
+// GetBatchList reads the listed objects as a single archive (see dfc.BatchGetMsg) and writes it to w
+func GetBatchList(proxyurl, bucket string, objnames []string, bmsg *dfc.BatchGetMsg, w io.Writer) error {
+	if bmsg == nil {
+		bmsg = &dfc.BatchGetMsg{}
+	}
+	value := struct {
+		dfc.ListMsg
+		dfc.BatchGetMsg
+	}{dfc.ListMsg{Objnames: objnames}, *bmsg}
+	return doBatchGet(proxyurl, bucket, value, w)
+}
+
+// GetBatchRange reads the range of objects as a single archive (see dfc.BatchGetMsg) and writes it to w
+func GetBatchRange(proxyurl, bucket, prefix, regex, rng string, bmsg *dfc.BatchGetMsg, w io.Writer) error {
+	if bmsg == nil {
+		bmsg = &dfc.BatchGetMsg{}
+	}
+	value := struct {
+		dfc.RangeMsg
+		dfc.BatchGetMsg
+	}{dfc.RangeMsg{Prefix: prefix, Regex: regex, Range: rng}, *bmsg}
+	return doBatchGet(proxyurl, bucket, value, w)
+}
+
+func doBatchGet(proxyurl, bucket string, value interface{}, w io.Writer) error {
+	msg, err := json.Marshal(dfc.ActionMsg{Action: dfc.ActBatchGet, Value: value})
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(proxyurl+dfc.URLPath(dfc.Rversion, dfc.Rbuckets, bucket), "application/json", bytes.NewBuffer(msg))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return newReqError(fmt.Sprintf("Batch GET failed: bucket %s, HTTP status code: %d, HTTP response body: %s",
+			bucket, resp.StatusCode, string(b)), resp.StatusCode)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
 // fastRandomFilename is taken from https://stackoverflow.com/questions/22892120/how-to-generate-a-random-string-of-a-fixed-length-in-golang
 const (
 	letterBytes   = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
@@ -704,6 +778,30 @@ func IsCached(proxyurl, bucket, objname string) (bool, error) {
 	return true, nil
 }
 
+// ListObjectVersions returns the current and all previous versions of an object in a local bucket,
+// the most recent first
+func ListObjectVersions(proxyurl, bucket, objname string) (*dfc.BucketList, error) {
+	url := proxyurl + dfc.URLPath(dfc.Rversion, dfc.Robjects, bucket, objname) +
+		"?" + dfc.URLParamWhat + "=" + dfc.GetWhatVersions
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body, err = %s", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("ListObjectVersions failed: bucket/object: %s/%s, HTTP status code: %d, HTTP response body: %s",
+			bucket, objname, resp.StatusCode, string(b))
+	}
+	versions := &dfc.BucketList{}
+	err = json.Unmarshal(b, versions)
+	return versions, err
+}
+
 func checkHTTPStatus(resp *http.Response, op string) error {
 	if resp.StatusCode >= http.StatusBadRequest {
 		return ReqError{
@@ -773,6 +871,78 @@ func Put(proxyURL string, reader Reader, bucket string, key string, silent bool)
 	return nil
 }
 
+// PutArchive uploads a tar, gzipped tar, or zip archive (the format is determined by the archive's
+// extension) and extracts its members as objects named prefix + member-name
+func PutArchive(proxyURL string, reader Reader, bucket, archname, prefix string) (*dfc.ExtractResult, error) {
+	q := url.Values{}
+	q.Set(dfc.URLParamExtract, "true")
+	q.Set(dfc.URLParamPrefix, prefix)
+	handle, err := reader.Open()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open reader, err: %v", err)
+	}
+	defer handle.Close()
+	req, err := http.NewRequest(http.MethodPut, proxyURL+dfc.URLPath(dfc.Rversion, dfc.Robjects, bucket, archname)+"?"+q.Encode(), handle)
+	if err != nil {
+		return nil, err
+	}
+	req.GetBody = func() (io.ReadCloser, error) {
+		return reader.Open()
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("HTTP error = %d, message = %s", resp.StatusCode, string(b))
+	}
+	result := &dfc.ExtractResult{}
+	err = json.Unmarshal(b, result)
+	return result, err
+}
+
+// Append appends the reader's content to the object of the local bucket (the object is created if it does not exist)
+func Append(proxyURL string, reader Reader, bucket, objname string) error {
+	q := url.Values{}
+	q.Set(dfc.URLParamAppend, "true")
+	handle, err := reader.Open()
+	if err != nil {
+		return fmt.Errorf("Failed to open reader, err: %v", err)
+	}
+	defer handle.Close()
+	req, err := http.NewRequest(http.MethodPut, proxyURL+dfc.URLPath(dfc.Rversion, dfc.Robjects, bucket, objname)+"?"+q.Encode(), handle)
+	if err != nil {
+		return err
+	}
+	req.GetBody = func() (io.ReadCloser, error) {
+		return reader.Open()
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("HTTP error = %d, message = %s", resp.StatusCode, string(b))
+	}
+	return nil
+}
+
+// Compose concatenates the source objects of the local bucket, in the given order, into the destination object
+func Compose(proxyURL, bucket, objname string, srcs []string) error {
+	msg, err := json.Marshal(dfc.ActionMsg{Action: dfc.ActCompose, Value: srcs})
+	if err != nil {
+		return err
+	}
+	return HTTPRequest(http.MethodPost, proxyURL+dfc.URLPath(dfc.Rversion, dfc.Robjects, bucket, objname), bytes.NewBuffer(msg))
+}
+
 // PutAsync sends a PUT request to the given URL
 func PutAsync(wg *sync.WaitGroup, proxyURL string, reader Reader, bucket string, key string,
 	errch chan error, silent bool) {
@@ -884,6 +1054,105 @@ func RenameLocalBucket(proxyURL, bucket, newBucketName string) error {
 	return waitForLocalBucket(proxyURL, newBucketName)
 }
 
+// CopyBucket starts copying all objects of the bucket into the (existing) local bucket newBucketName;
+// the copying runs asynchronously - see GetXactionCopyBucket
+func CopyBucket(proxyURL, bucket, newBucketName string) error {
+	msg, err := json.Marshal(dfc.ActionMsg{Action: dfc.ActCopyBucket, Name: newBucketName})
+	if err != nil {
+		return err
+	}
+	return HTTPRequest(http.MethodPost, proxyURL+"/"+dfc.Rversion+"/"+dfc.Rbuckets+"/"+bucket, bytes.NewBuffer(msg))
+}
+
+// Dsort starts the distributed sort (shuffle) of the input shards of the bucket into the output
+// shards of dmsg.OutputBucket; the sort runs asynchronously - see GetXactionDsort
+func Dsort(proxyURL, bucket string, dmsg *dfc.DsortMsg) error {
+	msg, err := json.Marshal(dfc.ActionMsg{Action: dfc.ActDsort, Value: dmsg})
+	if err != nil {
+		return err
+	}
+	return HTTPRequest(http.MethodPost, proxyURL+"/"+dfc.Rversion+"/"+dfc.Rbuckets+"/"+bucket, bytes.NewBuffer(msg))
+}
+
+// RenamePrefix starts renaming the objects of the local bucket whose names start with prefix
+// into newprefix + the rest of the name; the rename runs asynchronously - see WaitRenamePrefix
+func RenamePrefix(proxyURL, bucket, prefix, newprefix string) error {
+	msg, err := json.Marshal(dfc.ActionMsg{Action: dfc.ActRenamePrefix, Name: newprefix, Value: prefix})
+	if err != nil {
+		return err
+	}
+	return HTTPRequest(http.MethodPost, proxyURL+"/"+dfc.Rversion+"/"+dfc.Rbuckets+"/"+bucket, bytes.NewBuffer(msg))
+}
+
+// WaitRenamePrefix waits for the prefix rename to finish on all targets and returns
+// an error listing (some of) the objects that failed to rename, if any
+func WaitRenamePrefix(proxyURL string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+OUTER:
+	for {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Timed out waiting for %s to finish", dfc.XactionRenamePrefix)
+		}
+		time.Sleep(time.Second)
+		stats, err := GetXactionRenamePrefix(proxyURL)
+		if err != nil {
+			return err
+		}
+		var (
+			failed int64
+			errs   []string
+		)
+		for sid, ts := range stats.TargetStats {
+			for _, xaction := range ts.Xactions {
+				if xaction.Status != dfc.XactionStatusCompleted {
+					continue OUTER
+				}
+			}
+			failed += ts.NumFailed
+			for _, s := range ts.Errors {
+				errs = append(errs, sid+": "+s)
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("Failed to rename %d object(s): %s", failed, strings.Join(errs, "; "))
+		}
+		return nil
+	}
+}
+
+// Inventory runs the inventory of the bucket and returns once all targets are done;
+// if imsg.Bucket is specified the inventory is also stored as imsg.Objname in that local bucket
+func Inventory(proxyURL, bucket string, imsg *dfc.InventoryMsg) error {
+	msg, err := json.Marshal(dfc.ActionMsg{Action: dfc.ActInventory, Value: imsg})
+	if err != nil {
+		return err
+	}
+	return HTTPRequest(http.MethodPost, proxyURL+"/"+dfc.Rversion+"/"+dfc.Rbuckets+"/"+bucket, bytes.NewBuffer(msg))
+}
+
+// GetInventory returns the (decompressed) inventory of the bucket in the given format
+func GetInventory(proxyURL, bucket, format string) ([]byte, error) {
+	q := url.Values{}
+	q.Set(dfc.URLParamWhat, dfc.GetWhatInventory)
+	q.Set(dfc.URLParamFormat, format)
+	resp, err := client.Get(proxyURL + dfc.URLPath(dfc.Rversion, dfc.Rbuckets, bucket) + "?" + q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("GetInventory failed: bucket %s, HTTP status code: %d, HTTP response body: %s",
+			bucket, resp.StatusCode, string(b))
+	}
+	gzr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer gzr.Close()
+	return ioutil.ReadAll(gzr)
+}
+
 // DestroyLocalBucket deletes a local bucket
 func DestroyLocalBucket(proxyURL, bucket string) error {
 	msg, err := json.Marshal(dfc.ActionMsg{Action: dfc.ActDestroyLB})
@@ -1069,6 +1338,66 @@ func GetXactionRebalance(proxyURL string) (dfc.RebalanceStats, error) {
 	return rebalanceStats, nil
 }
 
+// GetXactionCopyBucket returns the progress of the bucket-copy xaction(s) on all targets
+func GetXactionCopyBucket(proxyURL string) (dfc.CopyBucketStats, error) {
+	var copyBucketStats dfc.CopyBucketStats
+	responseBytes, err := getXactionResponse(proxyURL, dfc.XactionCopyBucket)
+	if err != nil {
+		return copyBucketStats, err
+	}
+
+	err = json.Unmarshal(responseBytes, &copyBucketStats)
+	if err != nil {
+		return copyBucketStats,
+			fmt.Errorf("Failed to unmarshal copy bucket stats: %v", err)
+	}
+
+	return copyBucketStats, nil
+}
+
+// GetXactionDsort returns the phase and progress of the distributed sort on all targets
+func GetXactionDsort(proxyURL string) (dfc.DsortStats, error) {
+	var dsortStats dfc.DsortStats
+	responseBytes, err := getXactionResponse(proxyURL, dfc.XactionDsort)
+	if err != nil {
+		return dsortStats, err
+	}
+
+	err = json.Unmarshal(responseBytes, &dsortStats)
+	if err != nil {
+		return dsortStats,
+			fmt.Errorf("Failed to unmarshal dsort stats: %v", err)
+	}
+
+	return dsortStats, nil
+}
+
+// GetXactionRenamePrefix returns the progress and the failures of the prefix rename on all targets
+func GetXactionRenamePrefix(proxyURL string) (dfc.RenamePrefixStats, error) {
+	var renamePrefixStats dfc.RenamePrefixStats
+	responseBytes, err := getXactionResponse(proxyURL, dfc.XactionRenamePrefix)
+	if err != nil {
+		return renamePrefixStats, err
+	}
+
+	err = json.Unmarshal(responseBytes, &renamePrefixStats)
+	if err != nil {
+		return renamePrefixStats,
+			fmt.Errorf("Failed to unmarshal rename prefix stats: %v", err)
+	}
+
+	return renamePrefixStats, nil
+}
+
+// AbortXaction aborts all running xactions of the given kind cluster-wide
+func AbortXaction(proxyURL, kind string) error {
+	msg, err := json.Marshal(dfc.ActionMsg{Action: dfc.ActAbortXact, Name: kind})
+	if err != nil {
+		return err
+	}
+	return HTTPRequest(http.MethodPut, proxyURL+dfc.URLPath(dfc.Rversion, dfc.Rcluster), bytes.NewBuffer(msg))
+}
+
 func getXactionResponse(proxyURL string, kind string) ([]byte, error) {
 	q := getWhatRawQuery(dfc.GetWhatXaction, kind)
 	url := fmt.Sprintf("%s?%s", proxyURL+dfc.URLPath(dfc.Rversion, dfc.Rcluster), q)